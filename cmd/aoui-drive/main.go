@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
@@ -10,20 +11,38 @@ import (
 
 	_ "github.com/aouiniamine/aoui-drive/docs"
 
+	"github.com/aouiniamine/aoui-drive/internal/cache"
 	"github.com/aouiniamine/aoui-drive/internal/config"
 	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth"
+	authservice "github.com/aouiniamine/aoui-drive/internal/features/auth/service"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket"
+	"github.com/aouiniamine/aoui-drive/internal/features/export"
 	"github.com/aouiniamine/aoui-drive/internal/features/health"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource"
+	resourceservice "github.com/aouiniamine/aoui-drive/internal/features/resource/service"
 	"github.com/aouiniamine/aoui-drive/internal/features/ui"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
 	"github.com/aouiniamine/aoui-drive/internal/server"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/internal/throttle"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/joho/godotenv"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
+const (
+	// workerLockTTL is how long a background job's lock outlives a crashed
+	// holder; it is renewed every third of it while the job runs
+	workerLockTTL = time.Minute
+	// workerLockRetry is how often standby instances try to take over a job
+	workerLockRetry = time.Minute
+)
+
 // @title AOUI Drive API
 // @version 1.0
 // @description file and media hosting server with a web dashboard for bucket and resource management and RESTful API.
@@ -49,7 +68,7 @@ func main() {
 
 	cfg := config.Load()
 
-	db, err := database.New(cfg.Database.Path)
+	db, err := database.New(cfg.Database.Path, cfg.Database.SlowQueryThreshold)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -59,37 +78,249 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	if cfg.Auth.SessionStore != "memory" && cfg.Auth.SessionStore != "redis" {
+		log.Fatalf("Invalid AUTH_SESSION_STORE %q (expected memory or redis)", cfg.Auth.SessionStore)
+	}
+
+	if cfg.Server.WorkerLockStore != "memory" && cfg.Server.WorkerLockStore != "redis" {
+		log.Fatalf("Invalid WORKER_LOCK_STORE %q (expected memory or redis)", cfg.Server.WorkerLockStore)
+	}
+
+	// Redis is only required when an enabled feature depends on it
+	var rdb *cache.Redis
+	if cfg.Events.HasPublisher("redis") || cfg.Auth.SessionStore == "redis" || cfg.Server.WorkerLockStore == "redis" {
+		rdb, err = cache.New(cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.Password, cfg.Redis.DB)
+		if err != nil {
+			log.Fatalf("Failed to connect to redis: %v", err)
+		}
+		defer rdb.Close()
+	}
+
 	srv := server.New(cfg, db)
+	trustedProxies, err := server.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	srv.TrustProxies(trustedProxies)
+	srv.Echo().Use(middleware.WithBasePath(cfg.Server.BasePath))
+
+	// Generated links point at PUBLIC_URL (or are relative without it),
+	// under BASE_PATH when the app is mounted on a subpath
+	urlPrefix := cfg.Storage.PublicURL + cfg.Server.BasePath
+
+	pageLimits := pagination.NewLimits(cfg.Paging.DefaultPerPage, cfg.Paging.MaxPerPage)
+
+	srv.Router().GET("/swagger/*", echoSwagger.WrapHandler)
+
+	// Tracks stored bytes against MAX_TOTAL_STORAGE; loaded once the resource
+	// repository exists below
+	usage := storage.NewUsage(cfg.Storage.MaxTotalBytes, cfg.Storage.ReadOnlyWhenFull)
+
+	healthFeature := health.New(db, usage, int64(cfg.Events.WebhookMaxPending))
+	healthFeature.RegisterRoutes(srv.Router())
+
+	apiTokenSource, err := middleware.ParseTokenSource(cfg.Auth.APITokenSource)
+	if err != nil {
+		log.Fatalf("Invalid AUTH_API_TOKEN_SOURCE: %v", err)
+	}
+	uiTokenSource, err := middleware.ParseTokenSource(cfg.Auth.UITokenSource)
+	if err != nil {
+		log.Fatalf("Invalid AUTH_UI_TOKEN_SOURCE: %v", err)
+	}
+	uiFrameAncestors, err := middleware.ParseFrameAncestors(cfg.Server.UIFrameAncestors)
+	if err != nil {
+		log.Fatalf("Invalid UI_FRAME_ANCESTORS: %v", err)
+	}
+
+	var sessionRedis *cache.Redis
+	if cfg.Auth.SessionStore == "redis" {
+		sessionRedis = rdb
+	}
+	// Repeated failed logins lock the access key; ops can be alerted by webhook
+	var lockoutNotifier authservice.LockoutNotifier
+	if cfg.Auth.LockoutWebhookURL != "" {
+		lockoutNotifier = webhook.NewLockoutNotifier(db, cfg.Auth.LockoutWebhookURL, cfg.Server.RequestIDHeader)
+	}
+	loginLimiter := authservice.NewLoginLimiter(cfg.Auth.LockoutThreshold, cfg.Auth.LockoutWindow)
 
-	srv.Echo().GET("/swagger/*", echoSwagger.WrapHandler)
+	// Self-registration is off unless explicitly enabled, and never grants ADMIN
+	registrationRole, err := authservice.ParseRegistrationRole(cfg.Auth.RegistrationRole)
+	if err != nil {
+		log.Fatalf("Invalid REGISTRATION_ROLE: %v", err)
+	}
+	registration := authservice.Registration{
+		Enabled:    cfg.Auth.AllowSelfRegistration,
+		InviteCode: cfg.Auth.RegistrationInviteCode,
+		Role:       registrationRole,
+		Limiter:    authservice.NewRegistrationLimiter(cfg.Auth.RegistrationRateLimit, cfg.Auth.RegistrationRateWindow),
+	}
+	authFeature := auth.New(db, cfg.JWTSecret, cfg.JWTPreviousSecrets, cfg.JWTLeeway, sessionRedis, cfg.Quota.MaxClients, loginLimiter, lockoutNotifier, registration)
+	authFeature.RegisterRoutes(srv.Router(), apiTokenSource)
+
+	layout, err := storage.NewLayout(cfg.Storage.Path, cfg.Storage.Layout)
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+
+	// Encryption at rest is only available to buckets when a master key is set
+	var blobCipher *encryption.Cipher
+	if cfg.Storage.EncryptionKey != "" {
+		key, err := encryption.ParseKey(cfg.Storage.EncryptionKey)
+		if err != nil {
+			log.Fatalf("Invalid STORAGE_ENCRYPTION_KEY: %v", err)
+		}
+		blobCipher, err = encryption.New(key)
+		if err != nil {
+			log.Fatalf("Failed to initialize encryption: %v", err)
+		}
+	}
 
-	healthFeature := health.New(db)
-	healthFeature.RegisterRoutes(srv.Echo())
+	// Buckets can only opt into malware scanning when a scanner is configured
+	var uploadScanner scanner.Scanner
+	if cfg.Scanner.Address != "" {
+		clamav, err := scanner.NewClamAV(cfg.Scanner.Address, cfg.Scanner.Timeout)
+		if err != nil {
+			log.Fatalf("Invalid SCANNER_ADDRESS: %v", err)
+		}
+		uploadScanner = clamav
+	}
 
-	authFeature := auth.New(db, cfg.JWTSecret)
-	authFeature.RegisterRoutes(srv.Echo())
+	bucketFeature := bucket.New(db, layout, blobCipher != nil, uploadScanner != nil, cfg.Storage.CaseInsensitiveBucketNames, usage, cfg.Quota.MaxBuckets, pageLimits)
 
-	bucketFeature := bucket.New(db, cfg.Storage.Path)
-	bucketGroup := srv.Echo().Group("/buckets", middleware.Auth(authFeature.Service))
+	// Move bucket directories written under a previous STORAGE_LAYOUT
+	buckets, err := bucketFeature.Repository.List(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to list buckets: %v", err)
+	}
+	if err := layout.Migrate(buckets); err != nil {
+		log.Fatalf("Failed to migrate storage layout: %v", err)
+	}
+	bucketGroup := srv.Router().Group("/buckets", middleware.Auth(authFeature.Service, apiTokenSource))
 	bucketFeature.RegisterRoutes(bucketGroup)
 
+	// Presigned links, shared by share URLs and webhook download tokens
+	if cfg.Presign.SecretDerived {
+		log.Println("PRESIGN_SECRET is not set; share links are signed with a key derived from JWT_SECRET and stop working when it is rotated")
+	}
+	signer := presign.New(cfg.Presign.Secret, cfg.Presign.DefaultTTL, cfg.Presign.MaxTTL)
+	if cfg.Presign.PreviousSecret != "" {
+		// Links signed with JWT_SECRET before the key was derived
+		signer.AcceptPrevious(cfg.Presign.PreviousSecret)
+	}
+
 	// Webhook Feature (created before resource to enable auto-wiring)
-	webhookFeature := webhook.New(db, bucketFeature.Repository)
-	webhookGroup := srv.Echo().Group("/buckets/:bucketId/webhooks", middleware.Auth(authFeature.Service))
+	webhookFeature := webhook.New(db, bucketFeature.Repository, cfg.Events, rdb, cfg.Server.RequestIDHeader, signer, urlPrefix, pageLimits)
+	webhookGroup := srv.Router().Group("/buckets/:bucketId/webhooks", middleware.Auth(authFeature.Service, apiTokenSource))
 	webhookFeature.RegisterRoutes(webhookGroup)
 
+	// Download bandwidth, shared server-wide and per bucket
+	downloadLimits := throttle.New(cfg.Storage.DownloadRateLimit)
+
 	// Resource Feature (webhook launcher auto-wired)
-	resourceFeature := resource.New(db, bucketFeature.Repository, cfg.Storage.Path, cfg.Storage.PublicURL, webhookFeature.Service)
-	resourceGroup := srv.Echo().Group("/resources", middleware.Auth(authFeature.Service))
+	resourceFeature := resource.New(db, bucketFeature.Repository, bucketFeature.Service, webhookFeature.Service, resourceservice.Options{
+		Layout:         layout,
+		PublicURL:      urlPrefix,
+		CacheControl:   cfg.Storage.PublicCacheControl,
+		Signer:         signer,
+		ChunkSize:      cfg.Storage.ChunkSize,
+		MaxUploadSize:  cfg.Storage.MaxUploadSize,
+		TempDir:        cfg.Storage.TempDir,
+		Cipher:         blobCipher,
+		Usage:          usage,
+		Scanner:        uploadScanner,
+		ScanFailOpen:   cfg.Scanner.FailOpen,
+		Throttle:       downloadLimits,
+		StoreNames:     cfg.Storage.StoreFilenames,
+		TrashRetention: cfg.Storage.TrashRetention,
+		StrictTypes:    cfg.Storage.StrictContentType,
+	}, cfg.Storage.AutoCreateBuckets, pageLimits)
+	resourceGroup := srv.Router().Group("/resources", middleware.Auth(authFeature.Service, apiTokenSource))
 	resourceFeature.RegisterRoutes(resourceGroup)
 
-	// UI Feature (web interface) - uses unified auth middleware
-	uiFeature := ui.New(authFeature.Service, bucketFeature.Service, resourceFeature.Service, webhookFeature.Service, cfg.Storage.PublicURL)
-	uiFeature.RegisterRoutes(srv.Echo(), authFeature.Service)
+	totalSize, err := resourceFeature.Repository.StoredSize(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to compute storage usage: %v", err)
+	}
+	usage.Set(totalSize)
+
+	// Remove temp files left behind by uploads that crashed mid-stream
+	if cfg.Storage.TempDir != "" {
+		if err := os.MkdirAll(cfg.Storage.TempDir, 0755); err != nil {
+			log.Fatalf("Failed to create upload temp directory: %v", err)
+		}
+	}
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Each sweeper runs on one instance at a time; the others stand by and
+	// take over if it stops
+	var workerLocks cache.Locker = cache.NewLocalLocker()
+	if cfg.Server.WorkerLockStore == "redis" {
+		workerLocks = rdb
+	}
+	runElected := func(key string, job func(ctx context.Context)) {
+		go cache.RunElected(workersCtx, workerLocks, key, workerLockTTL, workerLockRetry, job)
+	}
+
+	runElected("temp-cleanup", func(ctx context.Context) {
+		resourceservice.RunTempCleanup(ctx, cfg.Storage.TempDir, cfg.Storage.TempMaxAge)
+	})
+
+	// Finish post-processing interrupted by the last shutdown. This runs once,
+	// on whichever instance gets the lock first.
+	go func() {
+		err := cache.RunExclusive(workersCtx, workerLocks, "resume-processing", workerLockTTL, func(ctx context.Context) error {
+			resourceFeature.Service.ResumeProcessing(ctx)
+			return nil
+		})
+		if err != nil && !errors.Is(err, cache.ErrLockNotAcquired) {
+			log.Printf("Error resuming processing: %v", err)
+		}
+	}()
+
+	// Remove shared blobs left behind by deleted buckets
+	runElected("blob-cleanup", resourceFeature.Service.RunBlobCleanup)
+
+	// Purge trashed resources once their retention has passed
+	runElected("trash-purge", resourceFeature.Service.RunTrashPurge)
+
+	// Keep the WAL from growing and planner statistics fresh
+	runElected("database-maintenance", func(ctx context.Context) {
+		healthFeature.Service.RunMaintenance(ctx, cfg.Database.OptimizeInterval)
+	})
+
+	// Retry failed webhook deliveries in the background. Every instance runs
+	// a worker, since events are claimed one by one in the database.
+	if webhookFeature.RetryWorker != nil {
+		go webhookFeature.RetryWorker.Run(workersCtx)
+	}
+
+	// /ready fails until here, so traffic is not routed to an instance whose
+	// workers are not running yet
+	healthFeature.Service.MarkWorkersStarted()
+
+	// Presigned share links (no auth, signature checked per request)
+	resourceFeature.RegisterShareRoutes(srv.Router().Group("/share"))
+
+	// Admin maintenance routes
+	adminGroup := srv.Router().Group("/admin", middleware.Auth(authFeature.Service, apiTokenSource), middleware.RequireAdmin(authFeature.Service))
+	resourceFeature.RegisterAdminRoutes(adminGroup)
+	bucketFeature.RegisterAdminRoutes(adminGroup)
+	healthFeature.RegisterAdminRoutes(adminGroup)
+
+	// Metadata export and import, for backups and moving servers
+	exportFeature := export.New(db, usage)
+	exportFeature.RegisterAdminRoutes(adminGroup)
+
+	// UI Feature (web interface)
+	uiFeature := ui.New(authFeature.Service, bucketFeature.Service, resourceFeature.Service, webhookFeature.Service, urlPrefix, cfg.Server.BasePath, pageLimits)
+	uiFeature.RegisterRoutes(srv.Echo(), srv.Router(), authFeature.Service, uiTokenSource, uiFrameAncestors)
 
-	// Serve public files with caching headers
+	// Serve public files with caching headers, plus an Atom feed per public
+	// bucket. Both are throttled by the bucket's download rate.
 	publicPath := cfg.Storage.Path + "/public"
-	srv.Echo().Static("/public", publicPath)
+	publicGroup := srv.Router().Group("/public", middleware.Streaming(), resourceFeature.Controller.ThrottlePublic(cfg.Server.BasePath+"/public"))
+	resourceFeature.RegisterPublicRoutes(publicGroup, publicPath)
 
 	go func() {
 		log.Printf("Starting server on %s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -102,9 +333,10 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	log.Printf("Shutting down server (timeout %s)...", cfg.Server.ShutdownTimeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// In-flight requests are drained until the timeout elapses
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	"github.com/aouiniamine/aoui-drive/internal/config"
 	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
@@ -38,7 +39,7 @@ func main() {
 
 	cfg := config.Load()
 
-	db, err := database.New(cfg.Database.Path)
+	db, err := database.New(cfg.Database.Path, cfg.Database.SlowQueryThreshold)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -67,6 +68,12 @@ func main() {
 		log.Fatalf("Failed to create client: %v", err)
 	}
 
+	audit.Event(audit.ClientCreated,
+		"actor", "cli",
+		"client_id", client.ID,
+		"role", client.Role,
+	)
+
 	fmt.Println("Client created successfully!")
 	fmt.Println("----------------------------------------")
 	fmt.Printf("ID:         %s\n", client.ID)
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLockNotAcquired = errors.New("lock is held by another instance")
+	ErrLockLost        = errors.New("lock expired or was taken over")
+)
+
+// Only the holder's token may release or extend a lock
+var (
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Lock is a held distributed lock
+type Lock interface {
+	Refresh(ctx context.Context, ttl time.Duration) error
+	Unlock(ctx context.Context) error
+}
+
+// Locker acquires named locks. Background workers take a Locker so that a
+// single-instance deployment can run them without Redis.
+type Locker interface {
+	Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+var (
+	_ Locker = (*Redis)(nil)
+	_ Locker = (*LocalLocker)(nil)
+)
+
+type redisLock struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+// Lock acquires key with SET NX PX. It returns ErrLockNotAcquired if another
+// instance holds it; the lock expires after ttl unless refreshed.
+func (r *Redis) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := r.Client.SetNX(ctx, lockKey(key), token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+
+	return &redisLock{client: r.Client, key: lockKey(key), token: token}, nil
+}
+
+func (l *redisLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	n, err := refreshScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *redisLock) Unlock(ctx context.Context) error {
+	n, err := unlockScript.Run(ctx, l.client, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// LocalLocker is an in-process Locker for single-instance deployments
+type LocalLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{held: make(map[string]bool)}
+}
+
+func (l *LocalLocker) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[key] {
+		return nil, ErrLockNotAcquired
+	}
+	l.held[key] = true
+	return &localLock{locker: l, key: key}, nil
+}
+
+type localLock struct {
+	locker *LocalLocker
+	key    string
+}
+
+func (l *localLock) Refresh(ctx context.Context, ttl time.Duration) error {
+	return nil
+}
+
+func (l *localLock) Unlock(ctx context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	delete(l.locker.held, l.key)
+	return nil
+}
+
+// RunExclusive runs fn only if key can be locked, renewing the lock every
+// ttl/3 while fn runs. fn's context is cancelled if the lock is lost.
+// It returns ErrLockNotAcquired when another instance is already running.
+func RunExclusive(ctx context.Context, locker Locker, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := locker.Lock(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lock.Refresh(runCtx, ttl); err != nil {
+					log.Printf("Lost lock %s: %v", key, err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err = fn(runCtx)
+	close(done)
+
+	// Release with a fresh context so shutdown cancellation doesn't leak the lock
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer unlockCancel()
+	if unlockErr := lock.Unlock(unlockCtx); unlockErr != nil && !errors.Is(unlockErr, ErrLockLost) {
+		log.Printf("Error releasing lock %s: %v", key, unlockErr)
+	}
+
+	return err
+}
+
+// RunElected runs fn under key on one instance at a time, for jobs that loop
+// until ctx is cancelled. Instances that find the lock held try again every
+// retry, so one of them takes over when the holder stops or loses the lock.
+// It returns once ctx is cancelled or fn returns on its own.
+func RunElected(ctx context.Context, locker Locker, key string, ttl, retry time.Duration, fn func(ctx context.Context)) {
+	for {
+		finished := false
+		err := RunExclusive(ctx, locker, key, ttl, func(ctx context.Context) error {
+			fn(ctx)
+			// fn returning before its context ends means the job is done,
+			// rather than interrupted by a lost lock
+			finished = ctx.Err() == nil
+			return nil
+		})
+		if finished {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrLockNotAcquired) {
+			log.Printf("Error taking lock %s: %v", key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+func lockKey(key string) string {
+	return "aoui-drive:lock:" + key
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalLocker(t *testing.T) {
+	locker := NewLocalLocker()
+	ctx := context.Background()
+
+	lock, err := locker.Lock(ctx, "gc", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if _, err := locker.Lock(ctx, "gc", time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("Lock() of a held key error = %v, want ErrLockNotAcquired", err)
+	}
+	if _, err := locker.Lock(ctx, "other", time.Minute); err != nil {
+		t.Errorf("Lock() of another key error = %v", err)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if _, err := locker.Lock(ctx, "gc", time.Minute); err != nil {
+		t.Errorf("Lock() after Unlock() error = %v", err)
+	}
+}
+
+func TestRunExclusive(t *testing.T) {
+	locker := NewLocalLocker()
+	ctx := context.Background()
+
+	err := RunExclusive(ctx, locker, "gc", time.Minute, func(ctx context.Context) error {
+		if err := RunExclusive(ctx, locker, "gc", time.Minute, func(context.Context) error { return nil }); !errors.Is(err, ErrLockNotAcquired) {
+			t.Errorf("nested RunExclusive() error = %v, want ErrLockNotAcquired", err)
+		}
+		return errors.New("done")
+	})
+	if err == nil || err.Error() != "done" {
+		t.Errorf("RunExclusive() error = %v, want fn's error", err)
+	}
+
+	// The lock is released once fn returns
+	if _, err := locker.Lock(ctx, "gc", time.Minute); err != nil {
+		t.Errorf("Lock() after RunExclusive() error = %v", err)
+	}
+}
+
+// lostLocker hands out locks that cannot be refreshed
+type lostLocker struct{}
+
+func (lostLocker) Lock(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	return lostLock{}, nil
+}
+
+type lostLock struct{}
+
+func (lostLock) Refresh(ctx context.Context, ttl time.Duration) error { return ErrLockLost }
+func (lostLock) Unlock(ctx context.Context) error                     { return ErrLockLost }
+
+func TestRunExclusiveCancelsOnLostLock(t *testing.T) {
+	err := RunExclusive(context.Background(), lostLocker{}, "gc", 30*time.Millisecond, func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("RunExclusive() error = %v, want fn cancelled", err)
+	}
+}
+
+// TestRunElected starts the same job on two instances sharing a locker. Only
+// one runs it; the other takes over once the first stops.
+func TestRunElected(t *testing.T) {
+	locker := NewLocalLocker()
+	running := make(chan int, 2)
+
+	var stops [2]context.CancelFunc
+	var done [2]chan struct{}
+	for i := range 2 {
+		ctx, cancel := context.WithCancel(context.Background())
+		stops[i], done[i] = cancel, make(chan struct{})
+		go func() {
+			defer close(done[i])
+			RunElected(ctx, locker, "sweeper", time.Minute, 10*time.Millisecond, func(ctx context.Context) {
+				running <- i
+				<-ctx.Done()
+			})
+		}()
+	}
+	defer func() {
+		for i := range 2 {
+			stops[i]()
+			<-done[i]
+		}
+	}()
+
+	first := <-running
+	select {
+	case other := <-running:
+		t.Fatalf("instances %d and %d both run the job", first, other)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	stops[first]()
+	<-done[first]
+	select {
+	case next := <-running:
+		if next == first {
+			t.Errorf("stopped instance %d ran the job again", first)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no instance took over the job")
+	}
+}
+
+func TestRunElectedFinishedJob(t *testing.T) {
+	locker := NewLocalLocker()
+	runs := 0
+
+	// A job that returns by itself is not started again
+	RunElected(context.Background(), locker, "once", time.Minute, time.Millisecond, func(context.Context) {
+		runs++
+	})
+	if runs != 1 {
+		t.Errorf("job ran %d times, want 1", runs)
+	}
+	if _, err := locker.Lock(context.Background(), "once", time.Minute); err != nil {
+		t.Errorf("Lock() after the job finished error = %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Redis struct {
+	Client *redis.Client
+}
+
+func New(host, port, password string, db int) (*Redis, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(host, port),
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis: %w", err)
+	}
+
+	return &Redis{Client: client}, nil
+}
+
+func (r *Redis) Close() error {
+	return r.Client.Close()
+}
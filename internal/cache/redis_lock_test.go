@@ -0,0 +1,135 @@
+//go:build integration
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestRedis connects to the Redis at REDIS_HOST:REDIS_PORT, default
+// localhost:6379. Run with: go test -tags integration ./internal/cache/
+func newTestRedis(t *testing.T) *Redis {
+	t.Helper()
+
+	host, port := os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "6379"
+	}
+	r, err := New(host, port, os.Getenv("REDIS_PASSWORD"), 0)
+	if err != nil {
+		t.Fatalf("connect to redis: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// testLockKey is unique per test, so reruns never see a lock left by a failed run
+func testLockKey(t *testing.T, r *Redis) string {
+	t.Helper()
+	token, err := newLockToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := t.Name() + ":" + token
+	t.Cleanup(func() { r.Client.Del(context.Background(), lockKey(key)) })
+	return key
+}
+
+func TestRedisLock(t *testing.T) {
+	r := newTestRedis(t)
+	key := testLockKey(t, r)
+	ctx := context.Background()
+
+	lock, err := r.Lock(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if _, err := r.Lock(ctx, key, time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("Lock() of a held key error = %v, want ErrLockNotAcquired", err)
+	}
+	if err := lock.Refresh(ctx, time.Minute); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("second Unlock() error = %v, want ErrLockLost", err)
+	}
+	again, err := r.Lock(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() after Unlock() error = %v", err)
+	}
+	again.Unlock(ctx)
+}
+
+func TestRedisLockContention(t *testing.T) {
+	r := newTestRedis(t)
+	key := testLockKey(t, r)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	acquired := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.Lock(ctx, key, time.Minute)
+			if err != nil && !errors.Is(err, ErrLockNotAcquired) {
+				t.Errorf("Lock() error = %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("%d of 10 concurrent Lock() calls succeeded, want 1", acquired)
+	}
+}
+
+// TestRedisLockExpiry lets a lock lapse and checks its old holder can no
+// longer refresh or release it once another instance has taken it
+func TestRedisLockExpiry(t *testing.T) {
+	r := newTestRedis(t)
+	key := testLockKey(t, r)
+	ctx := context.Background()
+
+	expired, err := r.Lock(ctx, key, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	holder, err := r.Lock(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("Lock() after expiry error = %v", err)
+	}
+	if err := expired.Refresh(ctx, time.Minute); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Refresh() of an expired lock error = %v, want ErrLockLost", err)
+	}
+	if err := expired.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Unlock() of an expired lock error = %v, want ErrLockLost", err)
+	}
+
+	// The new holder's lock survived the old holder's attempts
+	if err := holder.Refresh(ctx, time.Minute); err != nil {
+		t.Errorf("Refresh() by the new holder error = %v", err)
+	}
+	holder.Unlock(ctx)
+}
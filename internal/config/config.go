@@ -1,31 +1,226 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server      ServerConfig
-	Database    DatabaseConfig
-	Redis       RedisConfig
-	Storage     StorageConfig
-	JWTSecret   string
-	Env         string
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Redis     RedisConfig
+	Storage   StorageConfig
+	Events    EventsConfig
+	Paging    PagingConfig
+	Presign   PresignConfig
+	Scanner   ScannerConfig
+	Auth      AuthConfig
+	Quota     QuotaConfig
+	JWTSecret string
+	// JWTPreviousSecrets are former JWT secrets still accepted when
+	// validating tokens during a rotation; they are never used to sign
+	JWTPreviousSecrets []string
+	// JWTLeeway is the clock skew tolerated when checking a token's expiry,
+	// not-before and issued-at times; 0 checks them strictly
+	JWTLeeway time.Duration
+	Env       string
 }
 
 type StorageConfig struct {
 	Path      string
 	PublicURL string
+	// Layout is "flat" (<path>/<bucket>) or "client" (<path>/<client>/<bucket>)
+	Layout string
+	// ChunkSize is the byte length of each entry in resource chunk manifests
+	ChunkSize int64
+	// TempDir buffers uploads while they are hashed. It defaults to .tmp under
+	// Path, so stored uploads are renamed in place rather than copied across
+	// filesystems; empty means the system temp dir.
+	TempDir string
+	// TempMaxAge is how long an untouched upload temp file is kept before
+	// cleanup; 0 disables the sweep
+	TempMaxAge time.Duration
+	// EncryptionKey is the hex or base64 master key for encrypted buckets;
+	// empty disables encryption at rest
+	EncryptionKey string
+	// MaxUploadSize caps the bytes of a single upload; 0 is unlimited
+	MaxUploadSize int64
+	// MaxTotalBytes caps the bytes stored across all buckets; 0 is unlimited
+	MaxTotalBytes int64
+	// ReadOnlyWhenFull switches the server to read-only once an upload is
+	// refused by MaxTotalBytes, until restart
+	ReadOnlyWhenFull bool
+	// CaseInsensitiveBucketNames lower-cases bucket names on create instead
+	// of rejecting upper-case letters
+	CaseInsensitiveBucketNames bool
+	// DownloadRateLimit caps the combined bandwidth of all downloads in
+	// bytes per second; 0 is unlimited
+	DownloadRateLimit int64
+	// PublicCacheControl is the Cache-Control of public files in buckets
+	// that do not set their own
+	PublicCacheControl string
+	// StoreFilenames keeps upload filenames, for download names and lookup
+	// by name; false stores content by hash only
+	StoreFilenames bool
+	// TrashRetention keeps deleted resources in a trash, restorable, for
+	// that long before they are purged; 0 deletes them immediately. Set in
+	// days by TRASH_RETENTION_DAYS.
+	TrashRetention time.Duration
+	// StrictContentType rejects uploads whose content, as sniffed from its
+	// first bytes, does not match their extension
+	StrictContentType bool
+	// AutoCreateBuckets makes stream uploads to a bucket name the client
+	// does not have yet create it, unless the request sets auto_create=false
+	AutoCreateBuckets bool
+}
+
+// EventsConfig selects which backends receive bucket events.
+// Supported publishers are "webhook" (HTTP callbacks) and "redis" (Redis Streams).
+type EventsConfig struct {
+	Publishers             []string
+	RedisStreamPrefix      string
+	RedisStreamMaxLen      int64
+	WebhookResponseCapture int
+	// WebhookMaxAttempts is how many times a webhook delivery is attempted in total
+	WebhookMaxAttempts int
+	// WebhookRetryBackoff is the delay before the first retry; it doubles per retry
+	WebhookRetryBackoff time.Duration
+	// WebhookRetryConcurrency is how many retries the worker delivers in parallel
+	WebhookRetryConcurrency int
+	// WebhookRetryBatchSize is how many due events the worker claims per poll
+	WebhookRetryBatchSize int
+	// WebhookRetryPollInterval is how often the worker looks for due events
+	WebhookRetryPollInterval time.Duration
+	// WebhookClaimTimeout is how long a claimed event may stay in processing
+	// before another worker re-claims it
+	WebhookClaimTimeout time.Duration
+	// WebhookMaxStreams caps concurrently open delivery streams (SSE)
+	WebhookMaxStreams int
+	// WebhookMaxPending caps pending and retrying webhook events; new
+	// deliveries are shed at the cap. 0 is unlimited.
+	WebhookMaxPending int
+	// WebhookDownloadTokenTTL is how long presigned resource_url links in
+	// webhook payloads stay valid
+	WebhookDownloadTokenTTL time.Duration
+}
+
+// ScannerConfig points malware scanning of buckets with scan_uploads at a
+// ClamAV daemon
+type ScannerConfig struct {
+	// Address is tcp://host:port or unix:///path/to/clamd.sock; empty
+	// disables scanning
+	Address string
+	// Timeout bounds each scan
+	Timeout time.Duration
+	// FailOpen stores uploads unscanned when the scanner fails instead of
+	// rejecting them
+	FailOpen bool
+}
+
+// PresignConfig controls presigned share links
+type PresignConfig struct {
+	// Secret signs share links. Without PRESIGN_SECRET it is derived from
+	// JWTSecret, so the two never sign with the same key, but rotating the
+	// JWT secret still invalidates existing links.
+	Secret string
+	// SecretDerived is whether Secret was derived from JWTSecret
+	SecretDerived bool
+	// PreviousSecret is the key links were signed with before the derived
+	// one, JWTSecret itself. It is accepted for one MaxTTL after startup, so
+	// links shared before the upgrade keep working until they expire.
+	PreviousSecret string
+	DefaultTTL     time.Duration
+	MaxTTL         time.Duration
+}
+
+// AuthConfig selects where each route group reads the session token from:
+// "header" (Bearer only), "cookie" (session cookie only) or "any" (header, then cookie)
+type AuthConfig struct {
+	APITokenSource string
+	UITokenSource  string
+	// SessionStore is "memory" (single instance) or "redis" (shared, survives restarts)
+	SessionStore string
+	// LockoutThreshold is how many failed logins within LockoutWindow lock
+	// an access key for LockoutWindow; 0 disables lockouts
+	LockoutThreshold int
+	LockoutWindow    time.Duration
+	// LockoutWebhookURL receives a POST for every lockout; empty disables it
+	LockoutWebhookURL string
+	// AllowSelfRegistration enables POST /auth/register
+	AllowSelfRegistration bool
+	// RegistrationRole is given to self-registered clients: USER or MANAGER
+	RegistrationRole string
+	// RegistrationInviteCode must be sent with every registration when set
+	RegistrationInviteCode string
+	// RegistrationRateLimit caps registration attempts per IP within
+	// RegistrationRateWindow; 0 is unlimited
+	RegistrationRateLimit  int
+	RegistrationRateWindow time.Duration
+}
+
+// QuotaConfig caps how many clients and buckets may exist across the server,
+// e.g. for hosted free tiers. Zero means unlimited.
+type QuotaConfig struct {
+	MaxClients int
+	MaxBuckets int
+}
+
+// PagingConfig sets the default and maximum page size for list endpoints
+type PagingConfig struct {
+	DefaultPerPage int
+	MaxPerPage     int
 }
 
 type ServerConfig struct {
-	Host string
-	Port string
+	Host            string
+	Port            string
+	ShutdownTimeout time.Duration
+	// ReadHeaderTimeout bounds reading a request's headers, against clients
+	// that trickle them (slowloris)
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout and WriteTimeout bound reading a whole request and writing
+	// its response. Upload and download routes are exempt; 0 disables them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a keep-alive connection waits for its next
+	// request
+	IdleTimeout time.Duration
+	// MaxHeaderBytes caps the size of request headers
+	MaxHeaderBytes int
+	// CORSExposeHeaders are the response headers browser scripts may read
+	// on cross-origin requests (Access-Control-Expose-Headers)
+	CORSExposeHeaders []string
+	// RequestIDHeader carries the request ID in requests, responses and
+	// webhook deliveries
+	RequestIDHeader string
+	// UIFrameAncestors are the origins allowed to embed the UI in a frame;
+	// empty denies framing
+	UIFrameAncestors []string
+	// TrustedProxies are the IPs or CIDR ranges of reverse proxies whose
+	// X-Forwarded-For gives the client IP; empty uses the connection's address
+	TrustedProxies []string
+	// BasePath is the subpath the app is served under behind a reverse
+	// proxy, e.g. /drive; empty serves it at the root
+	BasePath string
+	// WorkerLockStore is where background jobs take their locks: "memory"
+	// (single instance) or "redis" (each job runs on one instance)
+	WorkerLockStore string
 }
 
 type DatabaseConfig struct {
 	Path string
+	// SlowQueryThreshold is the duration at which queries are logged as
+	// slow; zero disables the log
+	SlowQueryThreshold time.Duration
+	// OptimizeInterval is how often the WAL is truncated and PRAGMA optimize
+	// runs; zero disables the background job
+	OptimizeInterval time.Duration
 }
 
 type RedisConfig struct {
@@ -36,13 +231,39 @@ type RedisConfig struct {
 }
 
 func Load() *Config {
+	jwtSecret := getEnv("JWT_SECRET", "change-me-in-production")
+	presignSecret := getEnv("PRESIGN_SECRET", "")
+	presignDerived := presignSecret == ""
+	var presignPrevious string
+	if presignDerived {
+		presignSecret = deriveSecret(jwtSecret, "presign")
+		presignPrevious = jwtSecret
+	}
+	storagePath := getEnv("STORAGE_PATH", "./data/storage")
+
 	return &Config{
 		Server: ServerConfig{
-			Host: getEnv("HOST", "0.0.0.0"),
-			Port: getEnv("PORT", "8080"),
+			Host:              getEnv("HOST", "0.0.0.0"),
+			Port:              getEnv("PORT", "8080"),
+			ShutdownTimeout:   getEnvAsDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+			ReadHeaderTimeout: getEnvAsDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+			ReadTimeout:       getEnvAsDurationAllowZero("HTTP_READ_TIMEOUT", time.Minute),
+			WriteTimeout:      getEnvAsDurationAllowZero("HTTP_WRITE_TIMEOUT", 2*time.Minute),
+			IdleTimeout:       getEnvAsDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+			MaxHeaderBytes:    getEnvAsInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+			CORSExposeHeaders: getEnvAsSlice("CORS_EXPOSE_HEADERS", []string{
+				"X-Resource-Hash", "X-Deduplicated", "ETag", "Content-Range", "Accept-Ranges", "X-Request-Id",
+			}),
+			UIFrameAncestors: getEnvAsSlice("UI_FRAME_ANCESTORS", nil),
+			RequestIDHeader:  getEnv("REQUEST_ID_HEADER", "X-Request-ID"),
+			TrustedProxies:   getEnvAsSlice("TRUSTED_PROXIES", nil),
+			BasePath:         normalizeBasePath(getEnv("BASE_PATH", "")),
+			WorkerLockStore:  getEnv("WORKER_LOCK_STORE", "memory"),
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DATABASE_PATH", "./data/aoui-drive.db"),
+			Path:               getEnv("DATABASE_PATH", "./data/aoui-drive.db"),
+			SlowQueryThreshold: getEnvAsDurationAllowZero("DATABASE_SLOW_QUERY_THRESHOLD", 200*time.Millisecond),
+			OptimizeInterval:   getEnvAsDurationAllowZero("DATABASE_OPTIMIZE_INTERVAL", 24*time.Hour),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -51,11 +272,78 @@ func Load() *Config {
 			DB:       getEnvAsInt("REDIS_DB", 0),
 		},
 		Storage: StorageConfig{
-			Path:      getEnv("STORAGE_PATH", "./data/storage"),
-			PublicURL: getEnv("PUBLIC_URL", ""),
+			Path:                       storagePath,
+			PublicURL:                  getEnv("PUBLIC_URL", ""),
+			Layout:                     getEnv("STORAGE_LAYOUT", "flat"),
+			ChunkSize:                  int64(getEnvAsInt("CHUNK_SIZE", 4<<20)),
+			TempDir:                    getEnv("UPLOAD_TEMP_DIR", filepath.Join(storagePath, ".tmp")),
+			TempMaxAge:                 getEnvAsDurationAllowZero("UPLOAD_TEMP_MAX_AGE", 24*time.Hour),
+			EncryptionKey:              getEnv("STORAGE_ENCRYPTION_KEY", ""),
+			MaxUploadSize:              int64(getEnvAsInt("MAX_UPLOAD_SIZE", 0)),
+			MaxTotalBytes:              int64(getEnvAsInt("MAX_TOTAL_STORAGE", 0)),
+			ReadOnlyWhenFull:           getEnvAsBool("STORAGE_READ_ONLY_WHEN_FULL", false),
+			CaseInsensitiveBucketNames: getEnvAsBool("BUCKET_NAMES_CASE_INSENSITIVE", false),
+			DownloadRateLimit:          int64(getEnvAsInt("DOWNLOAD_RATE_LIMIT", 0)),
+			PublicCacheControl:         getEnv("PUBLIC_CACHE_CONTROL", "public, max-age=31536000, immutable"),
+			StoreFilenames:             getEnvAsBool("STORE_FILENAMES", true),
+			TrashRetention:             time.Duration(getEnvAsInt("TRASH_RETENTION_DAYS", 0)) * 24 * time.Hour,
+			StrictContentType:          getEnvAsBool("STRICT_CONTENT_TYPE", false),
+			AutoCreateBuckets:          getEnvAsBool("AUTO_CREATE_BUCKETS", false),
 		},
-		JWTSecret: getEnv("JWT_SECRET", "change-me-in-production"),
-		Env:       getEnv("ENV", "development"),
+		Events: EventsConfig{
+			Publishers:               getEnvAsSlice("EVENT_PUBLISHERS", []string{"webhook"}),
+			RedisStreamPrefix:        getEnv("EVENT_STREAM_PREFIX", "aoui-drive:events:"),
+			RedisStreamMaxLen:        int64(getEnvAsInt("EVENT_STREAM_MAXLEN", 10000)),
+			WebhookResponseCapture:   getEnvAsInt("WEBHOOK_RESPONSE_CAPTURE_BYTES", 4096),
+			WebhookMaxAttempts:       getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 5),
+			WebhookRetryBackoff:      getEnvAsDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+			WebhookRetryConcurrency:  getEnvAsInt("WEBHOOK_RETRY_CONCURRENCY", 4),
+			WebhookRetryBatchSize:    getEnvAsInt("WEBHOOK_RETRY_BATCH_SIZE", 50),
+			WebhookRetryPollInterval: getEnvAsDuration("WEBHOOK_RETRY_POLL_INTERVAL", 5*time.Second),
+			WebhookClaimTimeout:      getEnvAsDuration("WEBHOOK_CLAIM_TIMEOUT", 5*time.Minute),
+			WebhookMaxStreams:        getEnvAsInt("WEBHOOK_STREAM_MAX", 16),
+			WebhookMaxPending:        getEnvAsInt("WEBHOOK_MAX_PENDING", 10000),
+			WebhookDownloadTokenTTL:  getEnvAsDuration("WEBHOOK_DOWNLOAD_TOKEN_TTL", time.Hour),
+		},
+		Paging: PagingConfig{
+			DefaultPerPage: getEnvAsInt("PAGE_SIZE_DEFAULT", 20),
+			MaxPerPage:     getEnvAsInt("PAGE_SIZE_MAX", 100),
+		},
+		Presign: PresignConfig{
+			Secret:         presignSecret,
+			SecretDerived:  presignDerived,
+			PreviousSecret: presignPrevious,
+			DefaultTTL:     getEnvAsDuration("PRESIGN_TTL", time.Hour),
+			MaxTTL:         getEnvAsDuration("PRESIGN_MAX_TTL", 7*24*time.Hour),
+		},
+		Scanner: ScannerConfig{
+			Address:  getEnv("SCANNER_ADDRESS", ""),
+			Timeout:  getEnvAsDuration("SCANNER_TIMEOUT", 30*time.Second),
+			FailOpen: getEnvAsBool("SCANNER_FAIL_OPEN", false),
+		},
+		Auth: AuthConfig{
+			APITokenSource: getEnv("AUTH_API_TOKEN_SOURCE", "header"),
+			UITokenSource:  getEnv("AUTH_UI_TOKEN_SOURCE", "cookie"),
+			SessionStore:   getEnv("AUTH_SESSION_STORE", "memory"),
+
+			LockoutThreshold:  getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 0),
+			LockoutWindow:     getEnvAsDuration("LOGIN_LOCKOUT_WINDOW", 15*time.Minute),
+			LockoutWebhookURL: getEnv("LOGIN_LOCKOUT_WEBHOOK_URL", ""),
+
+			AllowSelfRegistration:  getEnvAsBool("ALLOW_SELF_REGISTRATION", false),
+			RegistrationRole:       getEnv("REGISTRATION_ROLE", "USER"),
+			RegistrationInviteCode: getEnv("REGISTRATION_INVITE_CODE", ""),
+			RegistrationRateLimit:  getEnvAsInt("REGISTRATION_RATE_LIMIT", 5),
+			RegistrationRateWindow: getEnvAsDuration("REGISTRATION_RATE_WINDOW", time.Hour),
+		},
+		Quota: QuotaConfig{
+			MaxClients: getEnvAsInt("MAX_CLIENTS", 0),
+			MaxBuckets: getEnvAsInt("MAX_BUCKETS", 0),
+		},
+		JWTSecret:          jwtSecret,
+		JWTPreviousSecrets: getEnvAsSlice("JWT_PREVIOUS_SECRETS", nil),
+		JWTLeeway:          getEnvAsDurationAllowZero("JWT_LEEWAY", 30*time.Second),
+		Env:                getEnv("ENV", "development"),
 	}
 }
 
@@ -67,6 +355,34 @@ func (c *Config) IsProduction() bool {
 	return c.Env == "production"
 }
 
+// HasPublisher reports whether the named event publisher is enabled.
+func (e EventsConfig) HasPublisher(name string) bool {
+	for _, p := range e.Publishers {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeBasePath gives a base path a leading slash and no trailing one,
+// so "drive/" and "/drive" both become "/drive" and "/" becomes ""
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// deriveSecret derives a key for purpose from secret with HMAC-SHA256, so a
+// secret can seed keys for unrelated uses without any of them being shared
+func deriveSecret(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -82,3 +398,46 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsDurationAllowZero is getEnvAsDuration for settings where 0 turns
+// the feature off, so an explicit 0 is kept rather than replaced by the default
+func getEnvAsDurationAllowZero(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,16 +1,21 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 //go:embed schema/*.sql
@@ -19,9 +24,16 @@ var schemaFS embed.FS
 type Database struct {
 	DB      *sql.DB
 	Queries *sqlc.Queries
+
+	instrumented *instrumentedDB
+	path         string
+	// maintenance keeps Optimize runs from overlapping
+	maintenance sync.Mutex
 }
 
-func New(dbPath string) (*Database, error) {
+// New opens the SQLite database. Queries issued through Queries are timed and
+// those taking at least slowQueryThreshold are logged; zero disables the log.
+func New(dbPath string, slowQueryThreshold time.Duration) (*Database, error) {
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
@@ -38,17 +50,31 @@ func New(dbPath string) (*Database, error) {
 
 	db.SetMaxOpenConns(1)
 
+	instrumented := &instrumentedDB{db: db, slowThreshold: slowQueryThreshold}
+
 	return &Database{
-		DB:      db,
-		Queries: sqlc.New(db),
+		DB:           db,
+		Queries:      sqlc.New(instrumented),
+		instrumented: instrumented,
+		path:         dbPath,
 	}, nil
 }
 
+// Stats returns query timings and connection wait metrics since startup
+func (d *Database) Stats() Stats {
+	return d.instrumented.stats()
+}
+
 func (d *Database) Close() error {
 	return d.DB.Close()
 }
 
+// Migrate applies every embedded schema file that has not been recorded in
+// schema_migrations yet. The version is the numeric prefix of the file name
+// (e.g. 006_webhook_compression.sql is version 6).
 func (d *Database) Migrate() error {
+	ctx := context.Background()
+
 	entries, err := schemaFS.ReadDir("schema")
 	if err != nil {
 		return fmt.Errorf("failed to read schema directory: %w", err)
@@ -62,16 +88,69 @@ func (d *Database) Migrate() error {
 	}
 	sort.Strings(files)
 
+	// schema_migrations is created by the first migration, so a fresh
+	// database has no history yet. The initial migrations are idempotent.
+	applied := make(map[int64]bool)
+	if migrations, err := d.Queries.GetAppliedMigrations(ctx); err == nil {
+		for _, m := range migrations {
+			applied[m.Version] = true
+		}
+	}
+
 	for _, file := range files {
+		version, err := migrationVersion(file)
+		if err != nil {
+			return err
+		}
+		if applied[version] {
+			continue
+		}
+
 		content, err := schemaFS.ReadFile("schema/" + file)
 		if err != nil {
 			return fmt.Errorf("failed to read migration %s: %w", file, err)
 		}
 
-		if _, err := d.DB.Exec(string(content)); err != nil {
+		tx, err := d.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", file, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+			tx.Rollback()
 			return fmt.Errorf("failed to execute migration %s: %w", file, err)
 		}
+
+		if err := d.Queries.WithTx(tx).InsertMigration(ctx, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", file, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", file, err)
+		}
 	}
 
 	return nil
 }
+
+// IsUniqueViolation reports whether err is an insert or update rejected by a
+// UNIQUE constraint or primary key. Repositories check for an existing row
+// before inserting, but two concurrent requests can both pass that check, so
+// the loser's constraint error is what tells them apart.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+func migrationVersion(file string) (int64, error) {
+	prefix, _, _ := strings.Cut(file, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid migration file name %s: %w", file, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,101 @@
+// Package dbtest opens throwaway SQLite databases for tests
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+// New opens a database in the test's temporary directory with every
+// migration applied. It is closed when the test ends.
+func New(t testing.TB) *database.Database {
+	t.Helper()
+
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), 0)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	return db
+}
+
+// Client inserts a USER client with the given ID, whose access key is the ID
+func Client(t testing.TB, db *database.Database, id string) sqlc.Client {
+	t.Helper()
+
+	client, err := db.Queries.CreateClient(context.Background(), sqlc.CreateClientParams{
+		ID:        id,
+		Name:      id,
+		AccessKey: id,
+		SecretKey: "secret",
+		Role:      "USER",
+	})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	return client
+}
+
+// Bucket inserts a private bucket of clientID with the given ID, also used as
+// its name
+func Bucket(t testing.TB, db *database.Database, clientID, id string) sqlc.Bucket {
+	t.Helper()
+
+	bucket, err := db.Queries.CreateBucket(context.Background(), sqlc.CreateBucketParams{
+		ID:       id,
+		Name:     id,
+		ClientID: clientID,
+	})
+	if err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	return bucket
+}
+
+// Resource inserts a ready resource of size bytes into bucketID, with no
+// extension
+func Resource(t testing.TB, db *database.Database, bucketID, hash string, size int64) sqlc.Resource {
+	t.Helper()
+
+	resource, err := db.Queries.CreateResource(context.Background(), sqlc.CreateResourceParams{
+		ID:               bucketID + "-" + hash,
+		BucketID:         bucketID,
+		Hash:             hash,
+		Size:             size,
+		ContentType:      "application/octet-stream",
+		ProcessingStatus: "ready",
+	})
+	if err != nil {
+		t.Fatalf("create resource: %v", err)
+	}
+	return resource
+}
+
+// StaleCheck returns queries on db where the sqlc query named name answers 0,
+// as an existence check does for the loser of two concurrent creations: the
+// row it looks for is only inserted after the check.
+func StaleCheck(db *database.Database, name string) *sqlc.Queries {
+	return sqlc.New(staleCheck{DBTX: db.DB, marker: "-- name: " + name + " "})
+}
+
+type staleCheck struct {
+	sqlc.DBTX
+	marker string
+}
+
+func (s staleCheck) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if strings.HasPrefix(query, s.marker) {
+		return s.DBTX.QueryRowContext(ctx, "SELECT 0")
+	}
+	return s.DBTX.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// instrumentedDB wraps *sql.DB as the sqlc DBTX, timing every statement.
+// With a single SQLite connection the measured duration includes the time
+// spent waiting for that connection, which is what surfaces contention.
+type instrumentedDB struct {
+	db            *sql.DB
+	slowThreshold time.Duration
+
+	queries     atomic.Int64
+	slowQueries atomic.Int64
+	totalNanos  atomic.Int64
+	maxNanos    atomic.Int64
+}
+
+// Stats is a snapshot of query timings and connection pool contention
+type Stats struct {
+	Queries       int64
+	SlowQueries   int64
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+	SlowThreshold time.Duration
+
+	// From database/sql: how often and how long callers waited for a connection
+	WaitCount    int64
+	WaitDuration time.Duration
+	InUse        int
+	Idle         int
+}
+
+func (d *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer d.observe(query, time.Now())
+	return d.db.ExecContext(ctx, query, args...)
+}
+
+func (d *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.db.PrepareContext(ctx, query)
+}
+
+// QueryContext times until the first result is available; row iteration is not included
+func (d *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer d.observe(query, time.Now())
+	return d.db.QueryContext(ctx, query, args...)
+}
+
+func (d *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer d.observe(query, time.Now())
+	return d.db.QueryRowContext(ctx, query, args...)
+}
+
+func (d *instrumentedDB) observe(query string, start time.Time) {
+	elapsed := time.Since(start)
+
+	d.queries.Add(1)
+	d.totalNanos.Add(int64(elapsed))
+	for {
+		current := d.maxNanos.Load()
+		if int64(elapsed) <= current || d.maxNanos.CompareAndSwap(current, int64(elapsed)) {
+			break
+		}
+	}
+
+	if d.slowThreshold > 0 && elapsed >= d.slowThreshold {
+		d.slowQueries.Add(1)
+		log.Printf("Slow query (%s): %s", elapsed.Round(time.Microsecond), queryName(query))
+	}
+}
+
+func (d *instrumentedDB) stats() Stats {
+	pool := d.db.Stats()
+	return Stats{
+		Queries:       d.queries.Load(),
+		SlowQueries:   d.slowQueries.Load(),
+		TotalDuration: time.Duration(d.totalNanos.Load()),
+		MaxDuration:   time.Duration(d.maxNanos.Load()),
+		SlowThreshold: d.slowThreshold,
+		WaitCount:     pool.WaitCount,
+		WaitDuration:  pool.WaitDuration,
+		InUse:         pool.InUse,
+		Idle:          pool.Idle,
+	}
+}
+
+// queryName returns the sqlc annotation (e.g. "GetBucketByID :one") when present,
+// otherwise the statement collapsed to a single line
+func queryName(query string) string {
+	if strings.HasPrefix(query, "-- name: ") {
+		line, _, _ := strings.Cut(query, "\n")
+		return strings.TrimPrefix(line, "-- name: ")
+	}
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > 200 {
+		query = query[:200] + "..."
+	}
+	return query
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrMaintenanceRunning is returned by Optimize while another run is in progress
+var ErrMaintenanceRunning = errors.New("database maintenance is already running")
+
+// MaintenanceResult describes one Optimize run. Sizes are in bytes and
+// include the WAL file.
+type MaintenanceResult struct {
+	SizeBefore int64
+	SizeAfter  int64
+	WALBefore  int64
+	WALAfter   int64
+	// CheckpointBusy is set when another process kept the WAL from being
+	// fully checkpointed and truncated; the next run picks up the rest
+	CheckpointBusy bool
+	Duration       time.Duration
+}
+
+// Optimize checkpoints the WAL into the main database file, truncates it and
+// refreshes the query planner statistics with PRAGMA optimize.
+//
+// Both statements run on the single connection, so they wait for in-flight
+// queries and transactions (imports, reindexes, bucket deletes) to finish and
+// hold back new ones until done.
+func (d *Database) Optimize(ctx context.Context) (*MaintenanceResult, error) {
+	if !d.maintenance.TryLock() {
+		return nil, ErrMaintenanceRunning
+	}
+	defer d.maintenance.Unlock()
+
+	start := time.Now()
+	result := &MaintenanceResult{}
+	result.SizeBefore, result.WALBefore = d.fileSizes()
+
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	var busy, logFrames, checkpointed int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	result.CheckpointBusy = busy != 0
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA optimize"); err != nil {
+		return nil, fmt.Errorf("failed to optimize: %w", err)
+	}
+
+	result.SizeAfter, result.WALAfter = d.fileSizes()
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// fileSizes returns the size of the database including its WAL, and of the
+// WAL alone. Missing files count as empty.
+func (d *Database) fileSizes() (total, wal int64) {
+	if info, err := os.Stat(d.path); err == nil {
+		total = info.Size()
+	}
+	if info, err := os.Stat(d.path + "-wal"); err == nil {
+		wal = info.Size()
+	}
+	return total + wal, wal
+}
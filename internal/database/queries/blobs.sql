@@ -0,0 +1,14 @@
+-- name: DeleteUnreferencedBlob :execrows
+DELETE FROM blobs WHERE hash = ? AND ref_count <= 0;
+
+-- name: DeleteUnreferencedBlobs :many
+DELETE FROM blobs WHERE ref_count <= 0 RETURNING hash, size;
+
+-- name: SumStoredSize :one
+-- Bytes on disk, counted against MAX_TOTAL_STORAGE: each shared blob once,
+-- until it is collected, plus every encrypted resource, which never shares
+-- its file.
+SELECT CAST(
+    (SELECT COALESCE(SUM(size), 0) FROM blobs) +
+    (SELECT COALESCE(SUM(size), 0) FROM resources WHERE encrypted = 1)
+AS INTEGER) AS total_size;
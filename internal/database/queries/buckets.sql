@@ -1,23 +1,23 @@
 -- name: GetBucketByID :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE id = ?;
 
 -- name: GetBucketByNameAndClientID :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE name = ? AND client_id = ?;
 
 -- name: ListBuckets :many
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets ORDER BY name;
 
 -- name: ListBucketsByClientID :many
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE client_id = ? ORDER BY name;
 
 -- name: CreateBucket :one
-INSERT INTO buckets (id, name, client_id, is_public)
-VALUES (?, ?, ?, ?)
-RETURNING id, name, client_id, is_public, created_at, updated_at;
+INSERT INTO buckets (id, name, client_id, is_public, encrypted, scan_uploads)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
 
 -- name: DeleteBucket :execrows
 DELETE FROM buckets WHERE id = ?;
@@ -26,5 +26,70 @@ DELETE FROM buckets WHERE id = ?;
 SELECT EXISTS(SELECT 1 FROM buckets WHERE name = ? AND client_id = ?) AS bucket_exists;
 
 -- name: GetPublicBucketByName :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE name = ? AND is_public = 1;
+
+-- name: UpdateBucketClientID :one
+UPDATE buckets SET client_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketCacheControl :one
+UPDATE buckets SET cache_control = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketDownloadRateLimit :one
+UPDATE buckets SET download_rate_limit = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketEncrypted :one
+UPDATE buckets SET encrypted = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketRetention :one
+UPDATE buckets SET worm = ?, retention_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketScanUploads :one
+UPDATE buckets SET scan_uploads = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketSensitive :one
+UPDATE buckets SET sensitive = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: UpdateBucketWebhooksSuspended :one
+UPDATE buckets SET webhooks_suspended = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control;
+
+-- name: CountBuckets :one
+SELECT COUNT(*) AS count FROM buckets;
+
+-- name: CountBucketsByClientID :one
+SELECT COUNT(*) AS count FROM buckets WHERE client_id = ?;
+
+-- name: ListBucketOverviewsByClientID :many
+-- Stats are grouped over the current page of buckets only, so the cost is
+-- independent of how many buckets the client owns
+WITH page AS (
+    SELECT id, name, is_public, created_at, webhooks_suspended, sensitive
+    FROM buckets WHERE client_id = ? ORDER BY name LIMIT ? OFFSET ?
+)
+SELECT page.id, page.name, page.is_public, page.created_at, page.webhooks_suspended, page.sensitive,
+       COALESCE(r.object_count, 0) AS object_count,
+       COALESCE(r.total_size, 0) AS total_size,
+       COALESCE(w.active_webhooks, 0) AS active_webhooks,
+       CAST(strftime('%s', e.last_event_at) AS INTEGER) AS last_event_unix
+FROM page
+LEFT JOIN (
+    SELECT bucket_id, SUM(deleted_at IS NULL) AS object_count, SUM(size) AS total_size
+    FROM resources WHERE bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) r ON r.bucket_id = page.id
+LEFT JOIN (
+    SELECT bucket_id, COUNT(*) AS active_webhooks
+    FROM webhook_urls WHERE is_active = 1 AND bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) w ON w.bucket_id = page.id
+LEFT JOIN (
+    SELECT bucket_id, MAX(created_at) AS last_event_at
+    FROM webhook_events WHERE bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) e ON e.bucket_id = page.id
+ORDER BY page.name;
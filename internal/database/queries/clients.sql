@@ -29,3 +29,6 @@ DELETE FROM clients WHERE id = ?;
 
 -- name: ClientExistsByAccessKey :one
 SELECT EXISTS(SELECT 1 FROM clients WHERE access_key = ?) AS client_exists;
+
+-- name: CountClients :one
+SELECT COUNT(*) AS count FROM clients;
@@ -0,0 +1,44 @@
+-- name: ExportClients :many
+-- Exports page through each table by primary key, so a dump is streamed
+-- without holding a table in memory. Client secrets are left out.
+SELECT id, name, access_key, role, is_active, created_at, updated_at
+FROM clients WHERE id > sqlc.arg(after) ORDER BY id LIMIT sqlc.arg(limit);
+
+-- name: ExportBuckets :many
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+FROM buckets WHERE id > sqlc.arg(after) ORDER BY id LIMIT sqlc.arg(limit);
+
+-- name: ExportResources :many
+-- Trashed resources are left out; their files are not part of the bucket
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE id > sqlc.arg(after) AND deleted_at IS NULL ORDER BY id LIMIT sqlc.arg(limit);
+
+-- name: ExportWebhookURLs :many
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
+FROM webhook_urls WHERE id > sqlc.arg(after) ORDER BY id LIMIT sqlc.arg(limit);
+
+-- name: ExportWebhookHeaders :many
+SELECT id, webhook_url_id, header_name, header_value, created_at
+FROM webhook_headers WHERE id > sqlc.arg(after) ORDER BY id LIMIT sqlc.arg(limit);
+
+-- name: ImportClient :execrows
+-- Imports keep the exported IDs and skip rows that already exist. Clients get
+-- an empty secret, which matches no key until an admin rotates it.
+INSERT OR IGNORE INTO clients (id, name, access_key, secret_key, role, is_active, created_at, updated_at)
+VALUES (?, ?, ?, '', ?, ?, ?, ?);
+
+-- name: ImportBucket :execrows
+INSERT OR IGNORE INTO buckets (id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ImportResource :execrows
+INSERT OR IGNORE INTO resources (id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ImportWebhookURL :execrows
+INSERT OR IGNORE INTO webhook_urls (id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ImportWebhookHeader :execrows
+INSERT OR IGNORE INTO webhook_headers (id, webhook_url_id, header_name, header_value, created_at)
+VALUES (?, ?, ?, ?, ?);
@@ -0,0 +1,8 @@
+-- name: ListResourceMetadata :many
+SELECT key, value FROM resource_metadata WHERE resource_id = ? ORDER BY key;
+
+-- name: InsertResourceMetadata :exec
+INSERT INTO resource_metadata (resource_id, key, value) VALUES (?, ?, ?);
+
+-- name: DeleteResourceMetadata :exec
+DELETE FROM resource_metadata WHERE resource_id = ?;
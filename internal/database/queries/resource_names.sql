@@ -0,0 +1,11 @@
+-- name: GetResourceByName :one
+-- The newest upload under the name wins
+SELECT r.id, r.bucket_id, r.hash, r.size, r.content_type, r.extension, r.created_at, r.retain_until, r.encrypted, r.processing_status, r.processing_error, r.original_name, r.deleted_at, r.changed_at, r.revision
+FROM resource_names n
+JOIN resources r ON r.bucket_id = n.bucket_id AND r.hash = n.hash
+WHERE n.bucket_id = ? AND n.name = ? AND r.deleted_at IS NULL
+ORDER BY n.id DESC
+LIMIT 1;
+
+-- name: UpsertResourceName :exec
+INSERT OR REPLACE INTO resource_names (bucket_id, name, hash) VALUES (?, ?, ?);
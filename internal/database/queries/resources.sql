@@ -1,19 +1,55 @@
 -- name: GetResourceByID :one
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
 FROM resources WHERE id = ?;
 
 -- name: GetResourceByBucketAndHash :one
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
-FROM resources WHERE bucket_id = ? AND hash = ?;
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL;
+
+-- name: GetTrashedResourceByBucketAndHash :one
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND hash = ? AND deleted_at IS NOT NULL;
 
 -- name: ListResourcesByBucketID :many
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
-FROM resources WHERE bucket_id = ? ORDER BY created_at DESC;
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND deleted_at IS NULL ORDER BY created_at DESC;
+
+-- name: ListResourcesByBucketIDPaged :many
+-- content_type_pattern is a LIKE pattern, empty for every type; the second
+-- LIKE matches types stored with parameters ("text/plain; charset=utf-8").
+-- sort_by is 'created_at' or 'size'; the CASEs keep the ordering
+-- parameterised. id breaks ties, so pages neither repeat nor skip rows.
+-- Trashed resources are only listed when include_deleted is 1.
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE bucket_id = sqlc.arg(bucket_id)
+AND (CAST(sqlc.arg(content_type_pattern) AS TEXT) = '' OR content_type LIKE sqlc.arg(content_type_pattern) ESCAPE '\'
+    OR content_type LIKE sqlc.arg(content_type_pattern) || ';%' ESCAPE '\')
+AND (CAST(sqlc.arg(include_deleted) AS INTEGER) = 1 OR deleted_at IS NULL)
+ORDER BY
+    CASE WHEN CAST(sqlc.arg(sort_by) AS TEXT) = 'size' AND CAST(sqlc.arg(descending) AS INTEGER) = 0 THEN size END ASC,
+    CASE WHEN sqlc.arg(sort_by) = 'size' AND sqlc.arg(descending) = 1 THEN size END DESC,
+    CASE WHEN sqlc.arg(sort_by) = 'created_at' AND sqlc.arg(descending) = 0 THEN created_at END ASC,
+    CASE WHEN sqlc.arg(sort_by) = 'created_at' AND sqlc.arg(descending) = 1 THEN created_at END DESC,
+    CASE WHEN sqlc.arg(descending) = 0 THEN id END ASC,
+    id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountResourcesByBucketID :one
+SELECT COUNT(*) AS count FROM resources
+WHERE bucket_id = sqlc.arg(bucket_id)
+AND (CAST(sqlc.arg(content_type_pattern) AS TEXT) = '' OR content_type LIKE sqlc.arg(content_type_pattern) ESCAPE '\'
+    OR content_type LIKE sqlc.arg(content_type_pattern) || ';%' ESCAPE '\')
+AND (CAST(sqlc.arg(include_deleted) AS INTEGER) = 1 OR deleted_at IS NULL);
+
+-- name: ListRecentResourcesByBucketID :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND deleted_at IS NULL ORDER BY created_at DESC LIMIT ?;
 
 -- name: CreateResource :one
-INSERT INTO resources (id, bucket_id, hash, size, content_type, extension)
-VALUES (?, ?, ?, ?, ?, ?)
-RETURNING id, bucket_id, hash, size, content_type, extension, created_at;
+INSERT INTO resources (id, bucket_id, hash, size, content_type, extension, retain_until, encrypted, processing_status, original_name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision;
 
 -- name: DeleteResource :execrows
 DELETE FROM resources WHERE id = ?;
@@ -21,5 +57,117 @@ DELETE FROM resources WHERE id = ?;
 -- name: DeleteResourceByBucketAndHash :execrows
 DELETE FROM resources WHERE bucket_id = ? AND hash = ?;
 
+-- name: TrashResource :execrows
+UPDATE resources SET deleted_at = CURRENT_TIMESTAMP
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL;
+
+-- name: RestoreResource :one
+UPDATE resources SET deleted_at = NULL, changed_at = CURRENT_TIMESTAMP
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NOT NULL
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision;
+
+-- name: ListExpiredTrashedResources :many
+-- Trashed resources deleted at or before the cutoff, oldest first
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE deleted_at IS NOT NULL AND datetime(deleted_at) <= datetime(sqlc.arg(cutoff))
+ORDER BY deleted_at LIMIT sqlc.arg(limit);
+
+-- name: PurgeTrashedResource :execrows
+-- Only a row that is still trashed is purged, so a concurrent restore wins
+DELETE FROM resources WHERE id = ? AND deleted_at IS NOT NULL;
+
+-- name: DeleteUnretainedResourcesByBucketID :many
+-- Resources still under retention are left in place, so one retained since
+-- the caller checked cannot be deleted
+DELETE FROM resources
+WHERE bucket_id = ? AND (retain_until IS NULL OR datetime(retain_until) <= CURRENT_TIMESTAMP)
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision;
+
 -- name: ResourceExistsByBucketAndHash :one
 SELECT EXISTS(SELECT 1 FROM resources WHERE bucket_id = ? AND hash = ?) AS resource_exists;
+
+-- name: ApplyResourceRetentionByBucketID :execrows
+UPDATE resources SET retain_until = ? WHERE bucket_id = ? AND retain_until IS NULL;
+
+-- name: CountRetainedResourcesByBucketID :one
+SELECT COUNT(*) AS count FROM resources
+WHERE bucket_id = ? AND retain_until IS NOT NULL AND datetime(retain_until) > CURRENT_TIMESTAMP;
+
+-- name: ListResourcesChangedAfter :many
+-- Incremental sync page: live resources whose latest change comes after
+-- after_seq, in change order. Only resources created or last changed at or
+-- after since are listed; the zero time lists them all.
+SELECT r.id, r.bucket_id, r.hash, r.size, r.content_type, r.extension, r.created_at, r.retain_until, r.encrypted, r.processing_status, r.processing_error, r.original_name, r.deleted_at, r.changed_at, r.revision, c.seq
+FROM resource_changes c
+JOIN resources r ON r.bucket_id = c.bucket_id AND r.hash = c.hash
+WHERE c.bucket_id = sqlc.arg(bucket_id) AND c.seq > sqlc.arg(after_seq) AND r.deleted_at IS NULL
+AND datetime(COALESCE(r.changed_at, r.created_at)) >= datetime(sqlc.arg(since))
+ORDER BY c.seq LIMIT sqlc.arg(limit);
+
+-- name: GetLatestResourceChange :one
+-- The seq of the bucket's latest change, 0 when nothing has changed
+SELECT CAST(COALESCE(MAX(seq), 0) AS INTEGER) AS seq FROM resource_changes WHERE bucket_id = ?;
+
+-- name: ListResourcesCreatedAfter :many
+-- Keyset page for reports: rows after (after, after_id) in (created_at, id)
+-- order. Timestamps are compared at second precision.
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE bucket_id = sqlc.arg(bucket_id) AND deleted_at IS NULL
+AND (datetime(created_at) > datetime(sqlc.arg(after))
+    OR (datetime(created_at) = datetime(sqlc.arg(after)) AND id > sqlc.arg(after_id)))
+ORDER BY datetime(created_at), id LIMIT sqlc.arg(limit);
+
+-- name: ListUnprocessedResources :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE processing_status IN ('pending', 'processing') AND deleted_at IS NULL ORDER BY created_at;
+
+-- name: UpdateResourceContentType :one
+UPDATE resources SET content_type = ?, changed_at = CURRENT_TIMESTAMP, revision = revision + 1
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision;
+
+-- name: UpdateResourceProcessingStatus :execrows
+-- Moves a resource between processing states. The update only applies while
+-- the resource is still in from_status, so a transition is taken at most once.
+UPDATE resources SET processing_status = sqlc.arg(status), processing_error = sqlc.arg(error)
+WHERE id = sqlc.arg(id) AND processing_status = sqlc.arg(from_status);
+
+-- name: UpsertResourceTombstone :exec
+INSERT INTO resource_tombstones (bucket_id, hash) VALUES (?, ?)
+ON CONFLICT(bucket_id, hash) DO UPDATE SET deleted_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteResourceTombstone :exec
+DELETE FROM resource_tombstones WHERE bucket_id = ? AND hash = ?;
+
+-- name: ListResourceTombstonesAfter :many
+-- Deletions for incremental sync, paged like ListResourcesChangedAfter
+SELECT t.bucket_id, t.hash, t.deleted_at, c.seq
+FROM resource_changes c
+JOIN resource_tombstones t ON t.bucket_id = c.bucket_id AND t.hash = c.hash
+WHERE c.bucket_id = sqlc.arg(bucket_id) AND c.seq > sqlc.arg(after_seq)
+AND datetime(t.deleted_at) >= datetime(sqlc.arg(since))
+ORDER BY c.seq LIMIT sqlc.arg(limit);
+
+-- name: SumEncryptedResourceSizesByBucketID :one
+-- Bytes freed with a bucket right away. Its other content is shared, and
+-- freed once the blobs it leaves unreferenced are collected.
+SELECT CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size FROM resources WHERE bucket_id = ? AND encrypted = 1;
+
+-- name: GetResourceListVersion :one
+-- Summarises a bucket's listing for its ETag: uploads, deletions, restores,
+-- processing progress and content type corrections each change at least one
+-- column
+SELECT COUNT(*) AS count,
+       CAST(COALESCE(SUM(deleted_at IS NOT NULL), 0) AS INTEGER) AS trashed,
+       CAST(COALESCE(MAX(created_at), '') AS TEXT) AS last_created,
+       CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size,
+       CAST(COALESCE(SUM(processing_status = 'pending'), 0) AS INTEGER) AS pending,
+       CAST(COALESCE(SUM(processing_status = 'processing'), 0) AS INTEGER) AS processing,
+       CAST(COALESCE(SUM(revision), 0) AS INTEGER) AS revisions
+FROM resources WHERE bucket_id = ?;
+
+-- name: GetResourceTotalsByBucketID :one
+SELECT COUNT(*) AS count, CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size
+FROM resources WHERE bucket_id = ?;
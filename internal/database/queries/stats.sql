@@ -0,0 +1,17 @@
+-- name: GetSystemStats :one
+-- Whole-system counts for GET /admin/stats. Logical size counts every
+-- resource in full. Physical size is what is on disk after deduplication:
+-- each referenced shared blob once, plus every encrypted resource, which
+-- never shares its file.
+SELECT
+    (SELECT COUNT(*) FROM clients) AS clients,
+    (SELECT COUNT(*) FROM buckets) AS buckets,
+    (SELECT COUNT(*) FROM resources WHERE deleted_at IS NULL) AS resources,
+    (SELECT COUNT(*) FROM resources WHERE deleted_at IS NOT NULL) AS trashed_resources,
+    CAST((SELECT COALESCE(SUM(size), 0) FROM resources) AS INTEGER) AS logical_size,
+    CAST(
+        (SELECT COALESCE(SUM(size), 0) FROM blobs WHERE ref_count > 0) +
+        (SELECT COALESCE(SUM(size), 0) FROM resources WHERE encrypted = 1)
+    AS INTEGER) AS physical_size,
+    (SELECT COUNT(*) FROM webhook_events WHERE status IN ('pending', 'retrying')) AS pending_webhooks,
+    (SELECT COUNT(*) FROM webhook_events WHERE status = 'failed') AS failed_webhooks;
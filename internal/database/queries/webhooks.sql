@@ -1,31 +1,34 @@
 -- Webhook URLs queries
 
 -- name: GetWebhookURLByID :one
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE id = ?;
 
 -- name: ListWebhookURLsByBucketID :many
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE bucket_id = ? ORDER BY created_at DESC;
 
 -- name: ListActiveWebhookURLsByBucketAndEvent :many
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE bucket_id = ? AND event_type = ? AND is_active = 1;
 
 -- name: CreateWebhookURL :one
-INSERT INTO webhook_urls (id, bucket_id, url, event_type, is_active)
-VALUES (?, ?, ?, ?, ?)
-RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at;
+INSERT INTO webhook_urls (id, bucket_id, url, event_type, is_active, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds;
 
 -- name: UpdateWebhookURL :one
 UPDATE webhook_urls
-SET url = ?, event_type = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
+SET url = ?, event_type = ?, is_active = ?, compress_payload = ?, partition_key_template = ?, payload_version = ?, content_type_filter = ?, include_download_token = ?, max_attempts = ?, retry_backoff_seconds = ?, updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at;
+RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds;
 
 -- name: DeleteWebhookURL :execrows
 DELETE FROM webhook_urls WHERE id = ?;
 
+-- name: CountWebhookURLsByBucketID :one
+SELECT COUNT(*) AS count FROM webhook_urls WHERE bucket_id = ?;
+
 -- name: WebhookURLExists :one
 SELECT EXISTS(SELECT 1 FROM webhook_urls WHERE bucket_id = ? AND url = ? AND event_type = ?) AS webhook_exists;
 
@@ -59,36 +62,71 @@ DELETE FROM webhook_headers WHERE webhook_url_id = ?;
 -- name: GetWebhookEventByID :one
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events WHERE id = ?;
 
 -- name: ListWebhookEventsByBucketID :many
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events WHERE bucket_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?;
 
 -- name: ListPendingWebhookEvents :many
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events
 WHERE (status = 'pending' OR (status = 'retrying' AND next_retry_at <= CURRENT_TIMESTAMP))
 AND attempts < max_attempts
 ORDER BY created_at ASC LIMIT ?;
 
+-- name: ClaimWebhookEvent :execrows
+UPDATE webhook_events SET status = 'processing', claimed_at = ? WHERE id = ? AND status = 'pending';
+
+-- name: ClaimPendingWebhookEvents :many
+-- Claims due events in one statement, so concurrent workers never get the same
+-- row. Events stuck in processing since before stale_before are claimed again.
+UPDATE webhook_events
+SET status = 'processing', claimed_at = sqlc.arg(claimed_at)
+WHERE id IN (
+    SELECT id FROM webhook_events
+    WHERE (status = 'pending'
+        OR (status = 'retrying' AND next_retry_at <= sqlc.arg(claimed_at))
+        OR (status = 'processing' AND claimed_at <= sqlc.arg(stale_before)))
+    AND attempts < max_attempts
+    ORDER BY created_at ASC LIMIT sqlc.arg(batch_size)
+)
+RETURNING id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
+          response_code, response_body, attempts, max_attempts, next_retry_at,
+          last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms;
+
 -- name: CreateWebhookEvent :one
-INSERT INTO webhook_events (id, webhook_url_id, bucket_id, resource_id, event_type, status, payload, max_attempts)
-VALUES (?, ?, ?, ?, ?, 'pending', ?, ?)
+INSERT INTO webhook_events (id, webhook_url_id, bucket_id, resource_id, event_type, status, payload, max_attempts, partition_key, request_id)
+VALUES (?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?)
 RETURNING id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
           response_code, response_body, attempts, max_attempts, next_retry_at,
-          last_attempt_at, created_at, completed_at;
+          last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms;
 
 -- name: UpdateWebhookEventStatus :exec
 UPDATE webhook_events
 SET status = ?, response_code = ?, response_body = ?, attempts = attempts + 1,
-    last_attempt_at = CURRENT_TIMESTAMP, next_retry_at = ?, completed_at = ?
+    latency_ms = latency_ms + ?, last_attempt_at = CURRENT_TIMESTAMP, next_retry_at = ?, completed_at = ?
 WHERE id = ?;
 
+-- name: GetWebhookDeliveryStats :one
+-- An event succeeds on its last attempt at most, so the failed attempts are
+-- the attempts minus the successful events
+SELECT COUNT(*) AS events,
+       CAST(COALESCE(SUM(attempts), 0) AS INTEGER) AS attempts,
+       CAST(COALESCE(SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END), 0) AS INTEGER) AS successes,
+       CAST(COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) AS INTEGER) AS failed_events,
+       CAST(COALESCE(SUM(latency_ms), 0) AS INTEGER) AS latency_ms
+FROM webhook_events
+WHERE webhook_url_id = ? AND datetime(created_at) >= datetime(sqlc.arg(since));
+
 -- name: CountWebhookEventsByBucketID :one
 SELECT COUNT(*) AS count FROM webhook_events WHERE bucket_id = ?;
+
+-- name: CountPendingWebhookEvents :one
+-- Events still waiting for a delivery attempt, the backlog WEBHOOK_MAX_PENDING caps
+SELECT COUNT(*) AS count FROM webhook_events WHERE status IN ('pending', 'retrying');
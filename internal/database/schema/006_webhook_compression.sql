@@ -0,0 +1,2 @@
+-- Optional gzip compression of webhook request bodies
+ALTER TABLE webhook_urls ADD COLUMN compress_payload INTEGER NOT NULL DEFAULT 0;
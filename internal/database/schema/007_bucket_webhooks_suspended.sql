@@ -0,0 +1,2 @@
+-- Bucket-level switch to suspend all event delivery (e.g. during maintenance)
+ALTER TABLE buckets ADD COLUMN webhooks_suspended INTEGER NOT NULL DEFAULT 0;
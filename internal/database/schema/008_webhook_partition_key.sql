@@ -0,0 +1,2 @@
+-- Per-webhook template for the X-Webhook-Partition-Key header (empty = no header)
+ALTER TABLE webhook_urls ADD COLUMN partition_key_template TEXT NOT NULL DEFAULT '';
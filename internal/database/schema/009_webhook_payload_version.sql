@@ -0,0 +1,2 @@
+-- Pinned webhook payload schema version (0 = always the latest)
+ALTER TABLE webhook_urls ADD COLUMN payload_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Sensitive buckets are served with Cache-Control: no-store
+ALTER TABLE buckets ADD COLUMN sensitive INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- WORM buckets keep every resource until its retention period elapses
+ALTER TABLE buckets ADD COLUMN worm INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE buckets ADD COLUMN retention_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- Set at upload time (or when WORM is enabled); NULL means deletable
+ALTER TABLE resources ADD COLUMN retain_until DATETIME;
@@ -0,0 +1,5 @@
+-- Encrypted buckets store new blobs with AES-GCM under the master key
+ALTER TABLE buckets ADD COLUMN encrypted INTEGER NOT NULL DEFAULT 0;
+
+-- Whether this resource's blob is encrypted; decided when it was written
+ALTER TABLE resources ADD COLUMN encrypted INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Set when a worker claims an event; claims older than the claim timeout are
+-- taken over by another worker, so a crash mid-delivery does not strand events
+ALTER TABLE webhook_events ADD COLUMN claimed_at DATETIME;
+
+-- Rendered when the event is triggered so retries send the same partition key
+ALTER TABLE webhook_events ADD COLUMN partition_key TEXT NOT NULL DEFAULT '';
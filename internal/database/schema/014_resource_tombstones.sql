@@ -0,0 +1,13 @@
+-- Records deleted resources so incremental sync (GET /resources/:bucket?since=)
+-- can report deletions. A (bucket, hash) is either live or tombstoned: uploading
+-- the hash again removes its tombstone.
+CREATE TABLE IF NOT EXISTS resource_tombstones (
+    bucket_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (bucket_id, hash),
+    FOREIGN KEY (bucket_id) REFERENCES buckets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_resources_bucket_created ON resources(bucket_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_resource_tombstones_bucket_deleted ON resource_tombstones(bucket_id, deleted_at);
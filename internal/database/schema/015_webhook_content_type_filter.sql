@@ -0,0 +1,2 @@
+-- Comma-separated content-type patterns a webhook fires for, e.g. "image/*" (empty = all)
+ALTER TABLE webhook_urls ADD COLUMN content_type_filter TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- ID of the API request that triggered the event, sent again on every retry
+ALTER TABLE webhook_events ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
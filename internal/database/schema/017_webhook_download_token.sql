@@ -0,0 +1,2 @@
+-- Sign resource_url in payloads of private buckets so receivers can download without credentials
+ALTER TABLE webhook_urls ADD COLUMN include_download_token INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Post-processing state of a resource: pending -> processing -> ready | failed.
+-- Resources stored before the pipeline existed are ready.
+ALTER TABLE resources ADD COLUMN processing_status TEXT NOT NULL DEFAULT 'ready';
+ALTER TABLE resources ADD COLUMN processing_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_resources_processing_status ON resources(processing_status);
@@ -0,0 +1,2 @@
+-- Scan uploads to the bucket with the configured malware scanner before storing them
+ALTER TABLE buckets ADD COLUMN scan_uploads INTEGER NOT NULL DEFAULT 0;
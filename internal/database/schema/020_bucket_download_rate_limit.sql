@@ -0,0 +1,2 @@
+-- Per-bucket download bandwidth limit in bytes per second, 0 = unlimited
+ALTER TABLE buckets ADD COLUMN download_rate_limit INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Time spent waiting on the receiver, summed over every delivery attempt
+ALTER TABLE webhook_events ADD COLUMN latency_ms INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Per-bucket Cache-Control for public files, '' = server default
+ALTER TABLE buckets ADD COLUMN cache_control TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Filename the resource was uploaded with, '' = unknown (streamed uploads)
+ALTER TABLE resources ADD COLUMN original_name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,31 @@
+-- Content shared across buckets. An unencrypted resource's file is a hard link
+-- to <storage>/.blobs/<hash>, so identical uploads to different buckets are
+-- stored once. ref_count is kept by triggers so every way a resource row comes
+-- or goes (uploads, imports, reindexing, bucket cascades) is counted; a blob is
+-- only removed from disk after its count reaches zero.
+CREATE TABLE IF NOT EXISTS blobs (
+    hash TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_blobs_unreferenced ON blobs(ref_count) WHERE ref_count <= 0;
+
+-- Encrypted resources are encrypted per bucket and never share a file
+CREATE TRIGGER IF NOT EXISTS resources_blob_ref AFTER INSERT ON resources
+WHEN NEW.encrypted = 0
+BEGIN
+    INSERT INTO blobs (hash, size, ref_count) VALUES (NEW.hash, NEW.size, 1)
+    ON CONFLICT(hash) DO UPDATE SET ref_count = ref_count + 1;
+END;
+
+CREATE TRIGGER IF NOT EXISTS resources_blob_unref AFTER DELETE ON resources
+WHEN OLD.encrypted = 0
+BEGIN
+    UPDATE blobs SET ref_count = ref_count - 1 WHERE hash = OLD.hash;
+END;
+
+-- Count resources stored before this migration. Their files stay private
+-- copies; the shared copy is created by the next upload of the same content.
+INSERT OR IGNORE INTO blobs (hash, size, ref_count)
+SELECT hash, MAX(size), COUNT(*) FROM resources WHERE encrypted = 0 GROUP BY hash;
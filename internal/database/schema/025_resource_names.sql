@@ -0,0 +1,26 @@
+-- Filenames a bucket's resources were uploaded under. Content stays addressed
+-- by hash: one hash may carry many names, and re-using a name for new content
+-- adds a row, so a name resolves to the newest upload (highest id). INSERT OR
+-- REPLACE gives a re-uploaded (name, hash) pair a fresh id.
+CREATE TABLE IF NOT EXISTS resource_names (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    bucket_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (bucket_id) REFERENCES buckets(id) ON DELETE CASCADE,
+    UNIQUE(bucket_id, name, hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_resource_names_lookup ON resource_names(bucket_id, name, id);
+
+-- A deleted resource takes its names with it, however it was deleted
+CREATE TRIGGER IF NOT EXISTS resources_names_drop AFTER DELETE ON resources
+BEGIN
+    DELETE FROM resource_names WHERE bucket_id = OLD.bucket_id AND hash = OLD.hash;
+END;
+
+-- Names recorded before this migration, oldest first
+INSERT OR IGNORE INTO resource_names (bucket_id, name, hash, created_at)
+SELECT bucket_id, original_name, hash, created_at FROM resources
+WHERE original_name <> '' ORDER BY created_at, id;
@@ -0,0 +1,6 @@
+-- Soft deletion: a deleted resource keeps its row, with deleted_at set, while
+-- its file sits in the bucket's .trash folder. NULL is a live resource.
+-- Trashed rows are purged once the trash retention has passed.
+ALTER TABLE resources ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_resources_trash ON resources(deleted_at) WHERE deleted_at IS NOT NULL;
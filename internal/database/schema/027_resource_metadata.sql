@@ -0,0 +1,10 @@
+-- Key-value metadata attached to resources, such as alt text or the app that
+-- uploaded them. Entries belong to a resource row, so they follow it into the
+-- trash and back and are dropped with it.
+CREATE TABLE IF NOT EXISTS resource_metadata (
+    resource_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (resource_id, key),
+    FOREIGN KEY (resource_id) REFERENCES resources(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Per-webhook retry policy; 0 falls back to WEBHOOK_MAX_ATTEMPTS and WEBHOOK_RETRY_BACKOFF
+ALTER TABLE webhook_urls ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE webhook_urls ADD COLUMN retry_backoff_seconds INTEGER NOT NULL DEFAULT 0;
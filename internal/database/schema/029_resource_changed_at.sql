@@ -0,0 +1,4 @@
+-- When a live resource last changed after its creation, e.g. by being restored
+-- from the trash. Incremental sync pages on changed_at, falling back to
+-- created_at, so clients that saw a deletion also see the restore.
+ALTER TABLE resources ADD COLUMN changed_at DATETIME;
@@ -0,0 +1,3 @@
+-- Counts the changes made to a resource after its creation, such as content
+-- type corrections. Listing ETags sum it, so every change gives a new tag.
+ALTER TABLE resources ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,49 @@
+-- Incremental sync pages on a change sequence rather than on timestamps.
+-- Timestamps have second precision, so a change committed later in the same
+-- second as a cursor, with a smaller key, was skipped for good. Each live
+-- resource and tombstone keeps the seq of its latest change. AUTOINCREMENT
+-- never reuses a value, and SQLite assigns it under the write lock, so seqs
+-- become visible in order and a cursor never passes an uncommitted change.
+CREATE TABLE IF NOT EXISTS resource_changes (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    bucket_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    FOREIGN KEY (bucket_id) REFERENCES buckets(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_resource_changes_hash ON resource_changes(bucket_id, hash);
+CREATE INDEX IF NOT EXISTS idx_resource_changes_seq ON resource_changes(bucket_id, seq);
+
+-- Number existing rows in the order the timestamp cursor used
+INSERT OR REPLACE INTO resource_changes (bucket_id, hash)
+SELECT bucket_id, hash FROM (
+    SELECT bucket_id, hash, datetime(COALESCE(changed_at, created_at)) AS at, id AS key
+    FROM resources WHERE deleted_at IS NULL
+    UNION ALL
+    SELECT bucket_id, hash, datetime(deleted_at), hash FROM resource_tombstones
+) ORDER BY at, key;
+
+-- A change moves the hash to the end of the sequence
+CREATE TRIGGER IF NOT EXISTS resources_change_insert AFTER INSERT ON resources
+BEGIN
+    DELETE FROM resource_changes WHERE bucket_id = NEW.bucket_id AND hash = NEW.hash;
+    INSERT INTO resource_changes (bucket_id, hash) VALUES (NEW.bucket_id, NEW.hash);
+END;
+
+CREATE TRIGGER IF NOT EXISTS resources_change_update AFTER UPDATE OF changed_at, deleted_at ON resources
+BEGIN
+    DELETE FROM resource_changes WHERE bucket_id = NEW.bucket_id AND hash = NEW.hash;
+    INSERT INTO resource_changes (bucket_id, hash) VALUES (NEW.bucket_id, NEW.hash);
+END;
+
+CREATE TRIGGER IF NOT EXISTS resource_tombstones_change_insert AFTER INSERT ON resource_tombstones
+BEGIN
+    DELETE FROM resource_changes WHERE bucket_id = NEW.bucket_id AND hash = NEW.hash;
+    INSERT INTO resource_changes (bucket_id, hash) VALUES (NEW.bucket_id, NEW.hash);
+END;
+
+CREATE TRIGGER IF NOT EXISTS resource_tombstones_change_update AFTER UPDATE OF deleted_at ON resource_tombstones
+BEGIN
+    DELETE FROM resource_changes WHERE bucket_id = NEW.bucket_id AND hash = NEW.hash;
+    INSERT INTO resource_changes (bucket_id, hash) VALUES (NEW.bucket_id, NEW.hash);
+END;
@@ -7,6 +7,7 @@ package sqlc
 
 import (
 	"context"
+	"database/sql"
 )
 
 const bucketExistsByNameAndClientID = `-- name: BucketExistsByNameAndClientID :one
@@ -25,17 +26,41 @@ func (q *Queries) BucketExistsByNameAndClientID(ctx context.Context, arg BucketE
 	return bucket_exists, err
 }
 
+const countBuckets = `-- name: CountBuckets :one
+SELECT COUNT(*) AS count FROM buckets
+`
+
+func (q *Queries) CountBuckets(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countBuckets)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countBucketsByClientID = `-- name: CountBucketsByClientID :one
+SELECT COUNT(*) AS count FROM buckets WHERE client_id = ?
+`
+
+func (q *Queries) CountBucketsByClientID(ctx context.Context, clientID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countBucketsByClientID, clientID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createBucket = `-- name: CreateBucket :one
-INSERT INTO buckets (id, name, client_id, is_public)
-VALUES (?, ?, ?, ?)
-RETURNING id, name, client_id, is_public, created_at, updated_at
+INSERT INTO buckets (id, name, client_id, is_public, encrypted, scan_uploads)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 `
 
 type CreateBucketParams struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	ClientID string `json:"client_id"`
-	IsPublic int64  `json:"is_public"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ClientID    string `json:"client_id"`
+	IsPublic    int64  `json:"is_public"`
+	Encrypted   int64  `json:"encrypted"`
+	ScanUploads int64  `json:"scan_uploads"`
 }
 
 func (q *Queries) CreateBucket(ctx context.Context, arg CreateBucketParams) (Bucket, error) {
@@ -44,6 +69,8 @@ func (q *Queries) CreateBucket(ctx context.Context, arg CreateBucketParams) (Buc
 		arg.Name,
 		arg.ClientID,
 		arg.IsPublic,
+		arg.Encrypted,
+		arg.ScanUploads,
 	)
 	var i Bucket
 	err := row.Scan(
@@ -53,6 +80,14 @@ func (q *Queries) CreateBucket(ctx context.Context, arg CreateBucketParams) (Buc
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
 	)
 	return i, err
 }
@@ -70,7 +105,7 @@ func (q *Queries) DeleteBucket(ctx context.Context, id string) (int64, error) {
 }
 
 const getBucketByID = `-- name: GetBucketByID :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE id = ?
 `
 
@@ -84,12 +119,20 @@ func (q *Queries) GetBucketByID(ctx context.Context, id string) (Bucket, error)
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
 	)
 	return i, err
 }
 
 const getBucketByNameAndClientID = `-- name: GetBucketByNameAndClientID :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE name = ? AND client_id = ?
 `
 
@@ -108,12 +151,20 @@ func (q *Queries) GetBucketByNameAndClientID(ctx context.Context, arg GetBucketB
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
 	)
 	return i, err
 }
 
 const getPublicBucketByName = `-- name: GetPublicBucketByName :one
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE name = ? AND is_public = 1
 `
 
@@ -127,12 +178,101 @@ func (q *Queries) GetPublicBucketByName(ctx context.Context, name string) (Bucke
 		&i.IsPublic,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
 	)
 	return i, err
 }
 
+const listBucketOverviewsByClientID = `-- name: ListBucketOverviewsByClientID :many
+WITH page AS (
+    SELECT id, name, is_public, created_at, webhooks_suspended, sensitive
+    FROM buckets WHERE client_id = ? ORDER BY name LIMIT ? OFFSET ?
+)
+SELECT page.id, page.name, page.is_public, page.created_at, page.webhooks_suspended, page.sensitive,
+       COALESCE(r.object_count, 0) AS object_count,
+       COALESCE(r.total_size, 0) AS total_size,
+       COALESCE(w.active_webhooks, 0) AS active_webhooks,
+       CAST(strftime('%s', e.last_event_at) AS INTEGER) AS last_event_unix
+FROM page
+LEFT JOIN (
+    SELECT bucket_id, SUM(deleted_at IS NULL) AS object_count, SUM(size) AS total_size
+    FROM resources WHERE bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) r ON r.bucket_id = page.id
+LEFT JOIN (
+    SELECT bucket_id, COUNT(*) AS active_webhooks
+    FROM webhook_urls WHERE is_active = 1 AND bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) w ON w.bucket_id = page.id
+LEFT JOIN (
+    SELECT bucket_id, MAX(created_at) AS last_event_at
+    FROM webhook_events WHERE bucket_id IN (SELECT id FROM page) GROUP BY bucket_id
+) e ON e.bucket_id = page.id
+ORDER BY page.name
+`
+
+type ListBucketOverviewsByClientIDParams struct {
+	ClientID string `json:"client_id"`
+	Limit    int64  `json:"limit"`
+	Offset   int64  `json:"offset"`
+}
+
+type ListBucketOverviewsByClientIDRow struct {
+	ID                string        `json:"id"`
+	Name              string        `json:"name"`
+	IsPublic          int64         `json:"is_public"`
+	CreatedAt         sql.NullTime  `json:"created_at"`
+	WebhooksSuspended int64         `json:"webhooks_suspended"`
+	Sensitive         int64         `json:"sensitive"`
+	ObjectCount       int64         `json:"object_count"`
+	TotalSize         int64         `json:"total_size"`
+	ActiveWebhooks    int64         `json:"active_webhooks"`
+	LastEventUnix     sql.NullInt64 `json:"last_event_unix"`
+}
+
+// Stats are grouped over the current page of buckets only, so the cost is
+// independent of how many buckets the client owns
+func (q *Queries) ListBucketOverviewsByClientID(ctx context.Context, arg ListBucketOverviewsByClientIDParams) ([]ListBucketOverviewsByClientIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, listBucketOverviewsByClientID, arg.ClientID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListBucketOverviewsByClientIDRow{}
+	for rows.Next() {
+		var i ListBucketOverviewsByClientIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsPublic,
+			&i.CreatedAt,
+			&i.WebhooksSuspended,
+			&i.Sensitive,
+			&i.ObjectCount,
+			&i.TotalSize,
+			&i.ActiveWebhooks,
+			&i.LastEventUnix,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listBuckets = `-- name: ListBuckets :many
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets ORDER BY name
 `
 
@@ -152,6 +292,14 @@ func (q *Queries) ListBuckets(ctx context.Context) ([]Bucket, error) {
 			&i.IsPublic,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.WebhooksSuspended,
+			&i.Sensitive,
+			&i.Worm,
+			&i.RetentionSeconds,
+			&i.Encrypted,
+			&i.ScanUploads,
+			&i.DownloadRateLimit,
+			&i.CacheControl,
 		); err != nil {
 			return nil, err
 		}
@@ -167,7 +315,7 @@ func (q *Queries) ListBuckets(ctx context.Context) ([]Bucket, error) {
 }
 
 const listBucketsByClientID = `-- name: ListBucketsByClientID :many
-SELECT id, name, client_id, is_public, created_at, updated_at
+SELECT id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
 FROM buckets WHERE client_id = ? ORDER BY name
 `
 
@@ -187,6 +335,14 @@ func (q *Queries) ListBucketsByClientID(ctx context.Context, clientID string) ([
 			&i.IsPublic,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.WebhooksSuspended,
+			&i.Sensitive,
+			&i.Worm,
+			&i.RetentionSeconds,
+			&i.Encrypted,
+			&i.ScanUploads,
+			&i.DownloadRateLimit,
+			&i.CacheControl,
 		); err != nil {
 			return nil, err
 		}
@@ -200,3 +356,260 @@ func (q *Queries) ListBucketsByClientID(ctx context.Context, clientID string) ([
 	}
 	return items, nil
 }
+
+const updateBucketCacheControl = `-- name: UpdateBucketCacheControl :one
+UPDATE buckets SET cache_control = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketCacheControlParams struct {
+	CacheControl string `json:"cache_control"`
+	ID           string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketCacheControl(ctx context.Context, arg UpdateBucketCacheControlParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketCacheControl, arg.CacheControl, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketClientID = `-- name: UpdateBucketClientID :one
+UPDATE buckets SET client_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketClientIDParams struct {
+	ClientID string `json:"client_id"`
+	ID       string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketClientID(ctx context.Context, arg UpdateBucketClientIDParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketClientID, arg.ClientID, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketDownloadRateLimit = `-- name: UpdateBucketDownloadRateLimit :one
+UPDATE buckets SET download_rate_limit = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketDownloadRateLimitParams struct {
+	DownloadRateLimit int64  `json:"download_rate_limit"`
+	ID                string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketDownloadRateLimit(ctx context.Context, arg UpdateBucketDownloadRateLimitParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketDownloadRateLimit, arg.DownloadRateLimit, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketEncrypted = `-- name: UpdateBucketEncrypted :one
+UPDATE buckets SET encrypted = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketEncryptedParams struct {
+	Encrypted int64  `json:"encrypted"`
+	ID        string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketEncrypted(ctx context.Context, arg UpdateBucketEncryptedParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketEncrypted, arg.Encrypted, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketRetention = `-- name: UpdateBucketRetention :one
+UPDATE buckets SET worm = ?, retention_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketRetentionParams struct {
+	Worm             int64  `json:"worm"`
+	RetentionSeconds int64  `json:"retention_seconds"`
+	ID               string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketRetention(ctx context.Context, arg UpdateBucketRetentionParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketRetention, arg.Worm, arg.RetentionSeconds, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketScanUploads = `-- name: UpdateBucketScanUploads :one
+UPDATE buckets SET scan_uploads = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketScanUploadsParams struct {
+	ScanUploads int64  `json:"scan_uploads"`
+	ID          string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketScanUploads(ctx context.Context, arg UpdateBucketScanUploadsParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketScanUploads, arg.ScanUploads, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketSensitive = `-- name: UpdateBucketSensitive :one
+UPDATE buckets SET sensitive = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketSensitiveParams struct {
+	Sensitive int64  `json:"sensitive"`
+	ID        string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketSensitive(ctx context.Context, arg UpdateBucketSensitiveParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketSensitive, arg.Sensitive, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
+
+const updateBucketWebhooksSuspended = `-- name: UpdateBucketWebhooksSuspended :one
+UPDATE buckets SET webhooks_suspended = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?
+RETURNING id, name, client_id, is_public, created_at, updated_at, webhooks_suspended, sensitive, worm, retention_seconds, encrypted, scan_uploads, download_rate_limit, cache_control
+`
+
+type UpdateBucketWebhooksSuspendedParams struct {
+	WebhooksSuspended int64  `json:"webhooks_suspended"`
+	ID                string `json:"id"`
+}
+
+func (q *Queries) UpdateBucketWebhooksSuspended(ctx context.Context, arg UpdateBucketWebhooksSuspendedParams) (Bucket, error) {
+	row := q.db.QueryRowContext(ctx, updateBucketWebhooksSuspended, arg.WebhooksSuspended, arg.ID)
+	var i Bucket
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ClientID,
+		&i.IsPublic,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhooksSuspended,
+		&i.Sensitive,
+		&i.Worm,
+		&i.RetentionSeconds,
+		&i.Encrypted,
+		&i.ScanUploads,
+		&i.DownloadRateLimit,
+		&i.CacheControl,
+	)
+	return i, err
+}
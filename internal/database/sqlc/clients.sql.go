@@ -21,6 +21,17 @@ func (q *Queries) ClientExistsByAccessKey(ctx context.Context, accessKey string)
 	return client_exists, err
 }
 
+const countClients = `-- name: CountClients :one
+SELECT COUNT(*) AS count FROM clients
+`
+
+func (q *Queries) CountClients(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countClients)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createClient = `-- name: CreateClient :one
 INSERT INTO clients (id, name, access_key, secret_key, role)
 VALUES (?, ?, ?, ?, ?)
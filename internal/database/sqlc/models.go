@@ -8,13 +8,27 @@ import (
 	"database/sql"
 )
 
+type Blob struct {
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	RefCount int64  `json:"ref_count"`
+}
+
 type Bucket struct {
-	ID        string       `json:"id"`
-	Name      string       `json:"name"`
-	ClientID  string       `json:"client_id"`
-	IsPublic  int64        `json:"is_public"`
-	CreatedAt sql.NullTime `json:"created_at"`
-	UpdatedAt sql.NullTime `json:"updated_at"`
+	ID                string       `json:"id"`
+	Name              string       `json:"name"`
+	ClientID          string       `json:"client_id"`
+	IsPublic          int64        `json:"is_public"`
+	CreatedAt         sql.NullTime `json:"created_at"`
+	UpdatedAt         sql.NullTime `json:"updated_at"`
+	WebhooksSuspended int64        `json:"webhooks_suspended"`
+	Sensitive         int64        `json:"sensitive"`
+	Worm              int64        `json:"worm"`
+	RetentionSeconds  int64        `json:"retention_seconds"`
+	Encrypted         int64        `json:"encrypted"`
+	ScanUploads       int64        `json:"scan_uploads"`
+	DownloadRateLimit int64        `json:"download_rate_limit"`
+	CacheControl      string       `json:"cache_control"`
 }
 
 type Client struct {
@@ -29,13 +43,47 @@ type Client struct {
 }
 
 type Resource struct {
-	ID          string       `json:"id"`
-	BucketID    string       `json:"bucket_id"`
-	Hash        string       `json:"hash"`
-	Size        int64        `json:"size"`
-	ContentType string       `json:"content_type"`
-	Extension   string       `json:"extension"`
-	CreatedAt   sql.NullTime `json:"created_at"`
+	ID               string         `json:"id"`
+	BucketID         string         `json:"bucket_id"`
+	Hash             string         `json:"hash"`
+	Size             int64          `json:"size"`
+	ContentType      string         `json:"content_type"`
+	Extension        string         `json:"extension"`
+	CreatedAt        sql.NullTime   `json:"created_at"`
+	RetainUntil      sql.NullTime   `json:"retain_until"`
+	Encrypted        int64          `json:"encrypted"`
+	ProcessingStatus string         `json:"processing_status"`
+	ProcessingError  sql.NullString `json:"processing_error"`
+	OriginalName     string         `json:"original_name"`
+	DeletedAt        sql.NullTime   `json:"deleted_at"`
+	ChangedAt        sql.NullTime   `json:"changed_at"`
+	Revision         int64          `json:"revision"`
+}
+
+type ResourceChange struct {
+	Seq      int64  `json:"seq"`
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+type ResourceMetadatum struct {
+	ResourceID string `json:"resource_id"`
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+}
+
+type ResourceName struct {
+	ID        int64        `json:"id"`
+	BucketID  string       `json:"bucket_id"`
+	Name      string       `json:"name"`
+	Hash      string       `json:"hash"`
+	CreatedAt sql.NullTime `json:"created_at"`
+}
+
+type ResourceTombstone struct {
+	BucketID  string       `json:"bucket_id"`
+	Hash      string       `json:"hash"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
 }
 
 type SchemaMigration struct {
@@ -59,6 +107,10 @@ type WebhookEvent struct {
 	LastAttemptAt sql.NullTime   `json:"last_attempt_at"`
 	CreatedAt     sql.NullTime   `json:"created_at"`
 	CompletedAt   sql.NullTime   `json:"completed_at"`
+	ClaimedAt     sql.NullTime   `json:"claimed_at"`
+	PartitionKey  string         `json:"partition_key"`
+	RequestID     string         `json:"request_id"`
+	LatencyMs     int64          `json:"latency_ms"`
 }
 
 type WebhookHeader struct {
@@ -70,11 +122,18 @@ type WebhookHeader struct {
 }
 
 type WebhookUrl struct {
-	ID        string       `json:"id"`
-	BucketID  string       `json:"bucket_id"`
-	Url       string       `json:"url"`
-	EventType string       `json:"event_type"`
-	IsActive  int64        `json:"is_active"`
-	CreatedAt sql.NullTime `json:"created_at"`
-	UpdatedAt sql.NullTime `json:"updated_at"`
+	ID                   string       `json:"id"`
+	BucketID             string       `json:"bucket_id"`
+	Url                  string       `json:"url"`
+	EventType            string       `json:"event_type"`
+	IsActive             int64        `json:"is_active"`
+	CreatedAt            sql.NullTime `json:"created_at"`
+	UpdatedAt            sql.NullTime `json:"updated_at"`
+	CompressPayload      int64        `json:"compress_payload"`
+	PartitionKeyTemplate string       `json:"partition_key_template"`
+	PayloadVersion       int64        `json:"payload_version"`
+	ContentTypeFilter    string       `json:"content_type_filter"`
+	IncludeDownloadToken int64        `json:"include_download_token"`
+	MaxAttempts          int64        `json:"max_attempts"`
+	RetryBackoffSeconds  int64        `json:"retry_backoff_seconds"`
 }
@@ -7,21 +7,83 @@ package sqlc
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
+const applyResourceRetentionByBucketID = `-- name: ApplyResourceRetentionByBucketID :execrows
+UPDATE resources SET retain_until = ? WHERE bucket_id = ? AND retain_until IS NULL
+`
+
+type ApplyResourceRetentionByBucketIDParams struct {
+	RetainUntil sql.NullTime `json:"retain_until"`
+	BucketID    string       `json:"bucket_id"`
+}
+
+func (q *Queries) ApplyResourceRetentionByBucketID(ctx context.Context, arg ApplyResourceRetentionByBucketIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, applyResourceRetentionByBucketID, arg.RetainUntil, arg.BucketID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countResourcesByBucketID = `-- name: CountResourcesByBucketID :one
+SELECT COUNT(*) AS count FROM resources
+WHERE bucket_id = ?
+AND (CAST(? AS TEXT) = '' OR content_type LIKE ? ESCAPE '\\'
+    OR content_type LIKE ? || ';%' ESCAPE '\\')
+AND (CAST(? AS INTEGER) = 1 OR deleted_at IS NULL)
+`
+
+type CountResourcesByBucketIDParams struct {
+	BucketID           string `json:"bucket_id"`
+	ContentTypePattern string `json:"content_type_pattern"`
+	IncludeDeleted     int64  `json:"include_deleted"`
+}
+
+func (q *Queries) CountResourcesByBucketID(ctx context.Context, arg CountResourcesByBucketIDParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countResourcesByBucketID,
+		arg.BucketID,
+		arg.ContentTypePattern,
+		arg.ContentTypePattern,
+		arg.ContentTypePattern,
+		arg.IncludeDeleted,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRetainedResourcesByBucketID = `-- name: CountRetainedResourcesByBucketID :one
+SELECT COUNT(*) AS count FROM resources
+WHERE bucket_id = ? AND retain_until IS NOT NULL AND datetime(retain_until) > CURRENT_TIMESTAMP
+`
+
+func (q *Queries) CountRetainedResourcesByBucketID(ctx context.Context, bucketID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countRetainedResourcesByBucketID, bucketID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createResource = `-- name: CreateResource :one
-INSERT INTO resources (id, bucket_id, hash, size, content_type, extension)
-VALUES (?, ?, ?, ?, ?, ?)
-RETURNING id, bucket_id, hash, size, content_type, extension, created_at
+INSERT INTO resources (id, bucket_id, hash, size, content_type, extension, retain_until, encrypted, processing_status, original_name)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
 `
 
 type CreateResourceParams struct {
-	ID          string `json:"id"`
-	BucketID    string `json:"bucket_id"`
-	Hash        string `json:"hash"`
-	Size        int64  `json:"size"`
-	ContentType string `json:"content_type"`
-	Extension   string `json:"extension"`
+	ID               string       `json:"id"`
+	BucketID         string       `json:"bucket_id"`
+	Hash             string       `json:"hash"`
+	Size             int64        `json:"size"`
+	ContentType      string       `json:"content_type"`
+	Extension        string       `json:"extension"`
+	RetainUntil      sql.NullTime `json:"retain_until"`
+	Encrypted        int64        `json:"encrypted"`
+	ProcessingStatus string       `json:"processing_status"`
+	OriginalName     string       `json:"original_name"`
 }
 
 func (q *Queries) CreateResource(ctx context.Context, arg CreateResourceParams) (Resource, error) {
@@ -32,6 +94,10 @@ func (q *Queries) CreateResource(ctx context.Context, arg CreateResourceParams)
 		arg.Size,
 		arg.ContentType,
 		arg.Extension,
+		arg.RetainUntil,
+		arg.Encrypted,
+		arg.ProcessingStatus,
+		arg.OriginalName,
 	)
 	var i Resource
 	err := row.Scan(
@@ -42,6 +108,14 @@ func (q *Queries) CreateResource(ctx context.Context, arg CreateResourceParams)
 		&i.ContentType,
 		&i.Extension,
 		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
 	)
 	return i, err
 }
@@ -75,9 +149,82 @@ func (q *Queries) DeleteResourceByBucketAndHash(ctx context.Context, arg DeleteR
 	return result.RowsAffected()
 }
 
+const deleteResourceTombstone = `-- name: DeleteResourceTombstone :exec
+DELETE FROM resource_tombstones WHERE bucket_id = ? AND hash = ?
+`
+
+type DeleteResourceTombstoneParams struct {
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+func (q *Queries) DeleteResourceTombstone(ctx context.Context, arg DeleteResourceTombstoneParams) error {
+	_, err := q.db.ExecContext(ctx, deleteResourceTombstone, arg.BucketID, arg.Hash)
+	return err
+}
+
+const deleteUnretainedResourcesByBucketID = `-- name: DeleteUnretainedResourcesByBucketID :many
+DELETE FROM resources
+WHERE bucket_id = ? AND (retain_until IS NULL OR datetime(retain_until) <= CURRENT_TIMESTAMP)
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+`
+
+// Resources still under retention are left in place, so one retained since
+// the caller checked cannot be deleted
+func (q *Queries) DeleteUnretainedResourcesByBucketID(ctx context.Context, bucketID string) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUnretainedResourcesByBucketID, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestResourceChange = `-- name: GetLatestResourceChange :one
+SELECT CAST(COALESCE(MAX(seq), 0) AS INTEGER) AS seq FROM resource_changes WHERE bucket_id = ?
+`
+
+// The seq of the bucket's latest change, 0 when nothing has changed
+func (q *Queries) GetLatestResourceChange(ctx context.Context, bucketID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLatestResourceChange, bucketID)
+	var seq int64
+	err := row.Scan(&seq)
+	return seq, err
+}
+
 const getResourceByBucketAndHash = `-- name: GetResourceByBucketAndHash :one
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
-FROM resources WHERE bucket_id = ? AND hash = ?
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL
 `
 
 type GetResourceByBucketAndHashParams struct {
@@ -96,12 +243,20 @@ func (q *Queries) GetResourceByBucketAndHash(ctx context.Context, arg GetResourc
 		&i.ContentType,
 		&i.Extension,
 		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
 	)
 	return i, err
 }
 
 const getResourceByID = `-- name: GetResourceByID :one
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
 FROM resources WHERE id = ?
 `
 
@@ -116,13 +271,268 @@ func (q *Queries) GetResourceByID(ctx context.Context, id string) (Resource, err
 		&i.ContentType,
 		&i.Extension,
 		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
+	)
+	return i, err
+}
+
+const getResourceListVersion = `-- name: GetResourceListVersion :one
+SELECT COUNT(*) AS count,
+       CAST(COALESCE(SUM(deleted_at IS NOT NULL), 0) AS INTEGER) AS trashed,
+       CAST(COALESCE(MAX(created_at), '') AS TEXT) AS last_created,
+       CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size,
+       CAST(COALESCE(SUM(processing_status = 'pending'), 0) AS INTEGER) AS pending,
+       CAST(COALESCE(SUM(processing_status = 'processing'), 0) AS INTEGER) AS processing,
+       CAST(COALESCE(SUM(revision), 0) AS INTEGER) AS revisions
+FROM resources WHERE bucket_id = ?
+`
+
+type GetResourceListVersionRow struct {
+	Count       int64  `json:"count"`
+	Trashed     int64  `json:"trashed"`
+	LastCreated string `json:"last_created"`
+	TotalSize   int64  `json:"total_size"`
+	Pending     int64  `json:"pending"`
+	Processing  int64  `json:"processing"`
+	Revisions   int64  `json:"revisions"`
+}
+
+// Summarises a bucket's listing for its ETag: uploads, deletions, restores,
+// processing progress and content type corrections each change at least one
+// column
+func (q *Queries) GetResourceListVersion(ctx context.Context, bucketID string) (GetResourceListVersionRow, error) {
+	row := q.db.QueryRowContext(ctx, getResourceListVersion, bucketID)
+	var i GetResourceListVersionRow
+	err := row.Scan(
+		&i.Count,
+		&i.Trashed,
+		&i.LastCreated,
+		&i.TotalSize,
+		&i.Pending,
+		&i.Processing,
+		&i.Revisions,
+	)
+	return i, err
+}
+
+const getResourceTotalsByBucketID = `-- name: GetResourceTotalsByBucketID :one
+SELECT COUNT(*) AS count, CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size
+FROM resources WHERE bucket_id = ?
+`
+
+type GetResourceTotalsByBucketIDRow struct {
+	Count     int64 `json:"count"`
+	TotalSize int64 `json:"total_size"`
+}
+
+func (q *Queries) GetResourceTotalsByBucketID(ctx context.Context, bucketID string) (GetResourceTotalsByBucketIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getResourceTotalsByBucketID, bucketID)
+	var i GetResourceTotalsByBucketIDRow
+	err := row.Scan(&i.Count, &i.TotalSize)
+	return i, err
+}
+
+const getTrashedResourceByBucketAndHash = `-- name: GetTrashedResourceByBucketAndHash :one
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND hash = ? AND deleted_at IS NOT NULL
+`
+
+type GetTrashedResourceByBucketAndHashParams struct {
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+func (q *Queries) GetTrashedResourceByBucketAndHash(ctx context.Context, arg GetTrashedResourceByBucketAndHashParams) (Resource, error) {
+	row := q.db.QueryRowContext(ctx, getTrashedResourceByBucketAndHash, arg.BucketID, arg.Hash)
+	var i Resource
+	err := row.Scan(
+		&i.ID,
+		&i.BucketID,
+		&i.Hash,
+		&i.Size,
+		&i.ContentType,
+		&i.Extension,
+		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
 	)
 	return i, err
 }
 
+const listExpiredTrashedResources = `-- name: ListExpiredTrashedResources :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE deleted_at IS NOT NULL AND datetime(deleted_at) <= datetime(?)
+ORDER BY deleted_at LIMIT ?
+`
+
+type ListExpiredTrashedResourcesParams struct {
+	Cutoff time.Time `json:"cutoff"`
+	Limit  int64     `json:"limit"`
+}
+
+// Trashed resources deleted at or before the cutoff, oldest first
+func (q *Queries) ListExpiredTrashedResources(ctx context.Context, arg ListExpiredTrashedResourcesParams) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, listExpiredTrashedResources, arg.Cutoff, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentResourcesByBucketID = `-- name: ListRecentResourcesByBucketID :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND deleted_at IS NULL ORDER BY created_at DESC LIMIT ?
+`
+
+type ListRecentResourcesByBucketIDParams struct {
+	BucketID string `json:"bucket_id"`
+	Limit    int64  `json:"limit"`
+}
+
+func (q *Queries) ListRecentResourcesByBucketID(ctx context.Context, arg ListRecentResourcesByBucketIDParams) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentResourcesByBucketID, arg.BucketID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listResourceTombstonesAfter = `-- name: ListResourceTombstonesAfter :many
+SELECT t.bucket_id, t.hash, t.deleted_at, c.seq
+FROM resource_changes c
+JOIN resource_tombstones t ON t.bucket_id = c.bucket_id AND t.hash = c.hash
+WHERE c.bucket_id = ? AND c.seq > ?
+AND datetime(t.deleted_at) >= datetime(?)
+ORDER BY c.seq LIMIT ?
+`
+
+type ListResourceTombstonesAfterParams struct {
+	BucketID string    `json:"bucket_id"`
+	AfterSeq int64     `json:"after_seq"`
+	Since    time.Time `json:"since"`
+	Limit    int64     `json:"limit"`
+}
+
+type ListResourceTombstonesAfterRow struct {
+	BucketID  string       `json:"bucket_id"`
+	Hash      string       `json:"hash"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+	Seq       int64        `json:"seq"`
+}
+
+// Deletions for incremental sync, paged like ListResourcesChangedAfter
+func (q *Queries) ListResourceTombstonesAfter(ctx context.Context, arg ListResourceTombstonesAfterParams) ([]ListResourceTombstonesAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, listResourceTombstonesAfter,
+		arg.BucketID,
+		arg.AfterSeq,
+		arg.Since,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListResourceTombstonesAfterRow{}
+	for rows.Next() {
+		var i ListResourceTombstonesAfterRow
+		if err := rows.Scan(
+			&i.BucketID,
+			&i.Hash,
+			&i.DeletedAt,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listResourcesByBucketID = `-- name: ListResourcesByBucketID :many
-SELECT id, bucket_id, hash, size, content_type, extension, created_at
-FROM resources WHERE bucket_id = ? ORDER BY created_at DESC
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE bucket_id = ? AND deleted_at IS NULL ORDER BY created_at DESC
 `
 
 func (q *Queries) ListResourcesByBucketID(ctx context.Context, bucketID string) ([]Resource, error) {
@@ -142,6 +552,14 @@ func (q *Queries) ListResourcesByBucketID(ctx context.Context, bucketID string)
 			&i.ContentType,
 			&i.Extension,
 			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
 		); err != nil {
 			return nil, err
 		}
@@ -156,6 +574,297 @@ func (q *Queries) ListResourcesByBucketID(ctx context.Context, bucketID string)
 	return items, nil
 }
 
+const listResourcesByBucketIDPaged = `-- name: ListResourcesByBucketIDPaged :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE bucket_id = ?
+AND (CAST(? AS TEXT) = '' OR content_type LIKE ? ESCAPE '\\'
+    OR content_type LIKE ? || ';%' ESCAPE '\\')
+AND (CAST(? AS INTEGER) = 1 OR deleted_at IS NULL)
+ORDER BY
+    CASE WHEN CAST(? AS TEXT) = 'size' AND CAST(? AS INTEGER) = 0 THEN size END ASC,
+    CASE WHEN ? = 'size' AND ? = 1 THEN size END DESC,
+    CASE WHEN ? = 'created_at' AND ? = 0 THEN created_at END ASC,
+    CASE WHEN ? = 'created_at' AND ? = 1 THEN created_at END DESC,
+    CASE WHEN ? = 0 THEN id END ASC,
+    id DESC
+LIMIT ? OFFSET ?
+`
+
+type ListResourcesByBucketIDPagedParams struct {
+	BucketID           string `json:"bucket_id"`
+	ContentTypePattern string `json:"content_type_pattern"`
+	IncludeDeleted     int64  `json:"include_deleted"`
+	SortBy             string `json:"sort_by"`
+	Descending         int64  `json:"descending"`
+	Limit              int64  `json:"limit"`
+	Offset             int64  `json:"offset"`
+}
+
+// content_type_pattern is a LIKE pattern, empty for every type; the second
+// LIKE matches types stored with parameters ("text/plain; charset=utf-8").
+// sort_by is 'created_at' or 'size'; the CASEs keep the ordering
+// parameterised. id breaks ties, so pages neither repeat nor skip rows.
+// Trashed resources are only listed when include_deleted is 1.
+func (q *Queries) ListResourcesByBucketIDPaged(ctx context.Context, arg ListResourcesByBucketIDPagedParams) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, listResourcesByBucketIDPaged,
+		arg.BucketID,
+		arg.ContentTypePattern,
+		arg.ContentTypePattern,
+		arg.ContentTypePattern,
+		arg.IncludeDeleted,
+		arg.SortBy,
+		arg.Descending,
+		arg.SortBy,
+		arg.Descending,
+		arg.SortBy,
+		arg.Descending,
+		arg.SortBy,
+		arg.Descending,
+		arg.Descending,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listResourcesChangedAfter = `-- name: ListResourcesChangedAfter :many
+SELECT r.id, r.bucket_id, r.hash, r.size, r.content_type, r.extension, r.created_at, r.retain_until, r.encrypted, r.processing_status, r.processing_error, r.original_name, r.deleted_at, r.changed_at, r.revision, c.seq
+FROM resource_changes c
+JOIN resources r ON r.bucket_id = c.bucket_id AND r.hash = c.hash
+WHERE c.bucket_id = ? AND c.seq > ? AND r.deleted_at IS NULL
+AND datetime(COALESCE(r.changed_at, r.created_at)) >= datetime(?)
+ORDER BY c.seq LIMIT ?
+`
+
+type ListResourcesChangedAfterParams struct {
+	BucketID string    `json:"bucket_id"`
+	AfterSeq int64     `json:"after_seq"`
+	Since    time.Time `json:"since"`
+	Limit    int64     `json:"limit"`
+}
+
+type ListResourcesChangedAfterRow struct {
+	ID               string         `json:"id"`
+	BucketID         string         `json:"bucket_id"`
+	Hash             string         `json:"hash"`
+	Size             int64          `json:"size"`
+	ContentType      string         `json:"content_type"`
+	Extension        string         `json:"extension"`
+	CreatedAt        sql.NullTime   `json:"created_at"`
+	RetainUntil      sql.NullTime   `json:"retain_until"`
+	Encrypted        int64          `json:"encrypted"`
+	ProcessingStatus string         `json:"processing_status"`
+	ProcessingError  sql.NullString `json:"processing_error"`
+	OriginalName     string         `json:"original_name"`
+	DeletedAt        sql.NullTime   `json:"deleted_at"`
+	ChangedAt        sql.NullTime   `json:"changed_at"`
+	Revision         int64          `json:"revision"`
+	Seq              int64          `json:"seq"`
+}
+
+// Incremental sync page: live resources whose latest change comes after
+// after_seq, in change order. Only resources created or last changed at or
+// after since are listed; the zero time lists them all.
+func (q *Queries) ListResourcesChangedAfter(ctx context.Context, arg ListResourcesChangedAfterParams) ([]ListResourcesChangedAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, listResourcesChangedAfter,
+		arg.BucketID,
+		arg.AfterSeq,
+		arg.Since,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListResourcesChangedAfterRow{}
+	for rows.Next() {
+		var i ListResourcesChangedAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+			&i.Seq,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listResourcesCreatedAfter = `-- name: ListResourcesCreatedAfter :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources
+WHERE bucket_id = ? AND deleted_at IS NULL
+AND (datetime(created_at) > datetime(?)
+    OR (datetime(created_at) = datetime(?) AND id > ?))
+ORDER BY datetime(created_at), id LIMIT ?
+`
+
+type ListResourcesCreatedAfterParams struct {
+	BucketID string    `json:"bucket_id"`
+	After    time.Time `json:"after"`
+	AfterID  string    `json:"after_id"`
+	Limit    int64     `json:"limit"`
+}
+
+// Keyset page for incremental sync: rows after (after, after_id) in
+// (created_at, id) order. Timestamps are compared at second precision.
+func (q *Queries) ListResourcesCreatedAfter(ctx context.Context, arg ListResourcesCreatedAfterParams) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, listResourcesCreatedAfter,
+		arg.BucketID,
+		arg.After,
+		arg.After,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnprocessedResources = `-- name: ListUnprocessedResources :many
+SELECT id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+FROM resources WHERE processing_status IN ('pending', 'processing') AND deleted_at IS NULL ORDER BY created_at
+`
+
+func (q *Queries) ListUnprocessedResources(ctx context.Context) ([]Resource, error) {
+	rows, err := q.db.QueryContext(ctx, listUnprocessedResources)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Resource{}
+	for rows.Next() {
+		var i Resource
+		if err := rows.Scan(
+			&i.ID,
+			&i.BucketID,
+			&i.Hash,
+			&i.Size,
+			&i.ContentType,
+			&i.Extension,
+			&i.CreatedAt,
+			&i.RetainUntil,
+			&i.Encrypted,
+			&i.ProcessingStatus,
+			&i.ProcessingError,
+			&i.OriginalName,
+			&i.DeletedAt,
+			&i.ChangedAt,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeTrashedResource = `-- name: PurgeTrashedResource :execrows
+DELETE FROM resources WHERE id = ? AND deleted_at IS NOT NULL
+`
+
+// Only a row that is still trashed is purged, so a concurrent restore wins
+func (q *Queries) PurgeTrashedResource(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeTrashedResource, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const resourceExistsByBucketAndHash = `-- name: ResourceExistsByBucketAndHash :one
 SELECT EXISTS(SELECT 1 FROM resources WHERE bucket_id = ? AND hash = ?) AS resource_exists
 `
@@ -171,3 +880,145 @@ func (q *Queries) ResourceExistsByBucketAndHash(ctx context.Context, arg Resourc
 	err := row.Scan(&resource_exists)
 	return resource_exists, err
 }
+
+const restoreResource = `-- name: RestoreResource :one
+UPDATE resources SET deleted_at = NULL, changed_at = CURRENT_TIMESTAMP
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NOT NULL
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+`
+
+type RestoreResourceParams struct {
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+func (q *Queries) RestoreResource(ctx context.Context, arg RestoreResourceParams) (Resource, error) {
+	row := q.db.QueryRowContext(ctx, restoreResource, arg.BucketID, arg.Hash)
+	var i Resource
+	err := row.Scan(
+		&i.ID,
+		&i.BucketID,
+		&i.Hash,
+		&i.Size,
+		&i.ContentType,
+		&i.Extension,
+		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
+	)
+	return i, err
+}
+
+const sumEncryptedResourceSizesByBucketID = `-- name: SumEncryptedResourceSizesByBucketID :one
+SELECT CAST(COALESCE(SUM(size), 0) AS INTEGER) AS total_size FROM resources WHERE bucket_id = ? AND encrypted = 1
+`
+
+// Bytes freed with a bucket right away. Its other content is shared, and
+// freed once the blobs it leaves unreferenced are collected.
+func (q *Queries) SumEncryptedResourceSizesByBucketID(ctx context.Context, bucketID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, sumEncryptedResourceSizesByBucketID, bucketID)
+	var total_size int64
+	err := row.Scan(&total_size)
+	return total_size, err
+}
+
+const trashResource = `-- name: TrashResource :execrows
+UPDATE resources SET deleted_at = CURRENT_TIMESTAMP
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL
+`
+
+type TrashResourceParams struct {
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+func (q *Queries) TrashResource(ctx context.Context, arg TrashResourceParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, trashResource, arg.BucketID, arg.Hash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateResourceContentType = `-- name: UpdateResourceContentType :one
+UPDATE resources SET content_type = ?, changed_at = CURRENT_TIMESTAMP, revision = revision + 1
+WHERE bucket_id = ? AND hash = ? AND deleted_at IS NULL
+RETURNING id, bucket_id, hash, size, content_type, extension, created_at, retain_until, encrypted, processing_status, processing_error, original_name, deleted_at, changed_at, revision
+`
+
+type UpdateResourceContentTypeParams struct {
+	ContentType string `json:"content_type"`
+	BucketID    string `json:"bucket_id"`
+	Hash        string `json:"hash"`
+}
+
+func (q *Queries) UpdateResourceContentType(ctx context.Context, arg UpdateResourceContentTypeParams) (Resource, error) {
+	row := q.db.QueryRowContext(ctx, updateResourceContentType, arg.ContentType, arg.BucketID, arg.Hash)
+	var i Resource
+	err := row.Scan(
+		&i.ID,
+		&i.BucketID,
+		&i.Hash,
+		&i.Size,
+		&i.ContentType,
+		&i.Extension,
+		&i.CreatedAt,
+		&i.RetainUntil,
+		&i.Encrypted,
+		&i.ProcessingStatus,
+		&i.ProcessingError,
+		&i.OriginalName,
+		&i.DeletedAt,
+		&i.ChangedAt,
+		&i.Revision,
+	)
+	return i, err
+}
+
+const updateResourceProcessingStatus = `-- name: UpdateResourceProcessingStatus :execrows
+UPDATE resources SET processing_status = ?, processing_error = ?
+WHERE id = ? AND processing_status = ?
+`
+
+type UpdateResourceProcessingStatusParams struct {
+	Status     string         `json:"status"`
+	Error      sql.NullString `json:"error"`
+	ID         string         `json:"id"`
+	FromStatus string         `json:"from_status"`
+}
+
+// Moves a resource between processing states. The update only applies while
+// the resource is still in from_status, so a transition is taken at most once.
+func (q *Queries) UpdateResourceProcessingStatus(ctx context.Context, arg UpdateResourceProcessingStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateResourceProcessingStatus,
+		arg.Status,
+		arg.Error,
+		arg.ID,
+		arg.FromStatus,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertResourceTombstone = `-- name: UpsertResourceTombstone :exec
+INSERT INTO resource_tombstones (bucket_id, hash) VALUES (?, ?)
+ON CONFLICT(bucket_id, hash) DO UPDATE SET deleted_at = CURRENT_TIMESTAMP
+`
+
+type UpsertResourceTombstoneParams struct {
+	BucketID string `json:"bucket_id"`
+	Hash     string `json:"hash"`
+}
+
+func (q *Queries) UpsertResourceTombstone(ctx context.Context, arg UpsertResourceTombstoneParams) error {
+	_, err := q.db.ExecContext(ctx, upsertResourceTombstone, arg.BucketID, arg.Hash)
+	return err
+}
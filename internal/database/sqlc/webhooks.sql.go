@@ -8,8 +8,110 @@ package sqlc
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
+const claimPendingWebhookEvents = `-- name: ClaimPendingWebhookEvents :many
+UPDATE webhook_events
+SET status = 'processing', claimed_at = ?
+WHERE id IN (
+    SELECT id FROM webhook_events
+    WHERE (status = 'pending'
+        OR (status = 'retrying' AND next_retry_at <= ?)
+        OR (status = 'processing' AND claimed_at <= ?))
+    AND attempts < max_attempts
+    ORDER BY created_at ASC LIMIT ?
+)
+RETURNING id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
+          response_code, response_body, attempts, max_attempts, next_retry_at,
+          last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
+`
+
+type ClaimPendingWebhookEventsParams struct {
+	ClaimedAt   time.Time `json:"claimed_at"`
+	StaleBefore time.Time `json:"stale_before"`
+	BatchSize   int64     `json:"batch_size"`
+}
+
+// Claims due events in one statement, so concurrent workers never get the same
+// row. Events stuck in processing since before stale_before are claimed again.
+func (q *Queries) ClaimPendingWebhookEvents(ctx context.Context, arg ClaimPendingWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingWebhookEvents,
+		arg.ClaimedAt,
+		arg.ClaimedAt,
+		arg.StaleBefore,
+		arg.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookEvent{}
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookUrlID,
+			&i.BucketID,
+			&i.ResourceID,
+			&i.EventType,
+			&i.Status,
+			&i.Payload,
+			&i.ResponseCode,
+			&i.ResponseBody,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.NextRetryAt,
+			&i.LastAttemptAt,
+			&i.CreatedAt,
+			&i.CompletedAt,
+			&i.ClaimedAt,
+			&i.PartitionKey,
+			&i.RequestID,
+			&i.LatencyMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimWebhookEvent = `-- name: ClaimWebhookEvent :execrows
+UPDATE webhook_events SET status = 'processing', claimed_at = ? WHERE id = ? AND status = 'pending'
+`
+
+type ClaimWebhookEventParams struct {
+	ClaimedAt time.Time `json:"claimed_at"`
+	ID        string    `json:"id"`
+}
+
+func (q *Queries) ClaimWebhookEvent(ctx context.Context, arg ClaimWebhookEventParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimWebhookEvent, arg.ClaimedAt, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countPendingWebhookEvents = `-- name: CountPendingWebhookEvents :one
+SELECT COUNT(*) AS count FROM webhook_events WHERE status IN ('pending', 'retrying')
+`
+
+// Events still waiting for a delivery attempt, the backlog WEBHOOK_MAX_PENDING caps
+func (q *Queries) CountPendingWebhookEvents(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingWebhookEvents)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countWebhookEventsByBucketID = `-- name: CountWebhookEventsByBucketID :one
 SELECT COUNT(*) AS count FROM webhook_events WHERE bucket_id = ?
 `
@@ -21,12 +123,23 @@ func (q *Queries) CountWebhookEventsByBucketID(ctx context.Context, bucketID str
 	return count, err
 }
 
+const countWebhookURLsByBucketID = `-- name: CountWebhookURLsByBucketID :one
+SELECT COUNT(*) AS count FROM webhook_urls WHERE bucket_id = ?
+`
+
+func (q *Queries) CountWebhookURLsByBucketID(ctx context.Context, bucketID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countWebhookURLsByBucketID, bucketID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createWebhookEvent = `-- name: CreateWebhookEvent :one
-INSERT INTO webhook_events (id, webhook_url_id, bucket_id, resource_id, event_type, status, payload, max_attempts)
-VALUES (?, ?, ?, ?, ?, 'pending', ?, ?)
+INSERT INTO webhook_events (id, webhook_url_id, bucket_id, resource_id, event_type, status, payload, max_attempts, partition_key, request_id)
+VALUES (?, ?, ?, ?, ?, 'pending', ?, ?, ?, ?)
 RETURNING id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
           response_code, response_body, attempts, max_attempts, next_retry_at,
-          last_attempt_at, created_at, completed_at
+          last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 `
 
 type CreateWebhookEventParams struct {
@@ -37,6 +150,8 @@ type CreateWebhookEventParams struct {
 	EventType    string `json:"event_type"`
 	Payload      string `json:"payload"`
 	MaxAttempts  int64  `json:"max_attempts"`
+	PartitionKey string `json:"partition_key"`
+	RequestID    string `json:"request_id"`
 }
 
 func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (WebhookEvent, error) {
@@ -48,6 +163,8 @@ func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEvent
 		arg.EventType,
 		arg.Payload,
 		arg.MaxAttempts,
+		arg.PartitionKey,
+		arg.RequestID,
 	)
 	var i WebhookEvent
 	err := row.Scan(
@@ -66,6 +183,10 @@ func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEvent
 		&i.LastAttemptAt,
 		&i.CreatedAt,
 		&i.CompletedAt,
+		&i.ClaimedAt,
+		&i.PartitionKey,
+		&i.RequestID,
+		&i.LatencyMs,
 	)
 	return i, err
 }
@@ -102,17 +223,24 @@ func (q *Queries) CreateWebhookHeader(ctx context.Context, arg CreateWebhookHead
 }
 
 const createWebhookURL = `-- name: CreateWebhookURL :one
-INSERT INTO webhook_urls (id, bucket_id, url, event_type, is_active)
-VALUES (?, ?, ?, ?, ?)
-RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at
+INSERT INTO webhook_urls (id, bucket_id, url, event_type, is_active, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 `
 
 type CreateWebhookURLParams struct {
-	ID        string `json:"id"`
-	BucketID  string `json:"bucket_id"`
-	Url       string `json:"url"`
-	EventType string `json:"event_type"`
-	IsActive  int64  `json:"is_active"`
+	ID                   string `json:"id"`
+	BucketID             string `json:"bucket_id"`
+	Url                  string `json:"url"`
+	EventType            string `json:"event_type"`
+	IsActive             int64  `json:"is_active"`
+	CompressPayload      int64  `json:"compress_payload"`
+	PartitionKeyTemplate string `json:"partition_key_template"`
+	PayloadVersion       int64  `json:"payload_version"`
+	ContentTypeFilter    string `json:"content_type_filter"`
+	IncludeDownloadToken int64  `json:"include_download_token"`
+	MaxAttempts          int64  `json:"max_attempts"`
+	RetryBackoffSeconds  int64  `json:"retry_backoff_seconds"`
 }
 
 func (q *Queries) CreateWebhookURL(ctx context.Context, arg CreateWebhookURLParams) (WebhookUrl, error) {
@@ -122,6 +250,13 @@ func (q *Queries) CreateWebhookURL(ctx context.Context, arg CreateWebhookURLPara
 		arg.Url,
 		arg.EventType,
 		arg.IsActive,
+		arg.CompressPayload,
+		arg.PartitionKeyTemplate,
+		arg.PayloadVersion,
+		arg.ContentTypeFilter,
+		arg.IncludeDownloadToken,
+		arg.MaxAttempts,
+		arg.RetryBackoffSeconds,
 	)
 	var i WebhookUrl
 	err := row.Scan(
@@ -132,6 +267,13 @@ func (q *Queries) CreateWebhookURL(ctx context.Context, arg CreateWebhookURLPara
 		&i.IsActive,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CompressPayload,
+		&i.PartitionKeyTemplate,
+		&i.PayloadVersion,
+		&i.ContentTypeFilter,
+		&i.IncludeDownloadToken,
+		&i.MaxAttempts,
+		&i.RetryBackoffSeconds,
 	)
 	return i, err
 }
@@ -172,11 +314,49 @@ func (q *Queries) DeleteWebhookURL(ctx context.Context, id string) (int64, error
 	return result.RowsAffected()
 }
 
+const getWebhookDeliveryStats = `-- name: GetWebhookDeliveryStats :one
+SELECT COUNT(*) AS events,
+       CAST(COALESCE(SUM(attempts), 0) AS INTEGER) AS attempts,
+       CAST(COALESCE(SUM(CASE WHEN status = 'success' THEN 1 ELSE 0 END), 0) AS INTEGER) AS successes,
+       CAST(COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) AS INTEGER) AS failed_events,
+       CAST(COALESCE(SUM(latency_ms), 0) AS INTEGER) AS latency_ms
+FROM webhook_events
+WHERE webhook_url_id = ? AND datetime(created_at) >= datetime(?)
+`
+
+type GetWebhookDeliveryStatsParams struct {
+	WebhookUrlID string    `json:"webhook_url_id"`
+	Since        time.Time `json:"since"`
+}
+
+type GetWebhookDeliveryStatsRow struct {
+	Events       int64 `json:"events"`
+	Attempts     int64 `json:"attempts"`
+	Successes    int64 `json:"successes"`
+	FailedEvents int64 `json:"failed_events"`
+	LatencyMs    int64 `json:"latency_ms"`
+}
+
+// An event succeeds on its last attempt at most, so the failed attempts are
+// the attempts minus the successful events
+func (q *Queries) GetWebhookDeliveryStats(ctx context.Context, arg GetWebhookDeliveryStatsParams) (GetWebhookDeliveryStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDeliveryStats, arg.WebhookUrlID, arg.Since)
+	var i GetWebhookDeliveryStatsRow
+	err := row.Scan(
+		&i.Events,
+		&i.Attempts,
+		&i.Successes,
+		&i.FailedEvents,
+		&i.LatencyMs,
+	)
+	return i, err
+}
+
 const getWebhookEventByID = `-- name: GetWebhookEventByID :one
 
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events WHERE id = ?
 `
 
@@ -200,6 +380,10 @@ func (q *Queries) GetWebhookEventByID(ctx context.Context, id string) (WebhookEv
 		&i.LastAttemptAt,
 		&i.CreatedAt,
 		&i.CompletedAt,
+		&i.ClaimedAt,
+		&i.PartitionKey,
+		&i.RequestID,
+		&i.LatencyMs,
 	)
 	return i, err
 }
@@ -226,7 +410,7 @@ func (q *Queries) GetWebhookHeaderByID(ctx context.Context, id string) (WebhookH
 
 const getWebhookURLByID = `-- name: GetWebhookURLByID :one
 
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE id = ?
 `
 
@@ -242,12 +426,19 @@ func (q *Queries) GetWebhookURLByID(ctx context.Context, id string) (WebhookUrl,
 		&i.IsActive,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CompressPayload,
+		&i.PartitionKeyTemplate,
+		&i.PayloadVersion,
+		&i.ContentTypeFilter,
+		&i.IncludeDownloadToken,
+		&i.MaxAttempts,
+		&i.RetryBackoffSeconds,
 	)
 	return i, err
 }
 
 const listActiveWebhookURLsByBucketAndEvent = `-- name: ListActiveWebhookURLsByBucketAndEvent :many
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE bucket_id = ? AND event_type = ? AND is_active = 1
 `
 
@@ -273,6 +464,13 @@ func (q *Queries) ListActiveWebhookURLsByBucketAndEvent(ctx context.Context, arg
 			&i.IsActive,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CompressPayload,
+			&i.PartitionKeyTemplate,
+			&i.PayloadVersion,
+			&i.ContentTypeFilter,
+			&i.IncludeDownloadToken,
+			&i.MaxAttempts,
+			&i.RetryBackoffSeconds,
 		); err != nil {
 			return nil, err
 		}
@@ -290,7 +488,7 @@ func (q *Queries) ListActiveWebhookURLsByBucketAndEvent(ctx context.Context, arg
 const listPendingWebhookEvents = `-- name: ListPendingWebhookEvents :many
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events
 WHERE (status = 'pending' OR (status = 'retrying' AND next_retry_at <= CURRENT_TIMESTAMP))
 AND attempts < max_attempts
@@ -322,6 +520,10 @@ func (q *Queries) ListPendingWebhookEvents(ctx context.Context, limit int64) ([]
 			&i.LastAttemptAt,
 			&i.CreatedAt,
 			&i.CompletedAt,
+			&i.ClaimedAt,
+			&i.PartitionKey,
+			&i.RequestID,
+			&i.LatencyMs,
 		); err != nil {
 			return nil, err
 		}
@@ -339,7 +541,7 @@ func (q *Queries) ListPendingWebhookEvents(ctx context.Context, limit int64) ([]
 const listWebhookEventsByBucketID = `-- name: ListWebhookEventsByBucketID :many
 SELECT id, webhook_url_id, bucket_id, resource_id, event_type, status, payload,
        response_code, response_body, attempts, max_attempts, next_retry_at,
-       last_attempt_at, created_at, completed_at
+       last_attempt_at, created_at, completed_at, claimed_at, partition_key, request_id, latency_ms
 FROM webhook_events WHERE bucket_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?
 `
 
@@ -374,6 +576,10 @@ func (q *Queries) ListWebhookEventsByBucketID(ctx context.Context, arg ListWebho
 			&i.LastAttemptAt,
 			&i.CreatedAt,
 			&i.CompletedAt,
+			&i.ClaimedAt,
+			&i.PartitionKey,
+			&i.RequestID,
+			&i.LatencyMs,
 		); err != nil {
 			return nil, err
 		}
@@ -423,7 +629,7 @@ func (q *Queries) ListWebhookHeadersByURLID(ctx context.Context, webhookUrlID st
 }
 
 const listWebhookURLsByBucketID = `-- name: ListWebhookURLsByBucketID :many
-SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at
+SELECT id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 FROM webhook_urls WHERE bucket_id = ? ORDER BY created_at DESC
 `
 
@@ -444,6 +650,13 @@ func (q *Queries) ListWebhookURLsByBucketID(ctx context.Context, bucketID string
 			&i.IsActive,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CompressPayload,
+			&i.PartitionKeyTemplate,
+			&i.PayloadVersion,
+			&i.ContentTypeFilter,
+			&i.IncludeDownloadToken,
+			&i.MaxAttempts,
+			&i.RetryBackoffSeconds,
 		); err != nil {
 			return nil, err
 		}
@@ -461,7 +674,7 @@ func (q *Queries) ListWebhookURLsByBucketID(ctx context.Context, bucketID string
 const updateWebhookEventStatus = `-- name: UpdateWebhookEventStatus :exec
 UPDATE webhook_events
 SET status = ?, response_code = ?, response_body = ?, attempts = attempts + 1,
-    last_attempt_at = CURRENT_TIMESTAMP, next_retry_at = ?, completed_at = ?
+    latency_ms = latency_ms + ?, last_attempt_at = CURRENT_TIMESTAMP, next_retry_at = ?, completed_at = ?
 WHERE id = ?
 `
 
@@ -469,6 +682,7 @@ type UpdateWebhookEventStatusParams struct {
 	Status       string         `json:"status"`
 	ResponseCode sql.NullInt64  `json:"response_code"`
 	ResponseBody sql.NullString `json:"response_body"`
+	LatencyMs    int64          `json:"latency_ms"`
 	NextRetryAt  sql.NullTime   `json:"next_retry_at"`
 	CompletedAt  sql.NullTime   `json:"completed_at"`
 	ID           string         `json:"id"`
@@ -479,6 +693,7 @@ func (q *Queries) UpdateWebhookEventStatus(ctx context.Context, arg UpdateWebhoo
 		arg.Status,
 		arg.ResponseCode,
 		arg.ResponseBody,
+		arg.LatencyMs,
 		arg.NextRetryAt,
 		arg.CompletedAt,
 		arg.ID,
@@ -511,16 +726,23 @@ func (q *Queries) UpdateWebhookHeader(ctx context.Context, arg UpdateWebhookHead
 
 const updateWebhookURL = `-- name: UpdateWebhookURL :one
 UPDATE webhook_urls
-SET url = ?, event_type = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP
+SET url = ?, event_type = ?, is_active = ?, compress_payload = ?, partition_key_template = ?, payload_version = ?, content_type_filter = ?, include_download_token = ?, max_attempts = ?, retry_backoff_seconds = ?, updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at
+RETURNING id, bucket_id, url, event_type, is_active, created_at, updated_at, compress_payload, partition_key_template, payload_version, content_type_filter, include_download_token, max_attempts, retry_backoff_seconds
 `
 
 type UpdateWebhookURLParams struct {
-	Url       string `json:"url"`
-	EventType string `json:"event_type"`
-	IsActive  int64  `json:"is_active"`
-	ID        string `json:"id"`
+	Url                  string `json:"url"`
+	EventType            string `json:"event_type"`
+	IsActive             int64  `json:"is_active"`
+	CompressPayload      int64  `json:"compress_payload"`
+	PartitionKeyTemplate string `json:"partition_key_template"`
+	PayloadVersion       int64  `json:"payload_version"`
+	ContentTypeFilter    string `json:"content_type_filter"`
+	IncludeDownloadToken int64  `json:"include_download_token"`
+	MaxAttempts          int64  `json:"max_attempts"`
+	RetryBackoffSeconds  int64  `json:"retry_backoff_seconds"`
+	ID                   string `json:"id"`
 }
 
 func (q *Queries) UpdateWebhookURL(ctx context.Context, arg UpdateWebhookURLParams) (WebhookUrl, error) {
@@ -528,6 +750,13 @@ func (q *Queries) UpdateWebhookURL(ctx context.Context, arg UpdateWebhookURLPara
 		arg.Url,
 		arg.EventType,
 		arg.IsActive,
+		arg.CompressPayload,
+		arg.PartitionKeyTemplate,
+		arg.PayloadVersion,
+		arg.ContentTypeFilter,
+		arg.IncludeDownloadToken,
+		arg.MaxAttempts,
+		arg.RetryBackoffSeconds,
 		arg.ID,
 	)
 	var i WebhookUrl
@@ -539,6 +768,13 @@ func (q *Queries) UpdateWebhookURL(ctx context.Context, arg UpdateWebhookURLPara
 		&i.IsActive,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CompressPayload,
+		&i.PartitionKeyTemplate,
+		&i.PayloadVersion,
+		&i.ContentTypeFilter,
+		&i.IncludeDownloadToken,
+		&i.MaxAttempts,
+		&i.RetryBackoffSeconds,
 	)
 	return i, err
 }
@@ -0,0 +1,291 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrInvalidKey = errors.New("encryption key must be 32 bytes, hex or base64 encoded")
+	ErrCorrupt    = errors.New("encrypted blob is corrupt or was written with another key")
+
+	// ErrUnavailable is returned when an encrypted bucket or blob is used but
+	// the server has no STORAGE_ENCRYPTION_KEY
+	ErrUnavailable = errors.New("encryption at rest is not configured on this server")
+)
+
+// Blob format:
+//
+//	magic (8) | key nonce (12) | data key sealed with the master key (48) | segments
+//
+// Each blob gets a random data key. The plaintext is split into segments of
+// segmentSize bytes, each sealed with AES-GCM under a nonce made of the segment
+// index and a final-segment flag, so segments can be decrypted independently
+// (for Range requests) and truncation or reordering is detected.
+const (
+	magic       = "AOUIENC1"
+	keySize     = 32
+	nonceSize   = 12
+	tagSize     = 16
+	segmentSize = 64 << 10
+
+	wrappedKeySize = keySize + tagSize
+	headerSize     = len(magic) + nonceSize + wrappedKeySize
+	sealedSegment  = segmentSize + tagSize
+)
+
+// Cipher encrypts blobs at rest with AES-256-GCM under a master key
+type Cipher struct {
+	master cipher.AEAD
+}
+
+// ParseKey decodes a 32-byte master key given as hex or standard base64
+func ParseKey(s string) ([]byte, error) {
+	if key, err := hex.DecodeString(s); err == nil && len(key) == keySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == keySize {
+		return key, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+func New(key []byte) (*Cipher, error) {
+	if len(key) != keySize {
+		return nil, ErrInvalidKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{master: aead}, nil
+}
+
+// Encrypt reads src to EOF and writes it to dst as an encrypted blob
+func (c *Cipher) Encrypt(dst io.Writer, src io.Reader) error {
+	dataKey := make([]byte, keySize)
+	keyNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	if _, err := rand.Read(keyNonce); err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, keyNonce...)
+	header = c.master.Seal(header, keyNonce, dataKey, []byte(magic))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, segmentSize)
+	next := make([]byte, segmentSize)
+	sealed := make([]byte, 0, sealedSegment)
+
+	n, err := readSegment(src, buf)
+	if err != nil {
+		return err
+	}
+	for index := uint64(0); ; index++ {
+		// A full segment is only final if nothing follows it
+		final := n < segmentSize
+		var m int
+		if !final {
+			if m, err = readSegment(src, next); err != nil {
+				return err
+			}
+			final = m == 0
+		}
+
+		sealed = aead.Seal(sealed[:0], segmentNonce(index, final), buf[:n], nil)
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+		buf, next, n = next, buf, m
+	}
+}
+
+// PlaintextSize returns the decrypted size of a blob of the given size
+func PlaintextSize(blobSize int64) (int64, error) {
+	body := blobSize - int64(headerSize)
+	if body < tagSize {
+		return 0, ErrCorrupt
+	}
+	full, rest := body/sealedSegment, body%sealedSegment
+	if rest == 0 {
+		return full * segmentSize, nil
+	}
+	if rest < tagSize {
+		return 0, ErrCorrupt
+	}
+	return full*segmentSize + rest - tagSize, nil
+}
+
+// Reader decrypts a blob on demand. It implements io.ReadSeeker so encrypted
+// resources keep Range support; only the segments that are read are decrypted.
+type Reader struct {
+	src      io.ReaderAt
+	closer   io.Closer
+	aead     cipher.AEAD
+	size     int64
+	segments int64
+	offset   int64
+
+	loaded  int64
+	plain   []byte
+	scratch []byte
+}
+
+// NewReader opens a blob of blobSize bytes read from src. If src is an
+// io.Closer, closing the Reader closes it.
+func (c *Cipher) NewReader(src io.ReaderAt, blobSize int64) (*Reader, error) {
+	size, err := PlaintextSize(blobSize)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read blob header: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrCorrupt
+	}
+	keyNonce := header[len(magic) : len(magic)+nonceSize]
+	dataKey, err := c.master.Open(nil, keyNonce, header[len(magic)+nonceSize:], []byte(magic))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := (size + segmentSize - 1) / segmentSize
+	if segments == 0 {
+		segments = 1
+	}
+
+	r := &Reader{
+		src:      src,
+		aead:     aead,
+		size:     size,
+		segments: segments,
+		loaded:   -1,
+		scratch:  make([]byte, sealedSegment),
+	}
+	if closer, ok := src.(io.Closer); ok {
+		r.closer = closer
+	}
+	return r, nil
+}
+
+// Size is the plaintext size of the blob
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	index := r.offset / segmentSize
+	if err := r.load(index); err != nil {
+		return 0, err
+	}
+
+	n := copy(p, r.plain[r.offset-index*segmentSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("encryption: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("encryption: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// load decrypts segment index into r.plain unless it is already there
+func (r *Reader) load(index int64) error {
+	if index == r.loaded {
+		return nil
+	}
+
+	length := min(segmentSize, r.size-index*segmentSize) + tagSize
+	sealed := r.scratch[:length]
+	if _, err := r.src.ReadAt(sealed, int64(headerSize)+index*sealedSegment); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	plain, err := r.aead.Open(r.plain[:0], segmentNonce(uint64(index), index == r.segments-1), sealed, nil)
+	if err != nil {
+		r.loaded = -1
+		return ErrCorrupt
+	}
+	r.plain = plain
+	r.loaded = index
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(index uint64, final bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce, index)
+	if final {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+// readSegment fills buf as far as src allows and returns how much was read
+func readSegment(src io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(src, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, nil
+	}
+	return n, err
+}
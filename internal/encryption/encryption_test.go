@@ -0,0 +1,148 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+
+	c, err := New(bytes.Repeat([]byte{7}, keySize))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+// plaintext is size bytes that differ from segment to segment, so a
+// misplaced segment cannot decrypt to the right bytes by chance
+func plaintext(size int) []byte {
+	p := make([]byte, size)
+	for i := range p {
+		p[i] = byte(i*31 + i/segmentSize)
+	}
+	return p
+}
+
+func encrypt(t *testing.T, c *Cipher, plain []byte) []byte {
+	t.Helper()
+
+	var blob bytes.Buffer
+	if err := c.Encrypt(&blob, bytes.NewReader(plain)); err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	return blob.Bytes()
+}
+
+// decrypt reads a whole blob back
+func decrypt(c *Cipher, blob []byte) ([]byte, error) {
+	r, err := c.NewReader(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 5} {
+		plain := plaintext(size)
+		blob := encrypt(t, c, plain)
+
+		if got, err := PlaintextSize(int64(len(blob))); err != nil || got != int64(size) {
+			t.Errorf("size %d: PlaintextSize() = %d, %v, want %d", size, got, err, size)
+		}
+		got, err := decrypt(c, blob)
+		if err != nil {
+			t.Errorf("size %d: decrypt error = %v", size, err)
+			continue
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted %d bytes that differ from the plaintext", size, len(got))
+		}
+	}
+}
+
+func TestTamperedBlob(t *testing.T) {
+	c := newTestCipher(t)
+	blob := encrypt(t, c, plaintext(3*segmentSize))
+	segment := func(i int) []byte {
+		start := headerSize + i*sealedSegment
+		return blob[start : start+sealedSegment]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name string
+		blob []byte
+	}{
+		// The last segment left is not sealed as the final one
+		{"truncated at a segment boundary", blob[:headerSize+2*sealedSegment]},
+		{"truncated inside a segment", blob[:len(blob)-100]},
+		{"truncated inside a tag", blob[:headerSize+2*sealedSegment+tagSize/2]},
+		{"segments reordered", join(blob[:headerSize], segment(1), segment(0), segment(2))},
+		// The final segment is followed by another one
+		{"segment appended", join(blob, segment(1))},
+		{"flipped bit", join(blob[:headerSize+10], []byte{blob[headerSize+10] ^ 1}, blob[headerSize+11:])},
+		{"key nonce replaced", join(blob[:len(magic)], bytes.Repeat([]byte{0}, nonceSize), blob[len(magic)+nonceSize:])},
+	}
+	for _, tt := range tests {
+		if _, err := decrypt(c, tt.blob); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: decrypt error = %v, want ErrCorrupt", tt.name, err)
+		}
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	c := newTestCipher(t)
+	plain := plaintext(2*segmentSize + 100)
+	blob := encrypt(t, c, plain)
+	r, err := c.NewReader(bytes.NewReader(blob), int64(len(blob)))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		length int
+		start  int64
+	}{
+		{"across the first boundary", segmentSize - 10, io.SeekStart, 20, segmentSize - 10},
+		{"across both boundaries", 5, io.SeekStart, segmentSize + 10, 5},
+		{"back into the first segment", -segmentSize, io.SeekCurrent, 30, 15},
+		{"tail from the end", -150, io.SeekEnd, 150, 2*segmentSize - 50},
+		{"start of the last segment", 2 * segmentSize, io.SeekStart, 100, 2 * segmentSize},
+	}
+	for _, tt := range tests {
+		pos, err := r.Seek(tt.offset, tt.whence)
+		if err != nil || pos != tt.start {
+			t.Errorf("%s: Seek() = %d, %v, want %d", tt.name, pos, err, tt.start)
+			continue
+		}
+		got := make([]byte, tt.length)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Errorf("%s: read error = %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, plain[tt.start:tt.start+int64(tt.length)]) {
+			t.Errorf("%s: read bytes that differ from plaintext[%d:%d]", tt.name, tt.start, tt.start+int64(tt.length))
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read() at the end = %d, %v, want 0, EOF", n, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek() to a negative position succeeded")
+	}
+}
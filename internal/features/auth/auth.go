@@ -1,11 +1,15 @@
 package auth
 
 import (
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/cache"
 	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/controller"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,9 +18,23 @@ type Feature struct {
 	Service    service.AuthService
 }
 
-func New(db *database.Database, jwtSecret string) *Feature {
+// New wires the auth feature. Sessions are kept in Redis when rdb is set,
+// otherwise in memory. previousSecrets are still accepted when validating
+// tokens, so JWT_SECRET can be rotated without logging everyone out.
+// leeway tolerates clock skew with other services issuing tokens.
+// maxClients caps the clients admins can create; 0 means unlimited.
+// lockout locks access keys after repeated failed logins (nil disables it),
+// and notifier is told of each lockout; it may be nil. registration enables
+// POST /auth/register.
+func New(db *database.Database, jwtSecret string, previousSecrets []string, leeway time.Duration, rdb *cache.Redis, maxClients int, lockout *service.LoginLimiter, notifier service.LockoutNotifier, registration service.Registration) *Feature {
+	var sessions service.SessionStore = service.NewMemorySessionStore()
+	if rdb != nil {
+		sessions = service.NewRedisSessionStore(rdb.Client)
+	}
+
 	repo := repository.New(db.Queries)
-	svc := service.New(repo, jwtSecret)
+	clientCap := quota.New("client", int64(maxClients), db.Queries.CountClients)
+	svc := service.New(repo, jwtSecret, previousSecrets, leeway, sessions, clientCap, lockout, notifier, registration)
 	ctrl := controller.New(svc)
 
 	return &Feature{
@@ -25,8 +43,8 @@ func New(db *database.Database, jwtSecret string) *Feature {
 	}
 }
 
-func (f *Feature) RegisterRoutes(e *echo.Echo) {
-	authMiddleware := middleware.Auth(f.Service)
+func (f *Feature) RegisterRoutes(g *echo.Group, tokenSource middleware.TokenSource) {
+	authMiddleware := middleware.Auth(f.Service, tokenSource)
 	adminMiddleware := middleware.RequireAdmin(f.Service)
-	f.Controller.RegisterRoutes(e, authMiddleware, adminMiddleware)
+	f.Controller.RegisterRoutes(g, authMiddleware, adminMiddleware)
 }
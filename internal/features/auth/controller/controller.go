@@ -2,10 +2,15 @@ package controller
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
 	"github.com/aouiniamine/aoui-drive/pkg/response"
 	"github.com/labstack/echo/v4"
 )
@@ -18,17 +23,22 @@ func New(svc service.AuthService) *AuthController {
 	return &AuthController{service: svc}
 }
 
-func (c *AuthController) RegisterRoutes(e *echo.Echo, authMiddleware, adminMiddleware echo.MiddlewareFunc) {
-	e.POST("/auth/login", c.Login)
+func (c *AuthController) RegisterRoutes(g *echo.Group, authMiddleware, adminMiddleware echo.MiddlewareFunc) {
+	g.POST("/auth/login", c.Login)
+	g.POST("/auth/register", c.Register)
 
-	admin := e.Group("/admin", authMiddleware, adminMiddleware)
+	sessions := g.Group("/auth/sessions", authMiddleware)
+	sessions.GET("", c.ListSessions)
+	sessions.DELETE("/:jti", c.RevokeSession)
+
+	admin := g.Group("/admin", authMiddleware, adminMiddleware)
 	admin.POST("/clients", c.CreateClient)
 	admin.POST("/clients/:id/regenerate-secret", c.RegenerateSecret)
 }
 
 // Login godoc
 // @Summary Authenticate client
-// @Description Login with access key and secret key to get JWT token
+// @Description Login with access key and secret key to get JWT token. With LOGIN_LOCKOUT_THRESHOLD set, an access key is refused with 429 for LOGIN_LOCKOUT_WINDOW after that many failed logins within the window.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -37,6 +47,7 @@ func (c *AuthController) RegisterRoutes(e *echo.Echo, authMiddleware, adminMiddl
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 403 {object} response.Response
+// @Failure 429 {object} response.Response
 // @Router /auth/login [post]
 func (c *AuthController) Login(ctx echo.Context) error {
 	var req dto.LoginRequest
@@ -48,11 +59,24 @@ func (c *AuthController) Login(ctx echo.Context) error {
 		return response.BadRequest(ctx, "access_key and secret_key are required")
 	}
 
-	token, err := c.service.Login(ctx.Request().Context(), req)
+	token, err := c.service.Login(ctx.Request().Context(), req, dto.SessionSource{
+		IP:        ctx.RealIP(),
+		UserAgent: audit.Truncate(ctx.Request().UserAgent()),
+		Via:       "api",
+	})
 	if err != nil {
+		audit.Event(audit.LoginFailed,
+			"access_key", audit.Truncate(req.AccessKey),
+			"ip", ctx.RealIP(),
+			"via", "api",
+			"reason", err.Error(),
+		)
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			return response.Unauthorized(ctx, "invalid credentials")
 		}
+		if errors.Is(err, service.ErrLoginLocked) {
+			return response.TooManyRequests(ctx, err.Error())
+		}
 		if errors.Is(err, service.ErrClientInactive) {
 			return response.Forbidden(ctx, "client is inactive")
 		}
@@ -62,9 +86,127 @@ func (c *AuthController) Login(ctx echo.Context) error {
 	return response.Success(ctx, token)
 }
 
+// maxRegisterNameLen bounds the client name a public caller may choose
+const maxRegisterNameLen = 100
+
+// Register godoc
+// @Summary Register a client
+// @Description Create a client without an admin and return its credentials, for open or demo deployments. Disabled unless ALLOW_SELF_REGISTRATION is set; until then it returns 404. Registered clients get REGISTRATION_ROLE (USER by default). When REGISTRATION_INVITE_CODE is set, invite_code must match it or the request is refused with 403. Each IP may attempt REGISTRATION_RATE_LIMIT registrations per REGISTRATION_RATE_WINDOW; further attempts get 429. MAX_CLIENTS applies (403).
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.RegisterRequest true "Client name and invite code"
+// @Success 201 {object} response.Response{data=dto.ClientResponse}
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /auth/register [post]
+func (c *AuthController) Register(ctx echo.Context) error {
+	var req dto.RegisterRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return response.BadRequest(ctx, "name is required")
+	}
+	if len(req.Name) > maxRegisterNameLen {
+		return response.BadRequest(ctx, fmt.Sprintf("name must be at most %d characters", maxRegisterNameLen))
+	}
+
+	client, err := c.service.Register(ctx.Request().Context(), req, ctx.RealIP())
+	if err != nil {
+		if errors.Is(err, service.ErrRegistrationDisabled) {
+			return response.NotFound(ctx, err.Error())
+		}
+		if errors.Is(err, service.ErrInvalidInviteCode) || errors.Is(err, service.ErrRegistrationLimited) {
+			audit.Event(audit.RegistrationFailed,
+				"ip", ctx.RealIP(),
+				"reason", err.Error(),
+			)
+		}
+		if errors.Is(err, service.ErrInvalidInviteCode) {
+			return response.Forbidden(ctx, err.Error())
+		}
+		if errors.Is(err, service.ErrRegistrationLimited) {
+			return response.TooManyRequests(ctx, err.Error())
+		}
+		if errors.Is(err, repository.ErrClientExists) {
+			return response.Conflict(ctx, "client already exists")
+		}
+		var limitErr *quota.LimitError
+		if errors.As(err, &limitErr) {
+			return response.Forbidden(ctx, limitErr.Error())
+		}
+		return response.InternalError(ctx, "failed to register client")
+	}
+
+	audit.Event(audit.ClientRegistered,
+		"ip", ctx.RealIP(),
+		"client_id", client.ID,
+		"role", string(client.Role),
+	)
+
+	return response.Created(ctx, client)
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the authenticated client's unexpired tokens with their issue time and approximate source (IP, user agent, api or ui). The session making the request is marked current.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=dto.SessionListResponse}
+// @Failure 401 {object} response.Response
+// @Router /auth/sessions [get]
+func (c *AuthController) ListSessions(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+
+	sessions, err := c.service.ListSessions(ctx.Request().Context(), clientID, middleware.GetSessionID(ctx))
+	if err != nil {
+		return response.InternalError(ctx, "failed to list sessions")
+	}
+
+	return response.Success(ctx, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Invalidate one of the authenticated client's tokens before it expires
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param jti path string true "Session ID (token jti)"
+// @Success 204
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /auth/sessions/{jti} [delete]
+func (c *AuthController) RevokeSession(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	sessionID := ctx.Param("jti")
+
+	if err := c.service.RevokeSession(ctx.Request().Context(), clientID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return response.NotFound(ctx, "session not found")
+		}
+		return response.InternalError(ctx, "failed to revoke session")
+	}
+
+	audit.Event(audit.SessionRevoked,
+		"client_id", clientID,
+		"session_id", sessionID,
+		"ip", ctx.RealIP(),
+	)
+
+	return response.NoContent(ctx)
+}
+
 // CreateClient godoc
 // @Summary Create a new client
-// @Description Create a new client with access credentials (Admin only)
+// @Description Create a new client with access credentials (Admin only). Returns 403 once MAX_CLIENTS clients exist.
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -74,6 +216,7 @@ func (c *AuthController) Login(ctx echo.Context) error {
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 403 {object} response.Response
+// @Failure 409 {object} response.Response
 // @Router /admin/clients [post]
 func (c *AuthController) CreateClient(ctx echo.Context) error {
 	var req dto.CreateClientRequest
@@ -96,11 +239,22 @@ func (c *AuthController) CreateClient(ctx echo.Context) error {
 	client, err := c.service.CreateClient(ctx.Request().Context(), req)
 	if err != nil {
 		if errors.Is(err, repository.ErrClientExists) {
-			return response.BadRequest(ctx, "client already exists")
+			return response.Conflict(ctx, "client already exists")
+		}
+		var limitErr *quota.LimitError
+		if errors.As(err, &limitErr) {
+			return response.Forbidden(ctx, limitErr.Error())
 		}
 		return response.InternalError(ctx, "failed to create client")
 	}
 
+	audit.Event(audit.ClientCreated,
+		"actor", middleware.GetClientID(ctx),
+		"ip", ctx.RealIP(),
+		"client_id", client.ID,
+		"role", string(client.Role),
+	)
+
 	return response.Created(ctx, client)
 }
 
@@ -128,5 +282,11 @@ func (c *AuthController) RegenerateSecret(ctx echo.Context) error {
 		return response.InternalError(ctx, "failed to regenerate secret")
 	}
 
+	audit.Event(audit.ClientSecretRotated,
+		"actor", middleware.GetClientID(ctx),
+		"ip", ctx.RealIP(),
+		"client_id", id,
+	)
+
 	return response.Success(ctx, secret)
 }
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/service"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/labstack/echo/v4"
+)
+
+func newRegisterServer(t *testing.T, registration service.Registration) (*echo.Echo, *database.Database) {
+	t.Helper()
+	return newRegisterServerWithCap(t, registration, 0)
+}
+
+// newRegisterServerWithCap is newRegisterServer with at most maxClients
+// clients; 0 is unlimited
+func newRegisterServerWithCap(t *testing.T, registration service.Registration, maxClients int64) (*echo.Echo, *database.Database) {
+	t.Helper()
+
+	db := dbtest.New(t)
+	clientCap := quota.New("client", maxClients, db.Queries.CountClients)
+	svc := service.New(repository.New(db.Queries), "secret", nil, 0, service.NewMemorySessionStore(), clientCap, nil, nil, registration)
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	pass := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	New(svc).RegisterRoutes(e.Group(""), pass, pass)
+	return e, db
+}
+
+func register(e *echo.Echo, ip, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func countClients(t *testing.T, db *database.Database) int64 {
+	t.Helper()
+	n, err := db.Queries.CountClients(t.Context())
+	if err != nil {
+		t.Fatalf("count clients: %v", err)
+	}
+	return n
+}
+
+func TestRegisterDisabled(t *testing.T) {
+	e, db := newRegisterServer(t, service.Registration{})
+
+	rec := register(e, "192.0.2.1", `{"name": "demo"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if n := countClients(t, db); n != 0 {
+		t.Errorf("%d clients created, want 0", n)
+	}
+}
+
+func TestRegisterEnabled(t *testing.T) {
+	e, db := newRegisterServer(t, service.Registration{Enabled: true, Role: dto.RoleUser})
+
+	rec := register(e, "192.0.2.1", `{"name": "demo"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var resp struct {
+		Data dto.ClientResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Data.AccessKey == "" || resp.Data.SecretKey == "" {
+		t.Errorf("credentials missing from %s", rec.Body)
+	}
+	if resp.Data.Role != dto.RoleUser {
+		t.Errorf("role = %s, want %s", resp.Data.Role, dto.RoleUser)
+	}
+	if n := countClients(t, db); n != 1 {
+		t.Errorf("%d clients created, want 1", n)
+	}
+}
+
+func TestRegisterInviteCode(t *testing.T) {
+	e, db := newRegisterServer(t, service.Registration{Enabled: true, Role: dto.RoleUser, InviteCode: "let-me-in"})
+
+	for _, body := range []string{`{"name": "demo"}`, `{"name": "demo", "invite_code": "guess"}`} {
+		if rec := register(e, "192.0.2.1", body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, http.StatusForbidden)
+		}
+	}
+	if rec := register(e, "192.0.2.1", `{"name": "demo", "invite_code": "let-me-in"}`); rec.Code != http.StatusCreated {
+		t.Errorf("with the invite code: status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if n := countClients(t, db); n != 1 {
+		t.Errorf("%d clients created, want 1", n)
+	}
+}
+
+func TestRegisterRateLimit(t *testing.T) {
+	e, _ := newRegisterServer(t, service.Registration{
+		Enabled: true,
+		Role:    dto.RoleUser,
+		Limiter: service.NewRegistrationLimiter(1, time.Hour),
+	})
+
+	if rec := register(e, "192.0.2.1", `{"name": "first"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("first registration: status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if rec := register(e, "192.0.2.1", `{"name": "second"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second registration from the same IP: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := register(e, "192.0.2.2", `{"name": "other"}`); rec.Code != http.StatusCreated {
+		t.Errorf("registration from another IP: status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+}
+
+func TestRegisterClientLimit(t *testing.T) {
+	e, db := newRegisterServerWithCap(t, service.Registration{Enabled: true, Role: dto.RoleUser}, 2)
+
+	for _, name := range []string{"first", "second"} {
+		if rec := register(e, "192.0.2.1", `{"name": "`+name+`"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("%s registration: status = %d, want %d", name, rec.Code, http.StatusCreated)
+		}
+	}
+	rec := register(e, "192.0.2.1", `{"name": "third"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("registration at the limit: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(rec.Body.String(), "client limit of 2 reached") {
+		t.Errorf("body = %s, want the limit error", rec.Body)
+	}
+	if n := countClients(t, db); n != 2 {
+		t.Errorf("%d clients created, want 2", n)
+	}
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type Role string
 
 const (
@@ -15,11 +17,25 @@ type LoginRequest struct {
 	SecretKey string `json:"secret_key"`
 }
 
+// SessionSource records where a login came from, shown when listing sessions
+type SessionSource struct {
+	IP        string
+	UserAgent string
+	Via       string
+}
+
 type CreateClientRequest struct {
 	Name string `json:"name"`
 	Role Role   `json:"role"`
 }
 
+// RegisterRequest creates a client through self-registration. InviteCode is
+// required when the server sets REGISTRATION_INVITE_CODE.
+type RegisterRequest struct {
+	Name       string `json:"name"`
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
 // Responses
 
 type TokenResponse struct {
@@ -38,3 +54,17 @@ type ClientResponse struct {
 type SecretResponse struct {
 	SecretKey string `json:"secret_key"`
 }
+
+type SessionResponse struct {
+	ID        string    `json:"jti"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Via       string    `json:"via,omitempty"`
+	Current   bool      `json:"current"`
+}
+
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 
+	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 )
 
@@ -69,6 +70,10 @@ func (r *clientRepository) Create(ctx context.Context, params sqlc.CreateClientP
 
 	client, err := r.queries.CreateClient(ctx, params)
 	if err != nil {
+		// Created concurrently since the check above
+		if database.IsUniqueViolation(err) {
+			return nil, ErrClientExists
+		}
 		return nil, err
 	}
 	return &client, nil
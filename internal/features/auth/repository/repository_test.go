@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+func TestCreateConcurrentSameAccessKey(t *testing.T) {
+	db := dbtest.New(t)
+	repo := New(db.Queries)
+
+	const attempts = 8
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.Create(context.Background(), sqlc.CreateClientParams{
+				ID:        fmt.Sprintf("client-%d", i),
+				Name:      "ci",
+				AccessKey: "shared-key",
+				SecretKey: "secret",
+				Role:      "USER",
+			})
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrClientExists):
+			t.Errorf("Create() error = %v, want nil or ErrClientExists", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created %d clients, want 1", created)
+	}
+}
+
+func TestCreateLosesRace(t *testing.T) {
+	db := dbtest.New(t)
+	ctx := context.Background()
+	params := sqlc.CreateClientParams{ID: "client-1", Name: "ci", AccessKey: "shared-key", SecretKey: "secret", Role: "USER"}
+
+	if _, err := New(db.Queries).Create(ctx, params); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The second request checked before the first inserted, so only the
+	// insert's unique constraint can tell it the access key is taken
+	repo := New(dbtest.StaleCheck(db, "ClientExistsByAccessKey"))
+	params.ID = "client-2"
+	if _, err := repo.Create(ctx, params); !errors.Is(err, ErrClientExists) {
+		t.Fatalf("Create() error = %v, want ErrClientExists", err)
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxTrackedKeys bounds the failure table; once reached, entries whose window
+// has passed are dropped before a new key is added
+const maxTrackedKeys = 10000
+
+// LockoutNotifier is told when an access key gets locked, e.g. to alert ops
+// of a possible brute-force attack
+type LockoutNotifier interface {
+	NotifyLockout(ctx context.Context, accessKey, ip string, attempts int)
+}
+
+// LoginLimiter locks an access key for window after threshold failed logins
+// within window. State is in memory, so each instance counts on its own and
+// locks are lost on restart. A nil *LoginLimiter never locks.
+type LoginLimiter struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	failures  map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	since       time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter returns nil, disabling lockouts, when threshold or window
+// is not positive
+func NewLoginLimiter(threshold int, window time.Duration) *LoginLimiter {
+	if threshold <= 0 || window <= 0 {
+		return nil
+	}
+	return &LoginLimiter{
+		threshold: threshold,
+		window:    window,
+		failures:  make(map[string]*loginFailures),
+	}
+}
+
+// Locked reports whether accessKey is currently locked
+func (l *LoginLimiter) Locked(accessKey string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[accessKey]
+	return ok && time.Now().Before(f.lockedUntil)
+}
+
+// Fail records a failed login. It returns the failures counted in the
+// current window, and whether this failure locked the key.
+func (l *LoginLimiter) Fail(accessKey string) (attempts int, locked bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	f, ok := l.failures[accessKey]
+	if !ok || now.Sub(f.since) > l.window {
+		if !ok && len(l.failures) >= maxTrackedKeys {
+			l.purge(now)
+		}
+		f = &loginFailures{since: now}
+		l.failures[accessKey] = f
+	}
+
+	f.count++
+	if f.count < l.threshold {
+		return f.count, false
+	}
+
+	attempts = f.count
+	f.count, f.since, f.lockedUntil = 0, now, now.Add(l.window)
+	return attempts, true
+}
+
+// Reset forgets the failures of accessKey after a successful login
+func (l *LoginLimiter) Reset(accessKey string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, accessKey)
+}
+
+// purge drops keys that are neither locked nor failing within the window
+func (l *LoginLimiter) purge(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.since) > l.window && now.After(f.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterLocksAtThreshold(t *testing.T) {
+	l := NewLoginLimiter(3, time.Minute)
+
+	for want := 1; want <= 2; want++ {
+		attempts, locked := l.Fail("key")
+		if attempts != want || locked {
+			t.Fatalf("failure %d: Fail() = %d, %v, want %d, false", want, attempts, locked, want)
+		}
+		if l.Locked("key") {
+			t.Fatalf("locked after %d failures", want)
+		}
+	}
+
+	if attempts, locked := l.Fail("key"); attempts != 3 || !locked {
+		t.Fatalf("failure 3: Fail() = %d, %v, want 3, true", attempts, locked)
+	}
+	if !l.Locked("key") {
+		t.Error("not locked after 3 failures")
+	}
+	if l.Locked("other") {
+		t.Error("another key is locked")
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	l := NewLoginLimiter(2, time.Minute)
+
+	l.Fail("key")
+	l.Reset("key")
+	if _, locked := l.Fail("key"); locked {
+		t.Error("locked by a failure counted before Reset")
+	}
+}
+
+func TestNilLoginLimiter(t *testing.T) {
+	var l *LoginLimiter
+	if NewLoginLimiter(0, time.Minute) != nil || NewLoginLimiter(3, 0) != nil {
+		t.Fatal("NewLoginLimiter() without a threshold and window should disable lockouts")
+	}
+	for range 10 {
+		if _, locked := l.Fail("key"); locked {
+			t.Fatal("nil limiter locked a key")
+		}
+	}
+	if l.Locked("key") {
+		t.Error("nil limiter reports a lock")
+	}
+}
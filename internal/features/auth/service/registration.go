@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+)
+
+var (
+	ErrRegistrationDisabled = errors.New("self-registration is disabled")
+	ErrInvalidInviteCode    = errors.New("invalid invite code")
+	ErrRegistrationLimited  = errors.New("too many registrations, try again later")
+	ErrInvalidRegisterRole  = errors.New("invalid registration role")
+)
+
+// Registration configures self-registration through POST /auth/register.
+// The zero value disables it.
+type Registration struct {
+	Enabled bool
+	// InviteCode, when set, must be sent with every registration
+	InviteCode string
+	// Role is given to every registered client
+	Role dto.Role
+	// Limiter caps registrations per IP; nil is unlimited
+	Limiter *RegistrationLimiter
+}
+
+// ParseRegistrationRole validates the role given to registered clients.
+// ADMIN is refused so self-registration can never hand out admin rights.
+func ParseRegistrationRole(value string) (dto.Role, error) {
+	switch role := dto.Role(strings.ToUpper(value)); role {
+	case dto.RoleUser, dto.RoleManager:
+		return role, nil
+	}
+	return "", fmt.Errorf("%w: %q (expected USER or MANAGER)", ErrInvalidRegisterRole, value)
+}
+
+// Register creates a client for an anonymous caller, as CreateClient does
+// for admins, and returns its credentials. ip is the caller's address for
+// rate limiting. Every attempt counts against the limit, including ones with
+// a wrong invite code, so codes cannot be guessed quickly.
+func (s *authService) Register(ctx context.Context, req dto.RegisterRequest, ip string) (*dto.ClientResponse, error) {
+	if !s.registration.Enabled {
+		return nil, ErrRegistrationDisabled
+	}
+	if !s.registration.Limiter.Allow(ip) {
+		return nil, ErrRegistrationLimited
+	}
+	if s.registration.InviteCode != "" &&
+		subtle.ConstantTimeCompare([]byte(req.InviteCode), []byte(s.registration.InviteCode)) != 1 {
+		return nil, ErrInvalidInviteCode
+	}
+
+	return s.CreateClient(ctx, dto.CreateClientRequest{Name: req.Name, Role: s.registration.Role})
+}
+
+// RegistrationLimiter allows each IP a fixed number of registrations per
+// window. State is in memory, so each instance counts on its own. A nil
+// *RegistrationLimiter allows everything.
+type RegistrationLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	counts map[string]*registrations
+}
+
+type registrations struct {
+	count int
+	since time.Time
+}
+
+// NewRegistrationLimiter returns nil, disabling the limit, when limit or
+// window is not positive
+func NewRegistrationLimiter(limit int, window time.Duration) *RegistrationLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &RegistrationLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]*registrations),
+	}
+}
+
+// Allow counts an attempt from ip and reports whether it is within the limit
+func (l *RegistrationLimiter) Allow(ip string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	r, ok := l.counts[ip]
+	if !ok || now.Sub(r.since) > l.window {
+		if !ok && len(l.counts) >= maxTrackedKeys {
+			for key, r := range l.counts {
+				if now.Sub(r.since) > l.window {
+					delete(l.counts, key)
+				}
+			}
+		}
+		r = &registrations{since: now}
+		l.counts[ip] = r
+	}
+
+	r.count++
+	return r.count <= l.limit
+}
@@ -5,11 +5,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"sort"
 	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -19,6 +22,7 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrClientInactive     = errors.New("client is inactive")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrLoginLocked        = errors.New("too many failed logins, try again later")
 )
 
 type Claims struct {
@@ -27,29 +31,68 @@ type Claims struct {
 }
 
 type AuthService interface {
-	Login(ctx context.Context, req dto.LoginRequest) (*dto.TokenResponse, error)
-	ValidateToken(tokenString string) (*Claims, error)
+	Login(ctx context.Context, req dto.LoginRequest, source dto.SessionSource) (*dto.TokenResponse, error)
+	ValidateToken(ctx context.Context, tokenString string) (*Claims, error)
+	ListSessions(ctx context.Context, clientID, currentID string) (*dto.SessionListResponse, error)
+	RevokeSession(ctx context.Context, clientID, id string) error
 	GetClientByID(ctx context.Context, id string) (*sqlc.Client, error)
 	CreateClient(ctx context.Context, req dto.CreateClientRequest) (*dto.ClientResponse, error)
 	RegenerateSecret(ctx context.Context, id string) (*dto.SecretResponse, error)
+	// Register creates a client through self-registration, when enabled
+	Register(ctx context.Context, req dto.RegisterRequest, ip string) (*dto.ClientResponse, error)
 }
 
 type authService struct {
-	repo      repository.ClientRepository
-	jwtSecret []byte
+	repo     repository.ClientRepository
+	sessions SessionStore
+	// jwtSecrets holds the signing secret first, then previous secrets that
+	// are still accepted for verification while a rotation is under way
+	jwtSecrets [][]byte
+	// parser tolerates clock skew between the issuer and this server
+	parser    *jwt.Parser
+	clientCap *quota.Cap
+	// lockout is nil when lockouts are disabled; notifier may be nil
+	lockout      *LoginLimiter
+	notifier     LockoutNotifier
+	registration Registration
 }
 
-func New(repo repository.ClientRepository, jwtSecret string) AuthService {
+// New creates the auth service. Tokens are signed with jwtSecret; tokens
+// signed with any of previousSecrets keep validating until they expire.
+// leeway is the clock skew allowed when checking exp, nbf and iat.
+// clientCap bounds the number of clients; nil means unlimited. lockout locks
+// access keys after repeated failed logins and notifier, if set, is told of
+// each lockout; a nil lockout disables both. registration configures
+// POST /auth/register; its zero value disables it.
+func New(repo repository.ClientRepository, jwtSecret string, previousSecrets []string, leeway time.Duration, sessions SessionStore, clientCap *quota.Cap, lockout *LoginLimiter, notifier LockoutNotifier, registration Registration) AuthService {
+	secrets := [][]byte{[]byte(jwtSecret)}
+	for _, secret := range previousSecrets {
+		secrets = append(secrets, []byte(secret))
+	}
+
 	return &authService{
-		repo:      repo,
-		jwtSecret: []byte(jwtSecret),
+		repo:         repo,
+		sessions:     sessions,
+		jwtSecrets:   secrets,
+		parser:       jwt.NewParser(jwt.WithLeeway(leeway), jwt.WithIssuedAt()),
+		clientCap:    clientCap,
+		lockout:      lockout,
+		notifier:     notifier,
+		registration: registration,
 	}
 }
 
-func (s *authService) Login(ctx context.Context, req dto.LoginRequest) (*dto.TokenResponse, error) {
+func (s *authService) Login(ctx context.Context, req dto.LoginRequest, source dto.SessionSource) (*dto.TokenResponse, error) {
+	// Locked keys are refused before the secret is checked, so guessing
+	// cannot continue while the lock lasts
+	if s.lockout.Locked(req.AccessKey) {
+		return nil, ErrLoginLocked
+	}
+
 	client, err := s.repo.GetByAccessKey(ctx, req.AccessKey)
 	if err != nil {
 		if errors.Is(err, repository.ErrClientNotFound) {
+			s.loginFailed(ctx, req.AccessKey, source)
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
@@ -60,28 +103,114 @@ func (s *authService) Login(ctx context.Context, req dto.LoginRequest) (*dto.Tok
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretKey), []byte(req.SecretKey)); err != nil {
+		s.loginFailed(ctx, req.AccessKey, source)
 		return nil, ErrInvalidCredentials
 	}
 
-	return s.generateToken(client.ID)
+	s.lockout.Reset(req.AccessKey)
+	return s.generateToken(ctx, client.ID, source)
 }
 
-func (s *authService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return s.jwtSecret, nil
-	})
+// loginFailed counts a failed login. Only the failure that locks the key is
+// audited and sent to the notifier; earlier ones are not.
+func (s *authService) loginFailed(ctx context.Context, accessKey string, source dto.SessionSource) {
+	attempts, locked := s.lockout.Fail(accessKey)
+	if !locked {
+		return
+	}
+
+	audit.Event(audit.LoginLocked,
+		"access_key", audit.Truncate(accessKey),
+		"ip", source.IP,
+		"via", source.Via,
+		"attempts", attempts,
+	)
+
+	if s.notifier != nil {
+		// Delivery must not slow down the login response
+		go s.notifier.NotifyLockout(context.WithoutCancel(ctx), accessKey, source.IP, attempts)
+	}
+}
+
+// ValidateToken checks the signature and expiry, then rejects revoked sessions.
+// Tokens issued before sessions were tracked have no jti and can't be revoked.
+func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.parseToken(tokenString)
 	if err != nil {
-		return nil, ErrInvalidToken
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		return nil, ErrInvalidToken
+	if claims.ID != "" {
+		revoked, err := s.sessions.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
 	}
 
 	return claims, nil
 }
 
+// parseToken verifies tokenString against the signing secret, then against
+// each previous secret. Any failure other than a signature mismatch, such as
+// expiry or an issue time further in the future than the leeway, is final.
+func (s *authService) parseToken(tokenString string) (*Claims, error) {
+	for _, secret := range s.jwtSecrets {
+		token, err := s.parser.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+			return secret, nil
+		})
+		if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			continue
+		}
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+
+		claims, ok := token.Claims.(*Claims)
+		if !ok || !token.Valid {
+			return nil, ErrInvalidToken
+		}
+		return claims, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// ListSessions returns the client's unexpired sessions, newest first.
+// currentID marks the session making the request.
+func (s *authService) ListSessions(ctx context.Context, clientID, currentID string) (*dto.SessionListResponse, error) {
+	sessions, err := s.sessions.List(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].IssuedAt.After(sessions[j].IssuedAt)
+	})
+
+	resp := &dto.SessionListResponse{
+		Sessions: make([]dto.SessionResponse, len(sessions)),
+	}
+	for i, session := range sessions {
+		resp.Sessions[i] = dto.SessionResponse{
+			ID:        session.ID,
+			IssuedAt:  session.IssuedAt,
+			ExpiresAt: session.ExpiresAt,
+			IP:        session.IP,
+			UserAgent: session.UserAgent,
+			Via:       session.Via,
+			Current:   session.ID == currentID,
+		}
+	}
+	return resp, nil
+}
+
+// RevokeSession invalidates one of the client's tokens before it expires
+func (s *authService) RevokeSession(ctx context.Context, clientID, id string) error {
+	return s.sessions.Revoke(ctx, clientID, id)
+}
+
 func (s *authService) GetClientByID(ctx context.Context, id string) (*sqlc.Client, error) {
 	return s.repo.GetByID(ctx, id)
 }
@@ -95,12 +224,16 @@ func (s *authService) CreateClient(ctx context.Context, req dto.CreateClientRequ
 		return nil, err
 	}
 
-	client, err := s.repo.Create(ctx, sqlc.CreateClientParams{
-		ID:        uuid.New().String(),
-		Name:      req.Name,
-		AccessKey: accessKey,
-		SecretKey: string(hashedSecret),
-		Role:      string(req.Role),
+	var client *sqlc.Client
+	err = s.clientCap.Create(ctx, func() error {
+		client, err = s.repo.Create(ctx, sqlc.CreateClientParams{
+			ID:        uuid.New().String(),
+			Name:      req.Name,
+			AccessKey: accessKey,
+			SecretKey: string(hashedSecret),
+			Role:      string(req.Role),
+		})
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -130,22 +263,37 @@ func (s *authService) RegenerateSecret(ctx context.Context, id string) (*dto.Sec
 	return &dto.SecretResponse{SecretKey: secretKey}, nil
 }
 
-func (s *authService) generateToken(clientID string) (*dto.TokenResponse, error) {
-	expiry := time.Now().Add(24 * time.Hour)
+func (s *authService) generateToken(ctx context.Context, clientID string, source dto.SessionSource) (*dto.TokenResponse, error) {
+	now := time.Now()
+	expiry := now.Add(24 * time.Hour)
 	claims := &Claims{
 		ClientID: clientID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expiry),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtSecret)
+	tokenString, err := token.SignedString(s.jwtSecrets[0])
 	if err != nil {
 		return nil, err
 	}
 
+	// An untracked token couldn't be revoked, so fail the login instead
+	if err := s.sessions.Save(ctx, Session{
+		ID:        claims.ID,
+		ClientID:  clientID,
+		IssuedAt:  now.UTC(),
+		ExpiresAt: expiry.UTC(),
+		IP:        source.IP,
+		UserAgent: source.UserAgent,
+		Via:       source.Via,
+	}); err != nil {
+		return nil, err
+	}
+
 	return &dto.TokenResponse{
 		AccessToken: tokenString,
 		ExpiresIn:   int64(24 * 60 * 60),
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type lockout struct {
+	accessKey, ip string
+	attempts      int
+}
+
+// recordingNotifier passes each lockout it is told of to a channel
+type recordingNotifier chan lockout
+
+func (n recordingNotifier) NotifyLockout(ctx context.Context, accessKey, ip string, attempts int) {
+	n <- lockout{accessKey, ip, attempts}
+}
+
+func TestLoginNotifiesOnlyOnLockout(t *testing.T) {
+	db := dbtest.New(t)
+	notifier := make(recordingNotifier, 10)
+	svc := New(repository.New(db.Queries), "secret", nil, 0, NewMemorySessionStore(), nil, NewLoginLimiter(3, time.Minute), notifier, Registration{})
+	ctx := context.Background()
+
+	client, err := svc.CreateClient(ctx, dto.CreateClientRequest{Name: "ci", Role: dto.RoleUser})
+	if err != nil {
+		t.Fatalf("CreateClient() error = %v", err)
+	}
+	source := dto.SessionSource{IP: "192.0.2.1", Via: "api"}
+	wrong := dto.LoginRequest{AccessKey: client.AccessKey, SecretKey: "wrong"}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := svc.Login(ctx, wrong, source); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failed login %d: error = %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+
+	select {
+	case got := <-notifier:
+		want := lockout{client.AccessKey, "192.0.2.1", 3}
+		if got != want {
+			t.Errorf("notified %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no notification after the lockout")
+	}
+
+	// Logins while locked are refused without counting as new failures
+	for range 3 {
+		if _, err := svc.Login(ctx, wrong, source); !errors.Is(err, ErrLoginLocked) {
+			t.Fatalf("login while locked: error = %v, want ErrLoginLocked", err)
+		}
+	}
+
+	select {
+	case got := <-notifier:
+		t.Errorf("unexpected notification %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestValidateTokenSecretRotation(t *testing.T) {
+	db := dbtest.New(t)
+	sessions := NewMemorySessionStore()
+	svc := New(repository.New(db.Queries), "current", []string{"previous"}, 0, sessions, nil, nil, nil, Registration{})
+	ctx := context.Background()
+
+	sign := func(secret string, expiry time.Time) string {
+		t.Helper()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			ClientID: "client-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(expiry),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return token
+	}
+	valid := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"current secret", sign("current", valid), false},
+		{"previous secret", sign("previous", valid), false},
+		{"unknown secret", sign("unknown", valid), true},
+		{"previous secret expired", sign("previous", time.Now().Add(-time.Hour)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := svc.ValidateToken(ctx, tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("ValidateToken() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if claims.ClientID != "client-1" {
+				t.Errorf("ClientID = %q, want client-1", claims.ClientID)
+			}
+		})
+	}
+
+	// Once the previous secret is dropped, its tokens stop validating
+	rotated := New(repository.New(db.Queries), "current", nil, 0, sessions, nil, nil, nil, Registration{})
+	if _, err := rotated.ValidateToken(ctx, sign("previous", valid)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ValidateToken() of a dropped secret's token error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestValidateTokenLeeway(t *testing.T) {
+	const leeway = 30 * time.Second
+	db := dbtest.New(t)
+	ctx := context.Background()
+
+	// token offsets one of nbf, iat or exp from now
+	token := func(claim string, offset time.Duration) string {
+		t.Helper()
+		now := time.Now()
+		claims := jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		}
+		switch claim {
+		case "nbf":
+			claims.NotBefore = jwt.NewNumericDate(now.Add(offset))
+		case "iat":
+			claims.IssuedAt = jwt.NewNumericDate(now.Add(offset))
+		case "exp":
+			claims.ExpiresAt = jwt.NewNumericDate(now.Add(offset))
+		}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{ClientID: "client-1", RegisteredClaims: claims}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		leeway time.Duration
+		claim  string
+		offset time.Duration
+		valid  bool
+	}{
+		{"nbf within the leeway", leeway, "nbf", leeway / 2, true},
+		{"nbf beyond the leeway", leeway, "nbf", 2 * leeway, false},
+		{"iat within the leeway", leeway, "iat", leeway / 2, true},
+		{"iat beyond the leeway", leeway, "iat", 2 * leeway, false},
+		{"exp within the leeway", leeway, "exp", -leeway / 2, true},
+		{"exp beyond the leeway", leeway, "exp", -2 * leeway, false},
+		{"no leeway, current", 0, "", 0, true},
+		{"no leeway, nbf ahead", 0, "nbf", leeway / 2, false},
+		{"no leeway, iat ahead", 0, "iat", leeway / 2, false},
+		{"no leeway, exp passed", 0, "exp", -leeway / 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := New(repository.New(db.Queries), "secret", nil, tt.leeway, NewMemorySessionStore(), nil, nil, nil, Registration{})
+			_, err := svc.ValidateToken(ctx, token(tt.claim, tt.offset))
+			if tt.valid && err != nil {
+				t.Errorf("ValidateToken() error = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestCreateClientLimit(t *testing.T) {
+	db := dbtest.New(t)
+	dbtest.Client(t, db, "client-1")
+	clientCap := quota.New("client", 2, db.Queries.CountClients)
+	svc := New(repository.New(db.Queries), "secret", nil, 0, NewMemorySessionStore(), clientCap, nil, nil, Registration{})
+	ctx := context.Background()
+
+	// One slot left below the limit
+	if _, err := svc.CreateClient(ctx, dto.CreateClientRequest{Name: "second", Role: dto.RoleUser}); err != nil {
+		t.Fatalf("CreateClient() at limit-1 error = %v", err)
+	}
+
+	_, err := svc.CreateClient(ctx, dto.CreateClientRequest{Name: "third", Role: dto.RoleUser})
+	var limitErr *quota.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("CreateClient() at the limit error = %v, want *quota.LimitError", err)
+	}
+	if limitErr.Kind != "client" || limitErr.Limit != 2 {
+		t.Errorf("LimitError = %+v, want client limit of 2", limitErr)
+	}
+	if n, err := db.Queries.CountClients(ctx); err != nil || n != 2 {
+		t.Errorf("CountClients() = %d, %v, want 2", n, err)
+	}
+}
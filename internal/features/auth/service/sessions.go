@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is an issued token, tracked by its jti so it can be listed and revoked
+type Session struct {
+	ID        string    `json:"id"`
+	ClientID  string    `json:"client_id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Via       string    `json:"via,omitempty"`
+}
+
+// SessionStore tracks issued tokens. Revocations are kept until the token
+// would have expired. Revoke returns ErrSessionNotFound for sessions of other clients.
+type SessionStore interface {
+	Save(ctx context.Context, session Session) error
+	List(ctx context.Context, clientID string) ([]Session, error)
+	Revoke(ctx context.Context, clientID, id string) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+var (
+	_ SessionStore = (*MemorySessionStore)(nil)
+	_ SessionStore = (*RedisSessionStore)(nil)
+)
+
+// MemorySessionStore is an in-process SessionStore for single-instance
+// deployments. Sessions and revocations are lost on restart.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	revoked  map[string]time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]Session),
+		revoked:  make(map[string]time.Time),
+	}
+}
+
+func (m *MemorySessionStore) Save(ctx context.Context, session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge()
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *MemorySessionStore) List(ctx context.Context, clientID string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge()
+	sessions := []Session{}
+	for _, s := range m.sessions {
+		if s.ClientID == clientID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MemorySessionStore) Revoke(ctx context.Context, clientID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.ClientID != clientID {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, id)
+	m.revoked[id] = session.ExpiresAt
+	return nil
+}
+
+func (m *MemorySessionStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+// purge drops expired sessions and revocations; callers hold mu
+func (m *MemorySessionStore) purge() {
+	now := time.Now()
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+	for id, expiresAt := range m.revoked {
+		if now.After(expiresAt) {
+			delete(m.revoked, id)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionKeyPrefix     = "aoui-drive:session:"
+	clientSessionsPrefix = "aoui-drive:sessions:"
+	revokedSessionPrefix = "aoui-drive:session-revoked:"
+)
+
+// RedisSessionStore shares sessions and revocations across instances.
+// Each session is a key expiring with its token, indexed per client in a
+// sorted set scored by expiry.
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+func NewRedisSessionStore(client *redis.Client) *RedisSessionStore {
+	return &RedisSessionStore{client: client}
+}
+
+func (r *RedisSessionStore) Save(ctx context.Context, session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	index := clientSessionsPrefix + session.ClientID
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, sessionKeyPrefix+session.ID, data, ttl)
+	pipe.ZAdd(ctx, index, redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: session.ID})
+	// Tokens share one lifetime, so the newest session outlives the others
+	pipe.Expire(ctx, index, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisSessionStore) List(ctx context.Context, clientID string) ([]Session, error) {
+	index := clientSessionsPrefix + clientID
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := r.client.ZRemRangeByScore(ctx, index, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+
+	ids, err := r.client.ZRange(ctx, index, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	if len(ids) == 0 {
+		return sessions, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKeyPrefix + id
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// Revoked or expired between ZRANGE and MGET
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (r *RedisSessionStore) Revoke(ctx context.Context, clientID, id string) error {
+	data, err := r.client.Get(ctx, sessionKeyPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return err
+	}
+	ttl := time.Until(session.ExpiresAt)
+	if session.ClientID != clientID || ttl <= 0 {
+		return ErrSessionNotFound
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, revokedSessionPrefix+id, 1, ttl)
+	pipe.Del(ctx, sessionKeyPrefix+id)
+	pipe.ZRem(ctx, clientSessionsPrefix+clientID, id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisSessionStore) IsRevoked(ctx context.Context, id string) (bool, error) {
+	n, err := r.client.Exists(ctx, revokedSessionPrefix+id).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -5,6 +5,9 @@ import (
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/controller"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,10 +17,11 @@ type Feature struct {
 	Repository repository.BucketRepository
 }
 
-func New(db *database.Database, storagePath string) *Feature {
+func New(db *database.Database, layout *storage.Layout, encryptionEnabled, scanningEnabled, foldNames bool, usage *storage.Usage, maxBuckets int, pageLimits pagination.Limits) *Feature {
 	repo := repository.New(db.Queries)
-	svc := service.New(repo, storagePath)
-	ctrl := controller.New(svc)
+	bucketCap := quota.New("bucket", int64(maxBuckets), db.Queries.CountBuckets)
+	svc := service.New(repo, layout, encryptionEnabled, scanningEnabled, foldNames, usage, bucketCap)
+	ctrl := controller.New(svc, pageLimits)
 
 	return &Feature{
 		Controller: ctrl,
@@ -29,3 +33,7 @@ func New(db *database.Database, storagePath string) *Feature {
 func (f *Feature) RegisterRoutes(g *echo.Group) {
 	f.Controller.RegisterRoutes(g)
 }
+
+func (f *Feature) RegisterAdminRoutes(g *echo.Group) {
+	f.Controller.RegisterAdminRoutes(g)
+}
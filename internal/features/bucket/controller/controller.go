@@ -2,42 +2,61 @@ package controller
 
 import (
 	"errors"
+	"net/http"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/aouiniamine/aoui-drive/pkg/response"
 	"github.com/labstack/echo/v4"
 )
 
 type BucketController struct {
-	service service.BucketService
+	service    service.BucketService
+	pageLimits pagination.Limits
 }
 
-func New(svc service.BucketService) *BucketController {
-	return &BucketController{service: svc}
+func New(svc service.BucketService, pageLimits pagination.Limits) *BucketController {
+	return &BucketController{service: svc, pageLimits: pageLimits}
 }
 
 func (c *BucketController) RegisterRoutes(g *echo.Group) {
 	g.POST("", c.Create)
 	g.GET("", c.List)
+	g.GET("/overview", c.Overview)
 	g.GET("/:id", c.Get)
+	g.HEAD("/:id", c.Head)
+	g.PATCH("/:id", c.Update)
 	g.DELETE("/:id", c.Delete)
 }
 
+// RegisterAdminRoutes registers bucket maintenance routes on an admin-only group
+func (c *BucketController) RegisterAdminRoutes(g *echo.Group) {
+	g.POST("/repair-symlinks", c.RepairSymlinks)
+	g.POST("/buckets/:id/transfer", c.Transfer)
+}
+
 // Create godoc
 // @Summary Create a new bucket
-// @Description Create a new storage bucket for the authenticated client. If public=true, a symlink is created in the public folder.
+// @Description Create a new storage bucket for the authenticated client. If public=true, a symlink is created in the public folder. encrypted=true stores new blobs encrypted at rest and requires a server encryption key; it cannot be combined with public. scan_uploads=true scans every upload for malware and requires a configured scanner. Returns 403 once MAX_BUCKETS buckets exist across all clients. A name the client already uses is rejected with 409 unless idempotent=true, which returns the existing bucket unchanged with 200.
 // @Tags buckets
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param public query boolean false "Make bucket publicly accessible"
+// @Param idempotent query boolean false "Return the existing bucket instead of an error if the name is taken by this client"
 // @Param request body dto.CreateBucketRequest true "Bucket details"
+// @Success 200 {object} response.Response{data=dto.BucketResponse}
 // @Success 201 {object} response.Response{data=dto.BucketResponse}
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 409 {object} response.Response
 // @Router /buckets [post]
 func (c *BucketController) Create(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
@@ -56,14 +75,24 @@ func (c *BucketController) Create(ctx echo.Context) error {
 		req.Public = true
 	}
 
-	bucket, err := c.service.Create(ctx.Request().Context(), clientID, req)
+	bucket, created, err := c.service.Create(ctx.Request().Context(), clientID, req, ctx.QueryParam("idempotent") == "true")
 	if err != nil {
 		if errors.Is(err, repository.ErrBucketExists) {
-			return response.BadRequest(ctx, "bucket already exists")
+			return response.Conflict(ctx, "bucket already exists")
+		}
+		if errors.Is(err, service.ErrInvalidBucketName) || errors.Is(err, encryption.ErrUnavailable) || errors.Is(err, service.ErrEncryptedPublic) || errors.Is(err, service.ErrScanningUnavailable) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		var limitErr *quota.LimitError
+		if errors.As(err, &limitErr) {
+			return response.Forbidden(ctx, limitErr.Error())
 		}
 		return response.InternalError(ctx, err.Error())
 	}
 
+	if !created {
+		return response.Success(ctx, bucket)
+	}
 	return response.Created(ctx, bucket)
 }
 
@@ -93,6 +122,30 @@ func (c *BucketController) Get(ctx echo.Context) error {
 	return response.Success(ctx, bucket)
 }
 
+// Head godoc
+// @Summary Check that a bucket exists
+// @Description Answer 200 if the bucket exists and belongs to the authenticated client, 404 otherwise, without a body
+// @Tags buckets
+// @Security BearerAuth
+// @Param id path string true "Bucket ID"
+// @Success 200
+// @Failure 401
+// @Failure 404
+// @Router /buckets/{id} [head]
+func (c *BucketController) Head(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+
+	if _, err := c.service.Get(ctx.Request().Context(), clientID, bucketID); err != nil {
+		if errors.Is(err, repository.ErrBucketNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	return ctx.NoContent(http.StatusOK)
+}
+
 // List godoc
 // @Summary List all buckets
 // @Description List all buckets owned by the authenticated client
@@ -113,27 +166,182 @@ func (c *BucketController) List(ctx echo.Context) error {
 	return response.Success(ctx, buckets)
 }
 
+// Overview godoc
+// @Summary List buckets with usage and webhook activity
+// @Description List the authenticated client's buckets with object count, total size, active webhook count and the time of the last webhook event
+// @Tags buckets
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Buckets per page (clamped to PAGE_SIZE_MAX)"
+// @Success 200 {object} response.Response{data=dto.BucketOverviewListResponse}
+// @Failure 401 {object} response.Response
+// @Router /buckets/overview [get]
+func (c *BucketController) Overview(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+
+	p := c.pageLimits.Parse(ctx)
+
+	overview, err := c.service.Overview(ctx.Request().Context(), clientID, p.Page, p.PerPage)
+	if err != nil {
+		return response.InternalError(ctx, "failed to list bucket overview")
+	}
+
+	return response.Paginated(ctx, overview, p, overview.Total)
+}
+
+// Update godoc
+// @Summary Update bucket settings
+// @Description Partially update a bucket. webhooks_suspended=true stops all event delivery for the bucket without touching individual webhook configs. sensitive=true serves the bucket's downloads with Cache-Control: no-store. worm=true with retention_seconds makes resources undeletable until their retention elapses; it cannot be disabled and the retention cannot be shortened. encrypted toggles encryption at rest for resources uploaded afterwards. scan_uploads toggles malware scanning of uploads. download_rate_limit caps the bandwidth of all downloads from the bucket in bytes per second; 0 removes the cap. cache_control replaces the server's default Cache-Control for the bucket's files; "" restores the default.
+// @Tags buckets
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Bucket ID"
+// @Param request body dto.UpdateBucketRequest true "Fields to update"
+// @Success 200 {object} response.Response{data=dto.BucketResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /buckets/{id} [patch]
+func (c *BucketController) Update(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+
+	var req dto.UpdateBucketRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+
+	bucket, err := c.service.Update(ctx.Request().Context(), clientID, bucketID, req)
+	if err != nil {
+		if errors.Is(err, repository.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, service.ErrInvalidRetention) || errors.Is(err, encryption.ErrUnavailable) || errors.Is(err, service.ErrEncryptedPublic) || errors.Is(err, service.ErrScanningUnavailable) || errors.Is(err, service.ErrInvalidRateLimit) || errors.Is(err, service.ErrInvalidCacheControl) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, service.ErrRetentionLocked) {
+			return response.Forbidden(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, bucket)
+}
+
 // Delete godoc
 // @Summary Delete a bucket
-// @Description Delete a bucket by ID (bucket must be empty)
+// @Description Delete a bucket by ID along with its resources and webhooks. With dry_run=true nothing is deleted; the response reports how many resources and bytes and how many webhooks would be removed.
 // @Tags buckets
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Bucket ID"
+// @Param dry_run query boolean false "Report what would be deleted without deleting"
+// @Success 200 {object} response.Response{data=dto.DeleteBucketResponse}
 // @Success 204
 // @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
 // @Failure 404 {object} response.Response
 // @Router /buckets/{id} [delete]
 func (c *BucketController) Delete(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("id")
 
+	if ctx.QueryParam("dry_run") == "true" {
+		preview, err := c.service.PreviewDelete(ctx.Request().Context(), clientID, bucketID)
+		if err != nil {
+			return deleteError(ctx, err)
+		}
+		return response.Success(ctx, preview)
+	}
+
 	if err := c.service.Delete(ctx.Request().Context(), clientID, bucketID); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return response.NoContent(ctx)
+}
+
+func deleteError(ctx echo.Context, err error) error {
+	if errors.Is(err, repository.ErrBucketNotFound) {
+		return response.NotFound(ctx, "bucket not found")
+	}
+	if errors.Is(err, repository.ErrRetentionActive) {
+		return response.Forbidden(ctx, "bucket has resources under retention")
+	}
+	return response.InternalError(ctx, "failed to delete bucket")
+}
+
+// RepairSymlinks godoc
+// @Summary Repair public bucket symlinks
+// @Description Recreate the public/<bucketId> symlink of every public bucket that is missing or points to the wrong directory, e.g. after moving the storage directory, and remove links of buckets that are no longer public (Admin only). Correct links are left untouched, so it is safe to run repeatedly.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=dto.RepairSymlinksResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/repair-symlinks [post]
+func (c *BucketController) RepairSymlinks(ctx echo.Context) error {
+	result, err := c.service.RepairSymlinks(ctx.Request().Context())
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// Transfer godoc
+// @Summary Transfer a bucket to another client
+// @Description Make another client the owner of a bucket (Admin only). Resources, webhooks and settings move with the bucket; with the client storage layout its directory is moved into the new owner's folder. The new owner must exist, be active and not already have a bucket with the same name.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Bucket ID"
+// @Param request body dto.TransferBucketRequest true "New owner"
+// @Success 200 {object} response.Response{data=dto.BucketResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /admin/buckets/{id}/transfer [post]
+func (c *BucketController) Transfer(ctx echo.Context) error {
+	bucketID := ctx.Param("id")
+
+	var req dto.TransferBucketRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+	if req.ClientID == "" {
+		return response.BadRequest(ctx, "client_id is required")
+	}
+
+	bucket, err := c.service.Transfer(ctx.Request().Context(), bucketID, req.ClientID)
+	if err != nil {
 		if errors.Is(err, repository.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
 		}
-		return response.InternalError(ctx, "failed to delete bucket")
+		if errors.Is(err, repository.ErrClientNotFound) {
+			return response.NotFound(ctx, "client not found")
+		}
+		if errors.Is(err, service.ErrClientInactive) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, repository.ErrBucketExists) {
+			return response.BadRequest(ctx, "client already has a bucket with this name")
+		}
+		return response.InternalError(ctx, err.Error())
 	}
 
-	return response.NoContent(ctx)
+	audit.Event(audit.BucketTransferred,
+		"actor", middleware.GetClientID(ctx),
+		"ip", ctx.RealIP(),
+		"bucket_id", bucket.ID,
+		"client_id", req.ClientID,
+	)
+
+	return response.Success(ctx, bucket)
 }
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+// newTestServer serves the bucket routes under /buckets for client-1
+func newTestServer(t *testing.T) (*echo.Echo, *database.Database) {
+	t.Helper()
+
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	svc := service.New(repository.New(db.Queries), layout, false, false, false, nil, nil)
+
+	e := echo.New()
+	New(svc, pagination.Limits{DefaultPerPage: 20, MaxPerPage: 100}).RegisterRoutes(e.Group("/buckets", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(middleware.ClientIDKey, client.ID)
+			return next(c)
+		}
+	}))
+	return e, db
+}
+
+func TestCreateIdempotent(t *testing.T) {
+	tests := []struct {
+		mode        string
+		query       string
+		repeatQuery string
+		wantRepeat  int
+	}{
+		{"default", "", "?public=true", http.StatusConflict},
+		{"idempotent", "?idempotent=true", "?idempotent=true&public=true", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			e, db := newTestServer(t)
+			create := func(query string) (*httptest.ResponseRecorder, dto.BucketResponse) {
+				t.Helper()
+				req := httptest.NewRequest(http.MethodPost, "/buckets"+query, strings.NewReader(`{"name": "photos"}`))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				var resp struct {
+					Data dto.BucketResponse `json:"data"`
+				}
+				if rec.Code < 300 {
+					if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+						t.Fatalf("decode response: %v", err)
+					}
+				}
+				return rec, resp.Data
+			}
+
+			rec, first := create(tt.query)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("first create status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+			}
+
+			// The repeat asks for a public bucket; an idempotent create
+			// returns the existing one unchanged
+			rec, repeat := create(tt.repeatQuery)
+			if rec.Code != tt.wantRepeat {
+				t.Fatalf("repeated create status = %d, want %d: %s", rec.Code, tt.wantRepeat, rec.Body)
+			}
+			if rec.Code == http.StatusOK && (repeat.ID != first.ID || repeat.Public) {
+				t.Errorf("repeated create = %s public=%v, want %s unchanged", repeat.ID, repeat.Public, first.ID)
+			}
+			if n, err := db.Queries.CountBuckets(context.Background()); err != nil || n != 1 {
+				t.Errorf("CountBuckets() = %d, %v, want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestHead(t *testing.T) {
+	e, db := newTestServer(t)
+	owned := dbtest.Bucket(t, db, "client-1", "bucket-1")
+	other := dbtest.Client(t, db, "client-2")
+	foreign := dbtest.Bucket(t, db, other.ID, "bucket-2")
+
+	tests := []struct {
+		name     string
+		id       string
+		wantCode int
+	}{
+		{"present", owned.ID, http.StatusOK},
+		{"absent", "bucket-3", http.StatusNotFound},
+		{"another client's", foreign.ID, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/buckets/"+tt.id, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("HEAD status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q, want none", rec.Body)
+			}
+		})
+	}
+}
@@ -4,20 +4,100 @@ import "time"
 
 // Requests
 
+// CreateBucketRequest creates a bucket. Encrypted buckets cannot be public,
+// since public files are served straight from disk. ScanUploads requires a
+// malware scanner to be configured.
 type CreateBucketRequest struct {
-	Name   string `json:"name"`
-	Public bool   `json:"public"`
+	Name        string `json:"name"`
+	Public      bool   `json:"public"`
+	Encrypted   bool   `json:"encrypted"`
+	ScanUploads bool   `json:"scan_uploads"`
+}
+
+// UpdateBucketRequest is a partial update; omitted fields are left unchanged.
+// Once Worm is enabled it cannot be disabled and RetentionSeconds cannot shrink.
+// Encrypted only affects resources uploaded afterwards. DownloadRateLimit is
+// in bytes per second, shared by all downloads from the bucket; 0 removes it.
+// CacheControl replaces the server's default Cache-Control for the bucket's
+// public files; an empty string restores the default.
+type UpdateBucketRequest struct {
+	WebhooksSuspended *bool   `json:"webhooks_suspended,omitempty"`
+	Sensitive         *bool   `json:"sensitive,omitempty"`
+	Worm              *bool   `json:"worm,omitempty"`
+	RetentionSeconds  *int64  `json:"retention_seconds,omitempty"`
+	Encrypted         *bool   `json:"encrypted,omitempty"`
+	ScanUploads       *bool   `json:"scan_uploads,omitempty"`
+	DownloadRateLimit *int64  `json:"download_rate_limit,omitempty"`
+	CacheControl      *string `json:"cache_control,omitempty"`
 }
 
 // Responses
 
 type BucketResponse struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Public    bool      `json:"public"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Public            bool      `json:"public"`
+	WebhooksSuspended bool      `json:"webhooks_suspended"`
+	Sensitive         bool      `json:"sensitive"`
+	Worm              bool      `json:"worm"`
+	RetentionSeconds  int64     `json:"retention_seconds"`
+	Encrypted         bool      `json:"encrypted"`
+	ScanUploads       bool      `json:"scan_uploads"`
+	DownloadRateLimit int64     `json:"download_rate_limit"`
+	CacheControl      string    `json:"cache_control,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// DeleteBucketResponse reports what deleting a bucket would remove. It is
+// only returned by dry runs; a real delete answers 204.
+type DeleteBucketResponse struct {
+	BucketID  string `json:"bucket_id"`
+	DryRun    bool   `json:"dry_run"`
+	Resources int64  `json:"resources"`
+	TotalSize int64  `json:"total_size"`
+	Webhooks  int64  `json:"webhooks"`
 }
 
 type BucketListResponse struct {
 	Buckets []BucketResponse `json:"buckets"`
 }
+
+// BucketOverview is a bucket with its content totals and webhook activity
+type BucketOverview struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Public            bool       `json:"public"`
+	WebhooksSuspended bool       `json:"webhooks_suspended"`
+	Sensitive         bool       `json:"sensitive"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ObjectCount       int64      `json:"object_count"`
+	TotalSize         int64      `json:"total_size"`
+	ActiveWebhooks    int64      `json:"active_webhooks"`
+	LastEventAt       *time.Time `json:"last_event_at"`
+}
+
+type BucketOverviewListResponse struct {
+	Buckets []BucketOverview `json:"buckets"`
+	Total   int64            `json:"total"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+}
+
+type SymlinkRepairFailure struct {
+	BucketID string `json:"bucket_id"`
+	Error    string `json:"error"`
+}
+
+// TransferBucketRequest names the client that becomes the bucket's owner
+type TransferBucketRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+// RepairSymlinksResponse lists the public links that were recreated, removed
+// because their bucket is no longer public, or could not be repaired
+type RepairSymlinksResponse struct {
+	Checked int                    `json:"checked"`
+	Fixed   []string               `json:"fixed"`
+	Removed []string               `json:"removed"`
+	Failed  []SymlinkRepairFailure `json:"failed"`
+}
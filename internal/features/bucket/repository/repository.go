@@ -4,13 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 )
 
 var (
-	ErrBucketNotFound = errors.New("bucket not found")
-	ErrBucketExists   = errors.New("bucket already exists")
+	ErrBucketNotFound  = errors.New("bucket not found")
+	ErrBucketExists    = errors.New("bucket already exists")
+	ErrClientNotFound  = errors.New("client not found")
+	ErrRetentionActive = errors.New("resource is under retention")
 )
 
 type BucketRepository interface {
@@ -18,9 +23,25 @@ type BucketRepository interface {
 	GetByNameAndClientID(ctx context.Context, name, clientID string) (*sqlc.Bucket, error)
 	List(ctx context.Context) ([]sqlc.Bucket, error)
 	ListByClientID(ctx context.Context, clientID string) ([]sqlc.Bucket, error)
+	ListOverviewsByClientID(ctx context.Context, clientID string, limit, offset int64) ([]sqlc.ListBucketOverviewsByClientIDRow, error)
+	CountByClientID(ctx context.Context, clientID string) (int64, error)
 	Create(ctx context.Context, params sqlc.CreateBucketParams) (*sqlc.Bucket, error)
 	Delete(ctx context.Context, id string) error
+	SetWebhooksSuspended(ctx context.Context, id string, suspended bool) (*sqlc.Bucket, error)
+	SetClientID(ctx context.Context, id, clientID string) (*sqlc.Bucket, error)
+	SetSensitive(ctx context.Context, id string, sensitive bool) (*sqlc.Bucket, error)
+	SetEncrypted(ctx context.Context, id string, encrypted bool) (*sqlc.Bucket, error)
+	SetScanUploads(ctx context.Context, id string, scan bool) (*sqlc.Bucket, error)
+	SetDownloadRateLimit(ctx context.Context, id string, bytesPerSecond int64) (*sqlc.Bucket, error)
+	SetCacheControl(ctx context.Context, id, cacheControl string) (*sqlc.Bucket, error)
+	SetRetention(ctx context.Context, id string, worm bool, retentionSeconds int64) (*sqlc.Bucket, error)
+	ApplyRetention(ctx context.Context, id string, retainUntil time.Time) error
+	HasRetainedResources(ctx context.Context, id string) (bool, error)
+	EncryptedSize(ctx context.Context, id string) (int64, error)
+	ResourceTotals(ctx context.Context, id string) (*sqlc.GetResourceTotalsByBucketIDRow, error)
+	WebhookCount(ctx context.Context, id string) (int64, error)
 	ExistsByNameAndClientID(ctx context.Context, name, clientID string) (bool, error)
+	GetClient(ctx context.Context, clientID string) (*sqlc.Client, error)
 }
 
 type bucketRepository struct {
@@ -42,9 +63,11 @@ func (r *bucketRepository) GetByID(ctx context.Context, id string) (*sqlc.Bucket
 	return &bucket, nil
 }
 
+// GetByNameAndClientID ignores the case of name, since stored names are
+// always lower-case
 func (r *bucketRepository) GetByNameAndClientID(ctx context.Context, name, clientID string) (*sqlc.Bucket, error) {
 	bucket, err := r.queries.GetBucketByNameAndClientID(ctx, sqlc.GetBucketByNameAndClientIDParams{
-		Name:     name,
+		Name:     strings.ToLower(name),
 		ClientID: clientID,
 	})
 	if err != nil {
@@ -64,6 +87,18 @@ func (r *bucketRepository) ListByClientID(ctx context.Context, clientID string)
 	return r.queries.ListBucketsByClientID(ctx, clientID)
 }
 
+func (r *bucketRepository) ListOverviewsByClientID(ctx context.Context, clientID string, limit, offset int64) ([]sqlc.ListBucketOverviewsByClientIDRow, error) {
+	return r.queries.ListBucketOverviewsByClientID(ctx, sqlc.ListBucketOverviewsByClientIDParams{
+		ClientID: clientID,
+		Limit:    limit,
+		Offset:   offset,
+	})
+}
+
+func (r *bucketRepository) CountByClientID(ctx context.Context, clientID string) (int64, error) {
+	return r.queries.CountBucketsByClientID(ctx, clientID)
+}
+
 func (r *bucketRepository) Create(ctx context.Context, params sqlc.CreateBucketParams) (*sqlc.Bucket, error) {
 	exists, err := r.ExistsByNameAndClientID(ctx, params.Name, params.ClientID)
 	if err != nil {
@@ -75,6 +110,10 @@ func (r *bucketRepository) Create(ctx context.Context, params sqlc.CreateBucketP
 
 	bucket, err := r.queries.CreateBucket(ctx, params)
 	if err != nil {
+		// Created concurrently since the check above
+		if database.IsUniqueViolation(err) {
+			return nil, ErrBucketExists
+		}
 		return nil, err
 	}
 	return &bucket, nil
@@ -91,9 +130,202 @@ func (r *bucketRepository) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+// SetClientID moves a bucket to another owner. Like Create, it fails with
+// ErrBucketExists if the new owner already has a bucket with the same name.
+func (r *bucketRepository) SetClientID(ctx context.Context, id, clientID string) (*sqlc.Bucket, error) {
+	bucket, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := r.ExistsByNameAndClientID(ctx, bucket.Name, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrBucketExists
+	}
+
+	updated, err := r.queries.UpdateBucketClientID(ctx, sqlc.UpdateBucketClientIDParams{
+		ClientID: clientID,
+		ID:       id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		if database.IsUniqueViolation(err) {
+			return nil, ErrBucketExists
+		}
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *bucketRepository) SetWebhooksSuspended(ctx context.Context, id string, suspended bool) (*sqlc.Bucket, error) {
+	var value int64
+	if suspended {
+		value = 1
+	}
+
+	bucket, err := r.queries.UpdateBucketWebhooksSuspended(ctx, sqlc.UpdateBucketWebhooksSuspendedParams{
+		WebhooksSuspended: value,
+		ID:                id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetSensitive(ctx context.Context, id string, sensitive bool) (*sqlc.Bucket, error) {
+	var value int64
+	if sensitive {
+		value = 1
+	}
+
+	bucket, err := r.queries.UpdateBucketSensitive(ctx, sqlc.UpdateBucketSensitiveParams{
+		Sensitive: value,
+		ID:        id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetEncrypted(ctx context.Context, id string, encrypted bool) (*sqlc.Bucket, error) {
+	var value int64
+	if encrypted {
+		value = 1
+	}
+
+	bucket, err := r.queries.UpdateBucketEncrypted(ctx, sqlc.UpdateBucketEncryptedParams{
+		Encrypted: value,
+		ID:        id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetScanUploads(ctx context.Context, id string, scan bool) (*sqlc.Bucket, error) {
+	var value int64
+	if scan {
+		value = 1
+	}
+
+	bucket, err := r.queries.UpdateBucketScanUploads(ctx, sqlc.UpdateBucketScanUploadsParams{
+		ScanUploads: value,
+		ID:          id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetDownloadRateLimit(ctx context.Context, id string, bytesPerSecond int64) (*sqlc.Bucket, error) {
+	bucket, err := r.queries.UpdateBucketDownloadRateLimit(ctx, sqlc.UpdateBucketDownloadRateLimitParams{
+		DownloadRateLimit: bytesPerSecond,
+		ID:                id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetCacheControl(ctx context.Context, id, cacheControl string) (*sqlc.Bucket, error) {
+	bucket, err := r.queries.UpdateBucketCacheControl(ctx, sqlc.UpdateBucketCacheControlParams{
+		CacheControl: cacheControl,
+		ID:           id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (r *bucketRepository) SetRetention(ctx context.Context, id string, worm bool, retentionSeconds int64) (*sqlc.Bucket, error) {
+	var value int64
+	if worm {
+		value = 1
+	}
+
+	bucket, err := r.queries.UpdateBucketRetention(ctx, sqlc.UpdateBucketRetentionParams{
+		Worm:             value,
+		RetentionSeconds: retentionSeconds,
+		ID:               id,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+// ApplyRetention retains the bucket's resources that have no retention yet
+func (r *bucketRepository) ApplyRetention(ctx context.Context, id string, retainUntil time.Time) error {
+	_, err := r.queries.ApplyResourceRetentionByBucketID(ctx, sqlc.ApplyResourceRetentionByBucketIDParams{
+		RetainUntil: sql.NullTime{Time: retainUntil, Valid: true},
+		BucketID:    id,
+	})
+	return err
+}
+
+// EncryptedSize sums the size of the bucket's encrypted resources, the only
+// ones whose files are not shared
+func (r *bucketRepository) EncryptedSize(ctx context.Context, id string) (int64, error) {
+	return r.queries.SumEncryptedResourceSizesByBucketID(ctx, id)
+}
+
+// ResourceTotals counts the bucket's resources and sums their size
+func (r *bucketRepository) ResourceTotals(ctx context.Context, id string) (*sqlc.GetResourceTotalsByBucketIDRow, error) {
+	totals, err := r.queries.GetResourceTotalsByBucketID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// WebhookCount counts the webhooks configured on the bucket
+func (r *bucketRepository) WebhookCount(ctx context.Context, id string) (int64, error) {
+	return r.queries.CountWebhookURLsByBucketID(ctx, id)
+}
+
+// HasRetainedResources reports whether any resource's retention has not elapsed
+func (r *bucketRepository) HasRetainedResources(ctx context.Context, id string) (bool, error) {
+	count, err := r.queries.CountRetainedResourcesByBucketID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (r *bucketRepository) ExistsByNameAndClientID(ctx context.Context, name, clientID string) (bool, error) {
 	result, err := r.queries.BucketExistsByNameAndClientID(ctx, sqlc.BucketExistsByNameAndClientIDParams{
-		Name:     name,
+		Name:     strings.ToLower(name),
 		ClientID: clientID,
 	})
 	if err != nil {
@@ -101,3 +333,15 @@ func (r *bucketRepository) ExistsByNameAndClientID(ctx context.Context, name, cl
 	}
 	return result > 0, nil
 }
+
+// GetClient loads a client, e.g. the new owner of a transferred bucket
+func (r *bucketRepository) GetClient(ctx context.Context, clientID string) (*sqlc.Client, error) {
+	client, err := r.queries.GetClientByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+func TestCreateConcurrentSameName(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	repo := New(db.Queries)
+
+	const attempts = 8
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = repo.Create(context.Background(), sqlc.CreateBucketParams{
+				ID:       fmt.Sprintf("bucket-%d", i),
+				Name:     "photos",
+				ClientID: client.ID,
+			})
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrBucketExists):
+			t.Errorf("Create() error = %v, want nil or ErrBucketExists", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created %d buckets, want 1", created)
+	}
+}
+
+func TestCreateLosesRace(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	ctx := context.Background()
+
+	if _, err := New(db.Queries).Create(ctx, sqlc.CreateBucketParams{ID: "bucket-1", Name: "photos", ClientID: client.ID}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The second request checked before the first inserted, so only the
+	// insert's unique constraint can tell it the bucket exists
+	repo := New(dbtest.StaleCheck(db, "BucketExistsByNameAndClientID"))
+	_, err := repo.Create(ctx, sqlc.CreateBucketParams{ID: "bucket-2", Name: "photos", ClientID: client.ID})
+	if !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("Create() error = %v, want ErrBucketExists", err)
+	}
+}
+
+func TestCreateSameNameOtherClient(t *testing.T) {
+	db := dbtest.New(t)
+	repo := New(db.Queries)
+	ctx := context.Background()
+
+	for i, clientID := range []string{"client-1", "client-2"} {
+		dbtest.Client(t, db, clientID)
+		if _, err := repo.Create(ctx, sqlc.CreateBucketParams{ID: fmt.Sprintf("bucket-%d", i), Name: "photos", ClientID: clientID}); err != nil {
+			t.Fatalf("Create() for %s error = %v", clientID, err)
+		}
+	}
+}
@@ -2,81 +2,198 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
-	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
 	"github.com/google/uuid"
 )
 
 var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
 
+// cacheDirective is one Cache-Control directive: a token, optionally set to a
+// token or a quoted string without control characters
+const cacheDirective = `[A-Za-z][A-Za-z0-9-]*(=([A-Za-z0-9-]+|"[^"\\\x00-\x1f]*"))?`
+
+var cacheControlRegex = regexp.MustCompile(`^` + cacheDirective + `(\s*,\s*` + cacheDirective + `)*$`)
+
+// maxCacheControlLen bounds a bucket's Cache-Control value
+const maxCacheControlLen = 256
+
+var (
+	ErrInvalidRetention = errors.New("worm requires a positive retention_seconds")
+	ErrRetentionLocked  = errors.New("retention of a worm bucket cannot be relaxed")
+
+	ErrEncryptedPublic = errors.New("encrypted buckets cannot be public")
+
+	ErrScanningUnavailable = errors.New("malware scanning is not configured on this server")
+
+	ErrInvalidRateLimit = errors.New("download_rate_limit must not be negative")
+
+	ErrInvalidCacheControl = errors.New("cache_control must be a list of Cache-Control directives")
+
+	ErrClientInactive = errors.New("client is inactive")
+
+	ErrInvalidBucketName = errors.New("invalid bucket name: must be 3-63 characters, lowercase letters, numbers, hyphens, and periods")
+)
+
 type BucketService interface {
-	Create(ctx context.Context, clientID string, req dto.CreateBucketRequest) (*dto.BucketResponse, error)
+	Create(ctx context.Context, clientID string, req dto.CreateBucketRequest, idempotent bool) (*dto.BucketResponse, bool, error)
 	Get(ctx context.Context, clientID, bucketID string) (*dto.BucketResponse, error)
 	List(ctx context.Context, clientID string) (*dto.BucketListResponse, error)
+	Overview(ctx context.Context, clientID string, page, limit int) (*dto.BucketOverviewListResponse, error)
+	Update(ctx context.Context, clientID, bucketID string, req dto.UpdateBucketRequest) (*dto.BucketResponse, error)
 	Delete(ctx context.Context, clientID, bucketID string) error
+	// PreviewDelete reports what Delete would remove without deleting
+	// anything. It fails the same way Delete would.
+	PreviewDelete(ctx context.Context, clientID, bucketID string) (*dto.DeleteBucketResponse, error)
+
+	// Admin maintenance
+	RepairSymlinks(ctx context.Context) (*dto.RepairSymlinksResponse, error)
+	Transfer(ctx context.Context, bucketID, clientID string) (*dto.BucketResponse, error)
 }
 
 type bucketService struct {
-	repo        repository.BucketRepository
-	storagePath string
+	repo              repository.BucketRepository
+	layout            *storage.Layout
+	encryptionEnabled bool
+	scanningEnabled   bool
+	foldNames         bool
+	usage             *storage.Usage
+	bucketCap         *quota.Cap
 }
 
-func New(repo repository.BucketRepository, storagePath string) BucketService {
+// New creates the bucket service. With foldNames, mixed-case bucket names are
+// lower-cased instead of rejected. bucketCap bounds the number of buckets
+// across all clients; nil means unlimited.
+func New(repo repository.BucketRepository, layout *storage.Layout, encryptionEnabled, scanningEnabled, foldNames bool, usage *storage.Usage, bucketCap *quota.Cap) BucketService {
 	return &bucketService{
-		repo:        repo,
-		storagePath: storagePath,
+		repo:              repo,
+		layout:            layout,
+		encryptionEnabled: encryptionEnabled,
+		scanningEnabled:   scanningEnabled,
+		foldNames:         foldNames,
+		usage:             usage,
+		bucketCap:         bucketCap,
 	}
 }
 
-func (s *bucketService) Create(ctx context.Context, clientID string, req dto.CreateBucketRequest) (*dto.BucketResponse, error) {
+// Create creates a bucket for the client. With idempotent, an existing bucket
+// of the same name owned by the client is returned as it is, with created
+// false, instead of failing with ErrBucketExists; its settings are not
+// compared with req.
+func (s *bucketService) Create(ctx context.Context, clientID string, req dto.CreateBucketRequest, idempotent bool) (*dto.BucketResponse, bool, error) {
+	// Stored names are always lower-case, so they are also unique regardless
+	// of case and folding the input is enough to make lookups case-insensitive
+	if s.foldNames {
+		req.Name = strings.ToLower(req.Name)
+	}
 	if !isValidBucketName(req.Name) {
-		return nil, fmt.Errorf("invalid bucket name: must be 3-63 characters, lowercase letters, numbers, hyphens, and periods")
+		return nil, false, ErrInvalidBucketName
 	}
 
-	bucketID := uuid.New().String()
+	if idempotent {
+		existing, err := s.repo.GetByNameAndClientID(ctx, req.Name, clientID)
+		if err == nil {
+			return bucketResponse(existing), false, nil
+		}
+		if !errors.Is(err, repository.ErrBucketNotFound) {
+			return nil, false, err
+		}
+	}
 
-	var isPublic int64
+	var isPublic, encrypted, scanUploads int64
 	if req.Public {
 		isPublic = 1
 	}
-
-	bucket, err := s.repo.Create(ctx, sqlc.CreateBucketParams{
-		ID:       bucketID,
-		Name:     req.Name,
-		ClientID: clientID,
-		IsPublic: isPublic,
-	})
-	if err != nil {
-		return nil, err
+	if req.Encrypted {
+		if err := s.checkEncryption(req.Public); err != nil {
+			return nil, false, err
+		}
+		encrypted = 1
 	}
-
-	bucketPath := filepath.Join(s.storagePath, bucketID)
-	if err := os.MkdirAll(bucketPath, 0755); err != nil {
-		s.repo.Delete(ctx, bucketID)
-		return nil, fmt.Errorf("failed to create bucket storage: %w", err)
+	if req.ScanUploads {
+		if !s.scanningEnabled {
+			return nil, false, ErrScanningUnavailable
+		}
+		scanUploads = 1
 	}
 
-	// Create symlink for public bucket
-	if req.Public {
-		if err := s.createPublicSymlink(bucketID); err != nil {
-			os.RemoveAll(bucketPath)
+	bucketID := uuid.New().String()
+
+	var bucket *sqlc.Bucket
+	err := s.bucketCap.Create(ctx, func() error {
+		var err error
+		bucket, err = s.repo.Create(ctx, sqlc.CreateBucketParams{
+			ID:          bucketID,
+			Name:        req.Name,
+			ClientID:    clientID,
+			IsPublic:    isPublic,
+			Encrypted:   encrypted,
+			ScanUploads: scanUploads,
+		})
+		if err != nil {
+			return err
+		}
+
+		bucketPath := s.layout.BucketDir(clientID, bucketID)
+		if err := os.MkdirAll(bucketPath, 0755); err != nil {
 			s.repo.Delete(ctx, bucketID)
-			return nil, fmt.Errorf("failed to create public symlink: %w", err)
+			return fmt.Errorf("failed to create bucket storage: %w", err)
+		}
+
+		// Create symlink for public bucket
+		if req.Public {
+			if err := s.layout.LinkPublic(clientID, bucketID); err != nil {
+				os.RemoveAll(bucketPath)
+				s.repo.Delete(ctx, bucketID)
+				return fmt.Errorf("failed to create public symlink: %w", err)
+			}
+		}
+		return nil
+	})
+	// A concurrent idempotent request may have created the bucket since the
+	// lookup above
+	if idempotent && errors.Is(err, repository.ErrBucketExists) {
+		existing, err := s.repo.GetByNameAndClientID(ctx, req.Name, clientID)
+		if err != nil {
+			return nil, false, err
 		}
+		return bucketResponse(existing), false, nil
 	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return bucketResponse(bucket), true, nil
+}
 
+// bucketResponse is the API view of a bucket
+func bucketResponse(bucket *sqlc.Bucket) *dto.BucketResponse {
 	return &dto.BucketResponse{
-		ID:        bucket.ID,
-		Name:      bucket.Name,
-		Public:    bucket.IsPublic == 1,
-		CreatedAt: bucket.CreatedAt.Time,
-	}, nil
+		ID:                bucket.ID,
+		Name:              bucket.Name,
+		Public:            bucket.IsPublic == 1,
+		WebhooksSuspended: bucket.WebhooksSuspended == 1,
+		Sensitive:         bucket.Sensitive == 1,
+		Worm:              bucket.Worm == 1,
+		RetentionSeconds:  bucket.RetentionSeconds,
+		Encrypted:         bucket.Encrypted == 1,
+		ScanUploads:       bucket.ScanUploads == 1,
+		DownloadRateLimit: bucket.DownloadRateLimit,
+		CacheControl:      bucket.CacheControl,
+		CreatedAt:         bucket.CreatedAt.Time,
+	}
 }
 
 func (s *bucketService) Get(ctx context.Context, clientID, bucketID string) (*dto.BucketResponse, error) {
@@ -90,12 +207,7 @@ func (s *bucketService) Get(ctx context.Context, clientID, bucketID string) (*dt
 		return nil, repository.ErrBucketNotFound
 	}
 
-	return &dto.BucketResponse{
-		ID:        bucket.ID,
-		Name:      bucket.Name,
-		Public:    bucket.IsPublic == 1,
-		CreatedAt: bucket.CreatedAt.Time,
-	}, nil
+	return bucketResponse(bucket), nil
 }
 
 func (s *bucketService) List(ctx context.Context, clientID string) (*dto.BucketListResponse, error) {
@@ -108,61 +220,388 @@ func (s *bucketService) List(ctx context.Context, clientID string) (*dto.BucketL
 		Buckets: make([]dto.BucketResponse, len(buckets)),
 	}
 
-	for i, b := range buckets {
-		response.Buckets[i] = dto.BucketResponse{
-			ID:        b.ID,
-			Name:      b.Name,
-			Public:    b.IsPublic == 1,
-			CreatedAt: b.CreatedAt.Time,
+	for i := range buckets {
+		response.Buckets[i] = *bucketResponse(&buckets[i])
+	}
+
+	return response, nil
+}
+
+// Overview returns a page of the client's buckets with object totals, active
+// webhook counts and the time of the last webhook event
+func (s *bucketService) Overview(ctx context.Context, clientID string, page, limit int) (*dto.BucketOverviewListResponse, error) {
+	rows, err := s.repo.ListOverviewsByClientID(ctx, clientID, int64(limit), int64((page-1)*limit))
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.repo.CountByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &dto.BucketOverviewListResponse{
+		Buckets: make([]dto.BucketOverview, len(rows)),
+		Total:   total,
+		Page:    page,
+		Limit:   limit,
+	}
+
+	for i, r := range rows {
+		overview := dto.BucketOverview{
+			ID:                r.ID,
+			Name:              r.Name,
+			Public:            r.IsPublic == 1,
+			WebhooksSuspended: r.WebhooksSuspended == 1,
+			Sensitive:         r.Sensitive == 1,
+			CreatedAt:         r.CreatedAt.Time,
+			ObjectCount:       r.ObjectCount,
+			TotalSize:         r.TotalSize,
+			ActiveWebhooks:    r.ActiveWebhooks,
+		}
+		if r.LastEventUnix.Valid {
+			t := time.Unix(r.LastEventUnix.Int64, 0).UTC()
+			overview.LastEventAt = &t
 		}
+		response.Buckets[i] = overview
 	}
 
 	return response, nil
 }
 
-func (s *bucketService) Delete(ctx context.Context, clientID, bucketID string) error {
+func (s *bucketService) Update(ctx context.Context, clientID, bucketID string, req dto.UpdateBucketRequest) (*dto.BucketResponse, error) {
 	bucket, err := s.repo.GetByID(ctx, bucketID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Verify bucket belongs to client
 	if bucket.ClientID != clientID {
-		return repository.ErrBucketNotFound
+		return nil, repository.ErrBucketNotFound
+	}
+
+	// Every field is validated before any is written, so a rejected request
+	// leaves the bucket as it was
+	if err := s.validateUpdate(bucket, req); err != nil {
+		return nil, err
+	}
+
+	if req.WebhooksSuspended != nil {
+		bucket, err = s.repo.SetWebhooksSuspended(ctx, bucketID, *req.WebhooksSuspended)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Sensitive != nil {
+		bucket, err = s.repo.SetSensitive(ctx, bucketID, *req.Sensitive)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Encrypted != nil {
+		bucket, err = s.repo.SetEncrypted(ctx, bucketID, *req.Encrypted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.ScanUploads != nil {
+		bucket, err = s.repo.SetScanUploads(ctx, bucketID, *req.ScanUploads)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.DownloadRateLimit != nil {
+		bucket, err = s.repo.SetDownloadRateLimit(ctx, bucketID, *req.DownloadRateLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.CacheControl != nil {
+		bucket, err = s.repo.SetCacheControl(ctx, bucketID, strings.TrimSpace(*req.CacheControl))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Worm != nil || req.RetentionSeconds != nil {
+		bucket, err = s.updateRetention(ctx, bucket, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bucketResponse(bucket), nil
+}
+
+// validateUpdate checks every field of an update against the bucket
+func (s *bucketService) validateUpdate(bucket *sqlc.Bucket, req dto.UpdateBucketRequest) error {
+	if req.Encrypted != nil && *req.Encrypted {
+		if err := s.checkEncryption(bucket.IsPublic == 1); err != nil {
+			return err
+		}
+	}
+
+	if req.ScanUploads != nil && *req.ScanUploads && !s.scanningEnabled {
+		return ErrScanningUnavailable
+	}
+
+	if req.DownloadRateLimit != nil && *req.DownloadRateLimit < 0 {
+		return ErrInvalidRateLimit
+	}
+
+	if req.CacheControl != nil {
+		if cacheControl := strings.TrimSpace(*req.CacheControl); cacheControl != "" && !isValidCacheControl(cacheControl) {
+			return ErrInvalidCacheControl
+		}
+	}
+
+	if req.Worm != nil || req.RetentionSeconds != nil {
+		if _, _, err := retentionSettings(bucket, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retentionSettings returns the WORM flag and retention a bucket has after
+// req. Retention can only be tightened once WORM is on.
+func retentionSettings(bucket *sqlc.Bucket, req dto.UpdateBucketRequest) (bool, int64, error) {
+	worm := bucket.Worm == 1
+	retention := bucket.RetentionSeconds
+
+	if req.Worm != nil {
+		if worm && !*req.Worm {
+			return false, 0, ErrRetentionLocked
+		}
+		worm = *req.Worm
+	}
+	if req.RetentionSeconds != nil {
+		if *req.RetentionSeconds < 0 {
+			return false, 0, ErrInvalidRetention
+		}
+		if bucket.Worm == 1 && *req.RetentionSeconds < retention {
+			return false, 0, ErrRetentionLocked
+		}
+		retention = *req.RetentionSeconds
+	}
+	if worm && retention <= 0 {
+		return false, 0, ErrInvalidRetention
+	}
+	return worm, retention, nil
+}
+
+// updateRetention applies WORM settings. Enabling WORM retains the resources
+// already in the bucket.
+func (s *bucketService) updateRetention(ctx context.Context, bucket *sqlc.Bucket, req dto.UpdateBucketRequest) (*sqlc.Bucket, error) {
+	worm, retention, err := retentionSettings(bucket, req)
+	if err != nil {
+		return nil, err
 	}
 
-	bucketPath := filepath.Join(s.storagePath, bucketID)
+	updated, err := s.repo.SetRetention(ctx, bucket.ID, worm, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	if worm {
+		retainUntil := time.Now().UTC().Add(time.Duration(retention) * time.Second)
+		if err := s.repo.ApplyRetention(ctx, bucket.ID, retainUntil); err != nil {
+			return nil, err
+		}
+	}
+	return updated, nil
+}
+
+// checkEncryption reports whether a bucket with the given visibility may be encrypted
+func (s *bucketService) checkEncryption(public bool) error {
+	if !s.encryptionEnabled {
+		return encryption.ErrUnavailable
+	}
+	if public {
+		return ErrEncryptedPublic
+	}
+	return nil
+}
+
+func (s *bucketService) Delete(ctx context.Context, clientID, bucketID string) error {
+	bucket, err := s.deletableBucket(ctx, clientID, bucketID)
+	if err != nil {
+		return err
+	}
+
+	bucketPath := s.layout.BucketDir(bucket.ClientID, bucketID)
+
+	// Resource rows go with the bucket (ON DELETE CASCADE), so the size of
+	// its encrypted files is read first to release it from the storage total.
+	// Shared content is released when its blobs are collected.
+	size, err := s.repo.EncryptedSize(ctx, bucketID)
+	if err != nil {
+		return err
+	}
 
 	if err := s.repo.Delete(ctx, bucketID); err != nil {
 		return err
 	}
+	s.usage.Add(-size)
 
 	// Remove public symlink if bucket was public
 	if bucket.IsPublic == 1 {
-		s.removePublicSymlink(bucketID)
+		s.layout.UnlinkPublic(bucketID)
 	}
 
 	os.RemoveAll(bucketPath)
+	os.RemoveAll(s.layout.TranscodeDir(bucketID))
+	os.RemoveAll(s.layout.ChunkDir(bucketID))
 
 	return nil
 }
 
-func (s *bucketService) createPublicSymlink(bucketID string) error {
-	publicDir := filepath.Join(s.storagePath, "public")
-	if err := os.MkdirAll(publicDir, 0755); err != nil {
-		return err
+func (s *bucketService) PreviewDelete(ctx context.Context, clientID, bucketID string) (*dto.DeleteBucketResponse, error) {
+	bucket, err := s.deletableBucket(ctx, clientID, bucketID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Use relative path from public folder to bucket folder
-	targetPath := filepath.Join("..", bucketID)
-	symlinkPath := filepath.Join(publicDir, bucketID)
+	totals, err := s.repo.ResourceTotals(ctx, bucket.ID)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := s.repo.WebhookCount(ctx, bucket.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.DeleteBucketResponse{
+		BucketID:  bucket.ID,
+		DryRun:    true,
+		Resources: totals.Count,
+		TotalSize: totals.TotalSize,
+		Webhooks:  webhooks,
+	}, nil
+}
+
+// deletableBucket returns the client's bucket if it may be deleted, i.e. no
+// resource in a WORM bucket is still under retention
+func (s *bucketService) deletableBucket(ctx context.Context, clientID, bucketID string) (*sqlc.Bucket, error) {
+	bucket, err := s.repo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, repository.ErrBucketNotFound
+	}
+
+	if bucket.Worm == 1 {
+		retained, err := s.repo.HasRetainedResources(ctx, bucketID)
+		if err != nil {
+			return nil, err
+		}
+		if retained {
+			return nil, repository.ErrRetentionActive
+		}
+	}
+
+	return bucket, nil
+}
+
+// RepairSymlinks recreates the public link of every public bucket that is
+// missing or points to the wrong directory, and removes links left behind by
+// buckets that are no longer public. Correct links are left alone.
+func (s *bucketService) RepairSymlinks(ctx context.Context) (*dto.RepairSymlinksResponse, error) {
+	buckets, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.RepairSymlinksResponse{
+		Fixed:   []string{},
+		Removed: []string{},
+		Failed:  []dto.SymlinkRepairFailure{},
+	}
+
+	public := make(map[string]bool)
+	for _, b := range buckets {
+		if b.IsPublic != 1 {
+			continue
+		}
+		public[b.ID] = true
+		result.Checked++
+
+		fixed, err := s.layout.RepairPublic(b.ClientID, b.ID)
+		if err != nil {
+			result.Failed = append(result.Failed, dto.SymlinkRepairFailure{BucketID: b.ID, Error: err.Error()})
+			continue
+		}
+		if fixed {
+			result.Fixed = append(result.Fixed, b.ID)
+		}
+	}
+
+	// A link to a private or deleted bucket would keep serving its files
+	links, err := s.layout.PublicLinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range links {
+		if !public[id] {
+			s.layout.UnlinkPublic(id)
+			result.Removed = append(result.Removed, id)
+		}
+	}
+
+	if len(result.Fixed)+len(result.Removed)+len(result.Failed) > 0 {
+		log.Printf("Repaired public symlinks: %d fixed, %d removed, %d failed", len(result.Fixed), len(result.Removed), len(result.Failed))
+	}
+	return result, nil
+}
+
+// Transfer hands a bucket, with its resources and webhooks, to another active
+// client. Under the client storage layout the bucket directory moves into the
+// new owner's folder and a public link is repointed at it.
+func (s *bucketService) Transfer(ctx context.Context, bucketID, clientID string) (*dto.BucketResponse, error) {
+	bucket, err := s.repo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.repo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.IsActive == 0 {
+		return nil, ErrClientInactive
+	}
+
+	previousOwner := bucket.ClientID
+	if previousOwner != clientID {
+		bucket, err = s.repo.SetClientID(ctx, bucketID, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.layout.MoveBucket(previousOwner, clientID, bucketID); err != nil {
+			s.repo.SetClientID(ctx, bucketID, previousOwner)
+			return nil, fmt.Errorf("failed to move bucket storage: %w", err)
+		}
+		if bucket.IsPublic == 1 {
+			if _, err := s.layout.RepairPublic(clientID, bucketID); err != nil {
+				log.Printf("Error repointing public link of transferred bucket %s: %v", bucketID, err)
+			}
+		}
+	}
 
-	return os.Symlink(targetPath, symlinkPath)
+	return bucketResponse(bucket), nil
 }
 
-func (s *bucketService) removePublicSymlink(bucketID string) {
-	symlinkPath := filepath.Join(s.storagePath, "public", bucketID)
-	os.Remove(symlinkPath)
+func isValidCacheControl(value string) bool {
+	return len(value) <= maxCacheControlLen && cacheControlRegex.MatchString(value)
 }
 
 func isValidBucketName(name string) bool {
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+)
+
+func TestPreviewDeleteLeavesBucket(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	dbtest.Resource(t, db, bucket.ID, "aaaa", 3)
+	dbtest.Resource(t, db, bucket.ID, "bbbb", 5)
+	ctx := context.Background()
+	if _, err := db.Queries.CreateWebhookURL(ctx, sqlc.CreateWebhookURLParams{
+		ID: "webhook-1", BucketID: bucket.ID, Url: "https://example.com/hook", EventType: "resource.new", IsActive: 1,
+	}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	file := filepath.Join(layout.BucketDir(client.ID, bucket.ID), "aaaa")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repository.New(db.Queries)
+	svc := New(repo, layout, false, false, false, nil, nil)
+
+	preview, err := svc.PreviewDelete(ctx, client.ID, bucket.ID)
+	if err != nil {
+		t.Fatalf("PreviewDelete() error = %v", err)
+	}
+	if !preview.DryRun || preview.Resources != 2 || preview.TotalSize != 8 || preview.Webhooks != 1 {
+		t.Errorf("PreviewDelete() = %+v, want a dry run of 2 resources, 8 bytes and 1 webhook", preview)
+	}
+
+	if _, err := repo.GetByID(ctx, bucket.ID); err != nil {
+		t.Errorf("bucket after dry run: %v", err)
+	}
+	if totals, err := repo.ResourceTotals(ctx, bucket.ID); err != nil || totals.Count != 2 {
+		t.Errorf("resources after dry run = %+v, %v, want 2", totals, err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("file after dry run: %v", err)
+	}
+
+	// The preview described what an actual delete removes
+	if err := svc.Delete(ctx, client.ID, bucket.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.GetByID(ctx, bucket.ID); !errors.Is(err, repository.ErrBucketNotFound) {
+		t.Errorf("bucket after delete: error = %v, want ErrBucketNotFound", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file after delete: %v, want it removed", err)
+	}
+}
+
+func TestPreviewDeleteRefusesRetainedBucket(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	ctx := context.Background()
+	if _, err := db.DB.ExecContext(ctx, `UPDATE buckets SET worm = 1, retention_seconds = 3600 WHERE id = ?`, bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.ExecContext(ctx, `INSERT INTO resources (id, bucket_id, hash, size, content_type, extension, retain_until)
+		VALUES ('r1', ?, 'aaaa', 1, 'text/plain', '', datetime('now', '+1 hour'))`, bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	svc := New(repository.New(db.Queries), layout, false, false, false, nil, nil)
+
+	if _, err := svc.PreviewDelete(ctx, client.ID, bucket.ID); !errors.Is(err, repository.ErrRetentionActive) {
+		t.Errorf("PreviewDelete() error = %v, want ErrRetentionActive", err)
+	}
+}
+
+func TestUpdateRejectedWritesNothing(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	ctx := context.Background()
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	repo := repository.New(db.Queries)
+	svc := New(repo, layout, false, false, false, nil, nil)
+
+	// The rate limit and cache control are valid, the retention is not
+	sensitive := true
+	rateLimit := int64(1024)
+	cacheControl := "no-cache"
+	retention := int64(-1)
+	_, err = svc.Update(ctx, client.ID, bucket.ID, dto.UpdateBucketRequest{
+		Sensitive:         &sensitive,
+		DownloadRateLimit: &rateLimit,
+		CacheControl:      &cacheControl,
+		RetentionSeconds:  &retention,
+	})
+	if !errors.Is(err, ErrInvalidRetention) {
+		t.Fatalf("Update() error = %v, want ErrInvalidRetention", err)
+	}
+
+	got, err := repo.GetByID(ctx, bucket.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Sensitive != 0 || got.DownloadRateLimit != 0 || got.CacheControl != "" {
+		t.Errorf("bucket after rejected update = %+v, want it unchanged", got)
+	}
+}
+
+func TestDeleteRetainedBucket(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	ctx := context.Background()
+	if _, err := db.DB.ExecContext(ctx, `UPDATE buckets SET worm = 1, retention_seconds = 3600 WHERE id = ?`, bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.ExecContext(ctx, `INSERT INTO resources (id, bucket_id, hash, size, content_type, extension, retain_until)
+		VALUES ('r1', ?, 'aaaa', 1, 'text/plain', '', datetime('now', '+1 hour'))`, bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	repo := repository.New(db.Queries)
+	svc := New(repo, layout, false, false, false, nil, nil)
+
+	if err := svc.Delete(ctx, client.ID, bucket.ID); !errors.Is(err, repository.ErrRetentionActive) {
+		t.Fatalf("Delete() before retain_until error = %v, want ErrRetentionActive", err)
+	}
+	if _, err := repo.GetByID(ctx, bucket.ID); err != nil {
+		t.Errorf("bucket after refused delete: %v", err)
+	}
+
+	if _, err := db.DB.ExecContext(ctx, `UPDATE resources SET retain_until = datetime('now', '-1 second') WHERE id = 'r1'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, client.ID, bucket.ID); err != nil {
+		t.Fatalf("Delete() after retain_until error = %v", err)
+	}
+	if _, err := repo.GetByID(ctx, bucket.ID); !errors.Is(err, repository.ErrBucketNotFound) {
+		t.Errorf("bucket after delete: error = %v, want ErrBucketNotFound", err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	db := dbtest.New(t)
+	owner := dbtest.Client(t, db, "client-1")
+	recipient := dbtest.Client(t, db, "client-2")
+	inactive := dbtest.Client(t, db, "client-3")
+	bucket := dbtest.Bucket(t, db, owner.ID, "bucket-1")
+	ctx := context.Background()
+	if _, err := db.DB.ExecContext(ctx, `UPDATE clients SET is_active = 0 WHERE id = ?`, inactive.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutClient)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	file := filepath.Join(layout.BucketDir(owner.ID, bucket.ID), "aaaa")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.New(db.Queries)
+	svc := New(repo, layout, false, false, false, nil, nil)
+
+	// Refused transfers leave the bucket with its owner
+	refused := []struct {
+		name     string
+		clientID string
+		want     error
+	}{
+		{"nonexistent client", "client-404", repository.ErrClientNotFound},
+		{"inactive client", inactive.ID, ErrClientInactive},
+	}
+	for _, tt := range refused {
+		if _, err := svc.Transfer(ctx, bucket.ID, tt.clientID); !errors.Is(err, tt.want) {
+			t.Errorf("Transfer() to %s error = %v, want %v", tt.name, err, tt.want)
+		}
+		if got, err := repo.GetByID(ctx, bucket.ID); err != nil || got.ClientID != owner.ID {
+			t.Errorf("owner after transfer to %s = %v, %v, want %s", tt.name, got, err, owner.ID)
+		}
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("file after transfer to %s: %v", tt.name, err)
+		}
+	}
+
+	if _, err := svc.Transfer(ctx, bucket.ID, recipient.ID); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if got, err := repo.GetByID(ctx, bucket.ID); err != nil || got.ClientID != recipient.ID {
+		t.Errorf("owner after transfer = %v, %v, want %s", got, err, recipient.ID)
+	}
+	moved := filepath.Join(layout.BucketDir(recipient.ID, bucket.ID), "aaaa")
+	if data, err := os.ReadFile(moved); err != nil || string(data) != "abc" {
+		t.Errorf("file in the new owner's folder = %q, %v, want abc", data, err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file in the old owner's folder: %v, want it moved", err)
+	}
+}
+
+func TestCreateBucketLimit(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	dbtest.Bucket(t, db, client.ID, "bucket-1")
+	ctx := context.Background()
+
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	bucketCap := quota.New("bucket", 2, db.Queries.CountBuckets)
+	svc := New(repository.New(db.Queries), layout, false, false, false, nil, bucketCap)
+
+	// One slot left below the limit
+	if _, _, err := svc.Create(ctx, client.ID, dto.CreateBucketRequest{Name: "second"}, false); err != nil {
+		t.Fatalf("Create() at limit-1 error = %v", err)
+	}
+
+	_, _, err = svc.Create(ctx, client.ID, dto.CreateBucketRequest{Name: "third"}, false)
+	var limitErr *quota.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Create() at the limit error = %v, want *quota.LimitError", err)
+	}
+	if limitErr.Kind != "bucket" || limitErr.Limit != 2 {
+		t.Errorf("LimitError = %+v, want bucket limit of 2", limitErr)
+	}
+	if n, err := db.Queries.CountBuckets(ctx); err != nil || n != 2 {
+		t.Errorf("CountBuckets() = %d, %v, want 2", n, err)
+	}
+}
+
+func TestCreateMixedCaseNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		foldNames bool
+		input     string
+		want      string
+		wantErr   error
+	}{
+		{"lower-case", false, "my-photos", "my-photos", nil},
+		{"mixed case rejected", false, "My-Photos", "", ErrInvalidBucketName},
+		{"upper case rejected", false, "PHOTOS", "", ErrInvalidBucketName},
+		{"mixed case folded", true, "My-Photos", "my-photos", nil},
+		{"upper case folded", true, "PHOTOS.2024", "photos.2024", nil},
+		{"folding keeps other rules", true, "My_Photos", "", ErrInvalidBucketName},
+		{"folding keeps the length rule", true, "AB", "", ErrInvalidBucketName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			client := dbtest.Client(t, db, "client-1")
+			layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+			if err != nil {
+				t.Fatalf("NewLayout() error = %v", err)
+			}
+			svc := New(repository.New(db.Queries), layout, false, false, tt.foldNames, nil, nil)
+
+			bucket, _, err := svc.Create(context.Background(), client.ID, dto.CreateBucketRequest{Name: tt.input}, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && bucket.Name != tt.want {
+				t.Errorf("Create(%q) name = %q, want %q", tt.input, bucket.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateFoldedNameConflicts(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	svc := New(repository.New(db.Queries), layout, false, false, true, nil, nil)
+	ctx := context.Background()
+
+	first, _, err := svc.Create(ctx, client.ID, dto.CreateBucketRequest{Name: "photos"}, false)
+	if err != nil {
+		t.Fatalf("Create(photos) error = %v", err)
+	}
+	if _, _, err := svc.Create(ctx, client.ID, dto.CreateBucketRequest{Name: "Photos"}, false); !errors.Is(err, repository.ErrBucketExists) {
+		t.Errorf("Create(Photos) error = %v, want ErrBucketExists", err)
+	}
+
+	// An idempotent create finds the bucket whatever the case
+	existing, created, err := svc.Create(ctx, client.ID, dto.CreateBucketRequest{Name: "PHOTOS"}, true)
+	if err != nil || created || existing.ID != first.ID {
+		t.Errorf("idempotent Create(PHOTOS) = %v, %v, %v, want %s not created", existing, created, err, first.ID)
+	}
+}
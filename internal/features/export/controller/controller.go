@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/audit"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/pkg/response"
+	"github.com/labstack/echo/v4"
+)
+
+type ExportController struct {
+	service service.ExportService
+}
+
+func New(svc service.ExportService) *ExportController {
+	return &ExportController{service: svc}
+}
+
+// RegisterAdminRoutes registers the export routes on an admin-only group
+func (c *ExportController) RegisterAdminRoutes(g *echo.Group) {
+	g.GET("/export", c.Export, middleware.Streaming())
+	g.POST("/import", c.Import, middleware.Streaming())
+}
+
+// Export godoc
+// @Summary Export all metadata
+// @Description Stream every client, bucket, resource, webhook and webhook header as NDJSON, one {"type","data"} record per line, starting with a header record (Admin only). Client secrets are not exported; webhook header values are, so treat the file as a credential. File contents are not included and must be copied separately.
+// @Tags admin
+// @Produce application/x-ndjson
+// @Security BearerAuth
+// @Success 200 {string} string "NDJSON export"
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/export [get]
+func (c *ExportController) Export(ctx echo.Context) error {
+	audit.Event(audit.MetadataExported,
+		"actor", middleware.GetClientID(ctx),
+		"ip", ctx.RealIP(),
+	)
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	response.Attachment(ctx, "aoui-drive-export-"+time.Now().UTC().Format("20060102-150405")+".ndjson")
+	response.NoStore(ctx)
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	// Headers are already sent; a failure here can only truncate the stream
+	if err := c.service.Export(ctx.Request().Context(), ctx.Response()); err != nil {
+		log.Printf("Error streaming metadata export: %v", err)
+	}
+	return nil
+}
+
+// Import godoc
+// @Summary Import metadata
+// @Description Apply an NDJSON export from GET /admin/export (Admin only). The import runs in one transaction: a record that cannot be applied rolls everything back and is reported with its line number. Records whose ID or unique key already exists are skipped, so importing the same file twice is harmless. Imported clients have no secret and must get one from POST /admin/clients/{id}/regenerate-secret.
+// @Tags admin
+// @Accept application/x-ndjson
+// @Produce json
+// @Security BearerAuth
+// @Param request body string true "NDJSON export"
+// @Success 200 {object} response.Response{data=dto.ImportResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/import [post]
+func (c *ExportController) Import(ctx echo.Context) error {
+	result, err := c.service.Import(ctx.Request().Context(), ctx.Request().Body)
+	if err != nil {
+		var importErr *service.ImportError
+		if errors.As(err, &importErr) {
+			return response.BadRequest(ctx, importErr.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	audit.Event(audit.MetadataImported,
+		"actor", middleware.GetClientID(ctx),
+		"ip", ctx.RealIP(),
+		"clients", result.Clients.Imported,
+		"buckets", result.Buckets.Imported,
+		"resources", result.Resources.Imported,
+	)
+
+	return response.Success(ctx, result)
+}
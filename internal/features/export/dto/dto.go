@@ -0,0 +1,118 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FormatVersion is written in the header of every export and checked on import
+const FormatVersion = 1
+
+// Record types, in the order an export writes them. Parents always come
+// before the records that reference them.
+const (
+	TypeHeader        = "header"
+	TypeClient        = "client"
+	TypeBucket        = "bucket"
+	TypeResource      = "resource"
+	TypeWebhook       = "webhook"
+	TypeWebhookHeader = "webhook_header"
+)
+
+// Record is one line of an NDJSON export
+type Record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Header is the first record of an export
+type Header struct {
+	FormatVersion int       `json:"format_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+}
+
+// Client is exported without its secret key
+type Client struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	AccessKey string    `json:"access_key"`
+	Role      string    `json:"role"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Bucket struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	ClientID          string    `json:"client_id"`
+	Public            bool      `json:"public"`
+	WebhooksSuspended bool      `json:"webhooks_suspended"`
+	Sensitive         bool      `json:"sensitive"`
+	Worm              bool      `json:"worm"`
+	RetentionSeconds  int64     `json:"retention_seconds"`
+	Encrypted         bool      `json:"encrypted"`
+	ScanUploads       bool      `json:"scan_uploads"`
+	DownloadRateLimit int64     `json:"download_rate_limit"`
+	CacheControl      string    `json:"cache_control,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type Resource struct {
+	ID               string     `json:"id"`
+	BucketID         string     `json:"bucket_id"`
+	Hash             string     `json:"hash"`
+	Size             int64      `json:"size"`
+	ContentType      string     `json:"content_type"`
+	Extension        string     `json:"extension"`
+	Encrypted        bool       `json:"encrypted"`
+	ProcessingStatus string     `json:"processing_status"`
+	ProcessingError  string     `json:"processing_error,omitempty"`
+	OriginalName     string     `json:"original_name,omitempty"`
+	RetainUntil      *time.Time `json:"retain_until,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type Webhook struct {
+	ID                   string    `json:"id"`
+	BucketID             string    `json:"bucket_id"`
+	URL                  string    `json:"url"`
+	EventType            string    `json:"event_type"`
+	IsActive             bool      `json:"is_active"`
+	CompressPayload      bool      `json:"compress_payload"`
+	PartitionKeyTemplate string    `json:"partition_key_template"`
+	PayloadVersion       int64     `json:"payload_version"`
+	ContentTypeFilter    string    `json:"content_type_filter"`
+	IncludeDownloadToken bool      `json:"include_download_token"`
+	MaxAttempts          int64     `json:"max_attempts"`
+	RetryBackoffSeconds  int64     `json:"retry_backoff_seconds"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// WebhookHeader is exported with its value, which may hold a credential
+type WebhookHeader struct {
+	ID           string    `json:"id"`
+	WebhookURLID string    `json:"webhook_url_id"`
+	Name         string    `json:"name"`
+	Value        string    `json:"value"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Responses
+
+// ImportCount reports how many records of one type were inserted, and how
+// many were skipped because a record with the same ID or unique key exists
+type ImportCount struct {
+	Imported int64 `json:"imported"`
+	Skipped  int64 `json:"skipped"`
+}
+
+type ImportResponse struct {
+	Clients        ImportCount `json:"clients"`
+	Buckets        ImportCount `json:"buckets"`
+	Resources      ImportCount `json:"resources"`
+	Webhooks       ImportCount `json:"webhooks"`
+	WebhookHeaders ImportCount `json:"webhook_headers"`
+}
@@ -0,0 +1,32 @@
+package export
+
+import (
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/controller"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/service"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+type Feature struct {
+	Controller *controller.ExportController
+	Service    service.ExportService
+	Repository repository.ExportRepository
+}
+
+func New(db *database.Database, usage *storage.Usage) *Feature {
+	repo := repository.New(db.Queries)
+	svc := service.New(db, repo, usage)
+	ctrl := controller.New(svc)
+
+	return &Feature{
+		Controller: ctrl,
+		Service:    svc,
+		Repository: repo,
+	}
+}
+
+func (f *Feature) RegisterAdminRoutes(g *echo.Group) {
+	f.Controller.RegisterAdminRoutes(g)
+}
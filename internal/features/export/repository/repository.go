@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+// ExportRepository pages through every table for exports and inserts the
+// records of an import. The Import methods report whether a row was
+// inserted; existing rows are left unchanged.
+type ExportRepository interface {
+	Clients(ctx context.Context, after string, limit int64) ([]sqlc.ExportClientsRow, error)
+	Buckets(ctx context.Context, after string, limit int64) ([]sqlc.Bucket, error)
+	Resources(ctx context.Context, after string, limit int64) ([]sqlc.Resource, error)
+	Webhooks(ctx context.Context, after string, limit int64) ([]sqlc.WebhookUrl, error)
+	WebhookHeaders(ctx context.Context, after string, limit int64) ([]sqlc.WebhookHeader, error)
+
+	ImportClient(ctx context.Context, params sqlc.ImportClientParams) (bool, error)
+	ImportBucket(ctx context.Context, params sqlc.ImportBucketParams) (bool, error)
+	ImportResource(ctx context.Context, params sqlc.ImportResourceParams) (bool, error)
+	ImportWebhook(ctx context.Context, params sqlc.ImportWebhookURLParams) (bool, error)
+	ImportWebhookHeader(ctx context.Context, params sqlc.ImportWebhookHeaderParams) (bool, error)
+
+	// StoredSize is the number of bytes stored on disk, as counted against
+	// MAX_TOTAL_STORAGE
+	StoredSize(ctx context.Context) (int64, error)
+
+	// WithTx returns a repository that runs its queries in tx
+	WithTx(tx *sql.Tx) ExportRepository
+}
+
+type exportRepository struct {
+	queries *sqlc.Queries
+}
+
+func New(queries *sqlc.Queries) ExportRepository {
+	return &exportRepository{queries: queries}
+}
+
+func (r *exportRepository) WithTx(tx *sql.Tx) ExportRepository {
+	return &exportRepository{queries: r.queries.WithTx(tx)}
+}
+
+func (r *exportRepository) Clients(ctx context.Context, after string, limit int64) ([]sqlc.ExportClientsRow, error) {
+	return r.queries.ExportClients(ctx, sqlc.ExportClientsParams{After: after, Limit: limit})
+}
+
+func (r *exportRepository) Buckets(ctx context.Context, after string, limit int64) ([]sqlc.Bucket, error) {
+	return r.queries.ExportBuckets(ctx, sqlc.ExportBucketsParams{After: after, Limit: limit})
+}
+
+func (r *exportRepository) Resources(ctx context.Context, after string, limit int64) ([]sqlc.Resource, error) {
+	return r.queries.ExportResources(ctx, sqlc.ExportResourcesParams{After: after, Limit: limit})
+}
+
+func (r *exportRepository) Webhooks(ctx context.Context, after string, limit int64) ([]sqlc.WebhookUrl, error) {
+	return r.queries.ExportWebhookURLs(ctx, sqlc.ExportWebhookURLsParams{After: after, Limit: limit})
+}
+
+func (r *exportRepository) WebhookHeaders(ctx context.Context, after string, limit int64) ([]sqlc.WebhookHeader, error) {
+	return r.queries.ExportWebhookHeaders(ctx, sqlc.ExportWebhookHeadersParams{After: after, Limit: limit})
+}
+
+func (r *exportRepository) ImportClient(ctx context.Context, params sqlc.ImportClientParams) (bool, error) {
+	rows, err := r.queries.ImportClient(ctx, params)
+	return rows > 0, err
+}
+
+func (r *exportRepository) ImportBucket(ctx context.Context, params sqlc.ImportBucketParams) (bool, error) {
+	rows, err := r.queries.ImportBucket(ctx, params)
+	return rows > 0, err
+}
+
+func (r *exportRepository) ImportResource(ctx context.Context, params sqlc.ImportResourceParams) (bool, error) {
+	rows, err := r.queries.ImportResource(ctx, params)
+	return rows > 0, err
+}
+
+func (r *exportRepository) ImportWebhook(ctx context.Context, params sqlc.ImportWebhookURLParams) (bool, error) {
+	rows, err := r.queries.ImportWebhookURL(ctx, params)
+	return rows > 0, err
+}
+
+func (r *exportRepository) ImportWebhookHeader(ctx context.Context, params sqlc.ImportWebhookHeaderParams) (bool, error) {
+	rows, err := r.queries.ImportWebhookHeader(ctx, params)
+	return rows > 0, err
+}
+
+func (r *exportRepository) StoredSize(ctx context.Context) (int64, error) {
+	return r.queries.SumStoredSize(ctx)
+}
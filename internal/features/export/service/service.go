@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/export/repository"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+)
+
+// exportPageSize is how many rows are read per query while exporting
+const exportPageSize = 500
+
+var (
+	ErrMissingHeader     = errors.New("export must start with a header record")
+	ErrUnsupportedFormat = errors.New("unsupported export format version")
+	ErrUnknownRecordType = errors.New("unknown record type")
+)
+
+// ImportError reports the record of an import that could not be applied.
+// Records are numbered from 1, which is also the line number of the export.
+type ImportError struct {
+	Record int
+	Err    error
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+type ExportService interface {
+	// Export writes every client, bucket, resource, webhook and webhook
+	// header to w as NDJSON, one record per line. File contents are not
+	// included.
+	Export(ctx context.Context, w io.Writer) error
+	// Import applies an export in a single transaction, so either every
+	// record is applied or none is. Records that already exist are skipped.
+	Import(ctx context.Context, r io.Reader) (*dto.ImportResponse, error)
+}
+
+type exportService struct {
+	db    *database.Database
+	repo  repository.ExportRepository
+	usage *storage.Usage
+}
+
+func New(db *database.Database, repo repository.ExportRepository, usage *storage.Usage) ExportService {
+	return &exportService{
+		db:    db,
+		repo:  repo,
+		usage: usage,
+	}
+}
+
+func (s *exportService) Export(ctx context.Context, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	write := func(recordType string, data any) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(dto.Record{Type: recordType, Data: raw})
+	}
+
+	if err := write(dto.TypeHeader, dto.Header{
+		FormatVersion: dto.FormatVersion,
+		ExportedAt:    time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+
+	err := exportPages(ctx, s.repo.Clients, func(c sqlc.ExportClientsRow) (string, error) {
+		return c.ID, write(dto.TypeClient, dto.Client{
+			ID:        c.ID,
+			Name:      c.Name,
+			AccessKey: c.AccessKey,
+			Role:      c.Role,
+			IsActive:  c.IsActive == 1,
+			CreatedAt: c.CreatedAt.Time,
+			UpdatedAt: c.UpdatedAt.Time,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export clients: %w", err)
+	}
+
+	err = exportPages(ctx, s.repo.Buckets, func(b sqlc.Bucket) (string, error) {
+		return b.ID, write(dto.TypeBucket, dto.Bucket{
+			ID:                b.ID,
+			Name:              b.Name,
+			ClientID:          b.ClientID,
+			Public:            b.IsPublic == 1,
+			WebhooksSuspended: b.WebhooksSuspended == 1,
+			Sensitive:         b.Sensitive == 1,
+			Worm:              b.Worm == 1,
+			RetentionSeconds:  b.RetentionSeconds,
+			Encrypted:         b.Encrypted == 1,
+			ScanUploads:       b.ScanUploads == 1,
+			DownloadRateLimit: b.DownloadRateLimit,
+			CacheControl:      b.CacheControl,
+			CreatedAt:         b.CreatedAt.Time,
+			UpdatedAt:         b.UpdatedAt.Time,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export buckets: %w", err)
+	}
+
+	err = exportPages(ctx, s.repo.Resources, func(r sqlc.Resource) (string, error) {
+		resource := dto.Resource{
+			ID:               r.ID,
+			BucketID:         r.BucketID,
+			Hash:             r.Hash,
+			Size:             r.Size,
+			ContentType:      r.ContentType,
+			Extension:        r.Extension,
+			Encrypted:        r.Encrypted == 1,
+			ProcessingStatus: r.ProcessingStatus,
+			ProcessingError:  r.ProcessingError.String,
+			OriginalName:     r.OriginalName,
+			CreatedAt:        r.CreatedAt.Time,
+		}
+		if r.RetainUntil.Valid {
+			resource.RetainUntil = &r.RetainUntil.Time
+		}
+		return r.ID, write(dto.TypeResource, resource)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export resources: %w", err)
+	}
+
+	err = exportPages(ctx, s.repo.Webhooks, func(w sqlc.WebhookUrl) (string, error) {
+		return w.ID, write(dto.TypeWebhook, dto.Webhook{
+			ID:                   w.ID,
+			BucketID:             w.BucketID,
+			URL:                  w.Url,
+			EventType:            w.EventType,
+			IsActive:             w.IsActive == 1,
+			CompressPayload:      w.CompressPayload == 1,
+			PartitionKeyTemplate: w.PartitionKeyTemplate,
+			PayloadVersion:       w.PayloadVersion,
+			ContentTypeFilter:    w.ContentTypeFilter,
+			IncludeDownloadToken: w.IncludeDownloadToken == 1,
+			MaxAttempts:          w.MaxAttempts,
+			RetryBackoffSeconds:  w.RetryBackoffSeconds,
+			CreatedAt:            w.CreatedAt.Time,
+			UpdatedAt:            w.UpdatedAt.Time,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export webhooks: %w", err)
+	}
+
+	err = exportPages(ctx, s.repo.WebhookHeaders, func(h sqlc.WebhookHeader) (string, error) {
+		return h.ID, write(dto.TypeWebhookHeader, dto.WebhookHeader{
+			ID:           h.ID,
+			WebhookURLID: h.WebhookUrlID,
+			Name:         h.HeaderName,
+			Value:        h.HeaderValue,
+			CreatedAt:    h.CreatedAt.Time,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export webhook headers: %w", err)
+	}
+
+	return nil
+}
+
+// exportPages reads a table page by page in ID order and passes each row to
+// write, which returns the row's ID so the next page starts after it
+func exportPages[T any](ctx context.Context, list func(ctx context.Context, after string, limit int64) ([]T, error), write func(T) (string, error)) error {
+	after := ""
+	for {
+		rows, err := list(ctx, after, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if after, err = write(row); err != nil {
+				return err
+			}
+		}
+		if len(rows) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+func (s *exportService) Import(ctx context.Context, r io.Reader) (*dto.ImportResponse, error) {
+	tx, err := s.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Imported resources whose content is already stored take no new space,
+	// so the storage total is compared rather than their sizes added up
+	repo := s.repo.WithTx(tx)
+	before, err := repo.StoredSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := importRecords(ctx, repo, json.NewDecoder(r))
+	if err != nil {
+		return nil, err
+	}
+	after, err := repo.StoredSize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	s.usage.Add(after - before)
+
+	return result, nil
+}
+
+// importRecords applies each record of dec and returns the counts
+func importRecords(ctx context.Context, repo repository.ExportRepository, dec *json.Decoder) (*dto.ImportResponse, error) {
+	result := &dto.ImportResponse{}
+
+	for n := 1; ; n++ {
+		var record dto.Record
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				if n == 1 {
+					return nil, &ImportError{Record: n, Err: ErrMissingHeader}
+				}
+				return result, nil
+			}
+			return nil, &ImportError{Record: n, Err: err}
+		}
+
+		if n == 1 {
+			if err := checkHeader(record); err != nil {
+				return nil, &ImportError{Record: n, Err: err}
+			}
+			continue
+		}
+
+		if err := importRecord(ctx, repo, record, result); err != nil {
+			return nil, &ImportError{Record: n, Err: err}
+		}
+	}
+}
+
+func checkHeader(record dto.Record) error {
+	if record.Type != dto.TypeHeader {
+		return ErrMissingHeader
+	}
+	var header dto.Header
+	if err := json.Unmarshal(record.Data, &header); err != nil {
+		return err
+	}
+	if header.FormatVersion != dto.FormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedFormat, header.FormatVersion)
+	}
+	return nil
+}
+
+// importRecord inserts one record and counts it in result
+func importRecord(ctx context.Context, repo repository.ExportRepository, record dto.Record, result *dto.ImportResponse) error {
+	switch record.Type {
+	case dto.TypeClient:
+		var c dto.Client
+		if err := json.Unmarshal(record.Data, &c); err != nil {
+			return err
+		}
+		inserted, err := repo.ImportClient(ctx, sqlc.ImportClientParams{
+			ID:        c.ID,
+			Name:      c.Name,
+			AccessKey: c.AccessKey,
+			Role:      c.Role,
+			IsActive:  flag(c.IsActive),
+			CreatedAt: nullTime(c.CreatedAt),
+			UpdatedAt: nullTime(c.UpdatedAt),
+		})
+		return count(&result.Clients, inserted, err)
+
+	case dto.TypeBucket:
+		var b dto.Bucket
+		if err := json.Unmarshal(record.Data, &b); err != nil {
+			return err
+		}
+		inserted, err := repo.ImportBucket(ctx, sqlc.ImportBucketParams{
+			ID:                b.ID,
+			Name:              b.Name,
+			ClientID:          b.ClientID,
+			IsPublic:          flag(b.Public),
+			CreatedAt:         nullTime(b.CreatedAt),
+			UpdatedAt:         nullTime(b.UpdatedAt),
+			WebhooksSuspended: flag(b.WebhooksSuspended),
+			Sensitive:         flag(b.Sensitive),
+			Worm:              flag(b.Worm),
+			RetentionSeconds:  b.RetentionSeconds,
+			Encrypted:         flag(b.Encrypted),
+			ScanUploads:       flag(b.ScanUploads),
+			DownloadRateLimit: b.DownloadRateLimit,
+			CacheControl:      b.CacheControl,
+		})
+		return count(&result.Buckets, inserted, err)
+
+	case dto.TypeResource:
+		var r dto.Resource
+		if err := json.Unmarshal(record.Data, &r); err != nil {
+			return err
+		}
+		params := sqlc.ImportResourceParams{
+			ID:               r.ID,
+			BucketID:         r.BucketID,
+			Hash:             r.Hash,
+			Size:             r.Size,
+			ContentType:      r.ContentType,
+			Extension:        r.Extension,
+			CreatedAt:        nullTime(r.CreatedAt),
+			Encrypted:        flag(r.Encrypted),
+			ProcessingStatus: r.ProcessingStatus,
+			ProcessingError:  sql.NullString{String: r.ProcessingError, Valid: r.ProcessingError != ""},
+			OriginalName:     r.OriginalName,
+		}
+		if r.RetainUntil != nil {
+			params.RetainUntil = nullTime(*r.RetainUntil)
+		}
+		inserted, err := repo.ImportResource(ctx, params)
+		return count(&result.Resources, inserted, err)
+
+	case dto.TypeWebhook:
+		var w dto.Webhook
+		if err := json.Unmarshal(record.Data, &w); err != nil {
+			return err
+		}
+		inserted, err := repo.ImportWebhook(ctx, sqlc.ImportWebhookURLParams{
+			ID:                   w.ID,
+			BucketID:             w.BucketID,
+			Url:                  w.URL,
+			EventType:            w.EventType,
+			IsActive:             flag(w.IsActive),
+			CreatedAt:            nullTime(w.CreatedAt),
+			UpdatedAt:            nullTime(w.UpdatedAt),
+			CompressPayload:      flag(w.CompressPayload),
+			PartitionKeyTemplate: w.PartitionKeyTemplate,
+			PayloadVersion:       w.PayloadVersion,
+			ContentTypeFilter:    w.ContentTypeFilter,
+			IncludeDownloadToken: flag(w.IncludeDownloadToken),
+			MaxAttempts:          w.MaxAttempts,
+			RetryBackoffSeconds:  w.RetryBackoffSeconds,
+		})
+		return count(&result.Webhooks, inserted, err)
+
+	case dto.TypeWebhookHeader:
+		var h dto.WebhookHeader
+		if err := json.Unmarshal(record.Data, &h); err != nil {
+			return err
+		}
+		inserted, err := repo.ImportWebhookHeader(ctx, sqlc.ImportWebhookHeaderParams{
+			ID:           h.ID,
+			WebhookUrlID: h.WebhookURLID,
+			HeaderName:   h.Name,
+			HeaderValue:  h.Value,
+			CreatedAt:    nullTime(h.CreatedAt),
+		})
+		return count(&result.WebhookHeaders, inserted, err)
+
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownRecordType, record.Type)
+	}
+}
+
+func count(c *dto.ImportCount, inserted bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if inserted {
+		c.Imported++
+	} else {
+		c.Skipped++
+	}
+	return nil
+}
+
+func flag(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
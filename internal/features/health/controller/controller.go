@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/features/health/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/health/service"
 	"github.com/aouiniamine/aoui-drive/pkg/response"
@@ -19,9 +21,19 @@ func New(svc service.HealthService) *HealthController {
 	}
 }
 
-func (h *HealthController) RegisterRoutes(e *echo.Echo) {
-	e.GET("/health", h.Health)
-	e.GET("/ready", h.Ready)
+func (h *HealthController) RegisterRoutes(g *echo.Group) {
+	g.GET("/health", h.Health)
+	g.GET("/ready", h.Ready)
+	g.GET("/health/storage", h.StorageStats)
+	g.GET("/health/webhooks", h.WebhookStats)
+}
+
+// RegisterAdminRoutes registers the system overview, database metrics and
+// database maintenance on an admin-only group
+func (h *HealthController) RegisterAdminRoutes(g *echo.Group) {
+	g.GET("/stats", h.SystemStats)
+	g.GET("/health/database", h.DatabaseStats)
+	g.POST("/maintenance/optimize", h.Optimize)
 }
 
 // Health godoc
@@ -55,3 +67,83 @@ func (h *HealthController) Ready(c echo.Context) error {
 
 	return response.Success(c, status)
 }
+
+// DatabaseStats godoc
+// @Summary Database metrics
+// @Description Query counts and timings, slow queries and time spent waiting for the SQLite connection since startup (Admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=dto.DatabaseStatsResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/health/database [get]
+func (h *HealthController) DatabaseStats(c echo.Context) error {
+	return response.Success(c, h.service.DatabaseStats())
+}
+
+// StorageStats godoc
+// @Summary Storage usage
+// @Description Bytes stored across all buckets against MAX_TOTAL_STORAGE, and whether uploads are blocked by the read-only tripwire
+// @Tags health
+// @Produce json
+// @Success 200 {object} response.Response{data=dto.StorageStatsResponse}
+// @Router /health/storage [get]
+func (h *HealthController) StorageStats(c echo.Context) error {
+	return response.Success(c, h.service.StorageStats())
+}
+
+// WebhookStats godoc
+// @Summary Webhook backlog
+// @Description Webhook events pending or waiting for a retry, against WEBHOOK_MAX_PENDING. At the cap new deliveries are shed.
+// @Tags health
+// @Produce json
+// @Success 200 {object} response.Response{data=dto.WebhookStatsResponse}
+// @Router /health/webhooks [get]
+func (h *HealthController) WebhookStats(c echo.Context) error {
+	stats, err := h.service.WebhookStats(c.Request().Context())
+	if err != nil {
+		return response.InternalError(c, "failed to count webhook events")
+	}
+	return response.Success(c, stats)
+}
+
+// SystemStats godoc
+// @Summary System overview
+// @Description Counts of clients, buckets, live and trashed resources, logical and physical storage with the deduplication ratio, webhook events pending and failed, and uptime (Admin only). Counts are cached for a minute; generated_at tells when they were computed.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=dto.SystemStatsResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/stats [get]
+func (h *HealthController) SystemStats(c echo.Context) error {
+	stats, err := h.service.SystemStats(c.Request().Context())
+	if err != nil {
+		return response.InternalError(c, "failed to compute system stats")
+	}
+	return response.Success(c, stats)
+}
+
+// Optimize godoc
+// @Summary Optimize the database
+// @Description Checkpoint the SQLite WAL into the database file, truncate it and refresh query planner statistics (Admin only). Waits for running queries and transactions to finish, and holds back new ones until done. Also runs every DATABASE_OPTIMIZE_INTERVAL.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} response.Response{data=dto.DatabaseOptimizeResponse}
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/maintenance/optimize [post]
+func (h *HealthController) Optimize(c echo.Context) error {
+	result, err := h.service.OptimizeDatabase(c.Request().Context())
+	if err != nil {
+		if errors.Is(err, database.ErrMaintenanceRunning) {
+			return response.Conflict(c, err.Error())
+		}
+		return response.InternalError(c, err.Error())
+	}
+	return response.Success(c, result)
+}
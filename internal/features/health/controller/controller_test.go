@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/health/service"
+	"github.com/labstack/echo/v4"
+)
+
+func TestDatabaseStatsAdminOnly(t *testing.T) {
+	db := dbtest.New(t)
+	ctrl := New(service.New(db, nil, 0))
+
+	// The admin group stands in for the auth and RequireAdmin middleware
+	e := echo.New()
+	ctrl.RegisterRoutes(e.Group(""))
+	ctrl.RegisterAdminRoutes(e.Group("/admin", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-Admin") != "true" {
+				return c.NoContent(http.StatusForbidden)
+			}
+			return next(c)
+		}
+	}))
+
+	tests := []struct {
+		name     string
+		target   string
+		admin    bool
+		wantCode int
+	}{
+		{"liveness probe", "/health", false, http.StatusOK},
+		{"public database metrics", "/health/database", false, http.StatusNotFound},
+		{"database metrics without admin", "/admin/health/database", false, http.StatusForbidden},
+		{"database metrics as admin", "/admin/health/database", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.admin {
+				req.Header.Set("X-Admin", "true")
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("GET %s status = %d, want %d", tt.target, rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -1,10 +1,83 @@
 package dto
 
+import "time"
+
 type HealthResponse struct {
 	Status string `json:"status"`
 }
 
 type ReadyResponse struct {
-	Status   string            `json:"status"`
-	Services map[string]string `json:"services"`
+	Status   string                   `json:"status"`
+	Services map[string]ServiceStatus `json:"services"`
+}
+
+// ServiceStatus is the result of one dependency check and how long it took
+type ServiceStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// StorageStatsResponse reports stored bytes against MAX_TOTAL_STORAGE.
+// MaxBytes is 0 when no cap is configured.
+type StorageStatsResponse struct {
+	UsedBytes int64 `json:"used_bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+	ReadOnly  bool  `json:"read_only"`
+}
+
+// WebhookStatsResponse reports the webhook backlog against
+// WEBHOOK_MAX_PENDING. MaxPending is 0 when no cap is configured.
+type WebhookStatsResponse struct {
+	Pending    int64 `json:"pending"`
+	MaxPending int64 `json:"max_pending"`
+}
+
+// SystemStatsResponse is a snapshot of the whole system for admins. Sizes
+// are in bytes: logical counts every resource, physical counts deduplicated
+// files once. DedupRatio is logical over physical, 0 when nothing is stored.
+// Everything but UptimeSeconds may be up to a minute old; GeneratedAt tells
+// when it was computed.
+type SystemStatsResponse struct {
+	Clients          int64              `json:"clients"`
+	Buckets          int64              `json:"buckets"`
+	Resources        int64              `json:"resources"`
+	TrashedResources int64              `json:"trashed_resources"`
+	LogicalBytes     int64              `json:"logical_bytes"`
+	PhysicalBytes    int64              `json:"physical_bytes"`
+	DedupRatio       float64            `json:"dedup_ratio"`
+	Webhooks         SystemWebhookStats `json:"webhooks"`
+	UptimeSeconds    int64              `json:"uptime_seconds"`
+	GeneratedAt      time.Time          `json:"generated_at"`
+}
+
+// SystemWebhookStats counts webhook events waiting for delivery and those
+// that ran out of attempts
+type SystemWebhookStats struct {
+	Pending int64 `json:"pending"`
+	Failed  int64 `json:"failed"`
+}
+
+// DatabaseStatsResponse reports query timings and connection contention since startup.
+// Durations are in milliseconds.
+type DatabaseStatsResponse struct {
+	Queries         int64   `json:"queries"`
+	SlowQueries     int64   `json:"slow_queries"`
+	SlowThresholdMs float64 `json:"slow_threshold_ms"`
+	AvgQueryMs      float64 `json:"avg_query_ms"`
+	MaxQueryMs      float64 `json:"max_query_ms"`
+	WaitCount       int64   `json:"wait_count"`
+	WaitMs          float64 `json:"wait_ms"`
+	InUse           int     `json:"in_use"`
+	Idle            int     `json:"idle"`
+}
+
+// DatabaseOptimizeResponse reports one database maintenance run. Sizes are in
+// bytes and include the WAL file.
+type DatabaseOptimizeResponse struct {
+	SizeBeforeBytes int64   `json:"size_before_bytes"`
+	SizeAfterBytes  int64   `json:"size_after_bytes"`
+	WALBeforeBytes  int64   `json:"wal_before_bytes"`
+	WALAfterBytes   int64   `json:"wal_after_bytes"`
+	CheckpointBusy  bool    `json:"checkpoint_busy"`
+	DurationMs      float64 `json:"duration_ms"`
 }
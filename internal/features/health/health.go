@@ -4,22 +4,29 @@ import (
 	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/features/health/controller"
 	"github.com/aouiniamine/aoui-drive/internal/features/health/service"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
 	"github.com/labstack/echo/v4"
 )
 
 type Feature struct {
+	Service    service.HealthService
 	Controller *controller.HealthController
 }
 
-func New(db *database.Database) *Feature {
-	svc := service.New(db)
+func New(db *database.Database, usage *storage.Usage, webhookMaxPending int64) *Feature {
+	svc := service.New(db, usage, webhookMaxPending)
 	ctrl := controller.New(svc)
 
 	return &Feature{
+		Service:    svc,
 		Controller: ctrl,
 	}
 }
 
-func (f *Feature) RegisterRoutes(e *echo.Echo) {
-	f.Controller.RegisterRoutes(e)
+func (f *Feature) RegisterRoutes(g *echo.Group) {
+	f.Controller.RegisterRoutes(g)
+}
+
+func (f *Feature) RegisterAdminRoutes(g *echo.Group) {
+	f.Controller.RegisterAdminRoutes(g)
 }
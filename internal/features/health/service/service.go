@@ -2,37 +2,228 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/features/health/dto"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
 )
 
 type HealthService interface {
 	Check(ctx context.Context) (*dto.ReadyResponse, error)
+	DatabaseStats() *dto.DatabaseStatsResponse
+	StorageStats() *dto.StorageStatsResponse
+	// WebhookStats counts webhook events waiting for delivery
+	WebhookStats(ctx context.Context) (*dto.WebhookStatsResponse, error)
+	// SystemStats returns the admin overview, recomputed at most every
+	// statsCacheTTL
+	SystemStats(ctx context.Context) (*dto.SystemStatsResponse, error)
+	// OptimizeDatabase checkpoints and truncates the WAL and runs PRAGMA
+	// optimize. It returns database.ErrMaintenanceRunning if a run is in progress.
+	OptimizeDatabase(ctx context.Context) (*dto.DatabaseOptimizeResponse, error)
+	// RunMaintenance optimizes the database every interval until ctx is
+	// cancelled. A non-positive interval disables it.
+	RunMaintenance(ctx context.Context, interval time.Duration)
+	// MarkWorkersStarted is called once every background worker is running;
+	// until then the instance reports not ready
+	MarkWorkersStarted()
 }
 
 type healthService struct {
-	db *database.Database
+	db                *database.Database
+	usage             *storage.Usage
+	webhookMaxPending int64
+
+	workersStarted atomic.Bool
+	started        time.Time
+
+	statsMu sync.Mutex
+	stats   *dto.SystemStatsResponse
 }
 
-func New(db *database.Database) HealthService {
+// statsCacheTTL is how long a system stats snapshot is served before its
+// counts are queried again
+const statsCacheTTL = time.Minute
+
+// New creates the health service. webhookMaxPending is only reported; the
+// webhook publisher enforces it.
+func New(db *database.Database, usage *storage.Usage, webhookMaxPending int64) HealthService {
 	return &healthService{
-		db: db,
+		db:                db,
+		usage:             usage,
+		webhookMaxPending: webhookMaxPending,
+		started:           time.Now(),
 	}
 }
 
 func (s *healthService) Check(ctx context.Context) (*dto.ReadyResponse, error) {
 	status := &dto.ReadyResponse{
 		Status:   "healthy",
-		Services: make(map[string]string),
+		Services: make(map[string]dto.ServiceStatus),
 	}
 
+	start := time.Now()
 	if err := s.db.DB.PingContext(ctx); err != nil {
 		status.Status = "unhealthy"
-		status.Services["database"] = "unhealthy"
+		status.Services["database"] = serviceStatus("unhealthy", start)
+	} else {
+		status.Services["database"] = serviceStatus("healthy", start)
+	}
+
+	// Keep load balancers away until retries and sweepers are running
+	start = time.Now()
+	if s.workersStarted.Load() {
+		status.Services["workers"] = serviceStatus("healthy", start)
 	} else {
-		status.Services["database"] = "healthy"
+		status.Services["workers"] = serviceStatus("starting", start)
+		if status.Status == "healthy" {
+			status.Status = "starting"
+		}
+	}
+
+	// A full store still serves reads, so it does not fail readiness
+	start = time.Now()
+	switch {
+	case s.usage.ReadOnly():
+		status.Services["storage"] = serviceStatus("read-only", start)
+	case s.usage.Check() != nil:
+		status.Services["storage"] = serviceStatus("full", start)
+	default:
+		status.Services["storage"] = serviceStatus("healthy", start)
 	}
 
 	return status, nil
 }
+
+// serviceStatus records a check result with the time elapsed since start
+func serviceStatus(status string, start time.Time) dto.ServiceStatus {
+	return dto.ServiceStatus{Status: status, LatencyMs: millis(time.Since(start))}
+}
+
+func (s *healthService) MarkWorkersStarted() {
+	s.workersStarted.Store(true)
+}
+
+func (s *healthService) StorageStats() *dto.StorageStatsResponse {
+	return &dto.StorageStatsResponse{
+		UsedBytes: s.usage.Used(),
+		MaxBytes:  s.usage.Limit(),
+		ReadOnly:  s.usage.ReadOnly(),
+	}
+}
+
+func (s *healthService) WebhookStats(ctx context.Context) (*dto.WebhookStatsResponse, error) {
+	pending, err := s.db.Queries.CountPendingWebhookEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.WebhookStatsResponse{
+		Pending:    pending,
+		MaxPending: max(s.webhookMaxPending, 0),
+	}, nil
+}
+
+func (s *healthService) SystemStats(ctx context.Context) (*dto.SystemStatsResponse, error) {
+	// Holding the lock while querying lets concurrent callers share one refresh
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	if s.stats == nil || time.Since(s.stats.GeneratedAt) >= statsCacheTTL {
+		row, err := s.db.Queries.GetSystemStats(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := &dto.SystemStatsResponse{
+			Clients:          row.Clients,
+			Buckets:          row.Buckets,
+			Resources:        row.Resources,
+			TrashedResources: row.TrashedResources,
+			LogicalBytes:     row.LogicalSize,
+			PhysicalBytes:    row.PhysicalSize,
+			Webhooks: dto.SystemWebhookStats{
+				Pending: row.PendingWebhooks,
+				Failed:  row.FailedWebhooks,
+			},
+			GeneratedAt: time.Now().UTC(),
+		}
+		if stats.PhysicalBytes > 0 {
+			stats.DedupRatio = float64(stats.LogicalBytes) / float64(stats.PhysicalBytes)
+		}
+		s.stats = stats
+	}
+
+	resp := *s.stats
+	resp.UptimeSeconds = int64(time.Since(s.started).Seconds())
+	return &resp, nil
+}
+
+func (s *healthService) DatabaseStats() *dto.DatabaseStatsResponse {
+	stats := s.db.Stats()
+
+	resp := &dto.DatabaseStatsResponse{
+		Queries:         stats.Queries,
+		SlowQueries:     stats.SlowQueries,
+		SlowThresholdMs: millis(stats.SlowThreshold),
+		MaxQueryMs:      millis(stats.MaxDuration),
+		WaitCount:       stats.WaitCount,
+		WaitMs:          millis(stats.WaitDuration),
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+	}
+	if stats.Queries > 0 {
+		resp.AvgQueryMs = millis(stats.TotalDuration / time.Duration(stats.Queries))
+	}
+
+	return resp
+}
+
+func (s *healthService) OptimizeDatabase(ctx context.Context) (*dto.DatabaseOptimizeResponse, error) {
+	result, err := s.db.Optimize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Database optimized in %s: %d -> %d bytes (WAL %d -> %d bytes)",
+		result.Duration.Round(time.Millisecond), result.SizeBefore, result.SizeAfter, result.WALBefore, result.WALAfter)
+	if result.CheckpointBusy {
+		log.Printf("Database WAL checkpoint was blocked by another connection and is incomplete")
+	}
+
+	return &dto.DatabaseOptimizeResponse{
+		SizeBeforeBytes: result.SizeBefore,
+		SizeAfterBytes:  result.SizeAfter,
+		WALBeforeBytes:  result.WALBefore,
+		WALAfterBytes:   result.WALAfter,
+		CheckpointBusy:  result.CheckpointBusy,
+		DurationMs:      millis(result.Duration),
+	}, nil
+}
+
+func (s *healthService) RunMaintenance(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A manual run in progress covers this tick
+			if _, err := s.OptimizeDatabase(ctx); err != nil && !errors.Is(err, database.ErrMaintenanceRunning) && ctx.Err() == nil {
+				log.Printf("Database maintenance failed: %v", err)
+			}
+		}
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
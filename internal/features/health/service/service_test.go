@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+)
+
+func TestSystemStatsDedupRatio(t *testing.T) {
+	tests := []struct {
+		name           string
+		setup          func(t *testing.T, db *database.Database)
+		wantLogical    int64
+		wantPhysical   int64
+		wantDedupRatio float64
+	}{
+		{
+			name:  "empty system",
+			setup: func(t *testing.T, db *database.Database) {},
+		},
+		{
+			name: "one blob shared by two buckets",
+			setup: func(t *testing.T, db *database.Database) {
+				client := dbtest.Client(t, db, "client-1")
+				for _, id := range []string{"bucket-1", "bucket-2"} {
+					dbtest.Bucket(t, db, client.ID, id)
+					dbtest.Resource(t, db, id, "aaaa", 10)
+				}
+			},
+			wantLogical:    20,
+			wantPhysical:   10,
+			wantDedupRatio: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			tt.setup(t, db)
+
+			stats, err := New(db, nil, 0).SystemStats(context.Background())
+			if err != nil {
+				t.Fatalf("SystemStats() error = %v", err)
+			}
+			if stats.LogicalBytes != tt.wantLogical || stats.PhysicalBytes != tt.wantPhysical {
+				t.Errorf("SystemStats() bytes = %d logical, %d physical, want %d, %d", stats.LogicalBytes, stats.PhysicalBytes, tt.wantLogical, tt.wantPhysical)
+			}
+			if math.IsNaN(stats.DedupRatio) || math.IsInf(stats.DedupRatio, 0) || stats.DedupRatio != tt.wantDedupRatio {
+				t.Errorf("SystemStats().DedupRatio = %v, want %v", stats.DedupRatio, tt.wantDedupRatio)
+			}
+			// NaN and Inf cannot be encoded, so /admin/stats would fail
+			if _, err := json.Marshal(stats); err != nil {
+				t.Errorf("json.Marshal(SystemStats()) error = %v", err)
+			}
+		})
+	}
+}
@@ -1,34 +1,152 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	bucketservice "github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/aouiniamine/aoui-drive/pkg/response"
 	"github.com/labstack/echo/v4"
 )
 
 type ResourceController struct {
-	service service.ResourceService
+	service    service.ResourceService
+	pageLimits pagination.Limits
+	// autoCreate is whether stream uploads create missing buckets when the
+	// request does not say
+	autoCreate bool
 }
 
-func New(svc service.ResourceService) *ResourceController {
-	return &ResourceController{service: svc}
+func New(svc service.ResourceService, pageLimits pagination.Limits, autoCreate bool) *ResourceController {
+	return &ResourceController{service: svc, pageLimits: pageLimits, autoCreate: autoCreate}
 }
 
 func (c *ResourceController) RegisterRoutes(g *echo.Group) {
-	g.PUT("/:bucket", c.UploadStream)
-	g.POST("/:bucket", c.UploadFile)
-	g.GET("/:bucket/:hash", c.Download)
+	// Routes that move or read whole files are exempt from the server's read
+	// and write timeouts
+	streaming := middleware.Streaming()
+
+	g.PUT("/:bucket", c.UploadStream, streaming)
+	g.POST("/:bucket", c.UploadFile, streaming)
+	g.POST("/:bucket/batch", c.UploadBatch, streaming)
+	g.GET("/:bucket/:hash", c.Download, streaming)
+	g.GET("/:bucket/name/:filename", c.DownloadByName, streaming)
 	g.HEAD("/:bucket/:hash", c.Head)
 	g.GET("/:bucket", c.List)
+	g.PATCH("/:bucket/:hash", c.Update)
+	g.GET("/:bucket/:hash/metadata", c.GetMetadata)
+	g.PUT("/:bucket/:hash/metadata", c.SetMetadata)
 	g.DELETE("/:bucket/:hash", c.Delete)
+	g.DELETE("/:bucket", c.DeleteAll)
+	g.POST("/:bucket/:hash/verify", c.Verify, streaming)
+	g.GET("/:bucket/:hash/chunks", c.Chunks, streaming)
+	g.GET("/:bucket/:hash/thumbnail", c.Thumbnail, streaming)
+	g.GET("/:bucket/:hash/status", c.Status)
+	g.POST("/:bucket/:hash/presign", c.Presign)
+	g.POST("/:bucket/:hash/copy", c.Copy, streaming)
+	g.POST("/:bucket/:hash/restore", c.Restore)
+	g.POST("/:bucket/verify", c.VerifyBucket, streaming)
+	g.POST("/:bucket/download-zip", c.DownloadZip, streaming)
+	g.GET("/:bucket/export.csv", c.ExportCSV, streaming)
+	g.POST("/:bucket/bulk-delete", c.BulkDelete)
+}
+
+// RegisterShareRoutes registers the unauthenticated presigned download route
+func (c *ResourceController) RegisterShareRoutes(g *echo.Group) {
+	g.GET("/:bucket/:hash", c.DownloadShared, middleware.Streaming())
+}
+
+// RegisterPublicRoutes registers the unauthenticated public routes: the
+// files under root, served for GET and HEAD, and each bucket's feed
+func (c *ResourceController) RegisterPublicRoutes(g *echo.Group, root string) {
+	g.GET("/:bucket/feed.xml", c.Feed)
+
+	files := c.publicFiles(echo.StaticDirectoryHandler(os.DirFS(root), false))
+	g.GET("/*", files)
+	g.HEAD("/*", files)
+}
+
+// publicFiles sets the Cache-Control of the file's bucket, and adds the
+// resource ETag to files named <hash><ext> so GET and HEAD answer
+// If-None-Match with 304 like authenticated downloads
+func (c *ResourceController) publicFiles(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if bucketID, _, _ := strings.Cut(ctx.Param("*"), "/"); bucketID != "" {
+			ctx.Response().Header().Set("Cache-Control", c.service.PublicCacheControl(ctx.Request().Context(), bucketID))
+		}
+
+		// Dot folders such as a bucket's .trash are not part of its files
+		for _, segment := range strings.Split(ctx.Param("*"), "/") {
+			if strings.HasPrefix(segment, ".") {
+				return echo.ErrNotFound
+			}
+		}
+
+		name := path.Base(ctx.Param("*"))
+		if hash, _, _ := strings.Cut(name, "."); isResourceHash(hash) {
+			ctx.Response().Header().Set("ETag", resourceETag(hash))
+		}
+
+		// A missing file may be uploaded later, so its 404 must not be cached
+		if err := next(ctx); err != nil {
+			ctx.Response().Header().Del("Cache-Control")
+			ctx.Response().Header().Del("ETag")
+			return err
+		}
+		return nil
+	}
+}
+
+// isResourceHash reports whether s looks like a hex SHA-256 digest
+func isResourceHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// ThrottlePublic is middleware for the public file routes, limiting each
+// response by the download rate of the bucket named in its path
+func (c *ResourceController) ThrottlePublic(prefix string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			path := strings.TrimPrefix(ctx.Request().URL.Path, prefix+"/")
+			if bucketID, _, _ := strings.Cut(path, "/"); bucketID != "" {
+				res := ctx.Response()
+				res.Writer = c.service.ThrottlePublic(ctx.Request().Context(), bucketID, res.Writer)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// RegisterAdminRoutes registers resource maintenance routes on an admin-only group
+func (c *ResourceController) RegisterAdminRoutes(g *echo.Group) {
+	g.POST("/reindex", c.Reindex, middleware.Streaming())
 }
 
 const webhookHeaderPrefix = "X-Webhook-Header-"
@@ -50,6 +168,136 @@ func extractWebhookHeaders(ctx echo.Context) map[string]string {
 	return headers
 }
 
+const metadataHeaderPrefix = "X-Meta-"
+
+// multipartOverhead is the room left in a single-file multipart body for
+// boundaries and part headers on top of MAX_UPLOAD_SIZE
+const multipartOverhead = 64 << 10
+
+// extractMetadata collects metadata entries from X-Meta- headers, keyed by
+// the lower-cased rest of the header name. Values are percent-decoded, since
+// header values are ASCII.
+func extractMetadata(ctx echo.Context) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for name, values := range ctx.Request().Header {
+		if strings.HasPrefix(name, metadataHeaderPrefix) && len(values) > 0 {
+			value, err := url.PathUnescape(values[0])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s must be percent-encoded", service.ErrInvalidMetadata, name)
+			}
+			metadata[strings.ToLower(strings.TrimPrefix(name, metadataHeaderPrefix))] = value
+		}
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+// attachShareURL adds a presigned link lasting ttl to an upload response when
+// ?share=true
+func (c *ResourceController) attachShareURL(ctx echo.Context, clientID, bucketID string, resource *dto.ResourceResponse, ttl time.Duration) error {
+	if ctx.QueryParam("share") != "true" {
+		return nil
+	}
+
+	link, err := c.service.Presign(ctx.Request().Context(), clientID, bucketID, resource.Hash, ttl)
+	if err != nil {
+		return err
+	}
+
+	resource.ShareURL = link.URL
+	resource.ShareExpiresAt = &link.ExpiresAt
+	return nil
+}
+
+// resolveURLs makes the links in an upload response absolute. Without
+// PUBLIC_URL the service returns relative paths, so resolve them against this request.
+func resolveURLs(ctx echo.Context, resource *dto.ResourceResponse) {
+	base := ctx.Scheme() + "://" + ctx.Request().Host
+	for _, url := range []*string{&resource.DownloadURL, &resource.PublicURL, &resource.ShareURL, &resource.StatusURL} {
+		if strings.HasPrefix(*url, "/") {
+			*url = base + *url
+		}
+	}
+}
+
+// wantsAsync reports whether the client asked for post-processing to continue
+// in the background, with ?async=true or "Prefer: respond-async"
+func wantsAsync(ctx echo.Context) bool {
+	if ctx.QueryParam("async") == "true" {
+		return true
+	}
+	for _, header := range ctx.Request().Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uploaded sends an upload response: 202 while processing continues in the
+// background, 200 once the resource is processed
+func uploaded(ctx echo.Context, resource *dto.ResourceResponse) error {
+	if resource.Deduplicated {
+		ctx.Response().Header().Set("X-Deduplicated", "true")
+	}
+	if resource.StatusURL != "" {
+		ctx.Response().Header().Set("Location", resource.StatusURL)
+		return response.Accepted(ctx, resource)
+	}
+	return response.Success(ctx, resource)
+}
+
+// parseTTL parses the link lifetime in query parameter name, a positive Go
+// duration. An empty value is 0, which falls back to the default TTL.
+func parseTTL(ctx echo.Context, name string) (time.Duration, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 30m, got %q", name, value)
+	}
+	return ttl, nil
+}
+
+// auditInfected records an upload the malware scanner flagged. It reports
+// whether err was such a rejection.
+func auditInfected(ctx echo.Context, clientID, bucketID string, err error) bool {
+	var infected *scanner.InfectedError
+	if !errors.As(err, &infected) {
+		return false
+	}
+	audit.Event(audit.UploadInfected,
+		"client_id", clientID,
+		"bucket_id", bucketID,
+		"ip", ctx.RealIP(),
+		"signature", audit.Truncate(infected.Signature),
+	)
+	return true
+}
+
+// scanError answers uploads refused by the malware scan: 422 for infected
+// content, 503 when the scan could not run. It returns nil for other errors.
+func scanError(ctx echo.Context, clientID, bucketID string, err error) error {
+	if auditInfected(ctx, clientID, bucketID, err) {
+		return response.UnprocessableEntity(ctx, err.Error())
+	}
+	if errors.Is(err, service.ErrScanFailed) {
+		return response.ServiceUnavailable(ctx, service.ErrScanFailed.Error())
+	}
+	return nil
+}
+
+// isStorageFull reports whether an upload was refused by the global storage cap
+func isStorageFull(err error) bool {
+	return errors.Is(err, storage.ErrStorageFull) || errors.Is(err, storage.ErrReadOnly)
+}
+
 // extractHash strips the file extension from the hash parameter if present
 // This allows URLs like /resources/{bucket}/{hash}.png to work
 func extractHash(hashParam string) string {
@@ -59,100 +307,362 @@ func extractHash(hashParam string) string {
 	return hashParam
 }
 
+// unescapedParam returns a path parameter decoded. Echo matches on the raw
+// path when the request has one, leaving its parameters escaped.
+func unescapedParam(ctx echo.Context, name string) (string, error) {
+	value := ctx.Param(name)
+	if ctx.Request().URL.RawPath == "" {
+		return value, nil
+	}
+	return url.PathUnescape(value)
+}
+
 // UploadStream godoc
 // @Summary Upload resource via stream
-// @Description Upload a resource to a bucket using request body stream. The file hash (SHA-256) becomes the resource identifier for deduplication. Use X-File-Extension header to specify the file extension (e.g., ".jpg", ".log"). Optional headers with X-Webhook-Header- prefix will be forwarded to webhook endpoints.
+// @Description Upload a resource to a bucket using request body stream. The file hash (SHA-256) becomes the resource identifier for deduplication. The stored extension comes from X-File-Extension (e.g. ".jpg", ".log") or, when that is omitted, from a specific Content-Type such as image/png; either header is enough. The request is rejected with 400 when X-File-Extension is malformed, or when it is omitted and Content-Type is missing, generic (application/octet-stream) or has no known extension. A generic Content-Type is replaced by the type of the extension, or when the extension has none, by the type detected from the first 512 bytes. Optional headers with X-Webhook-Header- prefix will be forwarded to webhook endpoints. With async=true or "Prefer: respond-async", post-processing runs in the background and the upload returns 202 with a status_url to poll. Bodies over MAX_UPLOAD_SIZE get 413, before the body is read when Content-Length declares the size. With X-Expected-Hash, a body whose SHA-256 differs (e.g. truncated in transit) is rejected with 400 HASH_MISMATCH before anything is stored. With STRICT_CONTENT_TYPE, content whose detected type does not match the extension is rejected with 415 CONTENT_TYPE_MISMATCH. With auto_create=true (default AUTO_CREATE_BUCKETS), {bucket} may also be the name of one of the client's buckets, and a name the client does not have yet creates a private bucket; the response then carries bucket_id and, when it was created, bucket_created. Invalid names get 400 and uploads over MAX_BUCKETS 403.
 // @Tags resources
 // @Accept */*
 // @Produce json
 // @Security BearerAuth
-// @Param bucket path string true "Bucket ID"
-// @Param X-File-Extension header string false "File extension (e.g., .jpg, .log)"
+// @Param bucket path string true "Bucket ID, or name with auto_create"
+// @Param auto_create query bool false "Create the bucket, named {bucket}, if the client has none by that ID or name"
+// @Param X-File-Extension header string false "File extension (e.g., .jpg, .log); derived from Content-Type when omitted"
+// @Param Content-Type header string false "Media type of the file; used to derive the extension when X-File-Extension is omitted"
+// @Param X-Expected-Hash header string false "Hex SHA-256 the body must hash to; a mismatch is rejected with 400 HASH_MISMATCH and nothing is stored"
+// @Param X-File-Name header string false "Percent-encoded file name, stored as original_name and for GET /resources/{bucket}/name/{filename}"
+// @Param share query bool false "Include a presigned share_url in the response (works for private buckets)"
+// @Param share_ttl query string false "Share link lifetime (Go duration, capped by PRESIGN_MAX_TTL)"
 // @Param X-Webhook-Header-* header string false "Optional headers to forward to webhooks (prefix stripped)"
+// @Param X-Meta-* header string false "Percent-encoded metadata entries keyed by the lower-cased rest of the header name; they replace the resource's metadata"
+// @Param async query bool false "Process in the background and return 202 (same as Prefer: respond-async)"
 // @Param file body string true "File content" format(binary)
 // @Success 200 {object} response.Response{data=dto.ResourceResponse}
+// @Success 202 {object} response.Response{data=dto.ResourceResponse}
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
 // @Failure 404 {object} response.Response
+// @Failure 413 {object} response.Response
+// @Failure 415 {object} response.Response
+// @Failure 422 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Failure 507 {object} response.Response
 // @Router /resources/{bucket} [put]
 func (c *ResourceController) UploadStream(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("bucket")
 
 	contentType := ctx.Request().Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
-
 	extension := ctx.Request().Header.Get("X-File-Extension")
+	expectedHash := ctx.Request().Header.Get("X-Expected-Hash")
 	webhookHeaders := extractWebhookHeaders(ctx)
+	metadata, err := extractMetadata(ctx)
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
+
+	// Header values are ASCII, so names are sent percent-encoded
+	filename, err := url.PathUnescape(ctx.Request().Header.Get("X-File-Name"))
+	if err != nil {
+		return response.BadRequest(ctx, "X-File-Name must be percent-encoded")
+	}
 
-	resource, err := c.service.UploadStream(ctx.Request().Context(), clientID, bucketID, contentType, extension, ctx.Request().Body, webhookHeaders)
+	autoCreate := c.autoCreate
+	if value := ctx.QueryParam("auto_create"); value != "" {
+		if autoCreate, err = strconv.ParseBool(value); err != nil {
+			return response.BadRequest(ctx, "auto_create must be true or false")
+		}
+	}
+	shareTTL, err := parseTTL(ctx, "share_ttl")
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
+
+	// A declared length over the limit is refused before the body is read
+	if err := c.service.CheckUploadSize(ctx.Request().ContentLength); err != nil {
+		return response.PayloadTooLarge(ctx, err.Error())
+	}
+
+	resource, err := c.service.UploadStream(ctx.Request().Context(), clientID, bucketID, contentType, extension, filename, expectedHash, ctx.Request().Body, webhookHeaders, metadata, wantsAsync(ctx), autoCreate)
 	if err != nil {
 		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
 		}
+		if errors.Is(err, service.ErrUnknownExtension) || errors.Is(err, service.ErrInvalidExtension) || errors.Is(err, service.ErrInvalidExpectedHash) || errors.Is(err, service.ErrInvalidFileName) || errors.Is(err, service.ErrInvalidMetadata) || errors.Is(err, bucketservice.ErrInvalidBucketName) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		var limitErr *quota.LimitError
+		if errors.As(err, &limitErr) {
+			return response.Forbidden(ctx, limitErr.Error())
+		}
+		if errors.Is(err, service.ErrHashMismatch) {
+			return response.Error(ctx, http.StatusBadRequest, response.CodeHashMismatch, err.Error())
+		}
+		if errors.Is(err, service.ErrContentTypeMismatch) {
+			return response.Error(ctx, http.StatusUnsupportedMediaType, response.CodeContentTypeMismatch, err.Error())
+		}
+		if errors.Is(err, service.ErrUploadTooLarge) {
+			return response.PayloadTooLarge(ctx, err.Error())
+		}
+		if isStorageFull(err) {
+			return response.InsufficientStorage(ctx, err.Error())
+		}
+		if err := scanError(ctx, clientID, bucketID, err); err != nil {
+			return err
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
-	return response.Success(ctx, resource)
+	// An auto-creating upload may have named the bucket
+	if resource.BucketID != "" {
+		bucketID = resource.BucketID
+	}
+	if err := c.attachShareURL(ctx, clientID, bucketID, resource, shareTTL); err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	resolveURLs(ctx, resource)
+
+	return uploaded(ctx, resource)
 }
 
 // UploadFile godoc
 // @Summary Upload resource via multipart form
-// @Description Upload a resource to a bucket using multipart form file upload. The file hash (SHA-256) becomes the resource identifier for deduplication. Optional headers with X-Webhook-Header- prefix will be forwarded to webhook endpoints.
+// @Description Upload a resource to a bucket using multipart form file upload. The file hash (SHA-256) becomes the resource identifier for deduplication. Optional headers with X-Webhook-Header- prefix will be forwarded to webhook endpoints. With async=true or "Prefer: respond-async", post-processing runs in the background and the upload returns 202 with a status_url to poll. Files over MAX_UPLOAD_SIZE get 413. With STRICT_CONTENT_TYPE, content whose detected type does not match the file's extension is rejected with 415 CONTENT_TYPE_MISMATCH.
 // @Tags resources
 // @Accept multipart/form-data
 // @Produce json
 // @Security BearerAuth
 // @Param bucket path string true "Bucket ID"
 // @Param file formData file true "File to upload"
+// @Param share query bool false "Include a presigned share_url in the response (works for private buckets)"
+// @Param share_ttl query string false "Share link lifetime (Go duration, capped by PRESIGN_MAX_TTL)"
 // @Param X-Webhook-Header-* header string false "Optional headers to forward to webhooks (prefix stripped)"
+// @Param X-Meta-* header string false "Percent-encoded metadata entries keyed by the lower-cased rest of the header name; they replace the resource's metadata"
+// @Param async query bool false "Process in the background and return 202 (same as Prefer: respond-async)"
 // @Success 200 {object} response.Response{data=dto.ResourceResponse}
+// @Success 202 {object} response.Response{data=dto.ResourceResponse}
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
+// @Failure 413 {object} response.Response
+// @Failure 415 {object} response.Response
+// @Failure 422 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Failure 507 {object} response.Response
 // @Router /resources/{bucket} [post]
 func (c *ResourceController) UploadFile(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("bucket")
 
+	shareTTL, err := parseTTL(ctx, "share_ttl")
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
+
+	// Check access before parsing the multipart body so "Expect: 100-continue"
+	// clients are rejected without uploading the file
+	if err := c.service.CheckUploadAccess(ctx.Request().Context(), clientID, bucketID); err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if isStorageFull(err) {
+			return response.InsufficientStorage(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	// Parsing the form spools the whole body to disk, so an oversized body is
+	// refused from its declared length and cut off while it is read
+	limit := c.service.MaxUploadSize()
+	if limit > 0 {
+		if err := c.service.CheckUploadSize(ctx.Request().ContentLength - multipartOverhead); err != nil {
+			return response.PayloadTooLarge(ctx, err.Error())
+		}
+		ctx.Request().Body = http.MaxBytesReader(ctx.Response(), ctx.Request().Body, limit+multipartOverhead)
+	}
+
 	file, err := ctx.FormFile("file")
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return response.PayloadTooLarge(ctx, fmt.Sprintf("%s of %d bytes", service.ErrUploadTooLarge, limit))
+		}
 		return response.BadRequest(ctx, "file is required")
 	}
 
 	webhookHeaders := extractWebhookHeaders(ctx)
+	metadata, err := extractMetadata(ctx)
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
 
-	resource, err := c.service.UploadFile(ctx.Request().Context(), clientID, bucketID, file, webhookHeaders)
+	resource, err := c.service.UploadFile(ctx.Request().Context(), clientID, bucketID, file, webhookHeaders, metadata, wantsAsync(ctx))
 	if err != nil {
 		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
 		}
+		if errors.Is(err, service.ErrUnknownExtension) || errors.Is(err, service.ErrInvalidExtension) || errors.Is(err, service.ErrInvalidMetadata) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, service.ErrContentTypeMismatch) {
+			return response.Error(ctx, http.StatusUnsupportedMediaType, response.CodeContentTypeMismatch, err.Error())
+		}
+		if errors.Is(err, service.ErrUploadTooLarge) {
+			return response.PayloadTooLarge(ctx, err.Error())
+		}
+		if isStorageFull(err) {
+			return response.InsufficientStorage(ctx, err.Error())
+		}
+		if err := scanError(ctx, clientID, bucketID, err); err != nil {
+			return err
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
-	return response.Success(ctx, resource)
+	if err := c.attachShareURL(ctx, clientID, bucketID, resource, shareTTL); err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+	resolveURLs(ctx, resource)
+
+	return uploaded(ctx, resource)
+}
+
+// UploadBatch godoc
+// @Summary Upload several resources in one request
+// @Description Upload any number of files as multipart "files" parts. Each file is stored like a single upload, and the response reports per file whether it was stored, deduplicated against content already in the bucket (including an earlier file of the same batch), or failed, with counts for each. A failed file does not stop the batch, so the request succeeds with 200 as long as the bucket is writable.
+// @Tags resources
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param files formData file true "Files to upload (repeat the part)"
+// @Param X-Webhook-Header-* header string false "Optional headers to forward to webhooks (prefix stripped)"
+// @Param async query bool false "Process in the background (same as Prefer: respond-async)"
+// @Success 200 {object} response.Response{data=dto.BatchUploadResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 507 {object} response.Response
+// @Router /resources/{bucket}/batch [post]
+func (c *ResourceController) UploadBatch(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	if err := c.service.CheckUploadAccess(ctx.Request().Context(), clientID, bucketID); err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if isStorageFull(err) {
+			return response.InsufficientStorage(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return response.BadRequest(ctx, "invalid multipart form")
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		return response.BadRequest(ctx, "files are required")
+	}
+
+	summary := c.service.UploadBatch(ctx.Request().Context(), clientID, bucketID, files, extractWebhookHeaders(ctx), wantsAsync(ctx))
+	for i := range summary.Files {
+		entry := &summary.Files[i]
+		if entry.Resource != nil {
+			resolveURLs(ctx, entry.Resource)
+		}
+		auditInfected(ctx, clientID, bucketID, entry.Err)
+	}
+
+	return response.Success(ctx, summary)
 }
 
 // Download godoc
 // @Summary Download a resource
-// @Description Download a resource from a bucket by its hash
+// @Description Download a resource from a bucket by its hash. Image resources can be re-encoded on the fly with ?format=jpeg or ?format=png, and ?format=webp in builds tagged libwebp; other formats, including avif, return the original. Without ?format= the Accept header is honoured: the original is served when it is acceptable, otherwise a converted image type the client lists (image/jpeg, image/png, or image/webp with libwebp), and the original as a fallback; responses carry Vary: Accept. Single-range requests are supported for resuming and chunked downloads; multiple ranges get 416. Last-Modified is the time the resource was stored; If-None-Match, or without it If-Modified-Since, can answer 304. With ?filename= the response is sent as an attachment under that name; otherwise resources uploaded as multipart files are served inline under their original filename. Non-ASCII names are RFC 5987 encoded.
 // @Tags resources
 // @Produce application/octet-stream
 // @Security BearerAuth
 // @Param bucket path string true "Bucket ID"
 // @Param hash path string true "Resource hash (SHA-256)"
+// @Param format query string false "Target image format"
+// @Param filename query string false "Download as an attachment with this file name"
+// @Param Accept header string false "Preferred media types, e.g. image/png"
+// @Param Range header string false "Byte range, e.g. bytes=0-4194303"
 // @Success 200 {file} binary
+// @Success 206 {file} binary
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
+// @Failure 416 {string} string "Malformed, unsatisfiable or multiple ranges"
 // @Router /resources/{bucket}/{hash} [get]
 func (c *ResourceController) Download(ctx echo.Context) error {
+	return c.download(ctx, ctx.Param("bucket"), extractHash(ctx.Param("hash")), "")
+}
+
+// DownloadByName godoc
+// @Summary Download a resource by file name
+// @Description Download the resource most recently uploaded to the bucket under this file name (multipart filename or X-File-Name). Names match exactly, including case. Otherwise behaves like GET /resources/{bucket}/{hash}, and the file is served inline under the requested name. 404 when no resource carries the name, including when STORE_FILENAMES is off.
+// @Tags resources
+// @Produce application/octet-stream
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param filename path string true "File name the resource was uploaded under"
+// @Param format query string false "Target image format"
+// @Param filename query string false "Download as an attachment with this file name"
+// @Param Range header string false "Byte range, e.g. bytes=0-4194303"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/name/{filename} [get]
+func (c *ResourceController) DownloadByName(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("bucket")
-	hash := extractHash(ctx.Param("hash"))
 
-	reader, resource, err := c.service.Download(ctx.Request().Context(), clientID, bucketID, hash)
+	name, err := unescapedParam(ctx, "filename")
+	if err != nil {
+		return response.BadRequest(ctx, "invalid file name")
+	}
+
+	resource, err := c.service.GetByName(ctx.Request().Context(), clientID, bucketID, name)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return c.download(ctx, bucketID, resource.Hash, name)
+}
+
+// download serves a resource's content. A non-empty name replaces the
+// resource's original_name as the inline file name of an unconverted download.
+func (c *ResourceController) download(ctx echo.Context, bucketID, hash, name string) error {
+	clientID := middleware.GetClientID(ctx)
+	format := ctx.QueryParam("format")
+
+	var (
+		reader   io.ReadCloser
+		resource *dto.ResourceResponse
+		err      error
+	)
+	if format != "" {
+		reader, resource, err = c.service.DownloadAs(ctx.Request().Context(), clientID, bucketID, hash, format)
+	} else {
+		reader, resource, err = c.service.Download(ctx.Request().Context(), clientID, bucketID, hash)
+		if err == nil {
+			ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+			if format = service.NegotiateFormat(ctx.Request().Header.Get(echo.HeaderAccept), resource); format != "" {
+				reader.Close()
+				reader, resource, err = c.service.DownloadAs(ctx.Request().Context(), clientID, bucketID, hash, format)
+			}
+		}
+	}
 	if err != nil {
 		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
@@ -165,14 +675,116 @@ func (c *ResourceController) Download(ctx echo.Context) error {
 	defer reader.Close()
 
 	ctx.Response().Header().Set("X-Resource-Hash", resource.Hash)
+	if filename := ctx.QueryParam("filename"); filename != "" {
+		response.Attachment(ctx, filename)
+	} else if name != "" && format == "" {
+		ctx.Response().Header().Set(echo.HeaderContentDisposition, response.ContentDisposition("inline", name))
+	} else if resource.OriginalName != "" {
+		ctx.Response().Header().Set(echo.HeaderContentDisposition, response.ContentDisposition("inline", resource.OriginalName))
+	}
+	setCacheControl(ctx, resource)
+
+	// Files on disk are seekable, so serve them with Range support
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		if isMultiRange(ctx.Request().Header.Get("Range")) {
+			return rangeNotSatisfiable(ctx, rs)
+		}
+		ctx.Response().Header().Set(echo.HeaderContentType, resource.ContentType)
+		if format == "" {
+			ctx.Response().Header().Set("ETag", resourceETag(resource.Hash))
+		}
+		// Last-Modified is the time the resource was stored
+		http.ServeContent(ctx.Response(), ctx.Request(), "", resource.CreatedAt, rs)
+		return nil
+	}
+
+	// http.ServeContent handles the conditional headers for seekable files;
+	// streamed ones are checked here so unchanged blobs are never re-sent
+	var etag string
+	if format == "" {
+		etag = resourceETag(resource.Hash)
+	}
+	if notModified(ctx, etag, resource.CreatedAt) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
 	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", resource.Size))
+	return ctx.Stream(http.StatusOK, resource.ContentType, reader)
+}
+
+// Thumbnail godoc
+// @Summary Get an image thumbnail
+// @Description Get an image resource shrunk, keeping its aspect ratio, to fit within w x h pixels (default 200, at most 1024 each). Images that already fit keep their size. PNG and GIF images give PNG thumbnails, others JPEG. Thumbnails are cached on disk, so repeat requests are cheap; those of encrypted resources are generated every time. Non-image resources, and images in a format that cannot be decoded (e.g. WebP or SVG) or over 40 megapixels, get 415.
+// @Tags resources
+// @Produce image/jpeg,image/png
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Param w query int false "Maximum width in pixels" default(200)
+// @Param h query int false "Maximum height in pixels" default(200)
+// @Success 200 {file} binary
+// @Success 304
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 415 {object} response.Response
+// @Router /resources/{bucket}/{hash}/thumbnail [get]
+func (c *ResourceController) Thumbnail(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	width, height := service.DefaultThumbnailSize, service.DefaultThumbnailSize
+	if w := ctx.QueryParam("w"); w != "" {
+		n, err := strconv.Atoi(w)
+		if err != nil {
+			return response.BadRequest(ctx, "w must be an integer")
+		}
+		width = n
+	}
+	if h := ctx.QueryParam("h"); h != "" {
+		n, err := strconv.Atoi(h)
+		if err != nil {
+			return response.BadRequest(ctx, "h must be an integer")
+		}
+		height = n
+	}
+
+	reader, resource, err := c.service.Thumbnail(ctx.Request().Context(), clientID, bucketID, hash, width, height)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		if errors.Is(err, service.ErrInvalidThumbnailSize) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, service.ErrNotThumbnailable) {
+			return response.UnsupportedMediaType(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+	defer reader.Close()
+
+	ctx.Response().Header().Set("X-Resource-Hash", resource.Hash)
+	setCacheControl(ctx, resource)
+	ctx.Response().Header().Set(echo.HeaderContentType, resource.ContentType)
+	// A resource's content never changes, so neither does its thumbnail
+	ctx.Response().Header().Set("ETag", fmt.Sprintf(`"%s-%dx%d"`, resource.Hash, width, height))
 
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(ctx.Response(), ctx.Request(), "", resource.CreatedAt, rs)
+		return nil
+	}
+	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", resource.Size))
 	return ctx.Stream(http.StatusOK, resource.ContentType, reader)
 }
 
 // Head godoc
 // @Summary Get resource metadata
-// @Description Get metadata of a resource without downloading the content
+// @Description Get metadata of a resource without downloading the content. The ETag is the quoted resource hash and Last-Modified the time it was stored, as on GET; a matching If-None-Match, or without one an If-Modified-Since at or after Last-Modified, returns 304.
 // @Tags resources
 // @Produce json
 // @Security BearerAuth
@@ -181,6 +793,9 @@ func (c *ResourceController) Download(ctx echo.Context) error {
 // @Success 200 {header} string X-Resource-Hash "Resource hash"
 // @Success 200 {header} string Content-Type "Resource content type"
 // @Success 200 {header} string Content-Length "Resource size in bytes"
+// @Success 200 {header} string ETag "Quoted resource hash"
+// @Success 200 {header} string Last-Modified "When the resource was stored (RFC 1123)"
+// @Success 304
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
 // @Router /resources/{bucket}/{hash} [head]
@@ -201,20 +816,35 @@ func (c *ResourceController) Head(ctx echo.Context) error {
 	}
 
 	ctx.Response().Header().Set("X-Resource-Hash", resource.Hash)
+	setCacheControl(ctx, resource)
+	if notModified(ctx, resourceETag(resource.Hash), resource.CreatedAt) {
+		return ctx.NoContent(http.StatusNotModified)
+	}
+
 	ctx.Response().Header().Set("Content-Type", resource.ContentType)
 	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", resource.Size))
-
 	return ctx.NoContent(http.StatusOK)
 }
 
 // List godoc
 // @Summary List resources in a bucket
-// @Description List all resources in a bucket
+// @Description List one page of a bucket's resources, newest first, with the total in meta. content_type narrows the listing to a media type or a type wildcard (image/*); sort and order change the ordering; include_deleted=true also lists trashed resources, marked with deleted_at. Pages carry a weak ETag that changes when a resource is uploaded, deleted, restored or finishes processing; a matching If-None-Match returns 304 without listing. With ?since= (RFC 3339) or ?cursor= it instead returns one page of changes for incremental sync, oldest first: resources created and hashes deleted after that point (since is compared at second precision, inclusive), plus a cursor to pass on the next call.
 // @Tags resources
 // @Produce json
 // @Security BearerAuth
 // @Param bucket path string true "Bucket ID"
+// @Param since query string false "Only changes at or after this time (RFC 3339)"
+// @Param cursor query string false "Continue from a previous sync response; overrides since"
+// @Param page query int false "Page number, ignored for sync" default(1)
+// @Param per_page query int false "Resources or changes per page (clamped to PAGE_SIZE_MAX)"
+// @Param content_type query string false "Only this media type or type wildcard, e.g. image/* (ignored for sync)"
+// @Param sort query string false "Sort field, ignored for sync" Enums(created_at, size) default(created_at)
+// @Param order query string false "Sort order, ignored for sync" Enums(asc, desc) default(desc)
+// @Param include_deleted query bool false "Also list resources in the trash (ignored for sync)"
+// @Param If-None-Match header string false "ETag of a previous page response"
 // @Success 200 {object} response.Response{data=dto.ResourceListResponse}
+// @Success 304 "Page unchanged"
+// @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
 // @Router /resources/{bucket} [get]
@@ -222,35 +852,90 @@ func (c *ResourceController) List(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("bucket")
 
-	resources, err := c.service.List(ctx.Request().Context(), clientID, bucketID)
+	var (
+		resources *dto.ResourceListResponse
+		err       error
+	)
+	p := c.pageLimits.Parse(ctx)
+	filter := dto.ListFilter{
+		ContentType:    ctx.QueryParam("content_type"),
+		Sort:           ctx.QueryParam("sort"),
+		Order:          ctx.QueryParam("order"),
+		IncludeDeleted: ctx.QueryParam("include_deleted") == "true",
+	}
+	since, cursor := ctx.QueryParam("since"), ctx.QueryParam("cursor")
+	sync := since != "" || cursor != ""
+	if sync {
+		var sinceTime time.Time
+		if since != "" {
+			if sinceTime, err = time.Parse(time.RFC3339, since); err != nil {
+				return response.BadRequest(ctx, "since must be an RFC 3339 timestamp")
+			}
+		}
+		resources, err = c.service.ListChanges(ctx.Request().Context(), clientID, bucketID, sinceTime, cursor, p.PerPage)
+	} else {
+		// Polling clients revalidate with If-None-Match; an unchanged bucket
+		// is answered from one aggregate query instead of a full page
+		var version string
+		if version, err = c.service.ListVersion(ctx.Request().Context(), clientID, bucketID); err == nil {
+			etag := listETag(version, p, filter)
+			ctx.Response().Header().Set("ETag", etag)
+			ctx.Response().Header().Set("Cache-Control", "private, no-cache")
+			if etagMatches(ctx.Request().Header.Get("If-None-Match"), etag) {
+				return ctx.NoContent(http.StatusNotModified)
+			}
+			resources, err = c.service.List(ctx.Request().Context(), clientID, bucketID, filter, p.PerPage, p.Offset())
+		}
+	}
 	if err != nil {
 		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
 		}
+		if errors.Is(err, service.ErrInvalidCursor) || errors.Is(err, service.ErrInvalidListFilter) {
+			return response.BadRequest(ctx, err.Error())
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
-	return response.Success(ctx, resources)
+	if sync {
+		return response.Success(ctx, resources)
+	}
+	return response.Paginated(ctx, resources, p, resources.Total)
 }
 
-// Delete godoc
-// @Summary Delete a resource
-// @Description Delete a resource from a bucket by its hash
+// Update godoc
+// @Summary Update a resource's content type
+// @Description Correct the content type stored for a resource without re-uploading it. The blob, hash and extension are unchanged; downloads are served with the new Content-Type from then on. Public file URLs take their type from the extension and are not affected.
 // @Tags resources
+// @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param bucket path string true "Bucket ID"
 // @Param hash path string true "Resource hash (SHA-256)"
-// @Success 204
+// @Param request body dto.UpdateResourceRequest true "New content type"
+// @Success 200 {object} response.Response{data=dto.ResourceResponse}
+// @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
-// @Router /resources/{bucket}/{hash} [delete]
-func (c *ResourceController) Delete(ctx echo.Context) error {
+// @Router /resources/{bucket}/{hash} [patch]
+func (c *ResourceController) Update(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("bucket")
 	hash := extractHash(ctx.Param("hash"))
 
-	if err := c.service.Delete(ctx.Request().Context(), clientID, bucketID, hash); err != nil {
+	var req dto.UpdateResourceRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+	if req.ContentType == "" {
+		return response.BadRequest(ctx, "content_type is required")
+	}
+
+	resource, err := c.service.UpdateContentType(ctx.Request().Context(), clientID, bucketID, hash, req.ContentType)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidContentType) {
+			return response.BadRequest(ctx, err.Error())
+		}
 		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
 			return response.NotFound(ctx, "bucket not found")
 		}
@@ -259,6 +944,767 @@ func (c *ResourceController) Delete(ctx echo.Context) error {
 		}
 		return response.InternalError(ctx, err.Error())
 	}
+	resolveURLs(ctx, resource)
 
-	return response.NoContent(ctx)
+	return response.Success(ctx, resource)
+}
+
+// GetMetadata godoc
+// @Summary Get a resource's metadata
+// @Description List the key-value metadata entries attached to a resource
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 200 {object} response.Response{data=dto.MetadataResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/metadata [get]
+func (c *ResourceController) GetMetadata(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	metadata, err := c.service.GetMetadata(ctx.Request().Context(), clientID, bucketID, hash)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, metadata)
+}
+
+// SetMetadata godoc
+// @Summary Replace a resource's metadata
+// @Description Replace every key-value metadata entry of a resource; an empty map removes them all. At most 32 entries; keys are 1 to 64 lower-case letters, digits, '.', '_' or '-', and values at most 1024 bytes of UTF-8.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Param request body dto.SetMetadataRequest true "New metadata"
+// @Success 200 {object} response.Response{data=dto.MetadataResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/metadata [put]
+func (c *ResourceController) SetMetadata(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	var req dto.SetMetadataRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+
+	metadata, err := c.service.SetMetadata(ctx.Request().Context(), clientID, bucketID, hash, req.Metadata)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMetadata) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, metadata)
+}
+
+// Delete godoc
+// @Summary Delete a resource
+// @Description Delete a resource from a bucket by its hash. When TRASH_RETENTION_DAYS is set the resource is moved to the bucket's trash instead, restorable with POST /resources/{bucket}/{hash}/restore until it is purged.
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 204
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash} [delete]
+func (c *ResourceController) Delete(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	if err := c.service.Delete(ctx.Request().Context(), clientID, bucketID, hash); err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		if errors.Is(err, bucketrepo.ErrRetentionActive) {
+			return response.Forbidden(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.NoContent(ctx)
+}
+
+// DeleteAll godoc
+// @Summary Delete all resources in a bucket
+// @Description Empty a bucket by deleting every resource (rows and files) while keeping the bucket. Fires a resource.deleted event per resource. Requires confirm=true, unless dry_run=true, which deletes nothing and reports how many resources and bytes would be removed.
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param confirm query bool false "Must be true to confirm the operation"
+// @Param dry_run query bool false "Report what would be deleted without deleting"
+// @Success 200 {object} response.Response{data=dto.DeleteAllResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket} [delete]
+func (c *ResourceController) DeleteAll(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	dryRun := ctx.QueryParam("dry_run") == "true"
+	if !dryRun && ctx.QueryParam("confirm") != "true" {
+		return response.BadRequest(ctx, "confirm=true is required to delete all resources")
+	}
+
+	result, err := c.service.DeleteAll(ctx.Request().Context(), clientID, bucketID, dryRun)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, bucketrepo.ErrRetentionActive) {
+			return response.Forbidden(ctx, err.Error())
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// Copy godoc
+// @Summary Copy a resource into another bucket
+// @Description Add a resource to another bucket of the same client without re-uploading it, e.g. to promote a file from staging to production. Unencrypted content is hard-linked; content moving into or out of an encrypted bucket is re-encrypted. If the destination already holds the hash, its resource is returned with deduplicated=true and X-Deduplicated: true, and nothing else happens. Otherwise the copy gets a new ID, the destination's retention and encryption, and a resource.new event for the destination bucket.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Source bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Param request body dto.CopyResourceRequest true "Destination bucket"
+// @Success 200 {object} response.Response{data=dto.ResourceResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 422 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Failure 507 {object} response.Response
+// @Router /resources/{bucket}/{hash}/copy [post]
+func (c *ResourceController) Copy(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	var req dto.CopyResourceRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+	if req.DestBucket == "" {
+		return response.BadRequest(ctx, "dest_bucket is required")
+	}
+
+	resource, err := c.service.Copy(ctx.Request().Context(), clientID, bucketID, hash, req.DestBucket)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, service.ErrDestinationNotFound) {
+			return response.NotFound(ctx, err.Error())
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		if isStorageFull(err) {
+			return response.InsufficientStorage(ctx, err.Error())
+		}
+		if err := scanError(ctx, clientID, req.DestBucket, err); err != nil {
+			return err
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+	resolveURLs(ctx, resource)
+
+	return uploaded(ctx, resource)
+}
+
+// Restore godoc
+// @Summary Restore a deleted resource
+// @Description Bring a resource back out of the bucket's trash. Only resources deleted while TRASH_RETENTION_DAYS is set, and not purged yet, can be restored. The resource keeps its ID and creation time and fires a resource.new event.
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 200 {object} response.Response{data=dto.ResourceResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/restore [post]
+func (c *ResourceController) Restore(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	resource, err := c.service.Restore(ctx.Request().Context(), clientID, bucketID, hash)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not in trash")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+	resolveURLs(ctx, resource)
+
+	return response.Success(ctx, resource)
+}
+
+// BulkDelete godoc
+// @Summary Delete several resources
+// @Description Delete the listed resources, best effort: each hash is deleted on its own and reported as deleted or failed with a reason, and one failure does not stop the rest. Fires a resource.deleted event per deleted resource. At most 1000 hashes per request; duplicates are reported once. With dry_run=true nothing is deleted and no event fires; each hash is reported as it would be.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param request body dto.BulkDeleteRequest true "Hashes to delete"
+// @Param dry_run query bool false "Report what would be deleted without deleting"
+// @Success 200 {object} response.Response{data=dto.BulkDeleteResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/bulk-delete [post]
+func (c *ResourceController) BulkDelete(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	var req dto.BulkDeleteRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+
+	hashes := make([]string, len(req.Hashes))
+	for i, h := range req.Hashes {
+		hashes[i] = extractHash(h)
+	}
+
+	result, err := c.service.DeleteMany(ctx.Request().Context(), clientID, bucketID, hashes, ctx.QueryParam("dry_run") == "true")
+	if err != nil {
+		if errors.Is(err, service.ErrEmptyArchive) {
+			return response.BadRequest(ctx, "hashes is required")
+		}
+		if errors.Is(err, service.ErrTooManyEntries) {
+			return response.BadRequest(ctx, fmt.Sprintf("at most %d hashes per bulk delete", service.MaxBulkDeleteEntries))
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// DownloadZip godoc
+// @Summary Download selected resources as a zip
+// @Description Stream a zip of the requested resources, named after their original_name, or {hash}{extension} when it is unknown; colliding names get a counter, e.g. report (2).pdf. A manifest.json entry lists included files and hashes that were not found. At most 1000 hashes per request.
+// @Tags resources
+// @Accept json
+// @Produce application/zip
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param request body dto.DownloadZipRequest true "Hashes to include"
+// @Success 200 {file} binary
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/download-zip [post]
+func (c *ResourceController) DownloadZip(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	var req dto.DownloadZipRequest
+	if err := ctx.Bind(&req); err != nil {
+		return response.BadRequest(ctx, "invalid request body")
+	}
+
+	hashes := make([]string, len(req.Hashes))
+	for i, h := range req.Hashes {
+		hashes[i] = extractHash(h)
+	}
+
+	archive, err := c.service.Archive(ctx.Request().Context(), clientID, bucketID, hashes)
+	if err != nil {
+		if errors.Is(err, service.ErrEmptyArchive) {
+			return response.BadRequest(ctx, "hashes is required")
+		}
+		if errors.Is(err, service.ErrTooManyEntries) {
+			return response.BadRequest(ctx, fmt.Sprintf("at most %d hashes per archive", service.MaxArchiveEntries))
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	response.Attachment(ctx, archive.BucketID+".zip")
+	if archive.Sensitive {
+		response.NoStore(ctx)
+	}
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	// Headers are already sent; a failure here can only truncate the stream
+	if err := archive.WriteZip(ctx.Request().Context(), ctx.Response()); err != nil {
+		log.Printf("Error streaming zip for bucket %s: %v", archive.BucketID, err)
+	}
+	return nil
+}
+
+// ExportCSV godoc
+// @Summary Export a bucket's resources as CSV
+// @Description Stream a CSV report of the bucket's resources created in a time window, oldest first, with the columns hash, size, content_type, created_at and public_url (empty for private buckets). from (inclusive) and to (exclusive) are RFC 3339 timestamps compared at second precision; either may be left out. An empty window returns just the header row.
+// @Tags resources
+// @Produce text/csv
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param from query string false "Only resources created at or after this time (RFC 3339)"
+// @Param to query string false "Only resources created before this time (RFC 3339)"
+// @Success 200 {file} binary
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/export.csv [get]
+func (c *ResourceController) ExportCSV(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	var from, to time.Time
+	var err error
+	if value := ctx.QueryParam("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return response.BadRequest(ctx, "from must be an RFC 3339 timestamp")
+		}
+	}
+	if value := ctx.QueryParam("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return response.BadRequest(ctx, "to must be an RFC 3339 timestamp")
+		}
+	}
+
+	report, err := c.service.Report(ctx.Request().Context(), clientID, bucketID, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimeWindow) {
+			return response.BadRequest(ctx, err.Error())
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	response.Attachment(ctx, report.BucketID+".csv")
+	if report.Sensitive {
+		response.NoStore(ctx)
+	}
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	// Headers are already sent; a failure here can only truncate the stream
+	if err := report.WriteCSV(ctx.Request().Context(), ctx.Response()); err != nil {
+		log.Printf("Error streaming CSV report for bucket %s: %v", report.BucketID, err)
+	}
+	return nil
+}
+
+// Presign godoc
+// @Summary Create a presigned download link
+// @Description Create a time-limited link that downloads the resource without credentials, even from a private bucket
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Param ttl query string false "Link lifetime (Go duration, capped by PRESIGN_MAX_TTL)"
+// @Success 200 {object} response.Response{data=dto.PresignResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/presign [post]
+func (c *ResourceController) Presign(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	ttl, err := parseTTL(ctx, "ttl")
+	if err != nil {
+		return response.BadRequest(ctx, err.Error())
+	}
+
+	link, err := c.service.Presign(ctx.Request().Context(), clientID, bucketID, hash, ttl)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, link)
+}
+
+// DownloadShared godoc
+// @Summary Download a resource via presigned link
+// @Description Download a resource using a presigned link; no authentication required. With ?filename= the response is sent as an attachment under that name.
+// @Tags resources
+// @Produce application/octet-stream
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Param expires query int true "Expiry (unix seconds)"
+// @Param signature query string true "Link signature"
+// @Param filename query string false "Download as an attachment with this file name"
+// @Success 200 {file} binary
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /share/{bucket}/{hash} [get]
+func (c *ResourceController) DownloadShared(ctx echo.Context) error {
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	expires, err := strconv.ParseInt(ctx.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return response.Forbidden(ctx, "invalid or missing link signature")
+	}
+
+	reader, resource, err := c.service.DownloadShared(ctx.Request().Context(), bucketID, hash, expires, ctx.QueryParam("signature"))
+	if err != nil {
+		if errors.Is(err, presign.ErrInvalidSignature) {
+			return response.Forbidden(ctx, "invalid or missing link signature")
+		}
+		if errors.Is(err, presign.ErrExpired) {
+			return response.Forbidden(ctx, "link has expired")
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) || errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+	defer reader.Close()
+
+	ctx.Response().Header().Set("X-Resource-Hash", resource.Hash)
+	ctx.Response().Header().Set("Content-Length", fmt.Sprintf("%d", resource.Size))
+	if filename := ctx.QueryParam("filename"); filename != "" {
+		response.Attachment(ctx, filename)
+	}
+	setCacheControl(ctx, resource)
+
+	return ctx.Stream(http.StatusOK, resource.ContentType, reader)
+}
+
+// Feed godoc
+// @Summary Atom feed of a public bucket
+// @Description List the 50 newest resources of a public bucket as an Atom feed, each with its public URL, size and creation time, so subscribers can follow new files without webhooks. No authentication is required; private buckets return 404.
+// @Tags resources
+// @Produce application/atom+xml
+// @Param bucket path string true "Bucket ID"
+// @Success 200 {string} string "Atom feed"
+// @Failure 404 {object} response.Response
+// @Router /public/{bucket}/feed.xml [get]
+func (c *ResourceController) Feed(ctx echo.Context) error {
+	feed, err := c.service.Feed(ctx.Request().Context(), ctx.Param("bucket"))
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	base := ctx.Scheme() + "://" + ctx.Request().Host
+	for _, links := range feedLinks(feed) {
+		for i := range links {
+			if strings.HasPrefix(links[i].Href, "/") {
+				links[i].Href = base + links[i].Href
+			}
+		}
+	}
+
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		return response.InternalError(ctx, err.Error())
+	}
+
+	if feed.Sensitive {
+		response.NoStore(ctx)
+	} else {
+		ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	}
+	ctx.Response().Header().Set("Last-Modified", feed.Updated.Format(http.TimeFormat))
+	return ctx.Blob(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// feedLinks returns the link lists of a feed and its entries
+func feedLinks(feed *dto.AtomFeed) [][]dto.AtomLink {
+	links := [][]dto.AtomLink{feed.Links}
+	for _, entry := range feed.Entries {
+		links = append(links, entry.Links)
+	}
+	return links
+}
+
+// Verify godoc
+// @Summary Verify resource integrity
+// @Description Re-read the stored blob, recompute its SHA-256 and compare hash and size with the resource record
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 200 {object} response.Response{data=dto.VerifyResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/verify [post]
+func (c *ResourceController) Verify(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	result, err := c.service.Verify(ctx.Request().Context(), clientID, bucketID, hash)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// Chunks godoc
+// @Summary Get a resource's chunk manifest
+// @Description List fixed-size byte ranges of the resource with the SHA-256 of each, so clients can download ranges with Range requests, verify every chunk independently and resume. The chunk size is set by CHUNK_SIZE; manifests are cached after the first request.
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 200 {object} response.Response{data=dto.ChunkManifest}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/chunks [get]
+func (c *ResourceController) Chunks(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	manifest, err := c.service.Chunks(ctx.Request().Context(), clientID, bucketID, hash)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, manifest)
+}
+
+// Status godoc
+// @Summary Get a resource's processing status
+// @Description Poll the post-processing state of a resource after an asynchronous upload: pending, processing, ready or failed (with error). Resources uploaded without processing steps are ready immediately.
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Param hash path string true "Resource hash (SHA-256)"
+// @Success 200 {object} response.Response{data=dto.ProcessingStatusResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/{hash}/status [get]
+func (c *ResourceController) Status(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+	hash := extractHash(ctx.Param("hash"))
+
+	status, err := c.service.Status(ctx.Request().Context(), clientID, bucketID, hash)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrResourceNotFound) {
+			return response.NotFound(ctx, "resource not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, status)
+}
+
+// VerifyBucket godoc
+// @Summary Verify integrity of all resources in a bucket
+// @Description Re-hash every stored blob in the bucket and report resources whose content or size no longer matches
+// @Tags resources
+// @Produce json
+// @Security BearerAuth
+// @Param bucket path string true "Bucket ID"
+// @Success 200 {object} response.Response{data=dto.BucketVerifyResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /resources/{bucket}/verify [post]
+func (c *ResourceController) VerifyBucket(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucket")
+
+	result, err := c.service.VerifyBucket(ctx.Request().Context(), clientID, bucketID)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// Reindex godoc
+// @Summary Rebuild a bucket's resource index from disk
+// @Description Walk the bucket's storage directory, hash every stored file and create missing resource records (Admin only). Content type is inferred from the file extension. Use dry_run=true to only report what would be added.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param bucket query string true "Bucket ID"
+// @Param dry_run query boolean false "Report without inserting records"
+// @Success 200 {object} response.Response{data=dto.ReindexResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /admin/reindex [post]
+func (c *ResourceController) Reindex(ctx echo.Context) error {
+	bucketID := ctx.QueryParam("bucket")
+	if bucketID == "" {
+		return response.BadRequest(ctx, "bucket is required")
+	}
+
+	dryRun := ctx.QueryParam("dry_run") == "true"
+
+	result, err := c.service.Reindex(ctx.Request().Context(), bucketID, dryRun)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, result)
+}
+
+// isMultiRange reports whether a Range header asks for more than one range.
+// Only single ranges are served; multipart/byteranges responses are not.
+func isMultiRange(rangeHeader string) bool {
+	return strings.Contains(rangeHeader, ",")
+}
+
+// rangeNotSatisfiable answers 416 the same way http.ServeContent does for
+// malformed ranges, reporting the full length in Content-Range
+func rangeNotSatisfiable(ctx echo.Context, rs io.Seeker) error {
+	if size, err := rs.Seek(0, io.SeekEnd); err == nil {
+		ctx.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	}
+	http.Error(ctx.Response(), "multiple ranges are not supported", http.StatusRequestedRangeNotSatisfiable)
+	return nil
+}
+
+// resourceETag is the strong entity tag of a resource's original content.
+// Resources are content-addressed, so the hash never changes for a name.
+func resourceETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// listETag is the weak entity tag of one page of a bucket listing. Weak,
+// because the JSON of an unchanged page may still differ, e.g. in share URLs.
+// The filter is hashed in, as it may hold characters a tag cannot.
+func listETag(version string, p pagination.Params, filter dto.ListFilter) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%t", filter.ContentType, filter.Sort, filter.Order, filter.IncludeDeleted)))
+	return fmt.Sprintf(`W/"%s-%d-%d-%s"`, version, p.Page, p.PerPage, hex.EncodeToString(sum[:4]))
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for: "*" or
+// any listed tag equal to etag once W/ prefixes are ignored
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag, when there is one, and Last-Modified of a
+// resource response, and reports whether the request's validators allow a
+// 304. As in http.ServeContent, If-Modified-Since is only consulted without
+// If-None-Match. Stored resources never change, so any If-Modified-Since at
+// or after the time they were stored matches.
+func notModified(ctx echo.Context, etag string, modified time.Time) bool {
+	header := ctx.Response().Header()
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if ifNoneMatch := ctx.Request().Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && etagMatches(ifNoneMatch, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ctx.Request().Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have whole seconds
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// setCacheControl applies the bucket's Cache-Control to a download, or
+// no-store for sensitive buckets
+func setCacheControl(ctx echo.Context, resource *dto.ResourceResponse) {
+	if resource.CacheControl != "" {
+		ctx.Response().Header().Set("Cache-Control", resource.CacheControl)
+	}
+	if resource.Sensitive {
+		response.NoStore(ctx)
+	}
 }
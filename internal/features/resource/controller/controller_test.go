@@ -0,0 +1,849 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	bucketservice "github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
+	exportrepo "github.com/aouiniamine/aoui-drive/internal/features/export/repository"
+	exportservice "github.com/aouiniamine/aoui-drive/internal/features/export/service"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/internal/quota"
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+// testServer serves the resource routes under /resources for one client,
+// who owns bucket, the share routes under /share and the public files under
+// /public
+type testServer struct {
+	e       *echo.Echo
+	db      *database.Database
+	layout  *storage.Layout
+	tempDir string
+	client  sqlc.Client
+	bucket  sqlc.Bucket
+}
+
+// newTestServer starts a test server whose service is configured by opts.
+// The layout and temp dir are filled in.
+func newTestServer(t *testing.T, opts service.Options) *testServer {
+	t.Helper()
+	return newTestServerWithBuckets(t, opts, 0)
+}
+
+// newTestServerWithBuckets is newTestServer where auto-creating uploads may
+// make buckets up to a total of maxBuckets; 0 is unlimited
+func newTestServerWithBuckets(t *testing.T, opts service.Options, maxBuckets int64) *testServer {
+	t.Helper()
+
+	db := dbtest.New(t)
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	opts.Layout, opts.TempDir = layout, t.TempDir()
+	bucketCap := quota.New("bucket", maxBuckets, db.Queries.CountBuckets)
+	buckets := bucketservice.New(bucketrepo.New(db.Queries), layout, false, false, false, nil, bucketCap)
+	svc := service.New(repository.New(db.DB, db.Queries), bucketrepo.New(db.Queries), buckets, nil, opts)
+
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	if err := os.MkdirAll(layout.BucketDir(client.ID, bucket.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	ctrl := New(svc, pagination.Limits{DefaultPerPage: 20, MaxPerPage: 100}, false)
+	ctrl.RegisterRoutes(e.Group("/resources", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(middleware.ClientIDKey, client.ID)
+			return next(c)
+		}
+	}))
+	ctrl.RegisterShareRoutes(e.Group("/share"))
+	ctrl.RegisterPublicRoutes(e.Group("/public"), filepath.Dir(layout.PublicLink(bucket.ID)))
+
+	return &testServer{e: e, db: db, layout: layout, tempDir: opts.TempDir, client: client, bucket: bucket}
+}
+
+// do serves a request with the given headers, as name/value pairs
+func (s *testServer) do(method, target string, body []byte, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// upload stores content in the bucket with a stream upload, sending the
+// extra headers as name/value pairs
+func (s *testServer) upload(t *testing.T, contentType string, content []byte, header ...string) dto.ResourceResponse {
+	t.Helper()
+
+	rec := s.do(http.MethodPut, "/resources/"+s.bucket.ID, content, append([]string{echo.HeaderContentType, contentType}, header...)...)
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data dto.ResourceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	return resp.Data
+}
+
+// pngImage encodes a blank width x height PNG
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	s := newTestServer(t, service.Options{})
+	img := s.upload(t, "image/png", pngImage(t, 400, 200))
+	text := s.upload(t, "text/plain", []byte("not an image"))
+	base := "/resources/" + s.bucket.ID + "/"
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"image", base + img.Hash + "/thumbnail?w=100&h=100", http.StatusOK},
+		{"default size", base + img.Hash + "/thumbnail", http.StatusOK},
+		{"not an image", base + text.Hash + "/thumbnail", http.StatusUnsupportedMediaType},
+		{"zero width", base + img.Hash + "/thumbnail?w=0", http.StatusBadRequest},
+		{"width over the max", base + img.Hash + "/thumbnail?w=1025", http.StatusBadRequest},
+		{"height over the max", base + img.Hash + "/thumbnail?h=4096", http.StatusBadRequest},
+		{"negative height", base + img.Hash + "/thumbnail?h=-1", http.StatusBadRequest},
+		{"width not a number", base + img.Hash + "/thumbnail?w=big", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := s.do(http.MethodGet, tt.target, nil); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	// Shrunk to fit 100x100 with the 2:1 aspect ratio kept
+	rec := s.do(http.MethodGet, base+img.Hash+"/thumbnail?w=100&h=100", nil)
+	if ct := rec.Header().Get(echo.HeaderContentType); ct != "image/png" {
+		t.Errorf("Content-Type = %s, want image/png", ct)
+	}
+	thumb, err := png.DecodeConfig(rec.Body)
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	if thumb.Width != 100 || thumb.Height != 50 {
+		t.Errorf("thumbnail is %dx%d, want 100x50", thumb.Width, thumb.Height)
+	}
+}
+
+// list returns the bucket's resources listed with query
+func (s *testServer) list(t *testing.T, query string) []dto.ResourceResponse {
+	t.Helper()
+
+	rec := s.do(http.MethodGet, "/resources/"+s.bucket.ID+query, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data dto.ResourceListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	return resp.Data.Resources
+}
+
+func TestTrash(t *testing.T) {
+	s := newTestServer(t, service.Options{TrashRetention: time.Hour, StoreNames: true})
+	kept := s.upload(t, "text/plain", []byte("kept"))
+	trashed := s.upload(t, "text/plain", []byte("trashed"), "X-File-Name", "trashed.txt")
+	base := "/resources/" + s.bucket.ID + "/"
+
+	if rec := s.do(http.MethodDelete, base+trashed.Hash, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// The file moves into the bucket's trash
+	filename := trashed.Hash + trashed.Extension
+	if _, err := os.Stat(filepath.Join(s.layout.BucketDir(s.client.ID, s.bucket.ID), filename)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("bucket file after delete: %v, want it gone", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.layout.TrashDir(s.client.ID, s.bucket.ID), filename)); err != nil {
+		t.Errorf("trash file after delete: %v", err)
+	}
+
+	// and the resource is hidden everywhere but an include_deleted listing
+	for _, target := range []string{base + trashed.Hash, base + "name/trashed.txt"} {
+		if rec := s.do(http.MethodGet, target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d, want %d", target, rec.Code, http.StatusNotFound)
+		}
+	}
+	if got := s.list(t, ""); len(got) != 1 || got[0].Hash != kept.Hash {
+		t.Errorf("list = %v, want only %s", got, kept.Hash)
+	}
+	listed := s.list(t, "?include_deleted=true")
+	if len(listed) != 2 {
+		t.Fatalf("list with include_deleted has %d resources, want 2", len(listed))
+	}
+	for _, r := range listed {
+		if deleted := r.DeletedAt != nil; deleted != (r.Hash == trashed.Hash) {
+			t.Errorf("%s deleted_at = %v, want it set only on the trashed resource", r.Hash, r.DeletedAt)
+		}
+	}
+	rec := s.do(http.MethodGet, base+"export.csv", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), trashed.Hash) || !strings.Contains(rec.Body.String(), kept.Hash) {
+		t.Errorf("export.csv = %d %q, want only %s", rec.Code, rec.Body, kept.Hash)
+	}
+	var export bytes.Buffer
+	if err := exportservice.New(s.db, exportrepo.New(s.db.Queries), nil).Export(context.Background(), &export); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if strings.Contains(export.String(), trashed.Hash) || !strings.Contains(export.String(), kept.Hash) {
+		t.Errorf("Export() includes %s = %v, want only %s", trashed.Hash, strings.Contains(export.String(), trashed.Hash), kept.Hash)
+	}
+
+	// Restoring brings it back, once
+	if rec := s.do(http.MethodPost, base+trashed.Hash+"/restore", nil); rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(http.MethodGet, base+trashed.Hash, nil); rec.Code != http.StatusOK || rec.Body.String() != "trashed" {
+		t.Errorf("GET after restore = %d %q, want the content", rec.Code, rec.Body)
+	}
+	for _, hash := range []string{trashed.Hash, kept.Hash} {
+		if rec := s.do(http.MethodPost, base+hash+"/restore", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("restore of live %s status = %d, want %d", hash, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestDeleteRetained(t *testing.T) {
+	s := newTestServer(t, service.Options{})
+	if _, err := s.db.DB.Exec(`UPDATE buckets SET worm = 1, retention_seconds = 3600 WHERE id = ?`, s.bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	resource := s.upload(t, "text/plain", []byte("kept for an hour"))
+	target := "/resources/" + s.bucket.ID + "/" + resource.Hash
+
+	if rec := s.do(http.MethodDelete, target, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete before retain_until status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if rec := s.do(http.MethodGet, target, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET after refused delete status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if _, err := s.db.DB.Exec(`UPDATE resources SET retain_until = datetime('now', '-1 second') WHERE hash = ?`, resource.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if rec := s.do(http.MethodDelete, target, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete after retain_until status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+	if rec := s.do(http.MethodGet, target, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestExportCSVWindow(t *testing.T) {
+	s := newTestServer(t, service.Options{})
+	resource := s.upload(t, "text/plain", []byte("in the report"))
+	target := "/resources/" + s.bucket.ID + "/export.csv"
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+		wantRows int
+	}{
+		{"no window", "", http.StatusOK, 1},
+		{"window around the upload", "?from=" + now.Add(-time.Hour).Format(time.RFC3339) + "&to=" + now.Add(time.Hour).Format(time.RFC3339), http.StatusOK, 1},
+		{"empty window", "?from=2000-01-01T00:00:00Z&to=2000-01-02T00:00:00Z", http.StatusOK, 0},
+		{"to equal to from", "?from=2000-01-01T00:00:00Z&to=2000-01-01T00:00:00Z", http.StatusBadRequest, 0},
+		{"to before from", "?from=2000-01-02T00:00:00Z&to=2000-01-01T00:00:00Z", http.StatusBadRequest, 0},
+		{"from not a timestamp", "?from=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		rec := s.do(http.MethodGet, target+tt.query, nil)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.wantCode, rec.Body)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: read CSV: %v", tt.name, err)
+		}
+		// The header row comes first even when no resource is in the window
+		if len(records) != tt.wantRows+1 || len(records[0]) == 0 || records[0][0] != "hash" {
+			t.Errorf("%s: records = %q, want a header and %d rows", tt.name, records, tt.wantRows)
+			continue
+		}
+		if tt.wantRows > 0 && records[1][0] != resource.Hash {
+			t.Errorf("%s: row = %q, want %s", tt.name, records[1], resource.Hash)
+		}
+	}
+}
+
+// fakeScanner reads the whole upload, then answers with err
+type fakeScanner struct {
+	err error
+}
+
+func (f fakeScanner) Scan(ctx context.Context, r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestUploadScan(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failOpen bool
+		want     int
+	}{
+		{"clean", nil, false, http.StatusOK},
+		{"infected", &scanner.InfectedError{Signature: "Eicar-Test-Signature"}, false, http.StatusUnprocessableEntity},
+		{"infected when failing open", &scanner.InfectedError{Signature: "Eicar-Test-Signature"}, true, http.StatusUnprocessableEntity},
+		{"scan error when failing open", errors.New("clamd unreachable"), true, http.StatusOK},
+		{"scan error when failing closed", errors.New("clamd unreachable"), false, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := storage.NewUsage(0, false)
+			s := newTestServer(t, service.Options{Scanner: fakeScanner{tt.err}, ScanFailOpen: tt.failOpen, Usage: usage})
+			if _, err := s.db.DB.Exec(`UPDATE buckets SET scan_uploads = 1 WHERE id = ?`, s.bucket.ID); err != nil {
+				t.Fatal(err)
+			}
+			content := []byte("scanned content")
+
+			rec := s.do(http.MethodPut, "/resources/"+s.bucket.ID, content, echo.HeaderContentType, "text/plain")
+			if rec.Code != tt.want {
+				t.Fatalf("upload status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			stored := tt.want == http.StatusOK
+			listed := s.list(t, "")
+			if got := len(listed) == 1; got != stored {
+				t.Errorf("%d resources listed, want stored %v", len(listed), stored)
+			}
+			wantUsed := int64(0)
+			if stored {
+				wantUsed = int64(len(content))
+			}
+			if got := usage.Used(); got != wantUsed {
+				t.Errorf("Used() = %d, want %d", got, wantUsed)
+			}
+			entries, err := os.ReadDir(s.tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("%d temp files left, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestListETag(t *testing.T) {
+	s := newTestServer(t, service.Options{TrashRetention: time.Hour})
+	base := "/resources/" + s.bucket.ID
+	s.upload(t, "text/plain", []byte("first"))
+
+	// etag lists the bucket and returns the page's tag, checking that
+	// sending it back gets 304
+	etag := func(step string) string {
+		t.Helper()
+		rec := s.do(http.MethodGet, base, nil)
+		tag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || tag == "" {
+			t.Fatalf("%s: list = %d with ETag %q", step, rec.Code, tag)
+		}
+		if rec := s.do(http.MethodGet, base, nil, "If-None-Match", tag); rec.Code != http.StatusNotModified {
+			t.Errorf("%s: If-None-Match status = %d, want %d", step, rec.Code, http.StatusNotModified)
+		}
+		return tag
+	}
+	patch := func(hash, contentType string) {
+		t.Helper()
+		body := []byte(`{"content_type": "` + contentType + `"}`)
+		if rec := s.do(http.MethodPatch, base+"/"+hash, body, echo.HeaderContentType, echo.MIMEApplicationJSON); rec.Code != http.StatusOK {
+			t.Fatalf("PATCH status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	tag := etag("initial")
+	if again := etag("unchanged"); again != tag {
+		t.Errorf("ETag changed without a change: %s, then %s", tag, again)
+	}
+
+	second := s.upload(t, "text/plain", []byte("second"))
+	steps := []struct {
+		name   string
+		change func()
+		want   bool
+	}{
+		{"upload", func() { s.upload(t, "text/plain", []byte("third")) }, true},
+		{"delete", func() { s.do(http.MethodDelete, base+"/"+second.Hash, nil) }, true},
+		{"restore", func() { s.do(http.MethodPost, base+"/"+second.Hash+"/restore", nil) }, true},
+		{"PATCH with the same content type", func() { patch(second.Hash, "text/plain") }, false},
+		{"PATCH with a new content type", func() { patch(second.Hash, "text/markdown") }, true},
+	}
+	tag = etag("after the second upload")
+	for _, step := range steps {
+		step.change()
+		next := etag(step.name)
+		if changed := next != tag; changed != step.want {
+			t.Errorf("%s: ETag changed = %v, want %v", step.name, changed, step.want)
+		}
+		tag = next
+	}
+}
+
+func TestUploadAutoCreate(t *testing.T) {
+	// bucket-1 takes one of the two slots
+	s := newTestServerWithBuckets(t, service.Options{}, 2)
+	ctx := context.Background()
+
+	// The strict default leaves unknown names alone
+	rec := s.do(http.MethodPut, "/resources/photos", []byte("a"), echo.HeaderContentType, "text/plain")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("upload to a missing bucket status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if n, err := s.db.Queries.CountBuckets(ctx); err != nil || n != 1 {
+		t.Fatalf("CountBuckets() = %d, %v, want 1", n, err)
+	}
+
+	// autoCreate uploads content to name with auto_create=true
+	autoCreate := func(name, content string) (*httptest.ResponseRecorder, dto.ResourceResponse) {
+		t.Helper()
+		rec := s.do(http.MethodPut, "/resources/"+name+"?auto_create=true", []byte(content), echo.HeaderContentType, "text/plain")
+		var resp struct {
+			Data dto.ResourceResponse `json:"data"`
+		}
+		if rec.Code == http.StatusCreated || rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode upload response: %v", err)
+			}
+		}
+		return rec, resp.Data
+	}
+
+	rec, created := autoCreate("photos", "a")
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("auto_create upload status = %d: %s", rec.Code, rec.Body)
+	}
+	if !created.BucketCreated || created.BucketID == "" {
+		t.Errorf("bucket_created = %v, bucket_id = %q, want a new bucket", created.BucketCreated, created.BucketID)
+	}
+	bucket, err := bucketrepo.New(s.db.Queries).GetByID(ctx, created.BucketID)
+	if err != nil {
+		t.Fatalf("GetByID(%s) error = %v", created.BucketID, err)
+	}
+	if bucket.Name != "photos" || bucket.ClientID != s.client.ID || bucket.IsPublic != 0 {
+		t.Errorf("created bucket = %s of %s public=%d, want private photos of %s", bucket.Name, bucket.ClientID, bucket.IsPublic, s.client.ID)
+	}
+
+	// The name now resolves to that bucket
+	rec, again := autoCreate("photos", "b")
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("second auto_create upload status = %d: %s", rec.Code, rec.Body)
+	}
+	if again.BucketCreated || again.BucketID != created.BucketID {
+		t.Errorf("second upload bucket_created = %v, bucket_id = %q, want %q reused", again.BucketCreated, again.BucketID, created.BucketID)
+	}
+
+	// and a third bucket is over MAX_BUCKETS
+	if rec, _ := autoCreate("videos", "c"); rec.Code != http.StatusForbidden {
+		t.Errorf("auto_create over the bucket limit status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if n, err := s.db.Queries.CountBuckets(ctx); err != nil || n != 2 {
+		t.Errorf("CountBuckets() = %d, %v, want 2", n, err)
+	}
+}
+
+func TestShareOnUpload(t *testing.T) {
+	s := newTestServer(t, service.Options{Signer: presign.New("secret", time.Hour, 2*time.Hour)})
+	if s.bucket.IsPublic != 0 {
+		t.Fatal("test bucket is public, want private")
+	}
+
+	before := time.Now()
+	rec := s.do(http.MethodPut, "/resources/"+s.bucket.ID+"?share=true&share_ttl=30m", []byte("shared"), echo.HeaderContentType, "text/plain")
+	if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data dto.ResourceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	if resp.Data.ShareURL == "" || resp.Data.ShareExpiresAt == nil {
+		t.Fatalf("upload response has no share link: %s", rec.Body)
+	}
+	if expires := resp.Data.ShareExpiresAt.Sub(before); expires < 29*time.Minute || expires > 31*time.Minute {
+		t.Errorf("share_expires_at is %v after the upload, want 30m", expires)
+	}
+
+	// The link downloads from the private bucket without credentials
+	link, err := url.Parse(resp.Data.ShareURL)
+	if err != nil {
+		t.Fatalf("parse share_url %q: %v", resp.Data.ShareURL, err)
+	}
+	if rec := s.do(http.MethodGet, link.RequestURI(), nil); rec.Code != http.StatusOK || rec.Body.String() != "shared" {
+		t.Errorf("GET share_url = %d %q, want the content", rec.Code, rec.Body)
+	}
+}
+
+func TestPresignTTL(t *testing.T) {
+	s := newTestServer(t, service.Options{Signer: presign.New("secret", time.Hour, 2*time.Hour)})
+	resource := s.upload(t, "text/plain", []byte("content"))
+	presignPath := "/resources/" + s.bucket.ID + "/" + resource.Hash + "/presign"
+
+	tests := []struct {
+		name     string
+		ttl      string
+		wantCode int
+	}{
+		{"default", "", http.StatusOK},
+		{"valid", "?ttl=30m", http.StatusOK},
+		{"over the maximum is capped", "?ttl=48h", http.StatusOK},
+		{"not a duration", "?ttl=soon", http.StatusBadRequest},
+		{"missing unit", "?ttl=30", http.StatusBadRequest},
+		{"zero", "?ttl=0s", http.StatusBadRequest},
+		{"negative", "?ttl=-5m", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := s.do(http.MethodPost, presignPath+tt.ttl, nil); rec.Code != tt.wantCode {
+				t.Errorf("POST presign%s status = %d, want %d: %s", tt.ttl, rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+
+	// An invalid share_ttl refuses the upload before anything is stored
+	rec := s.do(http.MethodPut, "/resources/"+s.bucket.ID+"?share=true&share_ttl=soon", []byte("refused"), echo.HeaderContentType, "text/plain")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("upload with share_ttl=soon status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := s.list(t, ""); len(got) != 1 {
+		t.Errorf("bucket has %d resources after the refused upload, want 1", len(got))
+	}
+}
+
+func TestSensitiveDownloadHeaders(t *testing.T) {
+	s := newTestServer(t, service.Options{Signer: presign.New("secret", time.Hour, time.Hour)})
+	ctx := context.Background()
+	if _, err := s.db.DB.ExecContext(ctx, `UPDATE buckets SET sensitive = 1, cache_control = 'public, max-age=60' WHERE id = ?`, s.bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	plain := dbtest.Bucket(t, s.db, s.client.ID, "bucket-2")
+	if _, err := s.db.DB.ExecContext(ctx, `UPDATE buckets SET cache_control = 'public, max-age=60' WHERE id = ?`, plain.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(s.layout.BucketDir(s.client.ID, plain.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The content is stored in the plain bucket first, then uploaded twice
+	// to the sensitive one; the second upload is a deduplicated response
+	content := []byte("regulated")
+	upload := func(bucketID string) dto.ResourceResponse {
+		t.Helper()
+		rec := s.do(http.MethodPut, "/resources/"+bucketID, content, echo.HeaderContentType, "text/plain")
+		if rec.Code != http.StatusCreated && rec.Code != http.StatusOK {
+			t.Fatalf("upload to %s status = %d: %s", bucketID, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Data dto.ResourceResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode upload response: %v", err)
+		}
+		return resp.Data
+	}
+	if got := upload(plain.ID); got.Sensitive {
+		t.Errorf("upload to a plain bucket sensitive = true, want false")
+	}
+	upload(s.bucket.ID)
+	dedup := upload(s.bucket.ID)
+	if !dedup.Deduplicated || !dedup.Sensitive {
+		t.Errorf("repeated upload deduplicated = %v, sensitive = %v, want both true", dedup.Deduplicated, dedup.Sensitive)
+	}
+
+	shareLink := func(bucketID string) string {
+		t.Helper()
+		rec := s.do(http.MethodPost, "/resources/"+bucketID+"/"+dedup.Hash+"/presign", nil)
+		var resp struct {
+			Data dto.PresignResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("presign in %s = %d %s", bucketID, rec.Code, rec.Body)
+		}
+		link, err := url.Parse(resp.Data.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.RequestURI()
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		wantCacheControl string
+		wantPragma       string
+	}{
+		{"sensitive GET", http.MethodGet, "/resources/" + s.bucket.ID + "/" + dedup.Hash, "no-store, private", "no-cache"},
+		{"sensitive HEAD", http.MethodHead, "/resources/" + s.bucket.ID + "/" + dedup.Hash, "no-store, private", "no-cache"},
+		{"sensitive share link", http.MethodGet, shareLink(s.bucket.ID), "no-store, private", "no-cache"},
+		{"plain GET", http.MethodGet, "/resources/" + plain.ID + "/" + dedup.Hash, "public, max-age=60", ""},
+		{"plain share link", http.MethodGet, shareLink(plain.ID), "public, max-age=60", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.target, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s %s status = %d: %s", tt.method, tt.target, rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			if got := rec.Header().Get("Pragma"); got != tt.wantPragma {
+				t.Errorf("Pragma = %q, want %q", got, tt.wantPragma)
+			}
+		})
+	}
+}
+
+func TestUploadBatchMixed(t *testing.T) {
+	s := newTestServer(t, service.Options{MaxUploadSize: 16})
+	existing := s.upload(t, "text/plain", []byte("already here"))
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"new.txt", "new content"},
+		{"existing.txt", "already here"},
+		{"too-large.txt", "more than sixteen bytes"},
+		{"other.txt", "other content"},
+		{"new-again.txt", "new content"},
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := form.CreateFormFile("files", f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do(http.MethodPost, "/resources/"+s.bucket.ID+"/batch", body.Bytes(), echo.HeaderContentType, form.FormDataContentType())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data dto.BatchUploadResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode batch response: %v", err)
+	}
+	summary := resp.Data
+
+	if summary.Stored != 2 || summary.Deduplicated != 2 || summary.Failed != 1 {
+		t.Errorf("summary = %d stored, %d deduplicated, %d failed, want 2, 2, 1", summary.Stored, summary.Deduplicated, summary.Failed)
+	}
+	want := []string{dto.BatchStored, dto.BatchDeduplicated, dto.BatchFailed, dto.BatchStored, dto.BatchDeduplicated}
+	if len(summary.Files) != len(want) {
+		t.Fatalf("batch reported %d files, want %d", len(summary.Files), len(want))
+	}
+	for i, entry := range summary.Files {
+		if entry.Filename != files[i].name || entry.Status != want[i] {
+			t.Errorf("file %d = %s %s, want %s %s", i, entry.Filename, entry.Status, files[i].name, want[i])
+		}
+		if failed := entry.Status == dto.BatchFailed; failed != (entry.Resource == nil) || failed != (entry.Error != "") {
+			t.Errorf("%s: resource = %v, error = %q, want exactly one", entry.Filename, entry.Resource, entry.Error)
+		}
+	}
+	if got := summary.Files[1].Resource.Hash; got != existing.Hash {
+		t.Errorf("existing.txt hash = %s, want %s", got, existing.Hash)
+	}
+	if first, again := summary.Files[0].Resource.Hash, summary.Files[4].Resource.Hash; first != again {
+		t.Errorf("new-again.txt hash = %s, want %s from earlier in the batch", again, first)
+	}
+
+	// Only the failed file is missing from the bucket
+	if got := s.list(t, ""); len(got) != 3 {
+		t.Errorf("bucket has %d resources after the batch, want 3", len(got))
+	}
+}
+
+func TestUploadStreamHeaders(t *testing.T) {
+	s := newTestServer(t, service.Options{})
+
+	tests := []struct {
+		name            string
+		contentType     string
+		extension       string
+		content         []byte
+		wantCode        int
+		wantExtension   string
+		wantContentType string
+		// wantError is part of the message of a refused upload
+		wantError string
+	}{
+		{"both", "image/png", ".png", pngImage(t, 2, 2), http.StatusOK, ".png", "image/png", ""},
+		{"content type only", "image/png", "", pngImage(t, 3, 3), http.StatusOK, ".png", "image/png", ""},
+		{"extension only", "", ".png", pngImage(t, 4, 4), http.StatusOK, ".png", "image/png", ""},
+		{"generic type with an extension", "application/octet-stream", ".png", pngImage(t, 5, 5), http.StatusOK, ".png", "image/png", ""},
+		{"extension without a type is detected", "", ".xyzzy", nil, http.StatusOK, ".xyzzy", "text/plain; charset=utf-8", ""},
+		{"extension without a dot", "text/plain", "txt", nil, http.StatusOK, ".txt", "text/plain", ""},
+		{"neither", "", "", nil, http.StatusBadRequest, "", "", "no extension and no Content-Type"},
+		{"generic type only", "application/octet-stream", "", nil, http.StatusBadRequest, "", "", "does not identify a file type"},
+		{"type without a known extension", "application/x-unheard-of", "", nil, http.StatusBadRequest, "", "", "has no known extension"},
+		{"malformed extension", "text/plain", ".tar$gz", nil, http.StatusBadRequest, "", "", "invalid file extension"},
+		{"path in the extension", "text/plain", "/../x.txt", nil, http.StatusBadRequest, "", "", "invalid file extension"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Distinct text per case, so no upload deduplicates against another
+			content := tt.content
+			if content == nil {
+				content = []byte("text for " + tt.name)
+			}
+			var header []string
+			if tt.contentType != "" {
+				header = append(header, echo.HeaderContentType, tt.contentType)
+			}
+			if tt.extension != "" {
+				header = append(header, "X-File-Extension", tt.extension)
+			}
+
+			rec := s.do(http.MethodPut, "/resources/"+s.bucket.ID, content, header...)
+			if rec.Code == http.StatusCreated {
+				rec.Code = http.StatusOK
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), tt.wantError) {
+					t.Errorf("body = %s, want an error mentioning %q", rec.Body, tt.wantError)
+				}
+				return
+			}
+			var resp struct {
+				Data dto.ResourceResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode upload response: %v", err)
+			}
+			if resp.Data.Extension != tt.wantExtension || resp.Data.ContentType != tt.wantContentType {
+				t.Errorf("stored %s as %q, want %s as %q", resp.Data.Extension, resp.Data.ContentType, tt.wantExtension, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestHeadPublicFile(t *testing.T) {
+	s := newTestServer(t, service.Options{})
+	if _, err := s.db.DB.ExecContext(context.Background(), `UPDATE buckets SET is_public = 1 WHERE id = ?`, s.bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.layout.LinkPublic(s.client.ID, s.bucket.ID); err != nil {
+		t.Fatalf("LinkPublic() error = %v", err)
+	}
+	resource := s.upload(t, "text/plain", []byte("public content"))
+	missing := strings.Repeat("0", 64)
+
+	tests := []struct {
+		name        string
+		file        string
+		header      []string
+		wantCode    int
+		wantHeaders bool
+	}{
+		{"present", resource.Hash + ".txt", nil, http.StatusOK, true},
+		{"present and unchanged", resource.Hash + ".txt", []string{"If-None-Match", `"` + resource.Hash + `"`}, http.StatusNotModified, false},
+		{"absent", missing + ".txt", nil, http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(http.MethodHead, "/public/"+s.bucket.ID+"/"+tt.file, nil, tt.header...)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("HEAD status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("HEAD body = %q, want none", rec.Body)
+			}
+			if !tt.wantHeaders {
+				if tt.wantCode == http.StatusNotFound && rec.Header().Get("ETag") != "" {
+					t.Errorf("ETag = %q on a missing file, want none", rec.Header().Get("ETag"))
+				}
+				return
+			}
+			want := map[string]string{
+				"ETag":           `"` + resource.Hash + `"`,
+				"Content-Length": strconv.FormatInt(resource.Size, 10),
+				"Content-Type":   "text/plain; charset=utf-8",
+			}
+			for name, value := range want {
+				if got := rec.Header().Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
@@ -2,18 +2,219 @@ package dto
 
 import "time"
 
+// Processing statuses. A new resource moves from pending to processing and
+// ends up ready or failed; resources that need no processing start ready.
+const (
+	ProcessingPending = "pending"
+	ProcessingRunning = "processing"
+	ProcessingReady   = "ready"
+	ProcessingFailed  = "failed"
+)
+
+// Outcomes of a file in a batch upload
+const (
+	BatchStored       = "stored"
+	BatchDeduplicated = "deduplicated"
+	BatchFailed       = "failed"
+)
+
+// Outcomes of a hash in a bulk delete
+const (
+	BulkDeleted = "deleted"
+	BulkFailed  = "failed"
+)
+
 // Responses
 
 type ResourceResponse struct {
-	ID          string    `json:"id"`
-	Hash        string    `json:"hash"`
-	Size        int64     `json:"size"`
-	ContentType string    `json:"content_type"`
-	Extension   string    `json:"extension"`
-	CreatedAt   time.Time `json:"created_at"`
-	PublicURL   string    `json:"public_url,omitempty"`
+	ID             string     `json:"id"`
+	Hash           string     `json:"hash"`
+	Size           int64      `json:"size"`
+	ContentType    string     `json:"content_type"`
+	Extension      string     `json:"extension"`
+	OriginalName   string     `json:"original_name,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	PublicURL      string     `json:"public_url,omitempty"`
+	DownloadURL    string     `json:"download_url,omitempty"`
+	ShareURL       string     `json:"share_url,omitempty"`
+	ShareExpiresAt *time.Time `json:"share_expires_at,omitempty"`
+	Sensitive      bool       `json:"sensitive,omitempty"`
+	// CacheControl is the bucket's own Cache-Control for downloads, if set
+	CacheControl     string `json:"-"`
+	Encrypted        bool   `json:"encrypted,omitempty"`
+	ProcessingStatus string `json:"processing_status,omitempty"`
+	ProcessingError  string `json:"processing_error,omitempty"`
+	StatusURL        string `json:"status_url,omitempty"`
+	// Deduplicated is set when the upload matched content already in the
+	// bucket and nothing new was stored
+	Deduplicated bool `json:"deduplicated,omitempty"`
+	// DeletedAt is set on trashed resources, listed with include_deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// BucketID is set on uploads with auto_create, which may address the
+	// bucket by name, and BucketCreated when the upload created it
+	BucketID      string `json:"bucket_id,omitempty"`
+	BucketCreated bool   `json:"bucket_created,omitempty"`
+	// Metadata is set on uploads and copies of resources that carry any
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// BatchUploadEntry is the outcome of one file in a batch upload
+type BatchUploadEntry struct {
+	Filename string            `json:"filename"`
+	Status   string            `json:"status"`
+	Resource *ResourceResponse `json:"resource,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	// Err is the failure behind Error, for callers that map or audit it
+	Err error `json:"-"`
+}
+
+// BatchUploadResponse summarises a batch upload file by file
+type BatchUploadResponse struct {
+	BucketID     string             `json:"bucket_id"`
+	Stored       int                `json:"stored"`
+	Deduplicated int                `json:"deduplicated"`
+	Failed       int                `json:"failed"`
+	Files        []BatchUploadEntry `json:"files"`
+}
+
+// ProcessingStatusResponse is the post-processing state of a resource, polled
+// after an asynchronous upload
+type ProcessingStatusResponse struct {
+	ID     string `json:"id"`
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
+// ListFilter narrows and orders a bucket listing. ContentType is a media
+// type ("image/png") or a type wildcard ("image/*"); Sort is "created_at" or
+// "size" and Order "asc" or "desc". Empty fields mean every type, newest
+// first. IncludeDeleted also lists resources in the trash.
+type ListFilter struct {
+	ContentType    string
+	Sort           string
+	Order          string
+	IncludeDeleted bool
+}
+
+// ResourceListResponse lists a bucket. A page of the listing carries the
+// bucket's total; for incremental sync (?since= or ?cursor=) it carries
+// deletions and a cursor to resume from instead.
 type ResourceListResponse struct {
 	Resources []ResourceResponse `json:"resources"`
+	Total     int64              `json:"total,omitempty"`
+	Deleted   []DeletedResource  `json:"deleted,omitempty"`
+	Cursor    string             `json:"cursor,omitempty"`
+	HasMore   bool               `json:"has_more,omitempty"`
+}
+
+type DeletedResource struct {
+	Hash      string    `json:"hash"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type ReindexEntry struct {
+	File   string `json:"file"`
+	Hash   string `json:"hash,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type ReindexResponse struct {
+	BucketID string         `json:"bucket_id"`
+	DryRun   bool           `json:"dry_run"`
+	Added    []ReindexEntry `json:"added"`
+	Skipped  []ReindexEntry `json:"skipped"`
+}
+
+type VerifyResponse struct {
+	Hash         string `json:"hash"`
+	Valid        bool   `json:"valid"`
+	ExpectedSize int64  `json:"expected_size"`
+	ActualSize   int64  `json:"actual_size"`
+	ActualHash   string `json:"actual_hash,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ChunkManifest splits a resource into fixed-size ranges with a hash per range
+type ChunkManifest struct {
+	Hash      string  `json:"hash"`
+	Size      int64   `json:"size"`
+	ChunkSize int64   `json:"chunk_size"`
+	Algorithm string  `json:"algorithm"`
+	Chunks    []Chunk `json:"chunks"`
+}
+
+type Chunk struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Hash   string `json:"hash"`
+}
+
+type BucketVerifyResponse struct {
+	BucketID string           `json:"bucket_id"`
+	Checked  int              `json:"checked"`
+	Corrupt  []VerifyResponse `json:"corrupt"`
+}
+
+// DeleteAllResponse reports what emptying a bucket removed, or with DryRun
+// what it would remove
+type DeleteAllResponse struct {
+	BucketID  string `json:"bucket_id"`
+	DryRun    bool   `json:"dry_run"`
+	Deleted   int    `json:"deleted"`
+	TotalSize int64  `json:"total_size"`
+}
+
+// BulkDeleteEntry is the outcome of one hash in a bulk delete
+type BulkDeleteEntry struct {
+	Hash   string `json:"hash"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BulkDeleteResponse summarises a bulk delete hash by hash. With DryRun
+// nothing was deleted and each hash is reported as it would have been.
+type BulkDeleteResponse struct {
+	BucketID string            `json:"bucket_id"`
+	DryRun   bool              `json:"dry_run"`
+	Deleted  int               `json:"deleted"`
+	Failed   int               `json:"failed"`
+	Results  []BulkDeleteEntry `json:"results"`
+}
+
+// UpdateResourceRequest changes a resource's metadata; the content is
+// never touched
+type UpdateResourceRequest struct {
+	ContentType string `json:"content_type"`
+}
+
+// SetMetadataRequest replaces every metadata entry of a resource
+type SetMetadataRequest struct {
+	Metadata map[string]string `json:"metadata"`
+}
+
+// MetadataResponse lists a resource's metadata entries
+type MetadataResponse struct {
+	Hash     string            `json:"hash"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type DownloadZipRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+// CopyResourceRequest names the bucket a resource is copied into
+type CopyResourceRequest struct {
+	DestBucket string `json:"dest_bucket"`
+}
+
+// BulkDeleteRequest names the resources to delete by hash
+type BulkDeleteRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+type PresignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// AtomNamespace is the XML namespace of Atom feeds (RFC 4287)
+const AtomNamespace = "http://www.w3.org/2005/Atom"
+
+// AtomFeed lists the most recent resources of a public bucket
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated time.Time   `xml:"updated"`
+	Author  AtomAuthor  `xml:"author"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+
+	// Sensitive feeds must not be cached
+	Sensitive bool `xml:"-"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+// AtomEntry is one resource; its enclosure link points at the public URL
+type AtomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated time.Time  `xml:"updated"`
+	Links   []AtomLink `xml:"link"`
+	Summary string     `xml:"summary"`
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 )
@@ -16,19 +17,47 @@ var (
 type ResourceRepository interface {
 	GetByID(ctx context.Context, id string) (*sqlc.Resource, error)
 	GetByBucketAndHash(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error)
+	GetByName(ctx context.Context, bucketID, name string) (*sqlc.Resource, error)
+	AddName(ctx context.Context, bucketID, name, hash string) error
 	ListByBucketID(ctx context.Context, bucketID string) ([]sqlc.Resource, error)
-	Create(ctx context.Context, params sqlc.CreateResourceParams) (*sqlc.Resource, error)
+	ListPageByBucketID(ctx context.Context, params sqlc.ListResourcesByBucketIDPagedParams) ([]sqlc.Resource, error)
+	CountByBucketID(ctx context.Context, params sqlc.CountResourcesByBucketIDParams) (int64, error)
+	ListVersion(ctx context.Context, bucketID string) (sqlc.GetResourceListVersionRow, error)
+	ListRecent(ctx context.Context, bucketID string, limit int64) ([]sqlc.Resource, error)
+	// Create stores a resource together with its metadata, which may be nil
+	Create(ctx context.Context, params sqlc.CreateResourceParams, metadata map[string]string) (*sqlc.Resource, error)
 	Delete(ctx context.Context, id string) error
 	DeleteByBucketAndHash(ctx context.Context, bucketID, hash string) error
+	DeleteUnretainedByBucketID(ctx context.Context, bucketID string) ([]sqlc.Resource, error)
 	ExistsByBucketAndHash(ctx context.Context, bucketID, hash string) (bool, error)
+	ListCreatedAfter(ctx context.Context, bucketID string, after time.Time, afterID string, limit int64) ([]sqlc.Resource, error)
+	ListChangedAfter(ctx context.Context, bucketID string, since time.Time, afterSeq, limit int64) ([]sqlc.ListResourcesChangedAfterRow, error)
+	ListDeletedAfter(ctx context.Context, bucketID string, since time.Time, afterSeq, limit int64) ([]sqlc.ListResourceTombstonesAfterRow, error)
+	LatestChange(ctx context.Context, bucketID string) (int64, error)
+	StoredSize(ctx context.Context) (int64, error)
+	ListUnprocessed(ctx context.Context) ([]sqlc.Resource, error)
+	TransitionProcessing(ctx context.Context, id, from, to, reason string) (bool, error)
+	UpdateContentType(ctx context.Context, bucketID, hash, contentType string) (*sqlc.Resource, error)
+	ReleaseBlob(ctx context.Context, hash string) (bool, error)
+	ReleaseUnreferencedBlobs(ctx context.Context) ([]sqlc.DeleteUnreferencedBlobsRow, error)
+	GetTrashed(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error)
+	Trash(ctx context.Context, bucketID, hash string) error
+	Restore(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error)
+	ListExpiredTrash(ctx context.Context, cutoff time.Time, limit int64) ([]sqlc.Resource, error)
+	Purge(ctx context.Context, id string) (bool, error)
+	GetMetadata(ctx context.Context, resourceID string) (map[string]string, error)
+	SetMetadata(ctx context.Context, resourceID string, metadata map[string]string) error
 }
 
 type resourceRepository struct {
+	db      *sql.DB
 	queries *sqlc.Queries
 }
 
-func New(queries *sqlc.Queries) ResourceRepository {
-	return &resourceRepository{queries: queries}
+// New returns the resource repository. db is used for the transactions that
+// span several queries.
+func New(db *sql.DB, queries *sqlc.Queries) ResourceRepository {
+	return &resourceRepository{db: db, queries: queries}
 }
 
 func (r *resourceRepository) GetByID(ctx context.Context, id string) (*sqlc.Resource, error) {
@@ -56,15 +85,88 @@ func (r *resourceRepository) GetByBucketAndHash(ctx context.Context, bucketID, h
 	return &resource, nil
 }
 
+// GetByName returns the resource most recently uploaded under name
+func (r *resourceRepository) GetByName(ctx context.Context, bucketID, name string) (*sqlc.Resource, error) {
+	resource, err := r.queries.GetResourceByName(ctx, sqlc.GetResourceByNameParams{
+		BucketID: bucketID,
+		Name:     name,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// AddName records that hash was uploaded under name, making it the newest
+// resource for that name
+func (r *resourceRepository) AddName(ctx context.Context, bucketID, name, hash string) error {
+	return r.queries.UpsertResourceName(ctx, sqlc.UpsertResourceNameParams{
+		BucketID: bucketID,
+		Name:     name,
+		Hash:     hash,
+	})
+}
+
 func (r *resourceRepository) ListByBucketID(ctx context.Context, bucketID string) ([]sqlc.Resource, error) {
 	return r.queries.ListResourcesByBucketID(ctx, bucketID)
 }
 
-func (r *resourceRepository) Create(ctx context.Context, params sqlc.CreateResourceParams) (*sqlc.Resource, error) {
-	resource, err := r.queries.CreateResource(ctx, params)
+// ListPageByBucketID returns one page of a bucket's resources, filtered and
+// ordered as params say
+func (r *resourceRepository) ListPageByBucketID(ctx context.Context, params sqlc.ListResourcesByBucketIDPagedParams) ([]sqlc.Resource, error) {
+	return r.queries.ListResourcesByBucketIDPaged(ctx, params)
+}
+
+// CountByBucketID counts a bucket's resources filtered like
+// ListPageByBucketID
+func (r *resourceRepository) CountByBucketID(ctx context.Context, params sqlc.CountResourcesByBucketIDParams) (int64, error) {
+	return r.queries.CountResourcesByBucketID(ctx, params)
+}
+
+// ListVersion aggregates a bucket's resources into values that change
+// whenever its listing does
+func (r *resourceRepository) ListVersion(ctx context.Context, bucketID string) (sqlc.GetResourceListVersionRow, error) {
+	return r.queries.GetResourceListVersion(ctx, bucketID)
+}
+
+// ListRecent returns a bucket's newest resources, newest first
+func (r *resourceRepository) ListRecent(ctx context.Context, bucketID string, limit int64) ([]sqlc.Resource, error) {
+	return r.queries.ListRecentResourcesByBucketID(ctx, sqlc.ListRecentResourcesByBucketIDParams{
+		BucketID: bucketID,
+		Limit:    limit,
+	})
+}
+
+// Create inserts a resource and clears any tombstone left by an earlier
+// deletion of the same hash
+func (r *resourceRepository) Create(ctx context.Context, params sqlc.CreateResourceParams, metadata map[string]string) (*sqlc.Resource, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	queries := r.queries.WithTx(tx)
+	resource, err := queries.CreateResource(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := queries.DeleteResourceTombstone(ctx, sqlc.DeleteResourceTombstoneParams{
+		BucketID: params.BucketID,
+		Hash:     params.Hash,
+	}); err != nil {
+		return nil, err
+	}
+	if err := insertMetadata(ctx, queries, resource.ID, metadata); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &resource, nil
 }
 
@@ -90,7 +192,40 @@ func (r *resourceRepository) DeleteByBucketAndHash(ctx context.Context, bucketID
 	if rowsAffected == 0 {
 		return ErrResourceNotFound
 	}
-	return nil
+	return r.queries.UpsertResourceTombstone(ctx, sqlc.UpsertResourceTombstoneParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	})
+}
+
+// DeleteUnretainedByBucketID removes every resource row of a bucket that is
+// not under retention in a single statement, leaves a tombstone for each in
+// the same transaction, and returns the deleted rows
+func (r *resourceRepository) DeleteUnretainedByBucketID(ctx context.Context, bucketID string) ([]sqlc.Resource, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	queries := r.queries.WithTx(tx)
+	resources, err := queries.DeleteUnretainedResourcesByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		if err := queries.UpsertResourceTombstone(ctx, sqlc.UpsertResourceTombstoneParams{
+			BucketID: bucketID,
+			Hash:     resource.Hash,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return resources, nil
 }
 
 func (r *resourceRepository) ExistsByBucketAndHash(ctx context.Context, bucketID, hash string) (bool, error) {
@@ -103,3 +238,241 @@ func (r *resourceRepository) ExistsByBucketAndHash(ctx context.Context, bucketID
 	}
 	return result > 0, nil
 }
+
+// ListCreatedAfter returns up to limit resources that sort after (after,
+// afterID) by creation time then ID
+func (r *resourceRepository) ListCreatedAfter(ctx context.Context, bucketID string, after time.Time, afterID string, limit int64) ([]sqlc.Resource, error) {
+	return r.queries.ListResourcesCreatedAfter(ctx, sqlc.ListResourcesCreatedAfterParams{
+		BucketID: bucketID,
+		After:    after,
+		AfterID:  afterID,
+		Limit:    limit,
+	})
+}
+
+// ListChangedAfter returns up to limit live resources whose latest change
+// comes after afterSeq, in change order, leaving out those created or last
+// changed before since
+func (r *resourceRepository) ListChangedAfter(ctx context.Context, bucketID string, since time.Time, afterSeq, limit int64) ([]sqlc.ListResourcesChangedAfterRow, error) {
+	return r.queries.ListResourcesChangedAfter(ctx, sqlc.ListResourcesChangedAfterParams{
+		BucketID: bucketID,
+		AfterSeq: afterSeq,
+		Since:    since,
+		Limit:    limit,
+	})
+}
+
+// ListDeletedAfter returns up to limit tombstones whose deletion comes after
+// afterSeq, in change order, leaving out those deleted before since
+func (r *resourceRepository) ListDeletedAfter(ctx context.Context, bucketID string, since time.Time, afterSeq, limit int64) ([]sqlc.ListResourceTombstonesAfterRow, error) {
+	return r.queries.ListResourceTombstonesAfter(ctx, sqlc.ListResourceTombstonesAfterParams{
+		BucketID: bucketID,
+		AfterSeq: afterSeq,
+		Since:    since,
+		Limit:    limit,
+	})
+}
+
+// LatestChange returns the seq of the bucket's latest change, 0 if none
+func (r *resourceRepository) LatestChange(ctx context.Context, bucketID string) (int64, error) {
+	return r.queries.GetLatestResourceChange(ctx, bucketID)
+}
+
+// StoredSize is the number of bytes stored on disk across all buckets, with
+// shared content counted once
+func (r *resourceRepository) StoredSize(ctx context.Context) (int64, error) {
+	return r.queries.SumStoredSize(ctx)
+}
+
+// ListUnprocessed returns resources whose post-processing has not finished,
+// oldest first
+func (r *resourceRepository) ListUnprocessed(ctx context.Context) ([]sqlc.Resource, error) {
+	return r.queries.ListUnprocessedResources(ctx)
+}
+
+// TransitionProcessing moves a resource from one processing status to another
+// and reports whether it was still in from. reason is stored for failures.
+func (r *resourceRepository) TransitionProcessing(ctx context.Context, id, from, to, reason string) (bool, error) {
+	rowsAffected, err := r.queries.UpdateResourceProcessingStatus(ctx, sqlc.UpdateResourceProcessingStatusParams{
+		Status:     to,
+		Error:      sql.NullString{String: reason, Valid: reason != ""},
+		ID:         id,
+		FromStatus: from,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// UpdateContentType changes only the stored content type; the blob is untouched
+func (r *resourceRepository) UpdateContentType(ctx context.Context, bucketID, hash, contentType string) (*sqlc.Resource, error) {
+	resource, err := r.queries.UpdateResourceContentType(ctx, sqlc.UpdateResourceContentTypeParams{
+		ContentType: contentType,
+		BucketID:    bucketID,
+		Hash:        hash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// ReleaseBlob forgets a shared blob once no resource references it and
+// reports whether it did, in which case the caller removes its file
+func (r *resourceRepository) ReleaseBlob(ctx context.Context, hash string) (bool, error) {
+	rowsAffected, err := r.queries.DeleteUnreferencedBlob(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// ReleaseUnreferencedBlobs forgets every blob without references and returns
+// their hashes and sizes
+func (r *resourceRepository) ReleaseUnreferencedBlobs(ctx context.Context) ([]sqlc.DeleteUnreferencedBlobsRow, error) {
+	return r.queries.DeleteUnreferencedBlobs(ctx)
+}
+
+// GetTrashed returns a soft-deleted resource
+func (r *resourceRepository) GetTrashed(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error) {
+	resource, err := r.queries.GetTrashedResourceByBucketAndHash(ctx, sqlc.GetTrashedResourceByBucketAndHashParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// Trash soft-deletes a resource and tombstones it in one transaction, so
+// sync reports the deletion as it would a permanent one
+func (r *resourceRepository) Trash(ctx context.Context, bucketID, hash string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := r.queries.WithTx(tx)
+	rowsAffected, err := queries.TrashResource(ctx, sqlc.TrashResourceParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	})
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrResourceNotFound
+	}
+	if err := queries.UpsertResourceTombstone(ctx, sqlc.UpsertResourceTombstoneParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore brings a soft-deleted resource back and clears its tombstone in one
+// transaction
+func (r *resourceRepository) Restore(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	queries := r.queries.WithTx(tx)
+	resource, err := queries.RestoreResource(ctx, sqlc.RestoreResourceParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrResourceNotFound
+		}
+		return nil, err
+	}
+	if err := queries.DeleteResourceTombstone(ctx, sqlc.DeleteResourceTombstoneParams{
+		BucketID: bucketID,
+		Hash:     hash,
+	}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// ListExpiredTrash returns up to limit resources trashed at or before cutoff
+func (r *resourceRepository) ListExpiredTrash(ctx context.Context, cutoff time.Time, limit int64) ([]sqlc.Resource, error) {
+	return r.queries.ListExpiredTrashedResources(ctx, sqlc.ListExpiredTrashedResourcesParams{
+		Cutoff: cutoff,
+		Limit:  limit,
+	})
+}
+
+// Purge permanently removes a trashed resource row and reports whether it was
+// still trashed
+func (r *resourceRepository) Purge(ctx context.Context, id string) (bool, error) {
+	rowsAffected, err := r.queries.PurgeTrashedResource(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// GetMetadata returns every metadata entry of a resource, empty when it has
+// none
+func (r *resourceRepository) GetMetadata(ctx context.Context, resourceID string) (map[string]string, error) {
+	rows, err := r.queries.ListResourceMetadata(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string, len(rows))
+	for _, row := range rows {
+		metadata[row.Key] = row.Value
+	}
+	return metadata, nil
+}
+
+// SetMetadata replaces every metadata entry of a resource in one
+// transaction, so concurrent replacements never mix their entries
+func (r *resourceRepository) SetMetadata(ctx context.Context, resourceID string, metadata map[string]string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := r.queries.WithTx(tx)
+	if err := queries.DeleteResourceMetadata(ctx, resourceID); err != nil {
+		return err
+	}
+	if err := insertMetadata(ctx, queries, resourceID, metadata); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertMetadata(ctx context.Context, queries *sqlc.Queries, resourceID string, metadata map[string]string) error {
+	for key, value := range metadata {
+		if err := queries.InsertResourceMetadata(ctx, sqlc.InsertResourceMetadataParams{
+			ResourceID: resourceID,
+			Key:        key,
+			Value:      value,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
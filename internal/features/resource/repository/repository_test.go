@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+func TestTransitionProcessing(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		from, to   string
+		reason     string
+		wantOK     bool
+		wantStatus string
+	}{
+		// The pipeline's own steps
+		{"start", dto.ProcessingPending, dto.ProcessingPending, dto.ProcessingRunning, "", true, dto.ProcessingRunning},
+		{"finish", dto.ProcessingRunning, dto.ProcessingRunning, dto.ProcessingReady, "", true, dto.ProcessingReady},
+		{"fail", dto.ProcessingRunning, dto.ProcessingRunning, dto.ProcessingFailed, "thumbnail: bad image", true, dto.ProcessingFailed},
+		{"requeue after a restart", dto.ProcessingRunning, dto.ProcessingRunning, dto.ProcessingPending, "", true, dto.ProcessingPending},
+
+		// A transition from a status the resource has left changes nothing
+		{"start twice", dto.ProcessingRunning, dto.ProcessingPending, dto.ProcessingRunning, "", false, dto.ProcessingRunning},
+		{"restart a finished resource", dto.ProcessingReady, dto.ProcessingPending, dto.ProcessingRunning, "", false, dto.ProcessingReady},
+		{"finish without starting", dto.ProcessingPending, dto.ProcessingRunning, dto.ProcessingReady, "", false, dto.ProcessingPending},
+		{"overwrite a failure", dto.ProcessingFailed, dto.ProcessingRunning, dto.ProcessingReady, "", false, dto.ProcessingFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.New(t)
+			client := dbtest.Client(t, db, "client-1")
+			bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+			resource := dbtest.Resource(t, db, bucket.ID, "aaaa", 1)
+			ctx := context.Background()
+			if _, err := db.DB.ExecContext(ctx, `UPDATE resources SET processing_status = ? WHERE id = ?`, tt.current, resource.ID); err != nil {
+				t.Fatal(err)
+			}
+			repo := New(db.DB, db.Queries)
+
+			ok, err := repo.TransitionProcessing(ctx, resource.ID, tt.from, tt.to, tt.reason)
+			if err != nil {
+				t.Fatalf("TransitionProcessing() error = %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("TransitionProcessing(%s -> %s) on %s = %v, want %v", tt.from, tt.to, tt.current, ok, tt.wantOK)
+			}
+
+			got, err := repo.GetByID(ctx, resource.ID)
+			if err != nil {
+				t.Fatalf("GetByID() error = %v", err)
+			}
+			if got.ProcessingStatus != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.ProcessingStatus, tt.wantStatus)
+			}
+			wantReason := ""
+			if tt.wantOK {
+				wantReason = tt.reason
+			}
+			if got.ProcessingError.String != wantReason {
+				t.Errorf("processing error = %q, want %q", got.ProcessingError.String, wantReason)
+			}
+		})
+	}
+}
@@ -6,25 +6,40 @@ import (
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/controller"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/service"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/labstack/echo/v4"
 )
 
 type Feature struct {
 	Controller *controller.ResourceController
 	Service    service.ResourceService
+	Repository repository.ResourceRepository
 }
 
-func New(db *database.Database, bucketRepo bucketrepo.BucketRepository, storagePath, publicURL string, webhookLauncher service.WebhookLauncher) *Feature {
-	repo := repository.New(db.Queries)
-	svc := service.New(repo, bucketRepo, storagePath, publicURL, webhookLauncher)
-	ctrl := controller.New(svc)
+func New(db *database.Database, bucketRepo bucketrepo.BucketRepository, bucketCreator service.BucketCreator, webhookLauncher service.WebhookLauncher, opts service.Options, autoCreateBuckets bool, pageLimits pagination.Limits) *Feature {
+	repo := repository.New(db.DB, db.Queries)
+	svc := service.New(repo, bucketRepo, bucketCreator, webhookLauncher, opts)
+	ctrl := controller.New(svc, pageLimits, autoCreateBuckets)
 
 	return &Feature{
 		Controller: ctrl,
 		Service:    svc,
+		Repository: repo,
 	}
 }
 
 func (f *Feature) RegisterRoutes(g *echo.Group) {
 	f.Controller.RegisterRoutes(g)
 }
+
+func (f *Feature) RegisterShareRoutes(g *echo.Group) {
+	f.Controller.RegisterShareRoutes(g)
+}
+
+func (f *Feature) RegisterPublicRoutes(g *echo.Group, root string) {
+	f.Controller.RegisterPublicRoutes(g, root)
+}
+
+func (f *Feature) RegisterAdminRoutes(g *echo.Group) {
+	f.Controller.RegisterAdminRoutes(g)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	"github.com/aouiniamine/aoui-drive/pkg/response"
+)
+
+// MaxArchiveEntries caps how many resources one zip download may request
+const MaxArchiveEntries = 1000
+
+// archiveManifestName is added to every archive to list included and omitted hashes
+const archiveManifestName = "manifest.json"
+
+var (
+	ErrEmptyArchive   = errors.New("no hashes requested")
+	ErrTooManyEntries = errors.New("too many hashes requested")
+)
+
+// Archive is a validated set of resources ready to be streamed as a zip.
+// Ownership and hash lookups happen before any bytes are written, so errors
+// can still be reported as a normal response.
+type Archive struct {
+	BucketID  string
+	Sensitive bool
+	entries   []archiveEntry
+	missing   []string
+}
+
+type archiveEntry struct {
+	hash string
+	name string
+	open func() (io.ReadCloser, error)
+	size int64
+}
+
+type archiveManifest struct {
+	BucketID string                 `json:"bucket_id"`
+	Included []archiveManifestEntry `json:"included"`
+	Missing  []string               `json:"missing"`
+}
+
+type archiveManifestEntry struct {
+	Hash string `json:"hash"`
+	File string `json:"file"`
+	Size int64  `json:"size"`
+}
+
+// Archive resolves the requested hashes in the bucket. Unknown hashes are not an
+// error; they are listed as missing in the archive manifest.
+func (s *resourceService) Archive(ctx context.Context, clientID, bucketID string, hashes []string) (*Archive, error) {
+	if len(hashes) == 0 {
+		return nil, ErrEmptyArchive
+	}
+	if len(hashes) > MaxArchiveEntries {
+		return nil, ErrTooManyEntries
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	archive := &Archive{BucketID: bucket.ID, Sensitive: bucket.Sensitive == 1}
+	seen := make(map[string]bool, len(hashes))
+	names := map[string]bool{archiveManifestName: true}
+
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		resource, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
+		if err != nil {
+			if errors.Is(err, repository.ErrResourceNotFound) {
+				archive.missing = append(archive.missing, hash)
+				continue
+			}
+			return nil, err
+		}
+
+		archive.entries = append(archive.entries, archiveEntry{
+			hash: resource.Hash,
+			name: uniqueEntryName(names, response.SanitizeFilename(DownloadName(&dto.ResourceResponse{
+				Hash:         resource.Hash,
+				Extension:    resource.Extension,
+				OriginalName: resource.OriginalName,
+			}))),
+			// Entries draw from the same download rates as single downloads
+			open: func() (io.ReadCloser, error) {
+				blob, err := s.openBlob(bucket, resource)
+				if err != nil {
+					return nil, err
+				}
+				return s.throttle.Reader(ctx, blob, bucket.ID, bucket.DownloadRateLimit), nil
+			},
+			size: resource.Size,
+		})
+	}
+
+	return archive, nil
+}
+
+// uniqueEntryName returns name, or "name (2).ext", "name (3).ext" and so on
+// when an earlier entry already took it, and records the result in used
+func uniqueEntryName(used map[string]bool, name string) string {
+	unique := name
+	if used[unique] {
+		// The suffix goes before the whole extension, e.g. "a (2).tar.gz",
+		// but a leading dot belongs to the stem
+		stem, ext := name, ""
+		if i := strings.Index(name[1:], "."); i >= 0 {
+			stem, ext = name[:i+1], name[i+1:]
+		}
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		}
+	}
+	used[unique] = true
+	return unique
+}
+
+// WriteZip streams the archive to w. Files that disappeared from storage since
+// the archive was resolved are moved to the manifest's missing list.
+func (a *Archive) WriteZip(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	manifest := archiveManifest{
+		BucketID: a.BucketID,
+		Included: []archiveManifestEntry{},
+		Missing:  append([]string{}, a.missing...),
+	}
+
+	for _, entry := range a.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		file, err := entry.open()
+		if err != nil {
+			manifest.Missing = append(manifest.Missing, entry.hash)
+			continue
+		}
+
+		dst, err := zw.Create(entry.name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		_, err = io.Copy(dst, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		manifest.Included = append(manifest.Included, archiveManifestEntry{Hash: entry.hash, File: entry.name, Size: entry.size})
+	}
+
+	dst, err := zw.Create(archiveManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestUniqueEntryName(t *testing.T) {
+	used := map[string]bool{archiveManifestName: true}
+	tests := []struct {
+		name, want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"report.pdf", "report (2).pdf"},
+		{"report.pdf", "report (3).pdf"},
+		{"backup.tar.gz", "backup.tar.gz"},
+		{"backup.tar.gz", "backup (2).tar.gz"},
+		{".env", ".env"},
+		{".env", ".env (2)"},
+		{"README", "README"},
+		{"README", "README (2)"},
+		{archiveManifestName, "manifest (2).json"},
+	}
+	for _, tt := range tests {
+		if got := uniqueEntryName(used, tt.name); got != tt.want {
+			t.Errorf("uniqueEntryName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
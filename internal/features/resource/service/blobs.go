@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
+)
+
+const (
+	blobCleanupInterval = time.Hour
+)
+
+// blobPath is where a resource's content is stored
+func (s *resourceService) blobPath(bucket *sqlc.Bucket, resource *sqlc.Resource) string {
+	return filepath.Join(s.layout.BucketDir(bucket.ClientID, bucket.ID), buildFilename(resource.Hash, resource.Extension))
+}
+
+// openBlob opens a resource's content for reading, decrypting it if it was
+// stored encrypted. The result is seekable either way so Range requests work.
+func (s *resourceService) openBlob(bucket *sqlc.Bucket, resource *sqlc.Resource) (io.ReadSeekCloser, error) {
+	file, err := os.Open(s.blobPath(bucket, resource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open resource file: %w", err)
+	}
+	if resource.Encrypted != 1 {
+		return file, nil
+	}
+
+	if s.cipher == nil {
+		file.Close()
+		return nil, encryption.ErrUnavailable
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader, err := s.cipher.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// storeBlob moves the uploaded temp file at src to dst, encrypting it on the
+// way when encrypt is set. The temp file always holds plaintext.
+func (s *resourceService) storeBlob(src, dst string, encrypt bool) error {
+	if !encrypt {
+		if err := os.Rename(src, dst); err != nil {
+			// If rename fails (cross-device), copy instead
+			return copyFile(src, dst)
+		}
+		return nil
+	}
+
+	if s.cipher == nil {
+		return encryption.ErrUnavailable
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Encrypt next to the destination so the final rename is atomic; dot files
+	// are ignored by reindexing
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if err := s.cipher.Encrypt(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// sharedBlobPath is where the shared copy of a content is kept, spread over
+// subdirectories named after the first two characters of its hash
+func (s *resourceService) sharedBlobPath(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(s.layout.BlobDir(), hash)
+	}
+	return filepath.Join(s.layout.BlobDir(), hash[:2], hash)
+}
+
+// storeShared moves the uploaded temp file at src to dst like storeBlob, but
+// shares the content with every other bucket holding it: dst becomes a hard
+// link to the shared copy when one exists, and is published as the shared
+// copy otherwise. linked reports the first case, where no new space is taken.
+// Failing to link only costs deduplication; dst always ends up with the
+// content.
+func (s *resourceService) storeShared(src, dst, hash string, size int64) (bool, error) {
+	shared := s.sharedBlobPath(hash)
+	if info, err := os.Stat(shared); err == nil {
+		if info.Size() == size {
+			// dst can only be an orphaned file here; it is replaced either way
+			os.Remove(dst)
+			if os.Link(shared, dst) == nil {
+				return true, nil
+			}
+		} else {
+			// A shared copy that no longer matches its hash is never linked again
+			os.Remove(shared)
+		}
+	}
+
+	if err := s.storeBlob(src, dst, false); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(shared), 0755); err == nil {
+		os.Link(dst, shared)
+	}
+	return false, nil
+}
+
+// releaseBlob frees the storage of a deleted resource. An encrypted file is
+// the resource's own. Other content is shared, so its shared copy is removed,
+// and its space freed, once the last resource referencing it has been
+// deleted. Bucket files are hard links, so this only drops the shared name;
+// other buckets keep their data regardless.
+func (s *resourceService) releaseBlob(ctx context.Context, resource *sqlc.Resource) {
+	if resource.Encrypted == 1 {
+		s.usage.Add(-resource.Size)
+		return
+	}
+
+	released, err := s.repo.ReleaseBlob(ctx, resource.Hash)
+	if err != nil {
+		log.Printf("Error releasing blob %s: %v", resource.Hash, err)
+		return
+	}
+	if released {
+		os.Remove(s.sharedBlobPath(resource.Hash))
+		s.usage.Add(-resource.Size)
+	}
+}
+
+// CollectBlobs removes the shared copies no resource references any more and
+// returns how many were removed. Deleting a bucket leaves these behind because
+// its resource rows go with it in a cascade; their space is freed here.
+func (s *resourceService) CollectBlobs(ctx context.Context) (int, error) {
+	blobs, err := s.repo.ReleaseUnreferencedBlobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, blob := range blobs {
+		os.Remove(s.sharedBlobPath(blob.Hash))
+		s.usage.Add(-blob.Size)
+	}
+	return len(blobs), nil
+}
+
+// RunBlobCleanup collects unreferenced shared blobs immediately and then
+// hourly until ctx is cancelled
+func (s *resourceService) RunBlobCleanup(ctx context.Context) {
+	collect := func() {
+		removed, err := s.CollectBlobs(ctx)
+		if err != nil {
+			log.Printf("Shared blob cleanup failed: %v", err)
+			return
+		}
+		if removed > 0 {
+			log.Printf("Removed %d unreferenced shared blobs", removed)
+		}
+	}
+
+	collect()
+
+	ticker := time.NewTicker(blobCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collect()
+		}
+	}
+}
+
+// hashReader streams r through SHA-256 and returns its hex digest and size
+func hashReader(r io.Reader) (string, int64, error) {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// hashEncryptedFile hashes the plaintext of an encrypted blob
+func (s *resourceService) hashEncryptedFile(path string) (string, int64, error) {
+	if s.cipher == nil {
+		return "", 0, encryption.ErrUnavailable
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	reader, err := s.cipher.NewReader(file, info.Size())
+	if err != nil {
+		return "", 0, err
+	}
+	return hashReader(reader)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
+)
+
+// addBucket creates another bucket of the client with its directory
+func (b *testBucket) addBucket(t *testing.T, id string) sqlc.Bucket {
+	t.Helper()
+
+	bucket := dbtest.Bucket(t, b.db, b.client.ID, id)
+	if err := os.MkdirAll(b.layout.BucketDir(b.client.ID, bucket.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bucket
+}
+
+// refCount is the blob's reference count, -1 when it has no row
+func (b *testBucket) refCount(t *testing.T, hash string) int64 {
+	t.Helper()
+
+	var count int64
+	err := b.db.DB.QueryRow(`SELECT ref_count FROM blobs WHERE hash = ?`, hash).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestSharedBlobs(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	other := b.addBucket(t, "bucket-2")
+	content := "the same content in two buckets"
+
+	var hash string
+	for _, bucketID := range []string{b.bucket.ID, other.ID} {
+		resource, err := b.svc.UploadStream(ctx, b.client.ID, bucketID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+		if err != nil {
+			t.Fatalf("UploadStream(%s) error = %v", bucketID, err)
+		}
+		hash = resource.Hash
+	}
+	paths := []string{
+		filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), hash+".txt"),
+		filepath.Join(b.layout.BucketDir(b.client.ID, other.ID), hash+".txt"),
+	}
+	shared := filepath.Join(b.layout.BlobDir(), hash[:2], hash)
+
+	// Both bucket files are links to the one shared copy
+	sharedInfo, err := os.Stat(shared)
+	if err != nil {
+		t.Fatalf("shared copy: %v", err)
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(info, sharedInfo) {
+			t.Errorf("%s is not a link to the shared copy", path)
+		}
+	}
+	if got := b.refCount(t, hash); got != 2 {
+		t.Errorf("ref_count = %d, want 2", got)
+	}
+
+	// Deleting one leaves the other readable
+	if err := b.svc.Delete(ctx, b.client.ID, b.bucket.ID, hash); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := b.refCount(t, hash); got != 1 {
+		t.Errorf("ref_count after one delete = %d, want 1", got)
+	}
+	body, _, err := b.svc.Download(ctx, b.client.ID, other.ID, hash)
+	if err != nil {
+		t.Fatalf("Download() from the other bucket error = %v", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(got) != content {
+		t.Errorf("Download() = %q, %v, want %q", got, err, content)
+	}
+	if _, err := os.Stat(shared); err != nil {
+		t.Errorf("shared copy with a reference left: %v", err)
+	}
+
+	// Deleting the last one removes the shared copy
+	if err := b.svc.Delete(ctx, b.client.ID, other.ID, hash); err != nil {
+		t.Fatalf("Delete() last reference error = %v", err)
+	}
+	if _, err := os.Stat(shared); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("shared copy after the last delete: %v, want it gone", err)
+	}
+	if got := b.refCount(t, hash); got != -1 {
+		t.Errorf("ref_count after the last delete = %d, want no blob row", got)
+	}
+}
+
+func TestCollectBlobsAfterBucketDelete(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	resource, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader("orphaned by a bucket delete"), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+	shared := filepath.Join(b.layout.BlobDir(), resource.Hash[:2], resource.Hash)
+
+	// Resource rows go with the bucket in a cascade
+	if _, err := b.db.DB.ExecContext(ctx, `DELETE FROM buckets WHERE id = ?`, b.bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.refCount(t, resource.Hash); got != 0 {
+		t.Errorf("ref_count after the cascade = %d, want 0", got)
+	}
+
+	collected, err := b.svc.(*resourceService).CollectBlobs(ctx)
+	if err != nil || collected != 1 {
+		t.Fatalf("CollectBlobs() = %d, %v, want 1", collected, err)
+	}
+	if _, err := os.Stat(shared); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("orphaned shared copy: %v, want it gone", err)
+	}
+	if got := b.refCount(t, resource.Hash); got != -1 {
+		t.Errorf("ref_count after collection = %d, want no blob row", got)
+	}
+}
+
+func TestEncryptedBucketsNeverLink(t *testing.T) {
+	blobCipher, err := encryption.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newTestBucketWith(t, Options{Cipher: blobCipher})
+	ctx := context.Background()
+	encrypted := b.addBucket(t, "bucket-2")
+	if _, err := b.db.DB.ExecContext(ctx, `UPDATE buckets SET encrypted = 1 WHERE id = ?`, encrypted.ID); err != nil {
+		t.Fatal(err)
+	}
+	content := "shared in the clear, private when encrypted"
+
+	var hash string
+	for _, bucketID := range []string{b.bucket.ID, encrypted.ID} {
+		resource, err := b.svc.UploadStream(ctx, b.client.ID, bucketID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+		if err != nil {
+			t.Fatalf("UploadStream(%s) error = %v", bucketID, err)
+		}
+		hash = resource.Hash
+	}
+
+	sharedInfo, err := os.Stat(filepath.Join(b.layout.BlobDir(), hash[:2], hash))
+	if err != nil {
+		t.Fatalf("shared copy: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(b.layout.BucketDir(b.client.ID, encrypted.ID), hash+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(info, sharedInfo) {
+		t.Error("encrypted bucket file is linked to the shared copy")
+	}
+	if got := b.refCount(t, hash); got != 1 {
+		t.Errorf("ref_count = %d, want 1 for the unencrypted resource only", got)
+	}
+}
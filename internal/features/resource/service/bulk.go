@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+)
+
+// MaxBulkDeleteEntries caps how many hashes one bulk delete may name
+const MaxBulkDeleteEntries = 1000
+
+// DeleteMany deletes each hash in turn through Delete, so every removal fires
+// its own resource.deleted event. It is best effort: a hash that cannot be
+// deleted is reported and the rest still go. Only a missing bucket or a bad
+// request fails the whole call, with the errors Archive uses for the same.
+// With dryRun nothing is deleted and no event fires; each hash is reported as
+// it would be, with the same reasons.
+func (s *resourceService) DeleteMany(ctx context.Context, clientID, bucketID string, hashes []string, dryRun bool) (*dto.BulkDeleteResponse, error) {
+	if len(hashes) == 0 {
+		return nil, ErrEmptyArchive
+	}
+	if len(hashes) > MaxBulkDeleteEntries {
+		return nil, ErrTooManyEntries
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	result := &dto.BulkDeleteResponse{
+		BucketID: bucketID,
+		DryRun:   dryRun,
+		Results:  make([]dto.BulkDeleteEntry, 0, len(hashes)),
+	}
+	seen := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		entry := dto.BulkDeleteEntry{Hash: hash, Status: dto.BulkDeleted}
+		var err error
+		if dryRun {
+			_, err = s.deletable(ctx, bucketID, hash)
+		} else {
+			err = s.Delete(ctx, clientID, bucketID, hash)
+		}
+		if err != nil {
+			entry.Status, entry.Reason = dto.BulkFailed, bulkDeleteReason(hash, err)
+			result.Failed++
+		} else {
+			result.Deleted++
+		}
+		result.Results = append(result.Results, entry)
+	}
+
+	return result, nil
+}
+
+// bulkDeleteReason names why one hash of a bulk delete was not removed.
+// Unexpected errors are logged rather than returned to the client.
+func bulkDeleteReason(hash string, err error) string {
+	switch {
+	case errors.Is(err, repository.ErrResourceNotFound):
+		return "resource not found"
+	case errors.Is(err, bucketrepo.ErrRetentionActive):
+		return err.Error()
+	default:
+		log.Printf("Error deleting resource %s in bulk: %v", hash, err)
+		return "internal error"
+	}
+}
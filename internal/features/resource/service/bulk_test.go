@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	webhookdto "github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+// eventRecorder is a WebhookLauncher that passes each event's resource hash
+// to a channel
+type eventRecorder chan string
+
+func (r eventRecorder) TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, metadata, extraHeaders map[string]string) error {
+	r <- eventType + " " + resource.Hash
+	return nil
+}
+
+func TestDeleteManyDryRun(t *testing.T) {
+	b := newTestBucket(t)
+	b.add(t, "aaaa", "abc")
+	b.add(t, "bbbb", "hello")
+	ctx := context.Background()
+	if _, err := b.db.DB.ExecContext(ctx, `UPDATE resources SET retain_until = datetime('now', '+1 hour') WHERE hash = 'bbbb'`); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := []string{"aaaa", "bbbb", "cccc", "aaaa"}
+	want := []dto.BulkDeleteEntry{
+		{Hash: "aaaa", Status: dto.BulkDeleted},
+		{Hash: "bbbb", Status: dto.BulkFailed, Reason: "resource is under retention"},
+		{Hash: "cccc", Status: dto.BulkFailed, Reason: "resource not found"},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		result, err := b.svc.DeleteMany(ctx, b.client.ID, b.bucket.ID, hashes, dryRun)
+		if err != nil {
+			t.Fatalf("DeleteMany(dryRun=%v) error = %v", dryRun, err)
+		}
+		if result.DryRun != dryRun || result.Deleted != 1 || result.Failed != 2 {
+			t.Errorf("DeleteMany(dryRun=%v) = %+v, want 1 deleted and 2 failed", dryRun, result)
+		}
+		if len(result.Results) != len(want) {
+			t.Fatalf("DeleteMany(dryRun=%v) results = %+v, want %+v", dryRun, result.Results, want)
+		}
+		for i, entry := range result.Results {
+			if entry != want[i] {
+				t.Errorf("DeleteMany(dryRun=%v) result %d = %+v, want %+v", dryRun, i, entry, want[i])
+			}
+		}
+
+		// The dry run reported what the real call then did
+		if dryRun {
+			b.assertStored(t, "aaaa")
+		}
+		b.assertStored(t, "bbbb")
+	}
+
+	if _, err := b.repo.GetByBucketAndHash(ctx, b.bucket.ID, "aaaa"); err == nil {
+		t.Error("aaaa still stored after the real delete")
+	}
+}
+
+func TestDeleteManyEvents(t *testing.T) {
+	b := newTestBucket(t)
+	b.add(t, "aaaa", "abc")
+	b.add(t, "bbbb", "hello")
+	events := make(eventRecorder, 10)
+	b.svc.(*resourceService).webhookLauncher = events
+
+	hashes := []string{"aaaa", "bbbb", "aaaa", "cccc", "bbbb"}
+	if _, err := b.svc.DeleteMany(context.Background(), b.client.ID, b.bucket.ID, hashes, false); err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+
+	// Events fire in the background; wait for two, then make sure no third follows
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("events = %v, want 2", got)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("extra event %q, want one per deleted resource", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sort.Strings(got)
+	want := []string{webhookdto.EventResourceDeleted + " aaaa", webhookdto.EventResourceDeleted + " bbbb"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
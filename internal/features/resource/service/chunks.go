@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+const (
+	// DefaultChunkSize is used when no positive chunk size is configured
+	DefaultChunkSize int64 = 4 << 20
+)
+
+// Chunks returns the resource's chunk manifest: fixed-size byte ranges with the
+// SHA-256 of each, so clients can fetch ranges independently and verify them.
+// Manifests are computed on first request and cached on disk.
+func (s *resourceService) Chunks(ctx context.Context, clientID, bucketID, hash string) (*dto.ChunkManifest, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	cachePath := filepath.Join(s.layout.ChunkDir(bucket.ID), resource.Hash+"-"+strconv.FormatInt(s.chunkSize, 10)+".json")
+	if manifest, err := readChunkManifest(cachePath); err == nil {
+		return manifest, nil
+	}
+
+	// Chunks cover the plaintext, so encrypted resources are decrypted first
+	file, err := s.openBlob(bucket, resource)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := &dto.ChunkManifest{
+		Hash:      resource.Hash,
+		Size:      resource.Size,
+		ChunkSize: s.chunkSize,
+		Algorithm: "sha256",
+		Chunks:    []dto.Chunk{},
+	}
+
+	var offset int64
+	for index := 0; ; index++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hasher := sha256.New()
+		n, err := io.CopyN(hasher, file, s.chunkSize)
+		if n > 0 {
+			manifest.Chunks = append(manifest.Chunks, dto.Chunk{
+				Index:  index,
+				Offset: offset,
+				Length: n,
+				Hash:   hex.EncodeToString(hasher.Sum(nil)),
+			})
+			offset += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read resource file: %w", err)
+		}
+	}
+
+	// The manifest is still valid if caching fails; it is recomputed next time
+	writeChunkManifest(cachePath, manifest)
+	return manifest, nil
+}
+
+// removeChunkManifests drops every cached manifest of a resource
+func (s *resourceService) removeChunkManifests(bucketID, hash string) {
+	matches, _ := filepath.Glob(filepath.Join(s.layout.ChunkDir(bucketID), hash+"-*.json"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+func readChunkManifest(path string) (*dto.ChunkManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest dto.ChunkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func writeChunkManifest(path string, manifest *dto.ChunkManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so concurrent readers never see partial output
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+	"github.com/google/uuid"
+)
+
+// ErrDestinationNotFound is returned when a copy's destination bucket does
+// not exist or belongs to another client
+var ErrDestinationNotFound = errors.New("destination bucket not found")
+
+// Copy adds a resource to another of the client's buckets without
+// re-uploading it. Unencrypted content is hard-linked; content leaving or
+// entering an encrypted bucket is decrypted and re-encrypted for the
+// destination. A hash already in the destination is returned as is, marked
+// Deduplicated. New copies are processed, scanned when only the destination
+// scans uploads, and announced with resource.new.
+func (s *resourceService) Copy(ctx context.Context, clientID, bucketID, hash, destBucketID string) (*dto.ResourceResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	dest, err := s.bucketRepo.GetByID(ctx, destBucketID)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return nil, ErrDestinationNotFound
+		}
+		return nil, err
+	}
+	if dest.ClientID != clientID {
+		return nil, ErrDestinationNotFound
+	}
+
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.repo.GetByBucketAndHash(ctx, dest.ID, hash); err == nil {
+		resp := s.detail(dest, existing)
+		resp.DownloadURL = s.buildDownloadURL(dest.ID, existing.Hash, existing.Extension)
+		resp.Deduplicated = true
+		return resp, nil
+	}
+
+	encrypt := dest.Encrypted == 1
+	if encrypt && s.cipher == nil {
+		return nil, encryption.ErrUnavailable
+	}
+	if err := s.usage.Reserve(resource.Size); err != nil {
+		return nil, err
+	}
+	// Purged once the copy is certain to be stored, so a refused copy leaves
+	// the destination's trashed copy restorable
+	if err := s.purgeTrashed(ctx, dest, hash); err != nil {
+		s.usage.Add(-resource.Size)
+		return nil, err
+	}
+
+	resourcePath := s.blobPath(dest, resource)
+	linked, err := s.copyBlob(ctx, bucket, resource, dest, resourcePath)
+	if err != nil {
+		s.usage.Add(-resource.Size)
+		return nil, err
+	}
+	// A hard-linked copy takes no new space
+	stored := resource.Size
+	if linked {
+		s.usage.Add(-resource.Size)
+		stored = 0
+	}
+
+	var encrypted int64
+	if encrypt {
+		encrypted = 1
+	}
+
+	// The copy takes the source's metadata along
+	metadata, err := s.repo.GetMetadata(ctx, resource.ID)
+	if err != nil {
+		s.usage.Add(-stored)
+		os.Remove(resourcePath)
+		return nil, err
+	}
+
+	created, err := s.repo.Create(ctx, sqlc.CreateResourceParams{
+		ID:               uuid.New().String(),
+		BucketID:         dest.ID,
+		Hash:             resource.Hash,
+		Size:             resource.Size,
+		ContentType:      resource.ContentType,
+		Extension:        resource.Extension,
+		RetainUntil:      retainUntil(dest),
+		Encrypted:        encrypted,
+		ProcessingStatus: initialProcessingStatus(),
+		OriginalName:     resource.OriginalName,
+	}, metadata)
+	if err != nil {
+		os.Remove(resourcePath)
+		s.usage.Add(-stored)
+		return nil, fmt.Errorf("failed to create resource record: %w", err)
+	}
+	s.recordName(ctx, dest.ID, created.OriginalName, created.Hash)
+
+	if created.ProcessingStatus == dto.ProcessingPending {
+		s.process(context.WithoutCancel(ctx), dest, created)
+	}
+
+	requestID := requestid.From(ctx)
+	go s.notifyNew(requestid.With(context.Background(), requestID), dest, created, nil)
+
+	resp := s.detail(dest, created)
+	resp.DownloadURL = s.buildDownloadURL(dest.ID, created.Hash, created.Extension)
+	if len(metadata) > 0 {
+		resp.Metadata = metadata
+	}
+	return resp, nil
+}
+
+// copyBlob writes resource's content from bucket to dst in dest. Between
+// unencrypted buckets it is a hard link, so the copy takes no space on disk;
+// otherwise the plaintext is buffered in a temp file and stored like an upload.
+// linked reports whether the copy is a link to content already stored.
+func (s *resourceService) copyBlob(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource, dest *sqlc.Bucket, dst string) (bool, error) {
+	src := s.blobPath(bucket, resource)
+	scan := dest.ScanUploads == 1 && bucket.ScanUploads != 1
+
+	if resource.Encrypted != 1 && dest.Encrypted != 1 {
+		if scan {
+			if err := s.scanUpload(ctx, src); err != nil {
+				return false, err
+			}
+		}
+		// dst can only be an orphaned file here; it is replaced either way
+		os.Remove(dst)
+		if os.Link(src, dst) == nil {
+			return true, nil
+		}
+		if err := copyFile(src, dst); err != nil {
+			os.Remove(dst)
+			return false, fmt.Errorf("failed to copy resource: %w", err)
+		}
+		return false, nil
+	}
+
+	reader, err := s.openBlob(bucket, resource)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+
+	tempFile, err := os.CreateTemp(s.tempDir, tempFilePattern)
+	if err != nil {
+		return false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	_, err = io.Copy(tempFile, reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read resource: %w", err)
+	}
+
+	if scan {
+		if err := s.scanUpload(ctx, tempPath); err != nil {
+			return false, err
+		}
+	}
+
+	linked := false
+	if dest.Encrypted == 1 {
+		err = s.storeBlob(tempPath, dst, true)
+	} else {
+		linked, err = s.storeShared(tempPath, dst, resource.Hash, resource.Size)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to store resource: %w", err)
+	}
+	return linked, nil
+}
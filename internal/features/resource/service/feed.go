@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// feedEntries is how many of the newest resources a bucket feed lists
+const feedEntries = 50
+
+// Feed builds an Atom feed of a public bucket's newest resources, linking each
+// to its public URL. Private buckets are reported as not found, the same as
+// missing ones.
+func (s *resourceService) Feed(ctx context.Context, bucketID string) (*dto.AtomFeed, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+	if bucket.IsPublic != 1 {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resources, err := s.repo.ListRecent(ctx, bucket.ID, feedEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &dto.AtomFeed{
+		Xmlns:     dto.AtomNamespace,
+		ID:        "urn:uuid:" + bucket.ID,
+		Title:     bucket.Name,
+		Updated:   bucket.UpdatedAt.Time,
+		Author:    dto.AtomAuthor{Name: bucket.Name},
+		Links:     []dto.AtomLink{{Rel: "self", Href: s.buildFeedURL(bucket.ID), Type: "application/atom+xml"}},
+		Entries:   make([]dto.AtomEntry, len(resources)),
+		Sensitive: bucket.Sensitive == 1,
+	}
+
+	for i, r := range resources {
+		created := r.CreatedAt.Time.UTC()
+		if created.After(feed.Updated) {
+			feed.Updated = created
+		}
+
+		feed.Entries[i] = dto.AtomEntry{
+			ID:      "urn:uuid:" + r.ID,
+			Title:   buildFilename(r.Hash, r.Extension),
+			Updated: created,
+			Links: []dto.AtomLink{{
+				Rel:    "enclosure",
+				Href:   s.buildPublicURL(bucket.ID, r.Hash, r.Extension),
+				Type:   r.ContentType,
+				Length: r.Size,
+			}},
+			Summary: fmt.Sprintf("%s, %d bytes", r.ContentType, r.Size),
+		}
+	}
+	feed.Updated = feed.Updated.UTC()
+
+	return feed, nil
+}
+
+// buildFeedURL constructs the URL of a public bucket's Atom feed
+func (s *resourceService) buildFeedURL(bucketID string) string {
+	return s.publicURL + "/public/" + bucketID + "/feed.xml"
+}
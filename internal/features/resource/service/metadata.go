@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"unicode/utf8"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+const (
+	// MaxMetadataEntries caps the metadata entries of one resource
+	MaxMetadataEntries = 32
+
+	// MaxMetadataKeyLength and MaxMetadataValueLength bound the bytes of a
+	// metadata key and value
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 1024
+)
+
+// ErrInvalidMetadata is returned for metadata with too many entries, or with
+// a key or value that is malformed or too long
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+// metadataKeyPattern keeps keys usable as X-Meta-* header names, which are
+// case-insensitive, so keys are lower-case
+var metadataKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// validateMetadata checks metadata against the entry, key and value limits
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataEntries {
+		return fmt.Errorf("%w: at most %d entries", ErrInvalidMetadata, MaxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if len(key) > MaxMetadataKeyLength || !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: key %q must be 1 to %d lower-case letters, digits, '.', '_' or '-'", ErrInvalidMetadata, key, MaxMetadataKeyLength)
+		}
+		if len(value) > MaxMetadataValueLength || !utf8.ValidString(value) {
+			return fmt.Errorf("%w: value of %q must be UTF-8 of at most %d bytes", ErrInvalidMetadata, key, MaxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata entries of a resource
+func (s *resourceService) GetMetadata(ctx context.Context, clientID, bucketID, hash string) (*dto.MetadataResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := s.repo.GetMetadata(ctx, resource.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.MetadataResponse{Hash: resource.Hash, Metadata: metadata}, nil
+}
+
+// SetMetadata replaces the metadata entries of a resource. An empty map
+// removes them all.
+func (s *resourceService) SetMetadata(ctx context.Context, clientID, bucketID, hash string, metadata map[string]string) (*dto.MetadataResponse, error) {
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if err := s.repo.SetMetadata(ctx, resource.ID, metadata); err != nil {
+		return nil, err
+	}
+	return &dto.MetadataResponse{Hash: resource.Hash, Metadata: metadata}, nil
+}
+
+// resourceMetadata returns a resource's metadata for a response or webhook.
+// A failure only loses the metadata and is logged.
+func (s *resourceService) resourceMetadata(ctx context.Context, resourceID string) map[string]string {
+	metadata, err := s.repo.GetMetadata(ctx, resourceID)
+	if err != nil {
+		log.Printf("Error loading metadata of resource %s: %v", resourceID, err)
+		return nil
+	}
+	return metadata
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// maxFileNameLength bounds a stored filename in bytes
+const maxFileNameLength = 255
+
+// ErrInvalidFileName is returned for an X-File-Name that is not a plain file
+// name: empty, "." or "..", over 255 bytes, or holding a path separator or
+// control character
+var ErrInvalidFileName = errors.New("invalid file name")
+
+// fileName reduces an uploaded filename to its last path element, as some
+// clients send full paths. ok is false when nothing usable remains.
+func fileName(name string) (string, bool) {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || len(name) > maxFileNameLength || !utf8.ValidString(name) {
+		return "", false
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", false
+	}
+	return name, true
+}
+
+// recordName maps name to hash in the bucket, so GetByName finds it. A
+// failure leaves the upload in place and is only logged.
+func (s *resourceService) recordName(ctx context.Context, bucketID, name, hash string) {
+	if name == "" {
+		return
+	}
+	if err := s.repo.AddName(ctx, bucketID, name, hash); err != nil {
+		log.Printf("Error recording name %q for resource %s: %v", name, hash, err)
+	}
+}
+
+// GetByName returns the resource most recently uploaded to the bucket under
+// name. Names are matched exactly, including case.
+func (s *resourceService) GetByName(ctx context.Context, clientID, bucketID, name string) (*dto.ResourceResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetByName(ctx, bucketID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.detail(bucket, resource), nil
+}
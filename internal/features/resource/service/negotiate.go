@@ -0,0 +1,121 @@
+package service
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// specificity ranks exact types above type/* and type/* above */*
+func (m mediaRange) specificity() int {
+	switch {
+	case m.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(m.mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (m mediaRange) matches(contentType string) bool {
+	if m.mediaType == "*/*" || m.mediaType == contentType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(m.mediaType, "*")
+	return ok && strings.HasPrefix(contentType, prefix)
+}
+
+// NegotiateFormat picks the representation of a resource to serve for an
+// Accept header. It returns the name of the image format to convert to, as
+// accepted by DownloadAs, or "" to serve the original.
+//
+// Each type is rated with the q-value of the most specific range matching it,
+// so "image/*, image/png;q=0.5" rates PNG at 0.5 and other images at 1.
+// Conversions are only made to image types the header names exactly; the
+// highest rated one is the candidate, the first listed on a tie. The original
+// wins whenever it is rated at least as high as the candidate, and is also the
+// answer when nothing acceptable can be produced: clients rarely list every
+// type they can handle, so a download never fails with 406.
+func NegotiateFormat(accept string, resource *dto.ResourceResponse) string {
+	if accept == "" || resource.Encrypted || !strings.HasPrefix(resource.ContentType, "image/") {
+		return ""
+	}
+
+	original, _, err := mime.ParseMediaType(resource.ContentType)
+	if err != nil {
+		return ""
+	}
+
+	ranges := parseAccept(accept)
+	format, best := "", 0.0
+	for _, r := range ranges {
+		if r.specificity() < 2 || r.mediaType == original || r.q <= best {
+			continue
+		}
+		if f, ok := lookupFormatByType(r.mediaType); ok {
+			format, best = f, r.q
+		}
+	}
+
+	if format == "" || quality(ranges, original) >= best {
+		return ""
+	}
+	return format
+}
+
+// quality rates contentType with the q-value of the most specific range that
+// matches it, the first listed among equally specific ones, or 0 if none does
+func quality(ranges []mediaRange, contentType string) float64 {
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		if r.matches(contentType) && r.specificity() > specificity {
+			q, specificity = r.q, r.specificity()
+		}
+	}
+	return q
+}
+
+// parseAccept returns the media ranges of an Accept header in header order.
+// Ranges with q=0 are kept, since they exclude the types they match from
+// broader ranges; ranges with an invalid q are left out.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// lookupFormatByType finds an encoder producing contentType. When several
+// do, the alphabetically first format name wins so the choice, and the cached
+// variant, stay stable.
+func lookupFormatByType(contentType string) (string, bool) {
+	found := ""
+	for format, enc := range imageEncoders {
+		if enc.ContentType == contentType && (found == "" || format < found) {
+			found = format
+		}
+	}
+	return found, found != ""
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	png := &dto.ResourceResponse{ContentType: "image/png"}
+	gif := &dto.ResourceResponse{ContentType: "image/gif"}
+
+	tests := []struct {
+		name     string
+		accept   string
+		resource *dto.ResourceResponse
+		want     string
+	}{
+		{"no header", "", png, ""},
+		{"original listed", "image/png", png, ""},
+		{"conversion listed", "image/jpeg", png, "jpeg"},
+		{"no encoder", "image/avif", png, ""},
+		{"nothing acceptable", "text/html", png, ""},
+		{"original wins a tie", "image/jpeg, image/png", png, ""},
+		{"higher q wins", "image/png;q=0.8, image/jpeg;q=0.9", png, "jpeg"},
+		{"wildcard rates the original", "image/jpeg;q=0.5, image/*", png, ""},
+		{"exact range overrides wildcard", "image/*, image/png;q=0.5, image/jpeg", png, "jpeg"},
+		{"exact range overrides wildcard without a conversion", "image/*;q=1, image/png;q=0.5", png, ""},
+		{"wildcard below conversion", "*/*;q=0.1, image/jpeg;q=0.2", png, "jpeg"},
+		{"q=0 excludes the original", "image/*, image/png;q=0, image/jpeg;q=0.1", png, "jpeg"},
+		{"first listed conversion wins a tie", "image/png, image/jpeg", gif, "png"},
+		{"first listed conversion wins a tie reversed", "image/jpeg, image/png", gif, "jpeg"},
+		{"encrypted", "image/jpeg", &dto.ResourceResponse{ContentType: "image/png", Encrypted: true}, ""},
+		{"not an image", "image/jpeg", &dto.ResourceResponse{ContentType: "application/pdf"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateFormat(tt.accept, tt.resource); got != tt.want {
+				t.Errorf("NegotiateFormat(%q, %s) = %q, want %q", tt.accept, tt.resource.ContentType, got, tt.want)
+			}
+		})
+	}
+}
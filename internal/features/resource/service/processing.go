@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+)
+
+// Processor is one post-processing step run on every new resource, such as
+// thumbnail generation or a virus scan. open returns the resource content,
+// decrypted for encrypted buckets. An error marks the resource failed and
+// skips the remaining steps.
+type Processor func(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource, open func() (io.ReadSeekCloser, error)) error
+
+var (
+	processorsMu sync.RWMutex
+	processors   []Processor
+
+	// processingSlots caps concurrent background processing to the number of CPUs
+	processingSlots = make(chan struct{}, runtime.NumCPU())
+)
+
+// RegisterProcessor appends a step to the post-processing pipeline. Steps run
+// in registration order; builds that ship processors register them at init.
+func RegisterProcessor(p Processor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	processors = append(processors, p)
+}
+
+func registeredProcessors() []Processor {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+	return slices.Clone(processors)
+}
+
+// initialProcessingStatus is the status a new resource is stored with. With no
+// processors registered there is nothing to wait for, so it is ready at once.
+func initialProcessingStatus() string {
+	if len(registeredProcessors()) == 0 {
+		return dto.ProcessingReady
+	}
+	return dto.ProcessingPending
+}
+
+// isProcessed reports whether a resource's processing has finished, either way
+func isProcessed(status string) bool {
+	return status == dto.ProcessingReady || status == dto.ProcessingFailed
+}
+
+// process runs the pipeline on a pending resource and records the outcome on
+// resource. It does nothing if the resource is no longer pending, e.g. because
+// another upload of the same content already picked it up.
+func (s *resourceService) process(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource) {
+	started, err := s.repo.TransitionProcessing(ctx, resource.ID, dto.ProcessingPending, dto.ProcessingRunning, "")
+	if err != nil {
+		log.Printf("Error starting processing of resource %s: %v", resource.ID, err)
+		return
+	}
+	if !started {
+		return
+	}
+	resource.ProcessingStatus = dto.ProcessingRunning
+
+	status, reason := dto.ProcessingReady, ""
+	open := func() (io.ReadSeekCloser, error) {
+		return s.openBlob(bucket, resource)
+	}
+	for _, p := range registeredProcessors() {
+		if err := p(ctx, bucket, resource, open); err != nil {
+			status, reason = dto.ProcessingFailed, err.Error()
+			break
+		}
+	}
+
+	if _, err := s.repo.TransitionProcessing(ctx, resource.ID, dto.ProcessingRunning, status, reason); err != nil {
+		log.Printf("Error recording processing result of resource %s: %v", resource.ID, err)
+		return
+	}
+	resource.ProcessingStatus = status
+	resource.ProcessingError.String, resource.ProcessingError.Valid = reason, reason != ""
+	if status == dto.ProcessingFailed {
+		log.Printf("Processing of resource %s failed: %s", resource.ID, reason)
+	}
+}
+
+// processInBackground processes a resource once a slot is free and then sends
+// its resource.new webhook
+func (s *resourceService) processInBackground(requestID string, bucket *sqlc.Bucket, resource *sqlc.Resource, webhookHeaders map[string]string) {
+	go func() {
+		ctx := requestid.With(context.Background(), requestID)
+
+		processingSlots <- struct{}{}
+		s.process(ctx, bucket, resource)
+		<-processingSlots
+
+		s.notifyNew(ctx, bucket, resource, webhookHeaders)
+	}()
+}
+
+// ResumeProcessing restarts processing of resources left unfinished by a
+// previous run. Resources that were mid-processing when the server stopped
+// are processed again from the start.
+func (s *resourceService) ResumeProcessing(ctx context.Context) {
+	resources, err := s.repo.ListUnprocessed(ctx)
+	if err != nil {
+		log.Printf("Error listing unprocessed resources: %v", err)
+		return
+	}
+	if len(resources) == 0 {
+		return
+	}
+
+	buckets := make(map[string]*sqlc.Bucket)
+	resumed := 0
+	for i := range resources {
+		resource := &resources[i]
+
+		if resource.ProcessingStatus == dto.ProcessingRunning {
+			if _, err := s.repo.TransitionProcessing(ctx, resource.ID, dto.ProcessingRunning, dto.ProcessingPending, ""); err != nil {
+				log.Printf("Error requeueing processing of resource %s: %v", resource.ID, err)
+				continue
+			}
+			resource.ProcessingStatus = dto.ProcessingPending
+		}
+
+		bucket, ok := buckets[resource.BucketID]
+		if !ok {
+			bucket, err = s.bucketRepo.GetByID(ctx, resource.BucketID)
+			if err != nil && !errors.Is(err, bucketrepo.ErrBucketNotFound) {
+				log.Printf("Error loading bucket %s: %v", resource.BucketID, err)
+				continue
+			}
+			buckets[resource.BucketID] = bucket
+		}
+		if bucket == nil {
+			continue
+		}
+
+		s.processInBackground("", bucket, resource, nil)
+		resumed++
+	}
+
+	log.Printf("Resumed processing of %d resource(s)", resumed)
+}
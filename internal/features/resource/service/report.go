@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+)
+
+// reportPageSize is how many rows are read per query while writing a report
+const reportPageSize = 500
+
+// ErrInvalidTimeWindow is returned for report windows that end before they start
+var ErrInvalidTimeWindow = errors.New("to must be after from")
+
+// formulaPrefixes are the leading characters that make spreadsheets evaluate
+// a cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// reportHeader is the first row of every CSV report
+var reportHeader = []string{"hash", "size", "content_type", "created_at", "public_url"}
+
+// Report is a bucket's resources created within a time window, ready to be
+// streamed as CSV. Like Archive, ownership is checked before any bytes are
+// written, so errors can still be reported as a normal response.
+type Report struct {
+	BucketID  string
+	Sensitive bool
+	public    bool
+	from, to  time.Time
+	s         *resourceService
+}
+
+// Report resolves a CSV report of the bucket's live resources created at or
+// after from and before to, at second precision. A zero from starts at the
+// first resource and a zero to ends at the last.
+func (s *resourceService) Report(ctx context.Context, clientID, bucketID string, from, to time.Time) (*Report, error) {
+	from, to = from.UTC().Truncate(time.Second), to.UTC().Truncate(time.Second)
+	if !to.IsZero() && !to.After(from) {
+		return nil, ErrInvalidTimeWindow
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	return &Report{
+		BucketID:  bucket.ID,
+		Sensitive: bucket.Sensitive == 1,
+		public:    bucket.IsPublic == 1,
+		from:      from,
+		to:        to,
+		s:         s,
+	}, nil
+}
+
+// WriteCSV streams the report to w, oldest resource first, one page of rows
+// at a time so large buckets are never held in memory. public_url is empty
+// for private buckets. An empty window gives just the header row.
+func (r *Report) WriteCSV(ctx context.Context, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(reportHeader); err != nil {
+		return err
+	}
+
+	// The first page includes resources in the same second as from
+	after, afterID := r.from, ""
+	for {
+		rows, err := r.s.repo.ListCreatedAfter(ctx, r.BucketID, after, afterID, reportPageSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range rows {
+			row := &rows[i]
+			created := row.CreatedAt.Time.UTC().Truncate(time.Second)
+			if !r.to.IsZero() && !created.Before(r.to) {
+				cw.Flush()
+				return cw.Error()
+			}
+			if err := cw.Write(r.record(row, created)); err != nil {
+				return err
+			}
+			after, afterID = created, row.ID
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if len(rows) < reportPageSize {
+			return nil
+		}
+	}
+}
+
+func (r *Report) record(row *sqlc.Resource, created time.Time) []string {
+	var publicURL string
+	if r.public {
+		publicURL = r.s.buildPublicURL(r.BucketID, row.Hash, row.Extension)
+	}
+	return []string{
+		row.Hash,
+		strconv.FormatInt(row.Size, 10),
+		neutralizeFormula(row.ContentType),
+		created.Format(time.RFC3339),
+		neutralizeFormula(publicURL),
+	}
+}
+
+// neutralizeFormula prefixes a field that a spreadsheet would evaluate with a
+// single quote, so an uploaded content type like =HYPERLINK(...) opens as text
+func neutralizeFormula(field string) string {
+	if field != "" && strings.ContainsRune(formulaPrefixes, rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
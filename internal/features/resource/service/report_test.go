@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+func TestReportCSVEscaping(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{"image/jpeg", "image/jpeg"},
+		{`text/plain; charset="utf-8", x`, `text/plain; charset="utf-8", x`},
+		{"text/plain\nnext,row", "text/plain\nnext,row"},
+		{`=HYPERLINK("http://evil.example","open")`, `'=HYPERLINK("http://evil.example","open")`},
+		{"+1+1", "'+1+1"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\tcmd", "'\tcmd"},
+	}
+	want := make(map[string]string)
+	for i, tt := range tests {
+		hash := fmt.Sprintf("%064x", i)
+		_, err := b.db.Queries.CreateResource(ctx, sqlc.CreateResourceParams{
+			ID:               hash,
+			BucketID:         b.bucket.ID,
+			Hash:             hash,
+			Size:             1,
+			ContentType:      tt.contentType,
+			ProcessingStatus: "ready",
+		})
+		if err != nil {
+			t.Fatalf("create resource: %v", err)
+		}
+		want[hash] = tt.want
+	}
+
+	report, err := b.svc.Report(ctx, b.client.ID, b.bucket.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Report() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(ctx, &buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != len(tests)+1 {
+		t.Fatalf("got %d records, want a header and %d rows", len(records), len(tests))
+	}
+	for _, record := range records[1:] {
+		if len(record) != len(reportHeader) {
+			t.Errorf("row %q has %d fields, want %d", record, len(record), len(reportHeader))
+			continue
+		}
+		if got := record[2]; got != want[record[0]] {
+			t.Errorf("content_type of %s = %q, want %q", record[0], got, want[record[0]])
+		}
+	}
+}
+
+func TestNeutralizeFormula(t *testing.T) {
+	tests := []struct {
+		field, want string
+	}{
+		{"", ""},
+		{"image/png", "image/png"},
+		{"a=b", "a=b"},
+		{"=1+1", "'=1+1"},
+		{"\r=1", "'\r=1"},
+		{"'=1", "'=1"},
+	}
+	for _, tt := range tests {
+		if got := neutralizeFormula(tt.field); got != tt.want {
+			t.Errorf("neutralizeFormula(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestReportInvalidWindow(t *testing.T) {
+	b := newTestBucket(t)
+	from := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		to   time.Time
+	}{
+		{"to equal to from", from},
+		{"to before from", from.Add(-time.Hour)},
+		{"to within the same second", from.Add(500 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		if _, err := b.svc.Report(context.Background(), b.client.ID, b.bucket.ID, from, tt.to); !errors.Is(err, ErrInvalidTimeWindow) {
+			t.Errorf("%s: Report() error = %v, want %v", tt.name, err, ErrInvalidTimeWindow)
+		}
+	}
+}
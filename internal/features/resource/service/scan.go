@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
+)
+
+// ErrScanFailed is returned when an upload to a scanned bucket could not be
+// scanned and the server fails closed
+var ErrScanFailed = errors.New("upload could not be scanned for malware")
+
+// scanUpload checks a buffered upload for malware before it is stored.
+// Infected content is always rejected with a *scanner.InfectedError. When the
+// scanner fails or is not configured, the upload is rejected too unless the
+// server fails open.
+func (s *resourceService) scanUpload(ctx context.Context, path string) error {
+	err := s.runScan(ctx, path)
+	var infected *scanner.InfectedError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &infected):
+		return err
+	case s.scanFailOpen:
+		log.Printf("Malware scan failed, storing upload unscanned: %v", err)
+		return nil
+	default:
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+}
+
+func (s *resourceService) runScan(ctx context.Context, path string) error {
+	if s.scanner == nil {
+		return errors.New("no scanner configured")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.scanner.Scan(ctx, file)
+}
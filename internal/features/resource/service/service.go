@@ -3,56 +3,344 @@ package service
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
+	bucketdto "github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
 	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
 	webhookdto "github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/internal/throttle"
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrUnknownExtension is returned when an upload has no extension and its
+	// Content-Type does not identify one. The wrapped message says which.
+	ErrUnknownExtension = errors.New("file extension could not be determined")
+
+	// ErrInvalidExtension is returned for extensions that are not a dot
+	// followed by letters, digits, '_', '+' or '-' (e.g. ".jpg", ".tar.gz")
+	ErrInvalidExtension = errors.New("invalid file extension")
+
+	// ErrUploadTooLarge is returned for uploads over MAX_UPLOAD_SIZE. The
+	// wrapped message states the limit.
+	ErrUploadTooLarge = errors.New("upload exceeds the maximum size")
+
+	// ErrInvalidContentType is returned when a new content type is not a
+	// valid media type
+	ErrInvalidContentType = errors.New("invalid content type")
+
+	// ErrInvalidExpectedHash is returned when an expected hash is not a
+	// hex-encoded SHA-256
+	ErrInvalidExpectedHash = errors.New("expected hash must be a hex-encoded SHA-256")
+
+	// ErrHashMismatch is returned when an upload's content does not hash to
+	// the expected value, e.g. because it was truncated in transit. Nothing
+	// is stored. The wrapped message has both hashes.
+	ErrHashMismatch = errors.New("upload does not match the expected hash")
+
+	// ErrContentTypeMismatch is returned in strict content type mode for
+	// uploads whose sniffed content does not match their extension. Nothing
+	// is stored. The wrapped message has the extension and detected type.
+	ErrContentTypeMismatch = errors.New("upload content does not match its extension")
+
+	// ErrInvalidListFilter is returned for a listing sort, order or content
+	// type filter outside what List accepts. The wrapped message says which.
+	ErrInvalidListFilter = errors.New("invalid list filter")
+)
+
+// validExtension allows up to three dotted parts, so names stay inside the
+// bucket directory
+var validExtension = regexp.MustCompile(`^(\.[A-Za-z0-9_+-]+){1,3}$`)
+
+// validHash matches a lower-case hex SHA-256
+var validHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// contentTypeFilter matches "type/subtype" and "type/*"
+var contentTypeFilter = regexp.MustCompile(`^[a-z0-9][a-z0-9!#$&^_.+-]*/(\*|[a-z0-9][a-z0-9!#$&^_.+-]*)$`)
+
+// listSorts are the columns a listing can be ordered by
+var listSorts = map[string]bool{"created_at": true, "size": true}
+
+// maxExtensionLength bounds X-File-Extension
+const maxExtensionLength = 32
+
+// preferredExtensions picks the conventional extension for common types,
+// since mime.ExtensionsByType returns candidates in alphabetical order
+var preferredExtensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"image/avif":       ".avif",
+	"image/svg+xml":    ".svg",
+	"text/plain":       ".txt",
+	"text/html":        ".html",
+	"text/css":         ".css",
+	"text/csv":         ".csv",
+	"application/json": ".json",
+	"application/pdf":  ".pdf",
+	"application/zip":  ".zip",
+	"video/mp4":        ".mp4",
+	"audio/mpeg":       ".mp3",
+}
+
+// BucketCreator creates buckets for uploads that auto-create them. It is the
+// bucket service, behind an interface to avoid circular dependencies.
+type BucketCreator interface {
+	Create(ctx context.Context, clientID string, req bucketdto.CreateBucketRequest, idempotent bool) (*bucketdto.BucketResponse, bool, error)
+}
+
 // WebhookLauncher is an interface to avoid circular dependencies
 type WebhookLauncher interface {
-	TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, extraHeaders map[string]string) error
+	TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, metadata, extraHeaders map[string]string) error
 }
 
 type ResourceService interface {
-	UploadStream(ctx context.Context, clientID, bucketID, contentType, extension string, reader io.Reader, webhookHeaders map[string]string) (*dto.ResourceResponse, error)
-	UploadFile(ctx context.Context, clientID, bucketID string, file *multipart.FileHeader, webhookHeaders map[string]string) (*dto.ResourceResponse, error)
+	// UploadStream stores the content of reader. A non-empty expectedHash is
+	// compared with the SHA-256 of the content before anything is stored.
+	// With autoCreate, bucket may also name a bucket of the client, which is
+	// created if it does not exist. Non-empty metadata replaces the
+	// resource's metadata, also when the content was already stored.
+	UploadStream(ctx context.Context, clientID, bucket, contentType, extension, filename, expectedHash string, reader io.Reader, webhookHeaders, metadata map[string]string, async, autoCreate bool) (*dto.ResourceResponse, error)
+	UploadFile(ctx context.Context, clientID, bucketID string, file *multipart.FileHeader, webhookHeaders, metadata map[string]string, async bool) (*dto.ResourceResponse, error)
+	UploadBatch(ctx context.Context, clientID, bucketID string, files []*multipart.FileHeader, webhookHeaders map[string]string, async bool) *dto.BatchUploadResponse
+	CheckUploadAccess(ctx context.Context, clientID, bucketID string) error
+	// CheckUploadSize returns ErrUploadTooLarge when size bytes exceed
+	// MAX_UPLOAD_SIZE. A negative size (unknown length) always passes.
+	CheckUploadSize(size int64) error
+	// MaxUploadSize returns MAX_UPLOAD_SIZE in bytes, 0 when unlimited
+	MaxUploadSize() int64
 	Download(ctx context.Context, clientID, bucketID, hash string) (io.ReadCloser, *dto.ResourceResponse, error)
+	DownloadShared(ctx context.Context, bucketID, hash string, expires int64, signature string) (io.ReadCloser, *dto.ResourceResponse, error)
+	Presign(ctx context.Context, clientID, bucketID, hash string, ttl time.Duration) (*dto.PresignResponse, error)
+	Feed(ctx context.Context, bucketID string) (*dto.AtomFeed, error)
+	ThrottlePublic(ctx context.Context, bucketID string, w http.ResponseWriter) http.ResponseWriter
+	PublicCacheControl(ctx context.Context, bucketID string) string
+	DownloadAs(ctx context.Context, clientID, bucketID, hash, format string) (io.ReadCloser, *dto.ResourceResponse, error)
+	// Thumbnail returns an image resource shrunk to fit within width x
+	// height, from the bucket's thumbnail cache when it was made before
+	Thumbnail(ctx context.Context, clientID, bucketID, hash string, width, height int) (io.ReadCloser, *dto.ResourceResponse, error)
 	Get(ctx context.Context, clientID, bucketID, hash string) (*dto.ResourceResponse, error)
-	List(ctx context.Context, clientID, bucketID string) (*dto.ResourceListResponse, error)
+	// GetByName returns the resource most recently uploaded under a filename
+	GetByName(ctx context.Context, clientID, bucketID, name string) (*dto.ResourceResponse, error)
+	UpdateContentType(ctx context.Context, clientID, bucketID, hash, contentType string) (*dto.ResourceResponse, error)
+	Status(ctx context.Context, clientID, bucketID, hash string) (*dto.ProcessingStatusResponse, error)
+	// List returns up to limit resources of a bucket matching filter, in its
+	// order (newest first by default), skipping offset, with the number that
+	// match
+	List(ctx context.Context, clientID, bucketID string, filter dto.ListFilter, limit, offset int) (*dto.ResourceListResponse, error)
+	// ListVersion returns a token that changes whenever the bucket's listing
+	// does, without loading the listing
+	ListVersion(ctx context.Context, clientID, bucketID string) (string, error)
+	ListChanges(ctx context.Context, clientID, bucketID string, since time.Time, cursor string, limit int) (*dto.ResourceListResponse, error)
+	// Delete removes a resource; with a trash retention it is moved to the
+	// bucket's trash instead, to be restored or purged later
 	Delete(ctx context.Context, clientID, bucketID, hash string) error
+	// Restore brings a resource back out of the trash
+	Restore(ctx context.Context, clientID, bucketID, hash string) (*dto.ResourceResponse, error)
+	// Copy adds a resource to another of the client's buckets without
+	// re-uploading it
+	Copy(ctx context.Context, clientID, bucketID, hash, destBucketID string) (*dto.ResourceResponse, error)
+	// DeleteMany deletes up to MaxBulkDeleteEntries hashes, best effort, and
+	// reports the outcome of each
+	DeleteMany(ctx context.Context, clientID, bucketID string, hashes []string, dryRun bool) (*dto.BulkDeleteResponse, error)
+	// DeleteAll empties a bucket. With dryRun it only reports what would be
+	// deleted.
+	DeleteAll(ctx context.Context, clientID, bucketID string, dryRun bool) (*dto.DeleteAllResponse, error)
+	Verify(ctx context.Context, clientID, bucketID, hash string) (*dto.VerifyResponse, error)
+	VerifyBucket(ctx context.Context, clientID, bucketID string) (*dto.BucketVerifyResponse, error)
+	Chunks(ctx context.Context, clientID, bucketID, hash string) (*dto.ChunkManifest, error)
+	Archive(ctx context.Context, clientID, bucketID string, hashes []string) (*Archive, error)
+	GetMetadata(ctx context.Context, clientID, bucketID, hash string) (*dto.MetadataResponse, error)
+	// SetMetadata replaces every metadata entry of a resource
+	SetMetadata(ctx context.Context, clientID, bucketID, hash string, metadata map[string]string) (*dto.MetadataResponse, error)
+	// Report resolves a CSV report of the resources created in a time window
+	Report(ctx context.Context, clientID, bucketID string, from, to time.Time) (*Report, error)
+
+	// Admin operations (no ownership checks)
+	Reindex(ctx context.Context, bucketID string, dryRun bool) (*dto.ReindexResponse, error)
+
+	// ResumeProcessing restarts post-processing left unfinished by a previous run
+	ResumeProcessing(ctx context.Context)
+	// RunBlobCleanup periodically removes shared copies of content that no
+	// bucket references any more
+	RunBlobCleanup(ctx context.Context)
+	// RunTrashPurge periodically removes trashed resources for good once the
+	// trash retention has passed
+	RunTrashPurge(ctx context.Context)
 }
 
 type resourceService struct {
 	repo            repository.ResourceRepository
 	bucketRepo      bucketrepo.BucketRepository
+	bucketCreator   BucketCreator
 	webhookLauncher WebhookLauncher
-	storagePath     string
+	signer          *presign.Signer
+	layout          *storage.Layout
 	publicURL       string
+	cacheControl    string
+	chunkSize       int64
+	maxUploadSize   int64
+	tempDir         string
+	cipher          *encryption.Cipher
+	usage           *storage.Usage
+	scanner         scanner.Scanner
+	scanFailOpen    bool
+	throttle        *throttle.Limits
+	storeNames      bool
+	trashRetention  time.Duration
+	strictTypes     bool
+}
+
+// Options configures the resource service. Zero values leave the optional
+// parts off.
+type Options struct {
+	Layout *storage.Layout
+	// PublicURL prefixes public and download URLs
+	PublicURL string
+	// CacheControl is the Cache-Control of public files in buckets that do
+	// not set their own
+	CacheControl string
+	Signer       *presign.Signer
+	// ChunkSize is the size of the chunks in a chunk manifest;
+	// DefaultChunkSize when not positive
+	ChunkSize int64
+	// MaxUploadSize caps each upload in bytes; 0 is unlimited
+	MaxUploadSize int64
+	TempDir       string
+	// Cipher encrypts blobs of encrypted buckets; nil when no key is set
+	Cipher *encryption.Cipher
+	Usage  *storage.Usage
+	// Scanner checks uploads to buckets with scan_uploads; nil when no
+	// scanner is configured. ScanFailOpen stores uploads it fails to scan.
+	Scanner      scanner.Scanner
+	ScanFailOpen bool
+	// Throttle limits download rates; nil leaves them unthrottled
+	Throttle *throttle.Limits
+	// StoreNames keeps upload filenames as original_name and in the bucket's
+	// name mapping
+	StoreNames bool
+	// TrashRetention keeps deleted resources restorable for that long; 0
+	// deletes them immediately
+	TrashRetention time.Duration
+	// StrictTypes rejects uploads whose content does not match their
+	// extension
+	StrictTypes bool
 }
 
-func New(repo repository.ResourceRepository, bucketRepo bucketrepo.BucketRepository, storagePath, publicURL string, webhookLauncher WebhookLauncher) ResourceService {
+// New creates the resource service
+func New(repo repository.ResourceRepository, bucketRepo bucketrepo.BucketRepository, bucketCreator BucketCreator, webhookLauncher WebhookLauncher, opts Options) ResourceService {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
 	return &resourceService{
 		repo:            repo,
 		bucketRepo:      bucketRepo,
-		storagePath:     storagePath,
-		publicURL:       publicURL,
+		bucketCreator:   bucketCreator,
+		layout:          opts.Layout,
+		publicURL:       opts.PublicURL,
+		cacheControl:    opts.CacheControl,
 		webhookLauncher: webhookLauncher,
+		signer:          opts.Signer,
+		chunkSize:       opts.ChunkSize,
+		maxUploadSize:   opts.MaxUploadSize,
+		tempDir:         opts.TempDir,
+		cipher:          opts.Cipher,
+		usage:           opts.Usage,
+		scanner:         opts.Scanner,
+		scanFailOpen:    opts.ScanFailOpen,
+		throttle:        opts.Throttle,
+		storeNames:      opts.StoreNames,
+		trashRetention:  opts.TrashRetention,
+		strictTypes:     opts.StrictTypes,
+	}
+}
+
+// UploadStream stores a resource and runs its post-processing. With async the
+// response is returned as soon as the content is stored, and processing and
+// the resource.new webhook follow in the background. An upload that does not
+// hash to a non-empty expectedHash fails with ErrHashMismatch. filename is
+// optional and must be a plain file name, not a path. With autoCreate, see
+// uploadBucket.
+func (s *resourceService) UploadStream(ctx context.Context, clientID, bucket, contentType, extension, filename, expectedHash string, reader io.Reader, webhookHeaders, metadata map[string]string, async, autoCreate bool) (*dto.ResourceResponse, error) {
+	if filename != "" {
+		if name, ok := fileName(filename); !ok || name != filename {
+			return nil, ErrInvalidFileName
+		}
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
 	}
+	if !autoCreate {
+		return s.upload(ctx, clientID, bucket, contentType, extension, filename, expectedHash, reader, webhookHeaders, metadata, async)
+	}
+
+	bucketID, created, err := s.uploadBucket(ctx, clientID, bucket)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.upload(ctx, clientID, bucketID, contentType, extension, filename, expectedHash, reader, webhookHeaders, metadata, async)
+	if err != nil {
+		return nil, err
+	}
+	resp.BucketID = bucketID
+	resp.BucketCreated = created
+	return resp, nil
 }
 
-func (s *resourceService) UploadStream(ctx context.Context, clientID, bucketID, contentType, extension string, reader io.Reader, webhookHeaders map[string]string) (*dto.ResourceResponse, error) {
+// uploadBucket resolves the bucket of an auto-creating upload: the client's
+// bucket with that ID, or else with that name, which is created as a private
+// bucket when the client has none. Names are validated and MAX_BUCKETS is
+// enforced as for POST /buckets. A UUID is never taken for a name, so a
+// mistyped ID still fails with ErrBucketNotFound. created reports whether the
+// bucket was made by this call; it is kept even if the upload then fails.
+func (s *resourceService) uploadBucket(ctx context.Context, clientID, ref string) (string, bool, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, ref)
+	if err == nil && bucket.ClientID == clientID {
+		return bucket.ID, false, nil
+	}
+	if err != nil && !errors.Is(err, bucketrepo.ErrBucketNotFound) {
+		return "", false, err
+	}
+	if _, err := uuid.Parse(ref); err == nil || s.bucketCreator == nil {
+		return "", false, bucketrepo.ErrBucketNotFound
+	}
+
+	// Idempotent, so an existing bucket of that name is returned, and so are
+	// buckets created concurrently by parallel first uploads
+	created, isNew, err := s.bucketCreator.Create(ctx, clientID, bucketdto.CreateBucketRequest{Name: ref}, true)
+	if err != nil {
+		return "", false, err
+	}
+	return created.ID, isNew, nil
+}
+
+// upload stores a resource under originalName, the filename it was uploaded
+// with; when it is empty the resource is downloaded as <hash><ext>. The name
+// is also mapped to the hash, for new and duplicate content alike, unless
+// names are not stored. A non-empty expectedHash must match the content's
+// SHA-256.
+func (s *resourceService) upload(ctx context.Context, clientID, bucketID, contentType, extension, originalName, expectedHash string, reader io.Reader, webhookHeaders, metadata map[string]string, async bool) (*dto.ResourceResponse, error) {
 	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
 	if err != nil {
 		return nil, err
@@ -63,18 +351,56 @@ func (s *resourceService) UploadStream(ctx context.Context, clientID, bucketID,
 		return nil, bucketrepo.ErrBucketNotFound
 	}
 
+	if !s.storeNames {
+		originalName = ""
+	}
+
+	// Everything that only depends on headers is validated before the body is
+	// read, so clients sending "Expect: 100-continue" are rejected early.
+	ext, err := resolveExtension(contentType, extension)
+	if err != nil {
+		return nil, err
+	}
+	contentType = resolveContentType(contentType, ext)
+
+	if expectedHash != "" {
+		expectedHash = strings.ToLower(expectedHash)
+		if !validHash.MatchString(expectedHash) {
+			return nil, ErrInvalidExpectedHash
+		}
+	}
+
+	encrypt := bucket.Encrypted == 1
+	if encrypt && s.cipher == nil {
+		return nil, encryption.ErrUnavailable
+	}
+
+	if err := s.usage.Check(); err != nil {
+		return nil, err
+	}
+
 	// Create temp file to compute hash while reading
-	tempFile, err := os.CreateTemp("", "resource-*")
+	tempFile, err := os.CreateTemp(s.tempDir, tempFilePattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
 	tempPath := tempFile.Name()
 	defer os.Remove(tempPath)
 
-	// Compute hash while copying to temp file
+	// Read one byte past the limit, so an oversized body is detected without
+	// buffering the rest of it
+	if s.maxUploadSize > 0 {
+		reader = io.LimitReader(reader, s.maxUploadSize+1)
+	}
+
+	// Compute hash while copying to temp file, keeping the first bytes to
+	// sniff the type from when the client did not give one
 	hasher := sha256.New()
-	teeReader := io.TeeReader(reader, hasher)
+	var head sniffBuffer
+	teeReader := io.TeeReader(contextReader{ctx: ctx, r: reader}, io.MultiWriter(hasher, &head))
 
+	// A cancelled request stops the copy; the deferred remove then drops the
+	// partial temp file
 	size, err := io.Copy(tempFile, teeReader)
 	if err != nil {
 		tempFile.Close()
@@ -82,104 +408,257 @@ func (s *resourceService) UploadStream(ctx context.Context, clientID, bucketID,
 	}
 	tempFile.Close()
 
-	hash := hex.EncodeToString(hasher.Sum(nil))
+	if err := s.CheckUploadSize(size); err != nil {
+		return nil, err
+	}
 
-	// Use provided extension or fall back to content type
-	ext := extension
-	if ext == "" {
-		var err error
-		ext, err = getExtensionFromContentType(contentType)
-		if err != nil {
+	if s.strictTypes && size > 0 {
+		if err := checkContentType(ext, head); err != nil {
 			return nil, err
 		}
 	}
-	if ext != "" && ext[0] != '.' {
-		ext = "." + ext
+
+	if contentType == defaultContentType && size > 0 {
+		contentType = http.DetectContentType(head)
 	}
 
-	// Check if resource already exists (deduplication)
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	// A truncated or corrupted body is refused before it is scanned or stored
+	if expectedHash != "" && hash != expectedHash {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrHashMismatch, expectedHash, hash)
+	}
+
+	// Scanned before deduplication, so infected content is rejected even if
+	// a copy was stored before scanning was enabled
+	if bucket.ScanUploads == 1 {
+		if err := s.scanUpload(ctx, tempPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check if resource already exists (deduplication). The hash is taken over
+	// the plaintext, so identical content keeps a single stored copy even in
+	// encrypted buckets where every encryption produces different bytes.
+	// Across buckets, unencrypted content is deduplicated by storeShared.
 	existing, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
 	if err == nil {
 		// Resource already exists, return it
-		resp := &dto.ResourceResponse{
-			ID:          existing.ID,
-			Hash:        existing.Hash,
-			Size:        existing.Size,
-			ContentType: existing.ContentType,
-			Extension:   existing.Extension,
-			CreatedAt:   existing.CreatedAt.Time,
-		}
-		if bucket.IsPublic == 1 {
-			resp.PublicURL = s.buildPublicURL(bucket.ID, existing.Hash, existing.Extension)
+		resp := s.detail(bucket, existing)
+		resp.DownloadURL = s.buildDownloadURL(bucket.ID, existing.Hash, existing.Extension)
+		resp.Deduplicated = true
+		if len(metadata) > 0 {
+			if err := s.repo.SetMetadata(ctx, existing.ID, metadata); err != nil {
+				return nil, fmt.Errorf("failed to store metadata: %w", err)
+			}
+			resp.Metadata = metadata
+		} else {
+			resp.Metadata = s.resourceMetadata(ctx, existing.ID)
 		}
+		s.recordName(ctx, bucket.ID, originalName, existing.Hash)
 		return resp, nil
 	}
 
+	// Only new content counts against the storage cap; duplicates were
+	// returned above
+	if err := s.usage.Reserve(size); err != nil {
+		return nil, err
+	}
+
+	// Nothing is stored for a request cancelled while it was scanned or
+	// deduplicated
+	if err := ctx.Err(); err != nil {
+		s.usage.Add(-size)
+		return nil, err
+	}
+
+	// A trashed copy would keep the hash taken. It is purged only now that
+	// the new copy is being stored, so a refused upload leaves it restorable.
+	if err := s.purgeTrashed(ctx, bucket, hash); err != nil {
+		s.usage.Add(-size)
+		return nil, err
+	}
+
 	// Move temp file to final location (with extension)
 	filename := buildFilename(hash, ext)
-	resourcePath := filepath.Join(s.storagePath, bucket.ID, filename)
-	if err := os.Rename(tempPath, resourcePath); err != nil {
-		// If rename fails (cross-device), copy instead
-		if err := copyFile(tempPath, resourcePath); err != nil {
-			return nil, fmt.Errorf("failed to store resource: %w", err)
-		}
+	resourcePath := filepath.Join(s.layout.BucketDir(bucket.ClientID, bucket.ID), filename)
+	linked := false
+	if encrypt {
+		err = s.storeBlob(tempPath, resourcePath, true)
+	} else {
+		linked, err = s.storeShared(tempPath, resourcePath, hash, size)
+	}
+	if err != nil {
+		s.usage.Add(-size)
+		return nil, fmt.Errorf("failed to store resource: %w", err)
+	}
+	// Content another bucket already holds takes no new space
+	stored := size
+	if linked {
+		s.usage.Add(-size)
+		stored = 0
+	}
+
+	var encrypted int64
+	if encrypt {
+		encrypted = 1
 	}
 
 	// Create database record
 	resourceID := uuid.New().String()
 	resource, err := s.repo.Create(ctx, sqlc.CreateResourceParams{
-		ID:          resourceID,
-		BucketID:    bucket.ID,
-		Hash:        hash,
-		Size:        size,
-		ContentType: contentType,
-		Extension:   ext,
-	})
+		ID:               resourceID,
+		BucketID:         bucket.ID,
+		Hash:             hash,
+		Size:             size,
+		ContentType:      contentType,
+		Extension:        ext,
+		RetainUntil:      retainUntil(bucket),
+		Encrypted:        encrypted,
+		ProcessingStatus: initialProcessingStatus(),
+		OriginalName:     originalName,
+	}, metadata)
 	if err != nil {
 		os.Remove(resourcePath)
+		s.usage.Add(-stored)
 		return nil, fmt.Errorf("failed to create resource record: %w", err)
 	}
+	s.recordName(ctx, bucket.ID, originalName, resource.Hash)
 
 	resp := &dto.ResourceResponse{
-		ID:          resource.ID,
-		Hash:        resource.Hash,
-		Size:        resource.Size,
-		ContentType: resource.ContentType,
-		Extension:   resource.Extension,
-		CreatedAt:   resource.CreatedAt.Time,
+		ID:           resource.ID,
+		Hash:         resource.Hash,
+		Size:         resource.Size,
+		ContentType:  resource.ContentType,
+		Extension:    resource.Extension,
+		OriginalName: resource.OriginalName,
+		CreatedAt:    resource.CreatedAt.Time,
+		Sensitive:    bucket.Sensitive == 1,
+		DownloadURL:  s.buildDownloadURL(bucket.ID, resource.Hash, resource.Extension),
+		Encrypted:    resource.Encrypted == 1,
+		Metadata:     metadata,
 	}
 	if bucket.IsPublic == 1 {
 		resp.PublicURL = s.buildPublicURL(bucket.ID, resource.Hash, resource.Extension)
 	}
 
-	// Trigger webhook event for new resource
-	if s.webhookLauncher != nil {
-		go func() {
-			triggerCtx := context.Background()
-			resourceURL := s.buildDownloadURL(bucket.ID, resource.Hash, resource.Extension)
-			s.webhookLauncher.TriggerEvent(triggerCtx, webhookdto.EventResourceNew, bucket, resource, resourceURL, webhookHeaders)
-		}()
+	if resource.ProcessingStatus == dto.ProcessingPending {
+		if async {
+			s.processInBackground(requestid.From(ctx), bucket, resource, webhookHeaders)
+			s.setProcessing(resp, resource)
+			return resp, nil
+		}
+		// Processing outlives a client that disconnects mid-way, so the
+		// resource never stays stuck in processing
+		s.process(context.WithoutCancel(ctx), bucket, resource)
 	}
+	s.setProcessing(resp, resource)
+
+	requestID := requestid.From(ctx)
+	go s.notifyNew(requestid.With(context.Background(), requestID), bucket, resource, webhookHeaders)
 
 	return resp, nil
 }
 
-func (s *resourceService) UploadFile(ctx context.Context, clientID, bucketID string, file *multipart.FileHeader, webhookHeaders map[string]string) (*dto.ResourceResponse, error) {
+// notifyNew sends the resource.new webhook for a stored resource, with its
+// metadata as it is when the event is sent
+func (s *resourceService) notifyNew(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource, webhookHeaders map[string]string) {
+	if s.webhookLauncher == nil {
+		return
+	}
+	resourceURL := s.buildDownloadURL(bucket.ID, resource.Hash, resource.Extension)
+	metadata := s.resourceMetadata(ctx, resource.ID)
+	s.webhookLauncher.TriggerEvent(ctx, webhookdto.EventResourceNew, bucket, resource, resourceURL, metadata, webhookHeaders)
+}
+
+// setProcessing copies a resource's processing state into a response, with a
+// link to poll while processing has not finished
+func (s *resourceService) setProcessing(resp *dto.ResourceResponse, resource *sqlc.Resource) {
+	resp.ProcessingStatus = resource.ProcessingStatus
+	resp.ProcessingError = resource.ProcessingError.String
+	if !isProcessed(resource.ProcessingStatus) {
+		resp.StatusURL = s.buildStatusURL(resource.BucketID, resource.Hash)
+	}
+}
+
+// CheckUploadAccess validates that the client may upload into the bucket
+// without touching the request body.
+func (s *resourceService) CheckUploadAccess(ctx context.Context, clientID, bucketID string) error {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return bucketrepo.ErrBucketNotFound
+	}
+
+	return s.usage.Check()
+}
+
+func (s *resourceService) CheckUploadSize(size int64) error {
+	if s.maxUploadSize > 0 && size > s.maxUploadSize {
+		return fmt.Errorf("%w of %d bytes", ErrUploadTooLarge, s.maxUploadSize)
+	}
+	return nil
+}
+
+func (s *resourceService) MaxUploadSize() int64 {
+	return s.maxUploadSize
+}
+
+func (s *resourceService) UploadFile(ctx context.Context, clientID, bucketID string, file *multipart.FileHeader, webhookHeaders, metadata map[string]string, async bool) (*dto.ResourceResponse, error) {
+	if err := s.CheckUploadSize(file.Size); err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(metadata); err != nil {
+		return nil, err
+	}
+
 	src, err := file.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
 	}
 	defer src.Close()
 
-	contentType := file.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
-
 	// Extract extension from original filename
 	extension := filepath.Ext(file.Filename)
 
-	return s.UploadStream(ctx, clientID, bucketID, contentType, extension, src, webhookHeaders)
+	// A filename that is unusable as a name is not stored; the upload still is
+	name, _ := fileName(file.Filename)
+
+	return s.upload(ctx, clientID, bucketID, file.Header.Get("Content-Type"), extension, name, "", src, webhookHeaders, metadata, async)
+}
+
+// UploadBatch uploads files one after another and reports for each whether it
+// was stored, matched content already in the bucket, or failed. A failed file
+// does not stop the rest of the batch.
+func (s *resourceService) UploadBatch(ctx context.Context, clientID, bucketID string, files []*multipart.FileHeader, webhookHeaders map[string]string, async bool) *dto.BatchUploadResponse {
+	summary := &dto.BatchUploadResponse{
+		BucketID: bucketID,
+		Files:    make([]dto.BatchUploadEntry, 0, len(files)),
+	}
+
+	for _, file := range files {
+		entry := dto.BatchUploadEntry{Filename: file.Filename}
+
+		resource, err := s.UploadFile(ctx, clientID, bucketID, file, webhookHeaders, nil, async)
+		switch {
+		case err != nil:
+			entry.Status, entry.Error, entry.Err = dto.BatchFailed, err.Error(), err
+			summary.Failed++
+		case resource.Deduplicated:
+			entry.Status, entry.Resource = dto.BatchDeduplicated, resource
+			summary.Deduplicated++
+		default:
+			entry.Status, entry.Resource = dto.BatchStored, resource
+			summary.Stored++
+		}
+		summary.Files = append(summary.Files, entry)
+	}
+
+	return summary
 }
 
 func (s *resourceService) Download(ctx context.Context, clientID, bucketID, hash string) (io.ReadCloser, *dto.ResourceResponse, error) {
@@ -193,25 +672,109 @@ func (s *resourceService) Download(ctx context.Context, clientID, bucketID, hash
 		return nil, nil, bucketrepo.ErrBucketNotFound
 	}
 
+	return s.openThrottled(ctx, bucket, hash)
+}
+
+// DownloadShared serves a resource through a presigned link; the signature
+// replaces the ownership check.
+func (s *resourceService) DownloadShared(ctx context.Context, bucketID, hash string, expires int64, signature string) (io.ReadCloser, *dto.ResourceResponse, error) {
+	if err := s.signer.Verify(bucketID, hash, expires, signature); err != nil {
+		return nil, nil, err
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.openThrottled(ctx, bucket, hash)
+}
+
+// ThrottlePublic limits the bandwidth of a public file response by the
+// bucket's download rate and the global one. Requests for buckets that cannot
+// be loaded are held to the global rate only.
+func (s *resourceService) ThrottlePublic(ctx context.Context, bucketID string, w http.ResponseWriter) http.ResponseWriter {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return s.throttle.ResponseWriter(ctx, w, bucketID, 0)
+	}
+	return s.throttle.ResponseWriter(ctx, w, bucket.ID, bucket.DownloadRateLimit)
+}
+
+// PublicCacheControl returns the Cache-Control of a bucket's public files:
+// the bucket's own value, or the server default. Sensitive buckets are never
+// cached, and buckets that cannot be loaded get the default.
+func (s *resourceService) PublicCacheControl(ctx context.Context, bucketID string) string {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return s.cacheControl
+	}
+	if bucket.Sensitive == 1 {
+		return "no-store, private"
+	}
+	if bucket.CacheControl != "" {
+		return bucket.CacheControl
+	}
+	return s.cacheControl
+}
+
+// Presign creates a time-limited link that downloads the resource without
+// credentials, even from a private bucket. ttl is clamped to the configured max.
+func (s *resourceService) Presign(ctx context.Context, clientID, bucketID, hash string, ttl time.Duration) (*dto.PresignResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
 	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	expires, signature := s.signer.Sign(bucket.ID, resource.Hash, ttl)
+	return &dto.PresignResponse{
+		URL:       s.buildShareURL(bucket.ID, resource.Hash, resource.Extension, expires, signature),
+		ExpiresAt: time.Unix(expires, 0).UTC(),
+	}, nil
+}
+
+// openThrottled opens a resource for download, throttled by the bucket's
+// download rate and the global one
+func (s *resourceService) openThrottled(ctx context.Context, bucket *sqlc.Bucket, hash string) (io.ReadCloser, *dto.ResourceResponse, error) {
+	reader, resp, err := s.openResource(ctx, bucket, hash)
 	if err != nil {
 		return nil, nil, err
 	}
+	return s.throttle.Reader(ctx, reader, bucket.ID, bucket.DownloadRateLimit), resp, nil
+}
 
-	filename := buildFilename(resource.Hash, resource.Extension)
-	resourcePath := filepath.Join(s.storagePath, bucket.ID, filename)
-	file, err := os.Open(resourcePath)
+func (s *resourceService) openResource(ctx context.Context, bucket *sqlc.Bucket, hash string) (io.ReadCloser, *dto.ResourceResponse, error) {
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucket.ID, hash)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open resource file: %w", err)
+		return nil, nil, err
+	}
+
+	file, err := s.openBlob(bucket, resource)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	resp := &dto.ResourceResponse{
-		ID:          resource.ID,
-		Hash:        resource.Hash,
-		Size:        resource.Size,
-		ContentType: resource.ContentType,
-		Extension:   resource.Extension,
-		CreatedAt:   resource.CreatedAt.Time,
+		ID:           resource.ID,
+		Hash:         resource.Hash,
+		Size:         resource.Size,
+		ContentType:  resource.ContentType,
+		Extension:    resource.Extension,
+		OriginalName: resource.OriginalName,
+		CreatedAt:    resource.CreatedAt.Time,
+		Sensitive:    bucket.Sensitive == 1,
+		Encrypted:    resource.Encrypted == 1,
+		CacheControl: bucket.CacheControl,
 	}
 	if bucket.IsPublic == 1 {
 		resp.PublicURL = s.buildPublicURL(bucket.ID, resource.Hash, resource.Extension)
@@ -235,21 +798,70 @@ func (s *resourceService) Get(ctx context.Context, clientID, bucketID, hash stri
 		return nil, err
 	}
 
+	return s.detail(bucket, resource), nil
+}
+
+// UpdateContentType corrects the stored content type of a resource. Only the
+// metadata changes: the blob, hash and extension stay as they are.
+func (s *resourceService) UpdateContentType(ctx context.Context, clientID, bucketID, hash, contentType string) (*dto.ResourceResponse, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidContentType, contentType)
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	contentType = mime.FormatMediaType(mediaType, params)
+
+	// Resending the current type is a no-op, so it neither changes the
+	// listing ETag nor shows up again in incremental sync
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if resource.ContentType == contentType {
+		return s.detail(bucket, resource), nil
+	}
+
+	resource, err = s.repo.UpdateContentType(ctx, bucketID, hash, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.detail(bucket, resource), nil
+}
+
+// detail is the resource as returned on its own, by Get and updates
+func (s *resourceService) detail(bucket *sqlc.Bucket, resource *sqlc.Resource) *dto.ResourceResponse {
 	resp := &dto.ResourceResponse{
-		ID:          resource.ID,
-		Hash:        resource.Hash,
-		Size:        resource.Size,
-		ContentType: resource.ContentType,
-		Extension:   resource.Extension,
-		CreatedAt:   resource.CreatedAt.Time,
+		ID:           resource.ID,
+		Hash:         resource.Hash,
+		Size:         resource.Size,
+		ContentType:  resource.ContentType,
+		Extension:    resource.Extension,
+		OriginalName: resource.OriginalName,
+		CreatedAt:    resource.CreatedAt.Time,
+		Sensitive:    bucket.Sensitive == 1,
+		Encrypted:    resource.Encrypted == 1,
+		CacheControl: bucket.CacheControl,
 	}
 	if bucket.IsPublic == 1 {
 		resp.PublicURL = s.buildPublicURL(bucket.ID, resource.Hash, resource.Extension)
 	}
-	return resp, nil
+	s.setProcessing(resp, resource)
+	return resp
 }
 
-func (s *resourceService) List(ctx context.Context, clientID, bucketID string) (*dto.ResourceListResponse, error) {
+// Status returns the post-processing state of a resource
+func (s *resourceService) Status(ctx context.Context, clientID, bucketID, hash string) (*dto.ProcessingStatusResponse, error) {
 	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
 	if err != nil {
 		return nil, err
@@ -260,31 +872,148 @@ func (s *resourceService) List(ctx context.Context, clientID, bucketID string) (
 		return nil, bucketrepo.ErrBucketNotFound
 	}
 
-	resources, err := s.repo.ListByBucketID(ctx, bucketID)
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ProcessingStatusResponse{
+		ID:     resource.ID,
+		Hash:   resource.Hash,
+		Status: resource.ProcessingStatus,
+		Error:  resource.ProcessingError.String,
+	}, nil
+}
+
+func (s *resourceService) List(ctx context.Context, clientID, bucketID string, filter dto.ListFilter, limit, offset int) (*dto.ResourceListResponse, error) {
+	params, err := listParams(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	params.BucketID = bucketID
+	params.Limit = int64(limit)
+	params.Offset = int64(offset)
+	resources, err := s.repo.ListPageByBucketID(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.repo.CountByBucketID(ctx, sqlc.CountResourcesByBucketIDParams{
+		BucketID:           bucketID,
+		ContentTypePattern: params.ContentTypePattern,
+		IncludeDeleted:     params.IncludeDeleted,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	response := &dto.ResourceListResponse{
 		Resources: make([]dto.ResourceResponse, len(resources)),
+		Total:     total,
+	}
+
+	for i := range resources {
+		response.Resources[i] = s.listEntry(bucket, &resources[i])
 	}
 
-	for i, r := range resources {
-		resp := dto.ResourceResponse{
-			ID:          r.ID,
-			Hash:        r.Hash,
-			Size:        r.Size,
-			ContentType: r.ContentType,
-			Extension:   r.Extension,
-			CreatedAt:   r.CreatedAt.Time,
+	return response, nil
+}
+
+// listParams validates a listing filter against the allowlists and turns it
+// into query parameters. "image/*" becomes the LIKE pattern "image/%", with
+// LIKE's own wildcards escaped.
+func listParams(filter dto.ListFilter) (sqlc.ListResourcesByBucketIDPagedParams, error) {
+	params := sqlc.ListResourcesByBucketIDPagedParams{SortBy: "created_at", Descending: 1}
+
+	if filter.Sort != "" {
+		if !listSorts[filter.Sort] {
+			return params, fmt.Errorf("%w: sort must be created_at or size", ErrInvalidListFilter)
 		}
-		if bucket.IsPublic == 1 {
-			resp.PublicURL = s.buildPublicURL(bucket.ID, r.Hash, r.Extension)
+		params.SortBy = filter.Sort
+	}
+
+	switch filter.Order {
+	case "", "desc":
+	case "asc":
+		params.Descending = 0
+	default:
+		return params, fmt.Errorf("%w: order must be asc or desc", ErrInvalidListFilter)
+	}
+
+	if filter.ContentType != "" {
+		contentType := strings.ToLower(filter.ContentType)
+		if !contentTypeFilter.MatchString(contentType) {
+			return params, fmt.Errorf("%w: content_type must look like image/png or image/*", ErrInvalidListFilter)
 		}
-		response.Resources[i] = resp
+		pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(contentType)
+		if strings.HasSuffix(pattern, "/*") {
+			pattern = strings.TrimSuffix(pattern, "*") + "%"
+		}
+		params.ContentTypePattern = pattern
 	}
 
-	return response, nil
+	if filter.IncludeDeleted {
+		params.IncludeDeleted = 1
+	}
+
+	return params, nil
+}
+
+// ListVersion hashes an aggregate of the bucket's resources. It changes when
+// a resource is uploaded, deleted, restored, makes progress in processing or
+// has its content type corrected.
+func (s *resourceService) ListVersion(ctx context.Context, clientID, bucketID string) (string, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return "", err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return "", bucketrepo.ErrBucketNotFound
+	}
+
+	v, err := s.repo.ListVersion(ctx, bucketID)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%d|%s|%d|%d|%d|%d", v.Count, v.Trashed, v.LastCreated, v.TotalSize, v.Pending, v.Processing, v.Revisions)))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// listEntry is the resource as shown in bucket listings
+func (s *resourceService) listEntry(bucket *sqlc.Bucket, r *sqlc.Resource) dto.ResourceResponse {
+	resp := dto.ResourceResponse{
+		ID:           r.ID,
+		Hash:         r.Hash,
+		Size:         r.Size,
+		ContentType:  r.ContentType,
+		Extension:    r.Extension,
+		OriginalName: r.OriginalName,
+		CreatedAt:    r.CreatedAt.Time,
+		Encrypted:    r.Encrypted == 1,
+	}
+	if r.DeletedAt.Valid {
+		// Trashed files are not served, publicly or otherwise
+		deletedAt := r.DeletedAt.Time
+		resp.DeletedAt = &deletedAt
+	} else if bucket.IsPublic == 1 {
+		resp.PublicURL = s.buildPublicURL(bucket.ID, r.Hash, r.Extension)
+	}
+	s.setProcessing(&resp, r)
+	return resp
 }
 
 func (s *resourceService) buildPublicURL(bucketID, hash, extension string) string {
@@ -295,6 +1024,19 @@ func (s *resourceService) buildPublicURL(bucketID, hash, extension string) strin
 	return fmt.Sprintf("/public/%s/%s", bucketID, filename)
 }
 
+// buildShareURL constructs a presigned, credential-free download URL
+func (s *resourceService) buildShareURL(bucketID, hash, extension string, expires int64, signature string) string {
+	return presign.ShareURL(s.publicURL, bucketID, hash, extension, expires, signature)
+}
+
+// retainUntil is the retention deadline for a resource stored now; only WORM buckets retain
+func retainUntil(bucket *sqlc.Bucket) sql.NullTime {
+	if bucket.Worm != 1 {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.Now().UTC().Add(time.Duration(bucket.RetentionSeconds) * time.Second), Valid: true}
+}
+
 // buildDownloadURL constructs the download endpoint URL (works for both public and private buckets)
 func (s *resourceService) buildDownloadURL(bucketID, hash string, extension string) string {
 	if s.publicURL != "" {
@@ -303,6 +1045,11 @@ func (s *resourceService) buildDownloadURL(bucketID, hash string, extension stri
 	return fmt.Sprintf("/resources/%s/%s%s", bucketID, hash, extension)
 }
 
+// buildStatusURL constructs the processing status endpoint URL
+func (s *resourceService) buildStatusURL(bucketID, hash string) string {
+	return fmt.Sprintf("%s/resources/%s/%s/status", s.publicURL, bucketID, hash)
+}
+
 func (s *resourceService) Delete(ctx context.Context, clientID, bucketID, hash string) error {
 	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
 	if err != nil {
@@ -314,7 +1061,7 @@ func (s *resourceService) Delete(ctx context.Context, clientID, bucketID, hash s
 		return bucketrepo.ErrBucketNotFound
 	}
 
-	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	resource, err := s.deletable(ctx, bucketID, hash)
 	if err != nil {
 		return err
 	}
@@ -332,24 +1079,316 @@ func (s *resourceService) Delete(ctx context.Context, clientID, bucketID, hash s
 			Extension:   resource.Extension,
 			CreatedAt:   resource.CreatedAt,
 		}
+		requestID := requestid.From(ctx)
 		go func() {
-			triggerCtx := context.Background()
-			s.webhookLauncher.TriggerEvent(triggerCtx, webhookdto.EventResourceDeleted, bucket, resourceCopy, resourceURL, nil)
+			triggerCtx := requestid.With(context.Background(), requestID)
+			s.webhookLauncher.TriggerEvent(triggerCtx, webhookdto.EventResourceDeleted, bucket, resourceCopy, resourceURL, nil, nil)
 		}()
 	}
 
+	if s.trashRetention > 0 {
+		return s.trash(ctx, bucket, resource)
+	}
+
 	if err := s.repo.DeleteByBucketAndHash(ctx, bucketID, hash); err != nil {
 		return err
 	}
 
 	// Remove file from storage
 	filename := buildFilename(resource.Hash, resource.Extension)
-	resourcePath := filepath.Join(s.storagePath, bucket.ID, filename)
+	resourcePath := filepath.Join(s.layout.BucketDir(bucket.ClientID, bucket.ID), filename)
 	os.Remove(resourcePath)
+	s.releaseBlob(ctx, resource)
+	s.removeTranscoded(bucket.ID, resource.Hash)
+	s.removeThumbnails(bucket, resource.Hash)
+	s.removeChunkManifests(bucket.ID, resource.Hash)
 
 	return nil
 }
 
+// deletable returns the resource Delete would remove from the bucket, or the
+// error it would refuse with
+func (s *resourceService) deletable(ctx context.Context, bucketID, hash string) (*sqlc.Resource, error) {
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if resource.RetainUntil.Valid && time.Now().Before(resource.RetainUntil.Time) {
+		return nil, bucketrepo.ErrRetentionActive
+	}
+	return resource, nil
+}
+
+// DeleteAll empties a bucket while keeping the bucket itself. Rows are removed
+// atomically; blob removal is best effort and a deleted event fires per resource.
+func (s *resourceService) DeleteAll(ctx context.Context, clientID, bucketID string, dryRun bool) (*dto.DeleteAllResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	if bucket.Worm == 1 {
+		retained, err := s.bucketRepo.HasRetainedResources(ctx, bucketID)
+		if err != nil {
+			return nil, err
+		}
+		if retained {
+			return nil, bucketrepo.ErrRetentionActive
+		}
+	}
+
+	if dryRun {
+		totals, err := s.bucketRepo.ResourceTotals(ctx, bucket.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &dto.DeleteAllResponse{
+			BucketID:  bucket.ID,
+			DryRun:    true,
+			Deleted:   int(totals.Count),
+			TotalSize: totals.TotalSize,
+		}, nil
+	}
+
+	// The delete skips resources under retention itself, so one retained
+	// since the check above stays, and the counts are of what was deleted
+	resources, err := s.repo.DeleteUnretainedByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalSize int64
+	for i := range resources {
+		resource := &resources[i]
+		totalSize += resource.Size
+
+		// Trashed resources go too, without a second deleted event
+		if resource.DeletedAt.Valid {
+			os.Remove(s.trashPath(bucket, resource))
+		} else {
+			os.Remove(s.blobPath(bucket, resource))
+		}
+		s.releaseBlob(ctx, resource)
+		s.removeTranscoded(bucket.ID, resource.Hash)
+		s.removeThumbnails(bucket, resource.Hash)
+		s.removeChunkManifests(bucket.ID, resource.Hash)
+
+		if s.webhookLauncher != nil && !resource.DeletedAt.Valid {
+			resourceURL := s.buildDownloadURL(bucket.ID, resource.Hash, resource.Extension)
+			requestID := requestid.From(ctx)
+			go func() {
+				triggerCtx := requestid.With(context.Background(), requestID)
+				s.webhookLauncher.TriggerEvent(triggerCtx, webhookdto.EventResourceDeleted, bucket, resource, resourceURL, nil, nil)
+			}()
+		}
+	}
+
+	return &dto.DeleteAllResponse{
+		BucketID:  bucket.ID,
+		Deleted:   len(resources),
+		TotalSize: totalSize,
+	}, nil
+}
+
+// Verify re-reads the stored blob and checks that its SHA-256 and size still
+// match the resource record, detecting bit-rot or truncated files.
+func (s *resourceService) Verify(ctx context.Context, clientID, bucketID, hash string) (*dto.VerifyResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetByBucketAndHash(ctx, bucketID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.verifyResource(bucket, resource)
+	return &result, nil
+}
+
+// VerifyBucket checks every resource in the bucket and reports the corrupt ones
+func (s *resourceService) VerifyBucket(ctx context.Context, clientID, bucketID string) (*dto.BucketVerifyResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resources, err := s.repo.ListByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.BucketVerifyResponse{
+		BucketID: bucket.ID,
+		Corrupt:  []dto.VerifyResponse{},
+	}
+
+	for i := range resources {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		check := s.verifyResource(bucket, &resources[i])
+		result.Checked++
+		if !check.Valid {
+			result.Corrupt = append(result.Corrupt, check)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *resourceService) verifyResource(bucket *sqlc.Bucket, resource *sqlc.Resource) dto.VerifyResponse {
+	result := dto.VerifyResponse{
+		Hash:         resource.Hash,
+		ExpectedSize: resource.Size,
+	}
+
+	actualHash, actualSize, err := s.hashBlob(bucket, resource)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ActualHash = actualHash
+	result.ActualSize = actualSize
+	result.Valid = actualHash == resource.Hash && actualSize == resource.Size
+	return result
+}
+
+// Reindex walks the bucket's storage directory and creates resource records for
+// stored files that have no database row (e.g. after restoring an older database).
+// Files are only indexed when their name matches the SHA-256 of their content.
+func (s *resourceService) Reindex(ctx context.Context, bucketID string, dryRun bool) (*dto.ReindexResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketPath := s.layout.BucketDir(bucket.ClientID, bucket.ID)
+	entries, err := os.ReadDir(bucketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket storage: %w", err)
+	}
+
+	result := &dto.ReindexResponse{
+		BucketID: bucket.ID,
+		DryRun:   dryRun,
+		Added:    []dto.ReindexEntry{},
+		Skipped:  []dto.ReindexEntry{},
+	}
+
+	for _, entry := range entries {
+		// Skip directories and hidden files (temp/trash/cache folders)
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		// Blobs are named <hash><ext>, and extensions such as .tar.gz have
+		// several dots, so the hash ends at the first one
+		name := entry.Name()
+		stem, ext, found := strings.Cut(name, ".")
+		if found {
+			ext = "." + ext
+		}
+
+		// Check the index first so already-known files are not re-hashed
+		exists, err := s.repo.ExistsByBucketAndHash(ctx, bucket.ID, stem)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			result.Skipped = append(result.Skipped, dto.ReindexEntry{File: name, Hash: stem, Reason: "already indexed"})
+			continue
+		}
+
+		path := filepath.Join(bucketPath, name)
+		hash, size, err := hashFile(path)
+		if err != nil {
+			result.Skipped = append(result.Skipped, dto.ReindexEntry{File: name, Reason: err.Error()})
+			continue
+		}
+
+		// Encrypted blobs are named after their plaintext hash
+		var encrypted int64
+		if hash != stem && s.cipher != nil {
+			if plainHash, plainSize, err := s.hashEncryptedFile(path); err == nil && plainHash == stem {
+				hash, size, encrypted = plainHash, plainSize, 1
+			}
+		}
+
+		if hash != stem {
+			result.Skipped = append(result.Skipped, dto.ReindexEntry{File: name, Hash: hash, Reason: "filename does not match content hash"})
+			continue
+		}
+
+		if !dryRun {
+			contentType := resolveContentType("", ext)
+
+			if _, err := s.repo.Create(ctx, sqlc.CreateResourceParams{
+				ID:               uuid.New().String(),
+				BucketID:         bucket.ID,
+				Hash:             hash,
+				Size:             size,
+				ContentType:      contentType,
+				Extension:        ext,
+				RetainUntil:      retainUntil(bucket),
+				Encrypted:        encrypted,
+				ProcessingStatus: dto.ProcessingReady,
+			}, nil); err != nil {
+				result.Skipped = append(result.Skipped, dto.ReindexEntry{File: name, Hash: hash, Reason: err.Error()})
+				continue
+			}
+			// Adopted files are already on disk, so they are counted even
+			// past the cap
+			s.usage.Add(size)
+		}
+
+		result.Added = append(result.Added, dto.ReindexEntry{File: name, Hash: hash})
+	}
+
+	return result, nil
+}
+
+// hashFile streams a stored file through SHA-256 and returns its hex digest and size
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	return hashReader(file)
+}
+
+// hashBlob hashes a resource's stored content, decrypting it if needed
+func (s *resourceService) hashBlob(bucket *sqlc.Bucket, resource *sqlc.Resource) (string, int64, error) {
+	blob, err := s.openBlob(bucket, resource)
+	if err != nil {
+		return "", 0, err
+	}
+	defer blob.Close()
+
+	return hashReader(blob)
+}
+
 func copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -367,15 +1406,172 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-func getExtensionFromContentType(contentType string) (string, error) {
-	exts, err := mime.ExtensionsByType(contentType)
+// resolveExtension returns the extension an upload is stored with: the given
+// one, validated and with a leading dot, or else one derived from contentType.
+// Either is enough; the error says what is missing when neither identifies one.
+func resolveExtension(contentType, extension string) (string, error) {
+	if extension != "" {
+		ext := extension
+		if ext[0] != '.' {
+			ext = "." + ext
+		}
+		if len(ext) > maxExtensionLength || !validExtension.MatchString(ext) {
+			return "", fmt.Errorf("%w %q", ErrInvalidExtension, extension)
+		}
+		return ext, nil
+	}
+
+	if strings.TrimSpace(contentType) == "" {
+		return "", fmt.Errorf("%w: no extension and no Content-Type were given", ErrUnknownExtension)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("%w: no extension was given and Content-Type %q is not a valid media type", ErrUnknownExtension, contentType)
+	}
+	if genericContentTypes[mediaType] {
+		return "", fmt.Errorf("%w: no extension was given and Content-Type %s does not identify a file type", ErrUnknownExtension, mediaType)
+	}
+	if ext, ok := getExtensionFromContentType(mediaType); ok {
+		return ext, nil
+	}
+	return "", fmt.Errorf("%w: no extension was given and Content-Type %s has no known extension", ErrUnknownExtension, mediaType)
+}
+
+func getExtensionFromContentType(mediaType string) (string, bool) {
+	if ext, ok := preferredExtensions[mediaType]; ok {
+		return ext, true
+	}
+
+	exts, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(exts) == 0 {
+		return "", false
 	}
-	if len(exts) == 0 {
-		return "", errors.New("file extension not found")
+	return exts[0], true
+}
+
+// genericContentTypes carry no information about the file; clients and
+// multipart encoders send them when they don't know the real type
+var genericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+	"application/binary":       true,
+	"application/unknown":      true,
+}
+
+// defaultContentType is the type of content nothing more is known about
+const defaultContentType = "application/octet-stream"
+
+// sniffLen is how much of an upload http.DetectContentType looks at
+const sniffLen = 512
+
+// sniffBuffer keeps the first sniffLen bytes written to it
+type sniffBuffer []byte
+
+func (b *sniffBuffer) Write(p []byte) (int, error) {
+	if room := sniffLen - len(*b); room > 0 {
+		*b = append(*b, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// checkContentType compares the type of an upload's extension with the type
+// sniffed from its first bytes. The sniffer only knows a few formats, so
+// content it does not recognize passes unless the extension promises text or
+// a format that always starts with a signature it checks. Extensions with no
+// known type are not checked.
+func checkContentType(ext string, head []byte) error {
+	expected, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return nil
+	}
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if contentTypesMatch(expected, detected) {
+		return nil
+	}
+	return fmt.Errorf("%w: extension %s is %s, but the content was detected as %s", ErrContentTypeMismatch, ext, expected, detected)
+}
+
+// signedContentTypes always start with a signature http.DetectContentType
+// recognizes, so content it does not recognize is not one of them
+var signedContentTypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"image/bmp":        true,
+	"application/pdf":  true,
+	"application/zip":  true,
+	"application/gzip": true,
+}
+
+// contentTypesMatch reports whether content sniffed as detected may be stored
+// under an extension of type expected. Media of the same kind match, so a
+// JPEG named .png passes, as do all textual types and zip-based documents.
+func contentTypesMatch(expected, detected string) bool {
+	kind, _, _ := strings.Cut(expected, "/")
+	detectedKind, _, _ := strings.Cut(detected, "/")
+
+	switch {
+	case expected == detected:
+		return true
+	case detected == defaultContentType:
+		return !signedContentTypes[expected] && !isTextType(expected)
+	case isTextType(detected):
+		return isTextType(expected)
+	case detected == "application/zip":
+		return isZipBased(expected)
+	case detected == "application/x-gzip":
+		return expected == "application/gzip"
+	case detected == "application/ogg":
+		return kind == "audio" || kind == "video"
+	case kind == detectedKind:
+		return kind == "image" || kind == "audio" || kind == "video" || kind == "font"
+	}
+	return false
+}
+
+func isTextType(mediaType string) bool {
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-sh":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// isZipBased reports whether files of mediaType are zip archives inside,
+// like office documents, EPUBs and JARs
+func isZipBased(mediaType string) bool {
+	switch mediaType {
+	case "application/java-archive", "application/vnd.android.package-archive", "application/x-zip-compressed":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+zip") ||
+		strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument.")
+}
+
+// resolveContentType keeps a specific client-provided type and otherwise
+// derives the type from the extension, so previews work for stored files.
+// When neither tells, uploads sniff the type from their first bytes.
+func resolveContentType(contentType, ext string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && !genericContentTypes[mediaType] {
+		return contentType
+	}
+	if byExt := mime.TypeByExtension(ext); byExt != "" {
+		return byExt
+	}
+	return defaultContentType
+}
+
+// DownloadName is the filename a resource is downloaded as: the name it was
+// uploaded with, or <hash><ext> when that is unknown
+func DownloadName(resource *dto.ResourceResponse) string {
+	if resource.OriginalName != "" {
+		return resource.OriginalName
 	}
-	return exts[0], nil
+	return buildFilename(resource.Hash, resource.Extension)
 }
 
 func buildFilename(hash, extension string) string {
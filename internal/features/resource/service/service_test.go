@@ -0,0 +1,415 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/encryption"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+)
+
+// testBucket is a bucket of the resource service under test, with its
+// directory on disk
+type testBucket struct {
+	db      *database.Database
+	svc     ResourceService
+	repo    repository.ResourceRepository
+	layout  *storage.Layout
+	tempDir string
+	client  sqlc.Client
+	bucket  sqlc.Bucket
+}
+
+func newTestBucket(t *testing.T) *testBucket {
+	t.Helper()
+	return newTestBucketWith(t, Options{})
+}
+
+// newTestBucketWith is newTestBucket with a service configured by opts. The
+// layout, public URL and temp dir are filled in.
+func newTestBucketWith(t *testing.T, opts Options) *testBucket {
+	t.Helper()
+
+	db := dbtest.New(t)
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatalf("NewLayout() error = %v", err)
+	}
+	tempDir := t.TempDir()
+	repo := repository.New(db.DB, db.Queries)
+	opts.Layout, opts.PublicURL, opts.TempDir = layout, "http://localhost", tempDir
+	svc := New(repo, bucketrepo.New(db.Queries), nil, nil, opts)
+
+	// The bucket service creates the directory along with the bucket
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	if err := os.MkdirAll(layout.BucketDir(client.ID, bucket.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testBucket{
+		db:      db,
+		svc:     svc,
+		repo:    repo,
+		layout:  layout,
+		tempDir: tempDir,
+		client:  client,
+		bucket:  bucket,
+	}
+}
+
+// add stores content as a resource with its file
+func (b *testBucket) add(t *testing.T, hash, content string) {
+	t.Helper()
+
+	dbtest.Resource(t, b.db, b.bucket.ID, hash, int64(len(content)))
+	path := filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), hash)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertStored fails unless hash is still a live resource with its file
+func (b *testBucket) assertStored(t *testing.T, hash string) {
+	t.Helper()
+
+	if _, err := b.repo.GetByBucketAndHash(context.Background(), b.bucket.ID, hash); err != nil {
+		t.Errorf("resource %s: %v", hash, err)
+	}
+	if _, err := os.Stat(filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), hash)); err != nil {
+		t.Errorf("file of %s: %v", hash, err)
+	}
+}
+
+func TestDeleteAllDryRun(t *testing.T) {
+	b := newTestBucket(t)
+	b.add(t, "aaaa", "abc")
+	b.add(t, "bbbb", "hello")
+	ctx := context.Background()
+
+	result, err := b.svc.DeleteAll(ctx, b.client.ID, b.bucket.ID, true)
+	if err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if !result.DryRun || result.Deleted != 2 || result.TotalSize != 8 {
+		t.Errorf("DeleteAll() = %+v, want a dry run of 2 resources and 8 bytes", result)
+	}
+	b.assertStored(t, "aaaa")
+	b.assertStored(t, "bbbb")
+
+	result, err = b.svc.DeleteAll(ctx, b.client.ID, b.bucket.ID, false)
+	if err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if result.DryRun || result.Deleted != 2 || result.TotalSize != 8 {
+		t.Errorf("DeleteAll() = %+v, want 2 resources and 8 bytes deleted", result)
+	}
+}
+
+func TestDeleteAllKeepsRetained(t *testing.T) {
+	b := newTestBucket(t)
+	b.add(t, "aaaa", "abc")
+	b.add(t, "bbbb", "hello")
+	ctx := context.Background()
+
+	// Retained after DeleteAll checked the bucket, as if WORM had been
+	// turned on concurrently
+	if _, err := b.db.DB.ExecContext(ctx, `UPDATE resources SET retain_until = datetime('now', '+1 hour') WHERE hash = 'bbbb'`); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := b.svc.DeleteAll(ctx, b.client.ID, b.bucket.ID, false)
+	if err != nil {
+		t.Fatalf("DeleteAll() error = %v", err)
+	}
+	if result.Deleted != 1 || result.TotalSize != 3 {
+		t.Errorf("DeleteAll() = %+v, want 1 resource and 3 bytes deleted", result)
+	}
+	b.assertStored(t, "bbbb")
+}
+
+// assertNoFiles fails if dir holds any file
+func assertNoFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s left behind in %s", entry.Name(), dir)
+	}
+}
+
+func TestUploadStream(t *testing.T) {
+	b := newTestBucket(t)
+	content := "hello, world"
+
+	resource, err := b.svc.UploadStream(context.Background(), b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	if want := hex.EncodeToString(sum[:]); resource.Hash != want {
+		t.Errorf("hash = %s, want %s", resource.Hash, want)
+	}
+	stored, err := os.ReadFile(filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), resource.Hash+".txt"))
+	if err != nil || string(stored) != content {
+		t.Errorf("stored file = %q, %v, want %q", stored, err, content)
+	}
+	assertNoFiles(t, b.tempDir)
+}
+
+// cancellingReader yields size zeros and cancels the upload once read of
+// them have been read, like a client disconnecting partway through a large
+// body
+type cancellingReader struct {
+	read, size int
+	cancel     context.CancelFunc
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	if r.size <= 0 {
+		return 0, io.EOF
+	}
+	if r.read <= 0 {
+		r.cancel()
+	}
+	n := min(len(p), r.size)
+	clear(p[:n])
+	r.read -= n
+	r.size -= n
+	return n, nil
+}
+
+func TestUploadStreamCancelled(t *testing.T) {
+	b := newTestBucket(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	body := &cancellingReader{read: 4 << 20, size: 64 << 20, cancel: cancel}
+	_, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "application/octet-stream", ".bin", "", "", body, nil, nil, false, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("UploadStream() error = %v, want context.Canceled", err)
+	}
+	if body.size == 0 {
+		t.Error("the whole body was read after the upload was cancelled")
+	}
+
+	assertNoFiles(t, b.tempDir)
+	assertNoFiles(t, b.layout.BucketDir(b.client.ID, b.bucket.ID))
+	totals, err := b.db.Queries.GetResourceTotalsByBucketID(context.Background(), b.bucket.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Count != 0 {
+		t.Errorf("%d resources stored, want 0", totals.Count)
+	}
+}
+
+func TestURLsIncludeBasePath(t *testing.T) {
+	tests := []struct {
+		urlPrefix        string
+		public, download string
+	}{
+		{"", "/public/b1/abc.txt", "/resources/b1/abc.txt"},
+		{"/drive", "/drive/public/b1/abc.txt", "/drive/resources/b1/abc.txt"},
+		{"https://example.com/drive", "https://example.com/drive/public/b1/abc.txt", "https://example.com/drive/resources/b1/abc.txt"},
+	}
+	for _, tt := range tests {
+		s := &resourceService{publicURL: tt.urlPrefix}
+		if got := s.buildPublicURL("b1", "abc", ".txt"); got != tt.public {
+			t.Errorf("buildPublicURL() with %q = %s, want %s", tt.urlPrefix, got, tt.public)
+		}
+		if got := s.buildDownloadURL("b1", "abc", ".txt"); got != tt.download {
+			t.Errorf("buildDownloadURL() with %q = %s, want %s", tt.urlPrefix, got, tt.download)
+		}
+	}
+}
+
+func TestReindexMultiDotExtension(t *testing.T) {
+	b := newTestBucket(t)
+	content := "archive"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	name := hash + ".tar.gz"
+	if err := os.WriteFile(filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := b.svc.Reindex(context.Background(), b.bucket.ID, false)
+	if err != nil {
+		t.Fatalf("Reindex() error = %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].Hash != hash {
+		t.Fatalf("Reindex() = %+v, want %s added", result, name)
+	}
+
+	resource, err := b.repo.GetByBucketAndHash(context.Background(), b.bucket.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource.Extension != ".tar.gz" {
+		t.Errorf("extension = %q, want .tar.gz", resource.Extension)
+	}
+}
+
+func TestUpdateContentTypeLeavesBlob(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	content := `{"hello":"world"}`
+
+	uploaded, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "text/plain", ".json", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+	path := filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), uploaded.Hash+".json")
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refCount := func() int64 {
+		t.Helper()
+		var n int64
+		if err := b.db.DB.QueryRowContext(ctx, "SELECT ref_count FROM blobs WHERE hash = ?", uploaded.Hash).Scan(&n); err != nil {
+			t.Fatalf("read ref_count: %v", err)
+		}
+		return n
+	}
+	refsBefore := refCount()
+
+	if _, err := b.svc.UpdateContentType(ctx, b.client.ID, b.bucket.ID, uploaded.Hash, "not a type;;"); !errors.Is(err, ErrInvalidContentType) {
+		t.Errorf("UpdateContentType() with an invalid type error = %v, want ErrInvalidContentType", err)
+	}
+	updated, err := b.svc.UpdateContentType(ctx, b.client.ID, b.bucket.ID, uploaded.Hash, "Application/JSON; charset=utf-8")
+	if err != nil {
+		t.Fatalf("UpdateContentType() error = %v", err)
+	}
+	if updated.ContentType != "application/json; charset=utf-8" || updated.Hash != uploaded.Hash {
+		t.Errorf("UpdateContentType() = %s %s, want %s application/json; charset=utf-8", updated.Hash, updated.ContentType, uploaded.Hash)
+	}
+
+	stored, err := os.ReadFile(path)
+	if err != nil || string(stored) != content {
+		t.Errorf("stored file = %q, %v, want it byte-identical to %q", stored, err, content)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("blob file was replaced or rewritten")
+	}
+	if refs := refCount(); refs != refsBefore {
+		t.Errorf("ref_count = %d after the update, want %d", refs, refsBefore)
+	}
+}
+
+func TestUploadEncryptedDeduplicates(t *testing.T) {
+	blobCipher, err := encryption.New(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newTestBucketWith(t, Options{Cipher: blobCipher})
+	ctx := context.Background()
+	if _, err := b.db.DB.ExecContext(ctx, `UPDATE buckets SET encrypted = 1 WHERE id = ?`, b.bucket.ID); err != nil {
+		t.Fatal(err)
+	}
+	content := "the same plaintext twice"
+
+	first, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+	second, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() again error = %v", err)
+	}
+	if !first.Encrypted || first.Deduplicated {
+		t.Errorf("first upload: encrypted %v, deduplicated %v, want an encrypted new resource", first.Encrypted, first.Deduplicated)
+	}
+	if !second.Deduplicated || second.Hash != first.Hash {
+		t.Errorf("second upload = %s deduplicated %v, want %s deduplicated", second.Hash, second.Deduplicated, first.Hash)
+	}
+
+	dir := b.layout.BucketDir(b.client.ID, b.bucket.ID)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d files stored, want 1", len(entries))
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte(content)) {
+		t.Error("stored blob holds the plaintext")
+	}
+
+	body, _, err := b.svc.Download(ctx, b.client.ID, b.bucket.ID, first.Hash)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	defer body.Close()
+	if got, err := io.ReadAll(body); err != nil || string(got) != content {
+		t.Errorf("Download() = %q, %v, want %q", got, err, content)
+	}
+}
+
+func TestUsageCountsSharedContentOnce(t *testing.T) {
+	usage := storage.NewUsage(0, false)
+	b := newTestBucketWith(t, Options{Usage: usage})
+	ctx := context.Background()
+	other := b.addBucket(t, "bucket-2")
+	content := "stored once, linked twice"
+	size := int64(len(content))
+
+	var hash string
+	for _, bucketID := range []string{b.bucket.ID, other.ID} {
+		resource, err := b.svc.UploadStream(ctx, b.client.ID, bucketID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+		if err != nil {
+			t.Fatalf("UploadStream(%s) error = %v", bucketID, err)
+		}
+		hash = resource.Hash
+		if got := usage.Used(); got != size {
+			t.Errorf("Used() after upload to %s = %d, want %d", bucketID, got, size)
+		}
+	}
+
+	if err := b.svc.Delete(ctx, b.client.ID, b.bucket.ID, hash); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := usage.Used(); got != size {
+		t.Errorf("Used() with one reference left = %d, want %d", got, size)
+	}
+	if err := b.svc.Delete(ctx, b.client.ID, other.ID, hash); err != nil {
+		t.Fatalf("Delete() last reference error = %v", err)
+	}
+	if got := usage.Used(); got != 0 {
+		t.Errorf("Used() after deleting every reference = %d, want 0", got)
+	}
+
+	stored, err := b.repo.StoredSize(ctx)
+	if err != nil {
+		t.Fatalf("StoredSize() error = %v", err)
+	}
+	if stored != usage.Used() {
+		t.Errorf("StoredSize() = %d, want the tracked %d", stored, usage.Used())
+	}
+}
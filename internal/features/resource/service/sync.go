@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// ErrInvalidCursor is returned when a sync cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid sync cursor")
+
+// syncPosition is a point in a bucket's change feed. Changes and deletions
+// share one order: the seq of each hash's latest change, which only grows.
+// since leaves out changes made before it, at second precision; it only
+// applies until the first cursor is handed out.
+type syncPosition struct {
+	seq   int64
+	since time.Time
+}
+
+func (p syncPosition) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.seq, 10)))
+}
+
+// decodeCursor reads a cursor. Cursors from before the change sequence hold
+// "<time>|<key>" and resume from that time, so nothing after it is missed.
+func decodeCursor(cursor string) (syncPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	if at, _, ok := strings.Cut(string(raw), "|"); ok {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return syncPosition{}, ErrInvalidCursor
+		}
+		return syncPosition{since: t.UTC()}, nil
+	}
+	seq, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || seq < 0 {
+		return syncPosition{}, ErrInvalidCursor
+	}
+	return syncPosition{seq: seq}, nil
+}
+
+type change struct {
+	seq       int64
+	resource  *sqlc.Resource
+	tombstone *sqlc.ListResourceTombstonesAfterRow
+}
+
+// ListChanges returns resources created, restored or corrected and hashes
+// deleted after since (at second precision, so changes in the same second as
+// since are included) or after cursor, which takes precedence. Pass the
+// returned cursor to the next call to continue; it is set even when nothing
+// changed.
+func (s *resourceService) ListChanges(ctx context.Context, clientID, bucketID string, since time.Time, cursor string, limit int) (*dto.ResourceListResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	from := syncPosition{since: since.UTC().Truncate(time.Second)}
+	if cursor != "" {
+		if from, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Any change in the first limit of the merged feed is within the first
+	// limit of its own list; one extra row tells whether more follow
+	changed, err := s.repo.ListChangedAfter(ctx, bucketID, from.since, from.seq, int64(limit)+1)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.repo.ListDeletedAfter(ctx, bucketID, from.since, from.seq, int64(limit)+1)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]change, 0, len(changed)+len(deleted))
+	for i := range changed {
+		changes = append(changes, change{seq: changed[i].Seq, resource: changedResource(&changed[i])})
+	}
+	for i := range deleted {
+		changes = append(changes, change{seq: deleted[i].Seq, tombstone: &deleted[i]})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].seq < changes[j].seq
+	})
+
+	response := &dto.ResourceListResponse{
+		Resources: []dto.ResourceResponse{},
+		Deleted:   []dto.DeletedResource{},
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		response.HasMore = true
+	}
+
+	next := from
+	if len(changes) == 0 && next.seq == 0 {
+		// Nothing since the given time: resume after the latest change, so
+		// the next call does not go back to the start of the feed
+		if next.seq, err = s.repo.LatestChange(ctx, bucketID); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range changes {
+		if c.resource != nil {
+			response.Resources = append(response.Resources, s.listEntry(bucket, c.resource))
+		} else {
+			response.Deleted = append(response.Deleted, dto.DeletedResource{
+				Hash:      c.tombstone.Hash,
+				DeletedAt: c.tombstone.DeletedAt.Time,
+			})
+		}
+		next.seq = c.seq
+	}
+	response.Cursor = next.encode()
+
+	return response, nil
+}
+
+// changedResource is the resource of a change feed row
+func changedResource(row *sqlc.ListResourcesChangedAfterRow) *sqlc.Resource {
+	return &sqlc.Resource{
+		ID:               row.ID,
+		BucketID:         row.BucketID,
+		Hash:             row.Hash,
+		Size:             row.Size,
+		ContentType:      row.ContentType,
+		Extension:        row.Extension,
+		CreatedAt:        row.CreatedAt,
+		RetainUntil:      row.RetainUntil,
+		Encrypted:        row.Encrypted,
+		ProcessingStatus: row.ProcessingStatus,
+		ProcessingError:  row.ProcessingError,
+		OriginalName:     row.OriginalName,
+		DeletedAt:        row.DeletedAt,
+		ChangedAt:        row.ChangedAt,
+		Revision:         row.Revision,
+	}
+}
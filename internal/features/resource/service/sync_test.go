@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// changedHashes lists the hashes in a page of changes, live ones first
+func changedHashes(page *dto.ResourceListResponse) (live, deleted []string) {
+	for _, r := range page.Resources {
+		live = append(live, r.Hash)
+	}
+	for _, d := range page.Deleted {
+		deleted = append(deleted, d.Hash)
+	}
+	return live, deleted
+}
+
+func TestListChangesSameSecond(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	second := time.Now().UTC().Truncate(time.Second)
+
+	// Every change lands in the same second, so only the order they were
+	// made in tells them apart
+	sameSecond := func() {
+		t.Helper()
+		if _, err := b.db.DB.ExecContext(ctx, `UPDATE resources SET created_at = ?`, second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.add(t, "bbbb", "first")
+	sameSecond()
+	page, err := b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, second, "", 10)
+	if err != nil {
+		t.Fatalf("ListChanges() error = %v", err)
+	}
+	if live, _ := changedHashes(page); len(live) != 1 || live[0] != "bbbb" {
+		t.Fatalf("ListChanges() = %v, want [bbbb]", live)
+	}
+
+	// IDs sort before and after the one the cursor stopped at
+	b.add(t, "aaaa", "before")
+	b.add(t, "cccc", "after")
+	sameSecond()
+	if err := b.db.Queries.UpsertResourceTombstone(ctx, sqlc.UpsertResourceTombstoneParams{BucketID: b.bucket.ID, Hash: "0000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, time.Time{}, page.Cursor, 10)
+	if err != nil {
+		t.Fatalf("ListChanges() error = %v", err)
+	}
+	live, deleted := changedHashes(page)
+	if len(live) != 2 || live[0] != "aaaa" || live[1] != "cccc" || len(deleted) != 1 || deleted[0] != "0000" {
+		t.Errorf("ListChanges() after cursor = %v deleted %v, want [aaaa cccc] deleted [0000]", live, deleted)
+	}
+	if page.HasMore {
+		t.Error("has_more = true, want false")
+	}
+
+	cursor := page.Cursor
+	page, err = b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, time.Time{}, cursor, 10)
+	if err != nil {
+		t.Fatalf("ListChanges() error = %v", err)
+	}
+	if live, deleted := changedHashes(page); len(live) != 0 || len(deleted) != 0 || page.Cursor != cursor {
+		t.Errorf("ListChanges() at the end = %v deleted %v, cursor %s, want nothing and cursor %s", live, deleted, page.Cursor, cursor)
+	}
+}
+
+func TestListChangesPages(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	for _, hash := range []string{"cccc", "aaaa", "bbbb"} {
+		b.add(t, hash, hash)
+	}
+
+	var got []string
+	cursor := ""
+	for range 3 {
+		page, err := b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, time.Time{}, cursor, 1)
+		if err != nil {
+			t.Fatalf("ListChanges() error = %v", err)
+		}
+		live, _ := changedHashes(page)
+		got = append(got, live...)
+		cursor = page.Cursor
+		if !page.HasMore {
+			break
+		}
+	}
+	if len(got) != 3 || got[0] != "cccc" || got[1] != "aaaa" || got[2] != "bbbb" {
+		t.Errorf("pages = %v, want [cccc aaaa bbbb] in upload order", got)
+	}
+}
+
+func TestListChangesSinceWithoutChanges(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	b.add(t, "aaaa", "old")
+
+	// Nothing changed since then, yet the cursor must not replay aaaa
+	page, err := b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, time.Now().Add(time.Hour), "", 10)
+	if err != nil {
+		t.Fatalf("ListChanges() error = %v", err)
+	}
+	if live, _ := changedHashes(page); len(live) != 0 {
+		t.Fatalf("ListChanges() = %v, want nothing", live)
+	}
+	page, err = b.svc.ListChanges(ctx, b.client.ID, b.bucket.ID, time.Time{}, page.Cursor, 10)
+	if err != nil {
+		t.Fatalf("ListChanges() error = %v", err)
+	}
+	if live, _ := changedHashes(page); len(live) != 0 {
+		t.Errorf("ListChanges() with the returned cursor = %v, want nothing", live)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		want   syncPosition
+		err    error
+	}{
+		{"seq", syncPosition{seq: 42}.encode(), syncPosition{seq: 42}, nil},
+		{"legacy time and key", "MjAyNi0xMC0xNlQxMjowMTowMFp8YWJj", syncPosition{since: time.Date(2026, 10, 16, 12, 1, 0, 0, time.UTC)}, nil},
+		{"not base64", "!!", syncPosition{}, ErrInvalidCursor},
+		{"not a number", "YWJj", syncPosition{}, ErrInvalidCursor},
+		{"negative", "LTE", syncPosition{}, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		got, err := decodeCursor(tt.cursor)
+		if err != tt.err || got.seq != tt.want.seq || !got.since.Equal(tt.want.since) {
+			t.Errorf("%s: decodeCursor(%q) = %+v, %v, want %+v, %v", tt.name, tt.cursor, got, err, tt.want, tt.err)
+		}
+	}
+}
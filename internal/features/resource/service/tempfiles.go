@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// tempFilePattern names upload temp files so cleanup never touches anything else
+	tempFilePattern = "resource-*"
+
+	tempCleanupInterval = time.Hour
+)
+
+// contextReader fails reads once ctx is done, so copying the body of an
+// upload whose client went away stops at the next read rather than waiting
+// on a connection that may never finish
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// CleanupTempFiles removes upload temp files in dir that have not been written
+// for maxAge. Uploads are buffered in these files while they are hashed, so a
+// crash mid-upload leaves them behind. An empty dir means the system temp dir.
+func CleanupTempFiles(dir string, maxAge time.Duration) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, tempFilePattern))
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, path := range matches {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// RunTempCleanup removes stale upload temp files immediately and then hourly
+// until ctx is cancelled. A non-positive maxAge disables cleanup.
+func RunTempCleanup(ctx context.Context, dir string, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+
+	clean := func() {
+		removed, err := CleanupTempFiles(dir, maxAge)
+		if err != nil {
+			log.Printf("Temp file cleanup failed: %v", err)
+			return
+		}
+		if removed > 0 {
+			log.Printf("Removed %d stale upload temp files", removed)
+		}
+	}
+
+	clean()
+
+	ticker := time.NewTicker(tempCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			clean()
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	files := map[string]time.Time{
+		"resource-stale": old,
+		"resource-fresh": time.Now(),
+		"unrelated":      old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := CleanupTempFiles(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("CleanupTempFiles() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d files, want 1", removed)
+	}
+	for name, wantKept := range map[string]bool{"resource-stale": false, "resource-fresh": true, "unrelated": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%s kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+const (
+	// DefaultThumbnailSize is the width and height a thumbnail fits in when
+	// the request does not give them
+	DefaultThumbnailSize = 200
+
+	// MaxThumbnailSize bounds the width and height a thumbnail may be asked for
+	MaxThumbnailSize = 1024
+)
+
+var (
+	// ErrInvalidThumbnailSize is returned for thumbnail dimensions outside
+	// 1..MaxThumbnailSize
+	ErrInvalidThumbnailSize = errors.New("invalid thumbnail size")
+
+	// ErrNotThumbnailable is returned for resources that are not images, or
+	// whose format cannot be decoded or is too large to thumbnail
+	ErrNotThumbnailable = errors.New("resource is not an image that can be thumbnailed")
+)
+
+// thumbnailPath is where the thumbnail of a resource at the given size and
+// format is cached
+func (s *resourceService) thumbnailPath(bucket *sqlc.Bucket, hash string, width, height int, enc ImageEncoder) string {
+	name := fmt.Sprintf("%s_%dx%d%s", hash, width, height, enc.Extension)
+	return filepath.Join(s.layout.ThumbnailDir(bucket.ClientID, bucket.ID), name)
+}
+
+// Thumbnail returns the resource shrunk, keeping its aspect ratio, to fit
+// within width x height. Images that already fit keep their size. PNG and
+// GIF images, which may be transparent, give PNG thumbnails and others JPEG.
+// Thumbnails are cached in the bucket's .thumbs folder, except those of
+// encrypted resources, which are generated on every request so no plaintext
+// is written to disk.
+func (s *resourceService) Thumbnail(ctx context.Context, clientID, bucketID, hash string, width, height int) (io.ReadCloser, *dto.ResourceResponse, error) {
+	if width < 1 || width > MaxThumbnailSize || height < 1 || height > MaxThumbnailSize {
+		return nil, nil, fmt.Errorf("%w: width and height must be between 1 and %d", ErrInvalidThumbnailSize, MaxThumbnailSize)
+	}
+
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, nil, bucketrepo.ErrBucketNotFound
+	}
+
+	reader, resource, err := s.openResource(ctx, bucket, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	if !strings.HasPrefix(resource.ContentType, "image/") {
+		return nil, nil, fmt.Errorf("%w: content type is %s", ErrNotThumbnailable, resource.ContentType)
+	}
+
+	format := "jpeg"
+	if resource.ContentType == "image/png" || resource.ContentType == "image/gif" {
+		format = "png"
+	}
+	enc, _ := lookupImageEncoder(format)
+
+	src, ok := reader.(io.ReadSeeker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: content is not seekable", ErrNotThumbnailable)
+	}
+
+	if resource.Encrypted {
+		var buf bytes.Buffer
+		if err := s.encodeImage(ctx, src, &buf, enc, width, height); err != nil {
+			return nil, nil, thumbnailError(err)
+		}
+		return memoryFile{bytes.NewReader(buf.Bytes())}, transcodedResponse(resource, enc, int64(buf.Len())), nil
+	}
+
+	cachePath := s.thumbnailPath(bucket, resource.Hash, width, height, enc)
+	if cached, info, err := openCached(cachePath); err == nil {
+		return cached, transcodedResponse(resource, enc, info.Size()), nil
+	}
+
+	if _, err := s.transcode(ctx, src, cachePath, enc, width, height); err != nil {
+		return nil, nil, thumbnailError(err)
+	}
+
+	cached, info, err := openCached(cachePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	return cached, transcodedResponse(resource, enc, info.Size()), nil
+}
+
+// thumbnailError reports images that cannot be decoded, or are too large to
+// be, as ErrNotThumbnailable. Other errors, like a cancelled request or a
+// failed write, are returned as they are.
+func thumbnailError(err error) error {
+	if errors.Is(err, errUndecodable) || errors.Is(err, errImageTooLarge) {
+		return fmt.Errorf("%w: %v", ErrNotThumbnailable, err)
+	}
+	return err
+}
+
+// removeThumbnails drops every cached thumbnail of a resource
+func (s *resourceService) removeThumbnails(bucket *sqlc.Bucket, hash string) {
+	matches, _ := filepath.Glob(filepath.Join(s.layout.ThumbnailDir(bucket.ClientID, bucket.ID), hash+"_*"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+// fitWithin shrinks img, keeping its aspect ratio, to fit within maxWidth x
+// maxHeight. An image that already fits is returned as it is. Each pixel of
+// the result is the average of the source pixels it covers, so fine detail
+// does not alias.
+func fitWithin(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	srcWidth, srcHeight := b.Dx(), b.Dy()
+	if srcWidth <= maxWidth && srcHeight <= maxHeight {
+		return img
+	}
+
+	scale := math.Min(float64(maxWidth)/float64(srcWidth), float64(maxHeight)/float64(srcHeight))
+	width := max(1, int(math.Round(float64(srcWidth)*scale)))
+	height := max(1, int(math.Round(float64(srcHeight)*scale)))
+
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := b.Min.Y+y*srcHeight/height, b.Min.Y+(y+1)*srcHeight/height
+		for x := 0; x < width; x++ {
+			x0, x1 := b.Min.X+x*srcWidth/width, b.Min.X+(x+1)*srcWidth/width
+
+			var r, g, bl, a uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+				}
+			}
+			n := uint64((y1 - y0) * (x1 - x0))
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// memoryFile serves an in-memory thumbnail like a file on disk, with Seek
+// for ranges and conditional requests
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestFitWithin(t *testing.T) {
+	tests := []struct {
+		width, height       int
+		maxWidth, maxHeight int
+		wantW, wantH        int
+	}{
+		{400, 200, 100, 100, 100, 50},
+		{200, 400, 100, 100, 50, 100},
+		{300, 300, 100, 50, 50, 50},
+		{1000, 10, 100, 100, 100, 1},
+		{80, 60, 100, 100, 80, 60},
+		{100, 100, 100, 100, 100, 100},
+	}
+	for _, tt := range tests {
+		got := fitWithin(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), tt.maxWidth, tt.maxHeight).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("fitWithin(%dx%d, %d, %d) = %dx%d, want %dx%d", tt.width, tt.height, tt.maxWidth, tt.maxHeight, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestThumbnailCached(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 300, 300))); err != nil {
+		t.Fatal(err)
+	}
+	resource, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "image/png", ".png", "", "", &img, nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+
+	thumbnail := func() []byte {
+		t.Helper()
+		reader, _, err := b.svc.Thumbnail(ctx, b.client.ID, b.bucket.ID, resource.Hash, 64, 64)
+		if err != nil {
+			t.Fatalf("Thumbnail() error = %v", err)
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	thumbnail()
+
+	// The second request is served from the cache, not made again
+	bucket, err := b.db.Queries.GetBucketByID(ctx, b.bucket.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := lookupImageEncoder("png")
+	path := b.svc.(*resourceService).thumbnailPath(&bucket, resource.Hash, 64, 64, enc)
+	if err := os.WriteFile(path, []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := thumbnail(); string(got) != "cached" {
+		t.Errorf("second Thumbnail() = %d bytes, want the cached file", len(got))
+	}
+}
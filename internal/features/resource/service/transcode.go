@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+const (
+	// maxTranscodePixels bounds decode memory; larger images are served as-is
+	maxTranscodePixels = 40_000_000
+)
+
+var (
+	// errImageTooLarge is returned for images over maxTranscodePixels
+	errImageTooLarge = errors.New("image too large to transcode")
+
+	// errUndecodable wraps the error of an image in a format that has no
+	// decoder or is corrupt
+	errUndecodable = errors.New("image cannot be decoded")
+)
+
+// ImageEncoder re-encodes a decoded image into a target format. JPEG and PNG
+// use the standard library. WebP needs libwebp and is added by builds tagged
+// libwebp (transcode_webp.go). There is no AVIF encoder, so AVIF serves the
+// original.
+type ImageEncoder struct {
+	ContentType string
+	Extension   string
+	Encode      func(w io.Writer, img image.Image) error
+}
+
+var (
+	imageEncoders = map[string]ImageEncoder{
+		"jpeg": {
+			ContentType: "image/jpeg",
+			Extension:   ".jpg",
+			Encode: func(w io.Writer, img image.Image) error {
+				return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+			},
+		},
+		"png": {
+			ContentType: "image/png",
+			Extension:   ".png",
+			Encode:      png.Encode,
+		},
+	}
+
+	// transcodeSlots caps concurrent decode/encode work to the number of CPUs
+	transcodeSlots = make(chan struct{}, runtime.NumCPU())
+)
+
+func lookupImageEncoder(format string) (ImageEncoder, bool) {
+	enc, ok := imageEncoders[strings.ToLower(format)]
+	return enc, ok
+}
+
+// DownloadAs returns the resource re-encoded to the requested image format.
+// Non-image resources, unsupported formats and oversized images fall back to
+// the original content; the returned response reflects what is actually served.
+// Transcoding reads the original unthrottled; only what is served is throttled.
+func (s *resourceService) DownloadAs(ctx context.Context, clientID, bucketID, hash, format string) (io.ReadCloser, *dto.ResourceResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, nil, bucketrepo.ErrBucketNotFound
+	}
+
+	reader, resource, err := s.openResource(ctx, bucket, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	throttled := func(r io.ReadCloser) io.ReadCloser {
+		return s.throttle.Reader(ctx, r, bucket.ID, bucket.DownloadRateLimit)
+	}
+
+	// Transcoded variants are cached unencrypted, so encrypted resources are
+	// always served in their original format
+	if resource.Encrypted {
+		return throttled(reader), resource, nil
+	}
+
+	enc, ok := lookupImageEncoder(format)
+	if !ok || !strings.HasPrefix(resource.ContentType, "image/") || resource.ContentType == enc.ContentType {
+		return throttled(reader), resource, nil
+	}
+
+	cachePath := filepath.Join(s.layout.TranscodeDir(bucketID), resource.Hash+"."+strings.ToLower(format))
+	if cached, info, err := openCached(cachePath); err == nil {
+		reader.Close()
+		return throttled(cached), transcodedResponse(resource, enc, info.Size()), nil
+	}
+
+	src, ok := reader.(io.ReadSeeker)
+	if !ok {
+		return throttled(reader), resource, nil
+	}
+
+	size, err := s.transcode(ctx, src, cachePath, enc, 0, 0)
+	reader.Close()
+	if err != nil {
+		// Fall back to the original on decode failures or size limits
+		return s.openThrottled(ctx, bucket, hash)
+	}
+
+	cached, _, err := openCached(cachePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open transcoded file: %w", err)
+	}
+	return throttled(cached), transcodedResponse(resource, enc, size), nil
+}
+
+// transcode re-encodes src with enc into cachePath. Positive maxWidth and
+// maxHeight shrink the image to fit within them first.
+func (s *resourceService) transcode(ctx context.Context, src io.ReadSeeker, cachePath string, enc ImageEncoder, maxWidth, maxHeight int) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return 0, err
+	}
+
+	// Write to a temp file first so concurrent readers never see partial output
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+
+	if err := s.encodeImage(ctx, src, tmp, enc, maxWidth, maxHeight); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// encodeImage decodes src and writes it to w encoded with enc, shrunk to fit
+// within maxWidth x maxHeight when those are positive
+func (s *resourceService) encodeImage(ctx context.Context, src io.ReadSeeker, w io.Writer, enc ImageEncoder, maxWidth, maxHeight int) error {
+	select {
+	case transcodeSlots <- struct{}{}:
+		defer func() { <-transcodeSlots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	cfg, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUndecodable, err)
+	}
+	if cfg.Width*cfg.Height > maxTranscodePixels {
+		return fmt.Errorf("%w: %dx%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUndecodable, err)
+	}
+	if maxWidth > 0 && maxHeight > 0 {
+		img = fitWithin(img, maxWidth, maxHeight)
+	}
+	return enc.Encode(w, img)
+}
+
+// removeTranscoded drops every cached variant of a resource
+func (s *resourceService) removeTranscoded(bucketID, hash string) {
+	matches, _ := filepath.Glob(filepath.Join(s.layout.TranscodeDir(bucketID), hash+".*"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+func openCached(path string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+func transcodedResponse(original *dto.ResourceResponse, enc ImageEncoder, size int64) *dto.ResourceResponse {
+	resp := *original
+	resp.ContentType = enc.ContentType
+	resp.Extension = enc.Extension
+	resp.Size = size
+	if resp.OriginalName != "" {
+		resp.OriginalName = strings.TrimSuffix(resp.OriginalName, filepath.Ext(resp.OriginalName)) + enc.Extension
+	}
+	return &resp
+}
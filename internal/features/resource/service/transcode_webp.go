@@ -0,0 +1,63 @@
+//go:build libwebp
+
+package service
+
+/*
+#cgo LDFLAGS: -lwebp
+#include <stdlib.h>
+#include <webp/encode.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"unsafe"
+)
+
+// webpQuality is the lossy quality passed to libwebp, from 0 to 100
+const webpQuality = 80
+
+// errWebPEncode is returned when libwebp produces no output, e.g. for an
+// image over its 16383 pixel side limit
+var errWebPEncode = errors.New("webp encoding failed")
+
+// Builds tagged libwebp link the system libwebp and serve ?format=webp and
+// Accept: image/webp
+func init() {
+	imageEncoders["webp"] = ImageEncoder{
+		ContentType: "image/webp",
+		Extension:   ".webp",
+		Encode:      encodeWebP,
+	}
+}
+
+func encodeWebP(w io.Writer, img image.Image) error {
+	// libwebp takes non-premultiplied RGBA rows
+	rgba, ok := img.(*image.NRGBA)
+	if !ok {
+		bounds := img.Bounds()
+		rgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+	width, height := rgba.Rect.Dx(), rgba.Rect.Dy()
+	if width == 0 || height == 0 {
+		return errWebPEncode
+	}
+
+	var output *C.uint8_t
+	size := C.WebPEncodeRGBA(
+		(*C.uint8_t)(unsafe.Pointer(&rgba.Pix[rgba.PixOffset(rgba.Rect.Min.X, rgba.Rect.Min.Y)])),
+		C.int(width), C.int(height), C.int(rgba.Stride),
+		C.float(webpQuality), &output,
+	)
+	if size == 0 {
+		return errWebPEncode
+	}
+	defer C.WebPFree(unsafe.Pointer(output))
+
+	_, err := w.Write(C.GoBytes(unsafe.Pointer(output), C.int(size)))
+	return err
+}
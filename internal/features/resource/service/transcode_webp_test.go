@@ -0,0 +1,53 @@
+//go:build libwebp
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestDownloadAsWebP(t *testing.T) {
+	b := newTestBucket(t)
+	ctx := context.Background()
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := range 40 {
+		src.Set(x, x%20, color.RGBA{R: 200, A: 255})
+	}
+	var img bytes.Buffer
+	if err := png.Encode(&img, src); err != nil {
+		t.Fatal(err)
+	}
+	resource, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "image/png", ".png", "", "", &img, nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+
+	reader, served, err := b.svc.DownloadAs(ctx, b.client.ID, b.bucket.ID, resource.Hash, "webp")
+	if err != nil {
+		t.Fatalf("DownloadAs() error = %v", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if served.ContentType != "image/webp" || served.Extension != ".webp" {
+		t.Errorf("DownloadAs() served %s %s, want image/webp .webp", served.ContentType, served.Extension)
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		t.Errorf("DownloadAs() = %q..., want a RIFF WEBP file", data[:min(len(data), 12)])
+	}
+	if served.Size != int64(len(data)) {
+		t.Errorf("size = %d, want %d", served.Size, len(data))
+	}
+	if got := NegotiateFormat("image/webp", resource); got != "webp" {
+		t.Errorf("NegotiateFormat(image/webp) = %q, want webp", got)
+	}
+}
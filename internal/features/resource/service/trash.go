@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+)
+
+const (
+	trashPurgeInterval = time.Hour
+
+	// trashPurgeBatch is how many expired resources a purge loads at a time
+	trashPurgeBatch = 500
+)
+
+// trashPath is where a soft-deleted resource's file is kept
+func (s *resourceService) trashPath(bucket *sqlc.Bucket, resource *sqlc.Resource) string {
+	return filepath.Join(s.layout.TrashDir(bucket.ClientID, bucket.ID), buildFilename(resource.Hash, resource.Extension))
+}
+
+// trash soft-deletes a resource. Its file moves into the bucket's trash, and
+// its storage stays counted and its blob referenced until it is purged.
+func (s *resourceService) trash(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource) error {
+	src, dst := s.blobPath(bucket, resource), s.trashPath(bucket, resource)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create trash folder: %w", err)
+	}
+	// A missing file does not keep the resource from being deleted, as with
+	// permanent deletion
+	if err := os.Rename(src, dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to move resource to trash: %w", err)
+	}
+	if err := s.repo.Trash(ctx, bucket.ID, resource.Hash); err != nil {
+		os.Rename(dst, src)
+		return err
+	}
+	return nil
+}
+
+// Restore moves a trashed resource's file back into the bucket and makes the
+// resource live again. It is announced with resource.new, like an upload.
+func (s *resourceService) Restore(ctx context.Context, clientID, bucketID, hash string) (*dto.ResourceResponse, error) {
+	bucket, err := s.bucketRepo.GetByID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify bucket belongs to client
+	if bucket.ClientID != clientID {
+		return nil, bucketrepo.ErrBucketNotFound
+	}
+
+	resource, err := s.repo.GetTrashed(ctx, bucket.ID, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	src, dst := s.trashPath(bucket, resource), s.blobPath(bucket, resource)
+	if err := os.Rename(src, dst); err != nil {
+		return nil, fmt.Errorf("failed to restore resource file: %w", err)
+	}
+	restored, err := s.repo.Restore(ctx, bucket.ID, hash)
+	if err != nil {
+		os.Rename(dst, src)
+		return nil, err
+	}
+
+	requestID := requestid.From(ctx)
+	go s.notifyNew(requestid.With(context.Background(), requestID), bucket, restored, nil)
+
+	resp := s.detail(bucket, restored)
+	resp.DownloadURL = s.buildDownloadURL(bucket.ID, restored.Hash, restored.Extension)
+	return resp, nil
+}
+
+// purgeTrashed permanently removes the bucket's trashed resource with the
+// hash, if there is one, so the hash can be stored again
+func (s *resourceService) purgeTrashed(ctx context.Context, bucket *sqlc.Bucket, hash string) error {
+	resource, err := s.repo.GetTrashed(ctx, bucket.ID, hash)
+	if errors.Is(err, repository.ErrResourceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.purge(ctx, bucket, resource)
+}
+
+// purge permanently removes a trashed resource and frees its storage. A
+// resource restored in the meantime is left alone.
+func (s *resourceService) purge(ctx context.Context, bucket *sqlc.Bucket, resource *sqlc.Resource) error {
+	purged, err := s.repo.Purge(ctx, resource.ID)
+	if err != nil || !purged {
+		return err
+	}
+
+	os.Remove(s.trashPath(bucket, resource))
+	s.releaseBlob(ctx, resource)
+	s.removeTranscoded(bucket.ID, resource.Hash)
+	s.removeThumbnails(bucket, resource.Hash)
+	s.removeChunkManifests(bucket.ID, resource.Hash)
+	return nil
+}
+
+// PurgeTrash permanently removes the resources trashed longer than the trash
+// retention and returns how many were removed. Without a retention, whatever
+// is left in the trash from when one was configured is removed.
+func (s *resourceService) PurgeTrash(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-s.trashRetention)
+	buckets := make(map[string]*sqlc.Bucket)
+	purged := 0
+	for {
+		resources, err := s.repo.ListExpiredTrash(ctx, cutoff, trashPurgeBatch)
+		if err != nil {
+			return purged, err
+		}
+		for i := range resources {
+			resource := &resources[i]
+			bucket, ok := buckets[resource.BucketID]
+			if !ok {
+				if bucket, err = s.bucketRepo.GetByID(ctx, resource.BucketID); err != nil {
+					return purged, err
+				}
+				buckets[resource.BucketID] = bucket
+			}
+			if err := s.purge(ctx, bucket, resource); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(resources) < trashPurgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// RunTrashPurge purges expired trash immediately and then hourly until ctx
+// is cancelled
+func (s *resourceService) RunTrashPurge(ctx context.Context) {
+	purge := func() {
+		purged, err := s.PurgeTrash(ctx)
+		if err != nil {
+			log.Printf("Trash purge failed: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("Purged %d trashed resources", purged)
+		}
+	}
+
+	purge()
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
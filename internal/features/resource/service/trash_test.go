@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+)
+
+// upload stores content in the bucket and returns its hash
+func (b *testBucket) upload(t *testing.T, content string) string {
+	t.Helper()
+
+	resource, err := b.svc.UploadStream(context.Background(), b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream(%q) error = %v", content, err)
+	}
+	return resource.Hash
+}
+
+func TestPurgeTrash(t *testing.T) {
+	usage := storage.NewUsage(0, false)
+	b := newTestBucketWith(t, Options{TrashRetention: time.Hour, Usage: usage})
+	ctx := context.Background()
+	expired, recent := b.upload(t, "trashed long ago"), b.upload(t, "trashed just now")
+	for _, hash := range []string{expired, recent} {
+		if err := b.svc.Delete(ctx, b.client.ID, b.bucket.ID, hash); err != nil {
+			t.Fatalf("Delete(%s) error = %v", hash, err)
+		}
+	}
+	if _, err := b.db.DB.ExecContext(ctx, `UPDATE resources SET deleted_at = datetime('now', '-2 hours') WHERE hash = ?`, expired); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := usage.Used(), int64(len("trashed long ago")+len("trashed just now")); got != want {
+		t.Errorf("Used() with both trashed = %d, want %d", got, want)
+	}
+
+	purged, err := b.svc.(*resourceService).PurgeTrash(ctx)
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeTrash() = %d, %v, want 1", purged, err)
+	}
+
+	// Only the resource trashed before the cutoff is gone, with its space
+	if _, err := b.repo.GetTrashed(ctx, b.bucket.ID, expired); !errors.Is(err, repository.ErrResourceNotFound) {
+		t.Errorf("GetTrashed(expired) error = %v, want %v", err, repository.ErrResourceNotFound)
+	}
+	if _, err := os.Stat(filepath.Join(b.layout.TrashDir(b.client.ID, b.bucket.ID), expired+".txt")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("trash file of the purged resource: %v, want it gone", err)
+	}
+	if got, want := usage.Used(), int64(len("trashed just now")); got != want {
+		t.Errorf("Used() after purge = %d, want %d", got, want)
+	}
+	if _, err := b.svc.Restore(ctx, b.client.ID, b.bucket.ID, recent); err != nil {
+		t.Errorf("Restore(recent) error = %v", err)
+	}
+}
+
+func TestUploadPurgesTrashedHash(t *testing.T) {
+	usage := storage.NewUsage(0, false)
+	b := newTestBucketWith(t, Options{TrashRetention: time.Hour, Usage: usage})
+	ctx := context.Background()
+	content := "deleted, then uploaded again"
+	hash := b.upload(t, content)
+	old, err := b.repo.GetByBucketAndHash(ctx, b.bucket.ID, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.svc.Delete(ctx, b.client.ID, b.bucket.ID, hash); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	again, err := b.svc.UploadStream(ctx, b.client.ID, b.bucket.ID, "text/plain", ".txt", "", "", strings.NewReader(content), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() again error = %v", err)
+	}
+	if again.Deduplicated || again.ID == old.ID {
+		t.Errorf("second upload = %s deduplicated %v, want a new resource", again.ID, again.Deduplicated)
+	}
+	if _, err := b.repo.GetTrashed(ctx, b.bucket.ID, hash); !errors.Is(err, repository.ErrResourceNotFound) {
+		t.Errorf("GetTrashed() error = %v, want the trashed row purged", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.layout.BucketDir(b.client.ID, b.bucket.ID), hash+".txt")); err != nil {
+		t.Errorf("file of the new resource: %v", err)
+	}
+	if got := usage.Used(); got != int64(len(content)) {
+		t.Errorf("Used() = %d, want %d", got, len(content))
+	}
+}
@@ -1,51 +1,60 @@
 package controller
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
 	authservice "github.com/aouiniamine/aoui-drive/internal/features/auth/service"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	bucketservice "github.com/aouiniamine/aoui-drive/internal/features/bucket/service"
+	resourcedto "github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	resourcerepo "github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
 	resourceservice "github.com/aouiniamine/aoui-drive/internal/features/resource/service"
 	webhookdto "github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
 	webhookservice "github.com/aouiniamine/aoui-drive/internal/features/webhook/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/internal/scanner"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/aouiniamine/aoui-drive/pkg/response"
 	"github.com/labstack/echo/v4"
 )
 
-const (
-	defaultPerPage = 20
-)
-
 type UIController struct {
 	authSvc     authservice.AuthService
 	bucketSvc   bucketservice.BucketService
 	resourceSvc resourceservice.ResourceService
 	webhookSvc  webhookservice.WebhookService
 	publicURL   string
+	pageLimits  pagination.Limits
 }
 
-func New(authSvc authservice.AuthService, bucketSvc bucketservice.BucketService, resourceSvc resourceservice.ResourceService, webhookSvc webhookservice.WebhookService, publicURL string) *UIController {
+func New(authSvc authservice.AuthService, bucketSvc bucketservice.BucketService, resourceSvc resourceservice.ResourceService, webhookSvc webhookservice.WebhookService, publicURL string, pageLimits pagination.Limits) *UIController {
 	return &UIController{
 		authSvc:     authSvc,
 		bucketSvc:   bucketSvc,
 		resourceSvc: resourceSvc,
 		webhookSvc:  webhookSvc,
 		publicURL:   publicURL,
+		pageLimits:  pageLimits,
 	}
 }
 
 func (c *UIController) RedirectToLogin(ctx echo.Context) error {
-	return ctx.Redirect(http.StatusFound, "/ui/login")
+	return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/login")
 }
 
 func (c *UIController) LoginPage(ctx echo.Context) error {
 	// Check if already logged in
 	cookie, err := ctx.Cookie(middleware.SessionCookieName)
 	if err == nil && cookie.Value != "" {
-		if _, err := c.authSvc.ValidateToken(cookie.Value); err == nil {
-			return ctx.Redirect(http.StatusFound, "/ui/buckets")
+		if _, err := c.authSvc.ValidateToken(ctx.Request().Context(), cookie.Value); err == nil {
+			return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/buckets")
 		}
 	}
 
@@ -59,34 +68,53 @@ func (c *UIController) Login(ctx echo.Context) error {
 	secretKey := ctx.FormValue("secret_key")
 
 	if accessKey == "" || secretKey == "" {
-		return ctx.Redirect(http.StatusFound, "/ui/login?error=Access+key+and+secret+key+are+required")
+		return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/login?error=Access+key+and+secret+key+are+required")
 	}
 
 	tokenResp, err := c.authSvc.Login(ctx.Request().Context(), dto.LoginRequest{
 		AccessKey: accessKey,
 		SecretKey: secretKey,
+	}, dto.SessionSource{
+		IP:        ctx.RealIP(),
+		UserAgent: audit.Truncate(ctx.Request().UserAgent()),
+		Via:       "ui",
 	})
 	if err != nil {
-		return ctx.Redirect(http.StatusFound, "/ui/login?error=Invalid+credentials")
+		audit.Event(audit.LoginFailed,
+			"access_key", audit.Truncate(accessKey),
+			"ip", ctx.RealIP(),
+			"via", "ui",
+			"reason", err.Error(),
+		)
+		if errors.Is(err, authservice.ErrLoginLocked) {
+			return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/login?error=Too+many+failed+logins,+try+again+later")
+		}
+		return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/login?error=Invalid+credentials")
 	}
 
 	// Set session cookie
 	ctx.SetCookie(&http.Cookie{
 		Name:     middleware.SessionCookieName,
 		Value:    tokenResp.AccessToken,
-		Path:     "/",
+		Path:     middleware.CookiePath(ctx),
 		HttpOnly: true,
 		Secure:   ctx.Request().TLS != nil,
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   86400, // 24 hours in seconds
 	})
 
-	return ctx.Redirect(http.StatusSeeOther, "/ui/buckets")
+	return ctx.Redirect(http.StatusSeeOther, middleware.BasePath(ctx)+"/ui/buckets")
 }
 
 func (c *UIController) Logout(ctx echo.Context) error {
+	// Revoke the token too, so a copied cookie stops working
+	if sessionID := middleware.GetSessionID(ctx); sessionID != "" {
+		if err := c.authSvc.RevokeSession(ctx.Request().Context(), middleware.GetClientID(ctx), sessionID); err != nil && !errors.Is(err, authservice.ErrSessionNotFound) {
+			log.Printf("Error revoking session on logout: %v", err)
+		}
+	}
 	c.clearSessionCookie(ctx)
-	return ctx.Redirect(http.StatusFound, "/ui/login")
+	return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/login")
 }
 
 func (c *UIController) BucketsPage(ctx echo.Context) error {
@@ -115,9 +143,7 @@ func (c *UIController) BucketPage(ctx echo.Context) error {
 		})
 	}
 
-	page, perPage := c.getPagination(ctx)
-
-	resources, err := c.resourceSvc.List(ctx.Request().Context(), clientID, bucketID)
+	resources, err := c.resourcePage(ctx, clientID, bucketID)
 	if err != nil {
 		return ctx.Render(http.StatusInternalServerError, "bucket.html", map[string]interface{}{
 			"Bucket": bucket,
@@ -125,33 +151,13 @@ func (c *UIController) BucketPage(ctx echo.Context) error {
 		})
 	}
 
-	// Calculate pagination
-	total := len(resources.Resources)
-	totalPages := (total + perPage - 1) / perPage
-	if page > totalPages && totalPages > 0 {
-		page = totalPages
-	}
-
-	start := (page - 1) * perPage
-	end := start + perPage
-	if end > total {
-		end = total
-	}
-
-	var paginatedResources []interface{}
-	if start < total {
-		for _, r := range resources.Resources[start:end] {
-			paginatedResources = append(paginatedResources, r)
-		}
-	}
-
 	data := map[string]interface{}{
 		"Bucket":     bucket,
-		"Resources":  paginatedResources,
-		"Page":       page,
-		"PerPage":    perPage,
-		"Total":      total,
-		"TotalPages": totalPages,
+		"Resources":  resources.Resources,
+		"Page":       resources.Page,
+		"PerPage":    resources.PerPage,
+		"Total":      resources.Total,
+		"TotalPages": resources.TotalPages,
 		"PublicURL":  c.publicURL,
 	}
 
@@ -159,6 +165,12 @@ func (c *UIController) BucketPage(ctx echo.Context) error {
 }
 
 func (c *UIController) ResourcesPartial(ctx echo.Context) error {
+	return c.renderResourceList(ctx, "")
+}
+
+// renderResourceList renders the page of resources selected by ?page= and
+// ?per_page=, with an optional notice shown above the list
+func (c *UIController) renderResourceList(ctx echo.Context, notice string) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("id")
 
@@ -167,41 +179,20 @@ func (c *UIController) ResourcesPartial(ctx echo.Context) error {
 		return ctx.HTML(http.StatusNotFound, "<p class='text-red-500'>Bucket not found</p>")
 	}
 
-	page, perPage := c.getPagination(ctx)
-
-	resources, err := c.resourceSvc.List(ctx.Request().Context(), clientID, bucketID)
+	resources, err := c.resourcePage(ctx, clientID, bucketID)
 	if err != nil {
 		return ctx.HTML(http.StatusInternalServerError, "<p class='text-red-500'>Failed to load resources</p>")
 	}
 
-	// Calculate pagination
-	total := len(resources.Resources)
-	totalPages := (total + perPage - 1) / perPage
-	if page > totalPages && totalPages > 0 {
-		page = totalPages
-	}
-
-	start := (page - 1) * perPage
-	end := start + perPage
-	if end > total {
-		end = total
-	}
-
-	var paginatedResources []interface{}
-	if start < total {
-		for _, r := range resources.Resources[start:end] {
-			paginatedResources = append(paginatedResources, r)
-		}
-	}
-
 	data := map[string]interface{}{
 		"Bucket":     bucket,
-		"Resources":  paginatedResources,
-		"Page":       page,
-		"PerPage":    perPage,
-		"Total":      total,
-		"TotalPages": totalPages,
+		"Resources":  resources.Resources,
+		"Page":       resources.Page,
+		"PerPage":    resources.PerPage,
+		"Total":      resources.Total,
+		"TotalPages": resources.TotalPages,
 		"PublicURL":  c.publicURL,
+		"Notice":     notice,
 	}
 
 	return ctx.Render(http.StatusOK, "resource-list.html", data)
@@ -214,6 +205,9 @@ func (c *UIController) DeleteResource(ctx echo.Context) error {
 
 	err := c.resourceSvc.Delete(ctx.Request().Context(), clientID, bucketID, hash)
 	if err != nil {
+		if errors.Is(err, bucketrepo.ErrRetentionActive) {
+			return ctx.HTML(http.StatusForbidden, "<p class='text-red-500'>Resource is under retention</p>")
+		}
 		return ctx.HTML(http.StatusInternalServerError, "<p class='text-red-500'>Failed to delete resource</p>")
 	}
 
@@ -222,6 +216,64 @@ func (c *UIController) DeleteResource(ctx echo.Context) error {
 	return ctx.NoContent(http.StatusOK)
 }
 
+// BulkDeleteResources deletes the selected resources and re-renders the
+// current page, so pagination survives the refresh
+func (c *UIController) BulkDeleteResources(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+
+	form, err := ctx.FormParams()
+	if err != nil {
+		return ctx.HTML(http.StatusBadRequest, `<div class="text-red-600 text-sm">Failed to parse selection</div>`)
+	}
+
+	// DeleteMany skips repeated hashes, so each resource fires one event
+	result, err := c.resourceSvc.DeleteMany(ctx.Request().Context(), clientID, bucketID, form["hashes"], false)
+	if err != nil {
+		if errors.Is(err, resourceservice.ErrEmptyArchive) || errors.Is(err, resourceservice.ErrTooManyEntries) {
+			return ctx.HTML(http.StatusBadRequest, `<div class="text-red-600 text-sm">`+err.Error()+`</div>`)
+		}
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return ctx.HTML(http.StatusNotFound, `<div class="text-red-600 text-sm">Bucket not found</div>`)
+		}
+		return ctx.HTML(http.StatusInternalServerError, `<div class="text-red-600 text-sm">Failed to delete resources</div>`)
+	}
+
+	notice := strconv.Itoa(result.Deleted) + " resources deleted"
+	if result.Failed > 0 {
+		notice += ", " + strconv.Itoa(result.Failed) + " failed"
+	}
+	return c.renderResourceList(ctx, notice)
+}
+
+// DownloadResourcesZip streams the selected resources as a zip
+func (c *UIController) DownloadResourcesZip(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+
+	form, err := ctx.FormParams()
+	if err != nil {
+		return ctx.String(http.StatusBadRequest, "Failed to parse selection")
+	}
+
+	archive, err := c.resourceSvc.Archive(ctx.Request().Context(), clientID, bucketID, form["hashes"])
+	if err != nil {
+		if errors.Is(err, resourceservice.ErrEmptyArchive) || errors.Is(err, resourceservice.ErrTooManyEntries) {
+			return ctx.String(http.StatusBadRequest, err.Error())
+		}
+		return ctx.String(http.StatusNotFound, "Bucket not found")
+	}
+
+	ctx.Response().Header().Set("Content-Type", "application/zip")
+	response.Attachment(ctx, archive.BucketID+".zip")
+	if archive.Sensitive {
+		response.NoStore(ctx)
+	}
+	ctx.Response().WriteHeader(http.StatusOK)
+
+	return archive.WriteZip(ctx.Request().Context(), ctx.Response())
+}
+
 func (c *UIController) ViewResource(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("id")
@@ -235,6 +287,38 @@ func (c *UIController) ViewResource(ctx echo.Context) error {
 
 	ctx.Response().Header().Set("Content-Type", resource.ContentType)
 	ctx.Response().Header().Set("Cache-Control", "private, max-age=3600")
+	if resource.Sensitive {
+		response.NoStore(ctx)
+	}
+
+	return ctx.Stream(http.StatusOK, resource.ContentType, file)
+}
+
+// galleryThumbnailSize fits the resource cards of the bucket page at twice
+// their width, for high-density screens
+const galleryThumbnailSize = 400
+
+// ThumbnailResource serves the gallery preview of an image. Images that
+// cannot be thumbnailed are served in full instead.
+func (c *UIController) ThumbnailResource(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+	hash := ctx.Param("hash")
+
+	file, resource, err := c.resourceSvc.Thumbnail(ctx.Request().Context(), clientID, bucketID, hash, galleryThumbnailSize, galleryThumbnailSize)
+	if errors.Is(err, resourceservice.ErrNotThumbnailable) {
+		return c.ViewResource(ctx)
+	}
+	if err != nil {
+		return ctx.String(http.StatusNotFound, "Resource not found")
+	}
+	defer file.Close()
+
+	ctx.Response().Header().Set("Content-Type", resource.ContentType)
+	ctx.Response().Header().Set("Cache-Control", "private, max-age=3600")
+	if resource.Sensitive {
+		response.NoStore(ctx)
+	}
 
 	return ctx.Stream(http.StatusOK, resource.ContentType, file)
 }
@@ -250,13 +334,67 @@ func (c *UIController) DownloadResource(ctx echo.Context) error {
 	}
 	defer file.Close()
 
-	filename := resource.Hash + resource.Extension
 	ctx.Response().Header().Set("Content-Type", resource.ContentType)
-	ctx.Response().Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	response.Attachment(ctx, resourceservice.DownloadName(resource))
+	if resource.Sensitive {
+		response.NoStore(ctx)
+	}
 
 	return ctx.Stream(http.StatusOK, resource.ContentType, file)
 }
 
+// shareTTLOptions are the expiries offered in the share dialog; an empty
+// value uses PRESIGN_TTL and every value is capped at PRESIGN_MAX_TTL
+var shareTTLOptions = []struct{ Label, Value string }{
+	{"Default", ""},
+	{"1 hour", "1h"},
+	{"24 hours", "24h"},
+	{"7 days", "168h"},
+}
+
+func (c *UIController) PresignResource(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("id")
+	hash := ctx.Param("hash")
+
+	ttlValue := ctx.FormValue("ttl")
+	var ttl time.Duration
+	if ttlValue != "" {
+		var err error
+		ttl, err = time.ParseDuration(ttlValue)
+		if err != nil || ttl <= 0 {
+			return ctx.HTML(http.StatusBadRequest, `<div class="text-red-600 text-sm">Invalid link expiry</div>`)
+		}
+	}
+
+	link, err := c.resourceSvc.Presign(ctx.Request().Context(), clientID, bucketID, hash, ttl)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return ctx.HTML(http.StatusNotFound, `<div class="text-red-600 text-sm">Bucket not found</div>`)
+		}
+		if errors.Is(err, resourcerepo.ErrResourceNotFound) {
+			return ctx.HTML(http.StatusNotFound, `<div class="text-red-600 text-sm">Resource not found</div>`)
+		}
+		return ctx.HTML(http.StatusInternalServerError, `<div class="text-red-600 text-sm">Failed to create share link</div>`)
+	}
+
+	// Without PUBLIC_URL the link is relative; resolve it against this request
+	url := link.URL
+	if strings.HasPrefix(url, "/") {
+		url = ctx.Scheme() + "://" + ctx.Request().Host + url
+	}
+
+	ctx.Response().Header().Set("HX-Trigger", "shareLinkCreated")
+	return ctx.Render(http.StatusOK, "share-link.html", map[string]interface{}{
+		"BucketID":  bucketID,
+		"Hash":      hash,
+		"URL":       url,
+		"ExpiresAt": link.ExpiresAt,
+		"TTL":       ttlValue,
+		"Options":   shareTTLOptions,
+	})
+}
+
 func (c *UIController) UploadResources(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
 	bucketID := ctx.Param("id")
@@ -271,56 +409,70 @@ func (c *UIController) UploadResources(ctx echo.Context) error {
 		return ctx.HTML(http.StatusBadRequest, `<div class="text-red-600 text-sm">No files selected</div>`)
 	}
 
-	var uploaded int
-	var errors []string
-
-	for _, file := range files {
-		_, err := c.resourceSvc.UploadFile(ctx.Request().Context(), clientID, bucketID, file, nil)
-		if err != nil {
-			errors = append(errors, file.Filename+": "+err.Error())
-		} else {
-			uploaded++
+	summary := c.resourceSvc.UploadBatch(ctx.Request().Context(), clientID, bucketID, files, nil, false)
+	for _, entry := range summary.Files {
+		var infected *scanner.InfectedError
+		if errors.As(entry.Err, &infected) {
+			audit.Event(audit.UploadInfected,
+				"client_id", clientID,
+				"bucket_id", bucketID,
+				"ip", ctx.RealIP(),
+				"signature", audit.Truncate(infected.Signature),
+			)
 		}
 	}
 
 	// Trigger refresh of resource list
 	ctx.Response().Header().Set("HX-Trigger", "resourceUploaded")
 
-	if len(errors) > 0 {
-		return ctx.HTML(http.StatusOK, `<div class="text-yellow-600 text-sm">`+strconv.Itoa(uploaded)+` files uploaded, `+strconv.Itoa(len(errors))+` failed</div>`)
-	}
-
-	return ctx.HTML(http.StatusOK, `<div class="text-green-600 text-sm">`+strconv.Itoa(uploaded)+` files uploaded successfully</div>`)
+	return ctx.Render(http.StatusOK, "upload-summary.html", summary)
 }
 
 func (c *UIController) clearSessionCookie(ctx echo.Context) {
 	cookie := &http.Cookie{
 		Name:     middleware.SessionCookieName,
 		Value:    "",
-		Path:     "/",
+		Path:     middleware.CookiePath(ctx),
 		HttpOnly: true,
 		MaxAge:   -1,
 	}
 	ctx.SetCookie(cookie)
 }
 
-func (c *UIController) getPagination(ctx echo.Context) (page, perPage int) {
-	page = 1
-	perPage = defaultPerPage
+// resourceListPage is one page of a bucket's resources as the templates show it
+type resourceListPage struct {
+	Resources  []resourcedto.ResourceResponse
+	Page       int
+	PerPage    int
+	Total      int64
+	TotalPages int
+}
 
-	if p := ctx.QueryParam("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
+// resourcePage loads the page selected by ?page= and ?per_page= from the
+// database. A page past the end shows the last page instead.
+func (c *UIController) resourcePage(ctx echo.Context, clientID, bucketID string) (*resourceListPage, error) {
+	p := c.pageLimits.Parse(ctx)
+
+	resources, err := c.resourceSvc.List(ctx.Request().Context(), clientID, bucketID, resourcedto.ListFilter{}, p.PerPage, p.Offset())
+	if err != nil {
+		return nil, err
 	}
 
-	if pp := ctx.QueryParam("per_page"); pp != "" {
-		if parsed, err := strconv.Atoi(pp); err == nil && parsed > 0 && parsed <= 100 {
-			perPage = parsed
+	totalPages := int((resources.Total + int64(p.PerPage) - 1) / int64(p.PerPage))
+	if p.Page > totalPages && totalPages > 0 {
+		p.Page = totalPages
+		if resources, err = c.resourceSvc.List(ctx.Request().Context(), clientID, bucketID, resourcedto.ListFilter{}, p.PerPage, p.Offset()); err != nil {
+			return nil, err
 		}
 	}
 
-	return
+	return &resourceListPage{
+		Resources:  resources.Resources,
+		Page:       p.Page,
+		PerPage:    p.PerPage,
+		Total:      resources.Total,
+		TotalPages: totalPages,
+	}, nil
 }
 
 // Webhook UI handlers
@@ -331,7 +483,7 @@ func (c *UIController) WebhooksPage(ctx echo.Context) error {
 
 	bucket, err := c.bucketSvc.Get(ctx.Request().Context(), clientID, bucketID)
 	if err != nil {
-		return ctx.Redirect(http.StatusFound, "/ui/buckets")
+		return ctx.Redirect(http.StatusFound, middleware.BasePath(ctx)+"/ui/buckets")
 	}
 
 	webhooks, _ := c.webhookSvc.ListURLs(ctx.Request().Context(), clientID, bucketID)
@@ -384,6 +536,14 @@ func (c *UIController) CreateWebhook(ctx echo.Context) error {
 		IsActive:  isActive,
 	})
 	if err != nil {
+		if errors.Is(err, webhookservice.ErrInvalidURL) {
+			audit.Event(audit.WebhookURLRejected,
+				"client_id", clientID,
+				"bucket_id", bucketID,
+				"ip", ctx.RealIP(),
+				"host", audit.Host(url),
+			)
+		}
 		return ctx.HTML(http.StatusBadRequest, `<div class="text-red-600 text-sm">`+err.Error()+`</div>`)
 	}
 
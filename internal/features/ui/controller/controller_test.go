@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	resourcedto "github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	resourcerepo "github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	resourceservice "github.com/aouiniamine/aoui-drive/internal/features/resource/service"
+	"github.com/labstack/echo/v4"
+)
+
+// presignStub answers Presign with a fixed error; the other methods are unused
+type presignStub struct {
+	resourceservice.ResourceService
+	err error
+}
+
+func (s presignStub) Presign(ctx context.Context, clientID, bucketID, hash string, ttl time.Duration) (*resourcedto.PresignResponse, error) {
+	return nil, s.err
+}
+
+func TestPresignResourceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      string
+		err      error
+		wantCode int
+	}{
+		{"invalid ttl", "soon", nil, http.StatusBadRequest},
+		{"negative ttl", "-1h", nil, http.StatusBadRequest},
+		{"missing bucket", "", bucketrepo.ErrBucketNotFound, http.StatusNotFound},
+		{"missing resource", "1h", resourcerepo.ErrResourceNotFound, http.StatusNotFound},
+		{"signer failure", "1h", errors.New("signing key unavailable"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &UIController{resourceSvc: presignStub{err: tt.err}}
+
+			form := url.Values{"ttl": {tt.ttl}}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			rec := httptest.NewRecorder()
+			ctx := echo.New().NewContext(req, rec)
+			ctx.SetParamNames("id", "hash")
+			ctx.SetParamValues("bucket-1", "abc")
+
+			if err := c.PresignResource(ctx); err != nil {
+				t.Fatalf("PresignResource() = %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("PresignResource() status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/aouiniamine/aoui-drive/internal/features/ui/controller"
 	webhookservice "github.com/aouiniamine/aoui-drive/internal/features/webhook/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/labstack/echo/v4"
 )
 
@@ -29,16 +30,22 @@ func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c
 
 type Feature struct {
 	Controller *controller.UIController
+	basePath   string
 }
 
-func New(authSvc authservice.AuthService, bucketSvc bucketservice.BucketService, resourceSvc resourceservice.ResourceService, webhookSvc webhookservice.WebhookService, publicURL string) *Feature {
-	ctrl := controller.New(authSvc, bucketSvc, resourceSvc, webhookSvc, publicURL)
+// New creates the UI feature. basePath is the BASE_PATH the UI's links are
+// prefixed with.
+func New(authSvc authservice.AuthService, bucketSvc bucketservice.BucketService, resourceSvc resourceservice.ResourceService, webhookSvc webhookservice.WebhookService, publicURL, basePath string, pageLimits pagination.Limits) *Feature {
+	ctrl := controller.New(authSvc, bucketSvc, resourceSvc, webhookSvc, publicURL, pageLimits)
 	return &Feature{
 		Controller: ctrl,
+		basePath:   basePath,
 	}
 }
 
-func (f *Feature) RegisterRoutes(e *echo.Echo, authSvc authservice.AuthService) {
+// RegisterRoutes registers the UI on the root group of e. frameAncestors are
+// the origins allowed to embed it in a frame; with none, framing is denied.
+func (f *Feature) RegisterRoutes(e *echo.Echo, r *echo.Group, authSvc authservice.AuthService, tokenSource middleware.TokenSource, frameAncestors []string) {
 	// Parse templates with custom functions
 	funcMap := template.FuncMap{
 		"formatBytes": formatBytes,
@@ -49,28 +56,36 @@ func (f *Feature) RegisterRoutes(e *echo.Echo, authSvc authservice.AuthService)
 		"isAudio":     isAudio,
 		"add":         func(a, b int) int { return a + b },
 		"subtract":    func(a, b int) int { return a - b },
+		"base":        func() string { return f.basePath },
 	}
 
 	tmpl := template.Must(template.New("").Funcs(funcMap).ParseFS(templatesFS, "templates/*.html", "templates/partials/*.html"))
 
 	e.Renderer = &TemplateRenderer{templates: tmpl}
 
+	framing := middleware.FrameAncestors(frameAncestors)
+
 	// Public routes (no auth required)
-	e.GET("/ui", f.Controller.RedirectToLogin)
-	e.GET("/ui/login", f.Controller.LoginPage)
-	e.POST("/ui/login", f.Controller.Login)
+	r.GET("/ui", f.Controller.RedirectToLogin, framing)
+	r.GET("/ui/login", f.Controller.LoginPage, framing)
+	r.POST("/ui/login", f.Controller.Login, framing)
 
-	// Protected routes (uses unified auth middleware that checks Bearer token and cookie)
-	ui := e.Group("/ui")
-	ui.Use(middleware.Auth(authSvc))
+	// Protected routes (token read from AUTH_UI_TOKEN_SOURCE, the session cookie by default).
+	// Framing headers come first so login redirects carry them too.
+	ui := r.Group("/ui")
+	ui.Use(framing, middleware.Auth(authSvc, tokenSource))
 
 	ui.GET("/logout", f.Controller.Logout)
 	ui.GET("/buckets", f.Controller.BucketsPage)
 	ui.GET("/buckets/:id", f.Controller.BucketPage)
 	ui.GET("/buckets/:id/resources", f.Controller.ResourcesPartial)
-	ui.POST("/buckets/:id/upload", f.Controller.UploadResources)
-	ui.GET("/buckets/:id/resources/:hash/view", f.Controller.ViewResource)
-	ui.GET("/buckets/:id/resources/:hash/download", f.Controller.DownloadResource)
+	ui.POST("/buckets/:id/resources/bulk-delete", f.Controller.BulkDeleteResources)
+	ui.POST("/buckets/:id/resources/download-zip", f.Controller.DownloadResourcesZip, middleware.Streaming())
+	ui.POST("/buckets/:id/upload", f.Controller.UploadResources, middleware.Streaming())
+	ui.GET("/buckets/:id/resources/:hash/view", f.Controller.ViewResource, middleware.Streaming())
+	ui.GET("/buckets/:id/resources/:hash/thumbnail", f.Controller.ThumbnailResource, middleware.Streaming())
+	ui.GET("/buckets/:id/resources/:hash/download", f.Controller.DownloadResource, middleware.Streaming())
+	ui.POST("/buckets/:id/resources/:hash/presign", f.Controller.PresignResource)
 	ui.DELETE("/buckets/:id/resources/:hash", f.Controller.DeleteResource)
 
 	// Webhook UI routes
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/repository"
+	authservice "github.com/aouiniamine/aoui-drive/internal/features/auth/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+// TestBasePath serves the UI under /drive, as main does with BASE_PATH=/drive
+func TestBasePath(t *testing.T) {
+	db := dbtest.New(t)
+	authSvc := authservice.New(repository.New(db.Queries), "secret", nil, 0, authservice.NewMemorySessionStore(), nil, nil, nil, authservice.Registration{})
+	client, err := authSvc.CreateClient(context.Background(), dto.CreateClientRequest{Name: "ui", Role: dto.RoleUser})
+	if err != nil {
+		t.Fatalf("CreateClient() error = %v", err)
+	}
+
+	e := echo.New()
+	e.Use(middleware.WithBasePath("/drive"))
+	feature := New(authSvc, nil, nil, nil, "/drive", "/drive", pagination.Limits{})
+	feature.RegisterRoutes(e, e.Group("/drive"), authSvc, middleware.TokenFromCookie, nil)
+
+	serve := func(method, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		} else {
+			body = strings.NewReader("")
+		}
+		req := httptest.NewRequest(method, path, body)
+		if form != nil {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	assertRedirect := func(rec *httptest.ResponseRecorder, wantPrefix string) {
+		t.Helper()
+		if rec.Code != http.StatusFound && rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want a redirect to %s", rec.Code, wantPrefix)
+		}
+		if location := rec.Header().Get("Location"); !strings.HasPrefix(location, wantPrefix) {
+			t.Errorf("redirected to %s, want %s", location, wantPrefix)
+		}
+	}
+
+	assertRedirect(serve(http.MethodGet, "/drive/ui", nil), "/drive/ui/login")
+	assertRedirect(serve(http.MethodGet, "/drive/ui/buckets", nil), "/drive/ui/login?error=")
+	assertRedirect(serve(http.MethodPost, "/drive/ui/login", url.Values{}), "/drive/ui/login?error=")
+
+	if rec := serve(http.MethodGet, "/ui/login", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("/ui/login outside the base path: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec := serve(http.MethodGet, "/drive/ui/login", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login page: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if !strings.Contains(rec.Body.String(), `action="/drive/ui/login"`) {
+		t.Error("login form does not post to /drive/ui/login")
+	}
+
+	rec = serve(http.MethodPost, "/drive/ui/login", url.Values{"access_key": {client.AccessKey}, "secret_key": {client.SecretKey}})
+	assertRedirect(rec, "/drive/ui/buckets")
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == middleware.SessionCookieName {
+			session = cookie
+		}
+	}
+	if session == nil {
+		t.Fatal("login set no session cookie")
+	}
+	if session.Path != "/drive" {
+		t.Errorf("session cookie path = %q, want /drive", session.Path)
+	}
+
+	rec = serve(http.MethodGet, "/drive/ui/logout", nil, session)
+	assertRedirect(rec, "/drive/ui/login")
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == middleware.SessionCookieName && cookie.Path != "/drive" {
+			t.Errorf("logout cleared the cookie at path %q, want /drive", cookie.Path)
+		}
+	}
+}
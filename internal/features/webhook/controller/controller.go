@@ -1,23 +1,30 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/audit"
 	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/service"
 	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/aouiniamine/aoui-drive/pkg/response"
 	"github.com/labstack/echo/v4"
 )
 
 type WebhookController struct {
-	service service.WebhookService
+	service    service.WebhookService
+	pageLimits pagination.Limits
 }
 
-func New(svc service.WebhookService) *WebhookController {
-	return &WebhookController{service: svc}
+func New(svc service.WebhookService, pageLimits pagination.Limits) *WebhookController {
+	return &WebhookController{service: svc, pageLimits: pageLimits}
 }
 
 func (c *WebhookController) RegisterRoutes(g *echo.Group) {
@@ -32,8 +39,22 @@ func (c *WebhookController) RegisterRoutes(g *echo.Group) {
 	g.POST("/:webhookId/headers", c.CreateHeader)
 	g.PUT("/:webhookId/headers/:headerId", c.UpdateHeader)
 	g.DELETE("/:webhookId/headers/:headerId", c.DeleteHeader)
+
+	// Delivery history. The stream stays open for as long as the client
+	// listens, so it is exempt from the server's read and write timeouts.
+	g.GET("/events", c.ListEvents)
+	g.GET("/:webhookId/events/stream", c.StreamEvents, middleware.Streaming())
+	g.GET("/:webhookId/stats", c.Stats)
 }
 
+const (
+	// streamHeartbeat keeps idle streams from being closed by proxies
+	streamHeartbeat = 15 * time.Second
+
+	// defaultStatsWindow is used when a stats request has no window
+	defaultStatsWindow = 24 * time.Hour
+)
+
 // CreateWebhookURL godoc
 // @Summary Create a webhook URL
 // @Description Create a new webhook URL for a bucket
@@ -47,6 +68,7 @@ func (c *WebhookController) RegisterRoutes(g *echo.Group) {
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
 // @Router /buckets/{bucketId}/webhooks [post]
 func (c *WebhookController) CreateWebhookURL(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
@@ -75,11 +97,29 @@ func (c *WebhookController) CreateWebhookURL(ctx echo.Context) error {
 			return response.NotFound(ctx, "bucket not found")
 		}
 		if errors.Is(err, repository.ErrWebhookURLExists) {
-			return response.BadRequest(ctx, "webhook URL already exists for this event type")
+			return response.Conflict(ctx, "webhook URL already exists for this event type")
 		}
 		if errors.Is(err, service.ErrInvalidURL) {
+			audit.Event(audit.WebhookURLRejected,
+				"client_id", clientID,
+				"bucket_id", bucketID,
+				"ip", ctx.RealIP(),
+				"host", audit.Host(req.URL),
+			)
 			return response.BadRequest(ctx, "invalid webhook URL")
 		}
+		if errors.Is(err, service.ErrInvalidPartitionKey) {
+			return response.BadRequest(ctx, "partition_key_template may only use {bucket}, {bucket_name}, {event}, {hash} and {resource}")
+		}
+		if errors.Is(err, service.ErrUnsupportedPayloadVersion) {
+			return response.BadRequest(ctx, "unsupported payload_version")
+		}
+		if errors.Is(err, service.ErrInvalidContentTypeFilter) {
+			return response.BadRequest(ctx, "content_type_filter must be comma-separated content types such as image/png, image/* or application/vnd.*")
+		}
+		if errors.Is(err, service.ErrInvalidRetryPolicy) {
+			return response.BadRequest(ctx, "max_attempts must be 0 to 20 and retry_backoff_seconds 0 to 3600, where 0 uses the server default")
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
@@ -185,8 +225,26 @@ func (c *WebhookController) UpdateWebhookURL(ctx echo.Context) error {
 			return response.NotFound(ctx, "webhook not found")
 		}
 		if errors.Is(err, service.ErrInvalidURL) {
+			audit.Event(audit.WebhookURLRejected,
+				"client_id", clientID,
+				"bucket_id", bucketID,
+				"ip", ctx.RealIP(),
+				"host", audit.Host(req.URL),
+			)
 			return response.BadRequest(ctx, "invalid webhook URL")
 		}
+		if errors.Is(err, service.ErrInvalidPartitionKey) {
+			return response.BadRequest(ctx, "partition_key_template may only use {bucket}, {bucket_name}, {event}, {hash} and {resource}")
+		}
+		if errors.Is(err, service.ErrUnsupportedPayloadVersion) {
+			return response.BadRequest(ctx, "unsupported payload_version")
+		}
+		if errors.Is(err, service.ErrInvalidContentTypeFilter) {
+			return response.BadRequest(ctx, "content_type_filter must be comma-separated content types such as image/png, image/* or application/vnd.*")
+		}
+		if errors.Is(err, service.ErrInvalidRetryPolicy) {
+			return response.BadRequest(ctx, "max_attempts must be 0 to 20 and retry_backoff_seconds 0 to 3600, where 0 uses the server default")
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
@@ -237,6 +295,7 @@ func (c *WebhookController) DeleteWebhookURL(ctx echo.Context) error {
 // @Failure 400 {object} response.Response
 // @Failure 401 {object} response.Response
 // @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
 // @Router /buckets/{bucketId}/webhooks/{webhookId}/headers [post]
 func (c *WebhookController) CreateHeader(ctx echo.Context) error {
 	clientID := middleware.GetClientID(ctx)
@@ -264,6 +323,9 @@ func (c *WebhookController) CreateHeader(ctx echo.Context) error {
 		if errors.Is(err, repository.ErrWebhookURLNotFound) {
 			return response.NotFound(ctx, "webhook not found")
 		}
+		if errors.Is(err, repository.ErrWebhookHeaderExists) {
+			return response.Conflict(ctx, "webhook header already exists")
+		}
 		return response.InternalError(ctx, err.Error())
 	}
 
@@ -353,3 +415,149 @@ func (c *WebhookController) DeleteHeader(ctx echo.Context) error {
 	return response.NoContent(ctx)
 }
 
+// ListEvents godoc
+// @Summary List webhook deliveries
+// @Description List the bucket's webhook delivery history (newest first), including the receiver's status code and a bounded snippet of its response body
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param bucketId path string true "Bucket ID"
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Events per page (clamped to PAGE_SIZE_MAX)"
+// @Success 200 {object} response.Response{data=dto.WebhookEventListResponse}
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /buckets/{bucketId}/webhooks/events [get]
+func (c *WebhookController) ListEvents(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucketId")
+
+	p := c.pageLimits.Parse(ctx)
+
+	events, err := c.service.ListEvents(ctx.Request().Context(), clientID, bucketID, p.Page, p.PerPage)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Paginated(ctx, events, p, events.Total)
+}
+
+// StreamEvents godoc
+// @Summary Stream webhook deliveries
+// @Description Stream the webhook's delivery results as Server-Sent Events while they happen, including retries. Each result is sent as a "delivery" event whose data is a WebhookEventResponse; comment lines are sent as heartbeats. The number of open streams is bounded by WEBHOOK_STREAM_MAX.
+// @Tags webhooks
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param bucketId path string true "Bucket ID"
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} dto.WebhookEventResponse
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 503 {object} response.Response
+// @Router /buckets/{bucketId}/webhooks/{webhookId}/events/stream [get]
+func (c *WebhookController) StreamEvents(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucketId")
+	webhookID := ctx.Param("webhookId")
+	reqCtx := ctx.Request().Context()
+
+	events, cancel, err := c.service.StreamEvents(reqCtx, clientID, bucketID, webhookID)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrWebhookURLNotFound) {
+			return response.NotFound(ctx, "webhook not found")
+		}
+		if errors.Is(err, service.ErrTooManyStreams) {
+			return response.ServiceUnavailable(ctx, "too many open event streams, try again later")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+	defer cancel()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-reqCtx.Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-events:
+			if !ok {
+				// The feed went away (e.g. Redis connection lost); the
+				// client reconnects
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: delivery\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+// Stats godoc
+// @Summary Get webhook delivery stats
+// @Description Aggregate the webhook's deliveries for events created within the window: events, attempts, successful and failed attempts, events that gave up, the success rate per attempt and the average time the receiver took per attempt. Results are cached for up to 30 seconds.
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param bucketId path string true "Bucket ID"
+// @Param webhookId path string true "Webhook ID"
+// @Param window query string false "Go duration to look back, up to 720h" default(24h)
+// @Success 200 {object} response.Response{data=dto.WebhookStatsResponse}
+// @Failure 400 {object} response.Response
+// @Failure 401 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /buckets/{bucketId}/webhooks/{webhookId}/stats [get]
+func (c *WebhookController) Stats(ctx echo.Context) error {
+	clientID := middleware.GetClientID(ctx)
+	bucketID := ctx.Param("bucketId")
+	webhookID := ctx.Param("webhookId")
+
+	window := defaultStatsWindow
+	if v := ctx.QueryParam("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return response.BadRequest(ctx, "invalid window, use a duration such as 1h or 168h")
+		}
+		window = d
+	}
+
+	stats, err := c.service.Stats(ctx.Request().Context(), clientID, bucketID, webhookID, window)
+	if err != nil {
+		if errors.Is(err, bucketrepo.ErrBucketNotFound) {
+			return response.NotFound(ctx, "bucket not found")
+		}
+		if errors.Is(err, repository.ErrWebhookURLNotFound) {
+			return response.NotFound(ctx, "webhook not found")
+		}
+		if errors.Is(err, service.ErrInvalidStatsWindow) {
+			return response.BadRequest(ctx, "window must be positive and at most 720h")
+		}
+		return response.InternalError(ctx, err.Error())
+	}
+
+	return response.Success(ctx, stats)
+}
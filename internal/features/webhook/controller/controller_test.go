@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/service"
+	"github.com/aouiniamine/aoui-drive/internal/middleware"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPayloadVersionValidation(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	repo := repository.New(db.Queries)
+	if _, err := repo.CreateURL(context.Background(), sqlc.CreateWebhookURLParams{
+		ID: "webhook-1", BucketID: bucket.ID, Url: "https://example.com/hook", EventType: "resource.new", IsActive: 1,
+	}); err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+
+	e := echo.New()
+	svc := service.New(repo, bucketrepo.New(db.Queries), nil, nil, 0)
+	New(svc, pagination.Limits{DefaultPerPage: 20, MaxPerPage: 100}).RegisterRoutes(e.Group("/buckets/:bucketId/webhooks", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(middleware.ClientIDKey, client.ID)
+			return next(c)
+		}
+	}))
+	base := "/buckets/" + bucket.ID + "/webhooks"
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"create following the latest", http.MethodPost, base, `{"url":"https://example.com/latest","event_type":"resource.new","is_active":true}`, http.StatusCreated},
+		{"create pinned", http.MethodPost, base, `{"url":"https://example.com/pinned","event_type":"resource.new","payload_version":1}`, http.StatusCreated},
+		{"create with an unknown version", http.MethodPost, base, `{"url":"https://example.com/unknown","event_type":"resource.new","payload_version":99}`, http.StatusBadRequest},
+		{"create with a negative version", http.MethodPost, base, `{"url":"https://example.com/negative","event_type":"resource.new","payload_version":-1}`, http.StatusBadRequest},
+		{"update pinned", http.MethodPut, base + "/webhook-1", `{"url":"https://example.com/hook","event_type":"resource.new","payload_version":1}`, http.StatusOK},
+		{"update to an unknown version", http.MethodPut, base + "/webhook-1", `{"url":"https://example.com/hook","event_type":"resource.new","payload_version":2}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
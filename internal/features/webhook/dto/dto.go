@@ -6,6 +6,9 @@ import "time"
 const (
 	EventResourceNew     = "resource.new"
 	EventResourceDeleted = "resource.deleted"
+
+	// EventLoginLocked is only sent to LOGIN_LOCKOUT_WEBHOOK_URL
+	EventLoginLocked = "auth.login_locked"
 )
 
 // Status constants
@@ -20,16 +23,30 @@ const (
 // Requests
 
 type CreateWebhookURLRequest struct {
-	URL       string                `json:"url"`
-	EventType string                `json:"event_type"`
-	IsActive  bool                  `json:"is_active"`
-	Headers   []CreateHeaderRequest `json:"headers,omitempty"`
+	URL                  string                `json:"url"`
+	EventType            string                `json:"event_type"`
+	IsActive             bool                  `json:"is_active"`
+	CompressPayload      bool                  `json:"compress_payload"`
+	PartitionKeyTemplate string                `json:"partition_key_template,omitempty"`
+	PayloadVersion       int64                 `json:"payload_version,omitempty"`
+	ContentTypeFilter    string                `json:"content_type_filter,omitempty"`
+	IncludeDownloadToken bool                  `json:"include_download_token"`
+	MaxAttempts          int64                 `json:"max_attempts,omitempty"`
+	RetryBackoffSeconds  int64                 `json:"retry_backoff_seconds,omitempty"`
+	Headers              []CreateHeaderRequest `json:"headers,omitempty"`
 }
 
 type UpdateWebhookURLRequest struct {
-	URL       string `json:"url"`
-	EventType string `json:"event_type"`
-	IsActive  bool   `json:"is_active"`
+	URL                  string `json:"url"`
+	EventType            string `json:"event_type"`
+	IsActive             bool   `json:"is_active"`
+	CompressPayload      bool   `json:"compress_payload"`
+	PartitionKeyTemplate string `json:"partition_key_template,omitempty"`
+	PayloadVersion       int64  `json:"payload_version,omitempty"`
+	ContentTypeFilter    string `json:"content_type_filter,omitempty"`
+	IncludeDownloadToken bool   `json:"include_download_token"`
+	MaxAttempts          int64  `json:"max_attempts,omitempty"`
+	RetryBackoffSeconds  int64  `json:"retry_backoff_seconds,omitempty"`
 }
 
 type CreateHeaderRequest struct {
@@ -44,14 +61,21 @@ type UpdateHeaderRequest struct {
 // Responses
 
 type WebhookURLResponse struct {
-	ID        string           `json:"id"`
-	BucketID  string           `json:"bucket_id"`
-	URL       string           `json:"url"`
-	EventType string           `json:"event_type"`
-	IsActive  bool             `json:"is_active"`
-	Headers   []HeaderResponse `json:"headers,omitempty"`
-	CreatedAt time.Time        `json:"created_at"`
-	UpdatedAt time.Time        `json:"updated_at"`
+	ID                   string           `json:"id"`
+	BucketID             string           `json:"bucket_id"`
+	URL                  string           `json:"url"`
+	EventType            string           `json:"event_type"`
+	IsActive             bool             `json:"is_active"`
+	CompressPayload      bool             `json:"compress_payload"`
+	PartitionKeyTemplate string           `json:"partition_key_template,omitempty"`
+	PayloadVersion       int64            `json:"payload_version"`
+	ContentTypeFilter    string           `json:"content_type_filter,omitempty"`
+	IncludeDownloadToken bool             `json:"include_download_token"`
+	MaxAttempts          int64            `json:"max_attempts"`
+	RetryBackoffSeconds  int64            `json:"retry_backoff_seconds"`
+	Headers              []HeaderResponse `json:"headers,omitempty"`
+	CreatedAt            time.Time        `json:"created_at"`
+	UpdatedAt            time.Time        `json:"updated_at"`
 }
 
 type HeaderResponse struct {
@@ -73,6 +97,7 @@ type WebhookEventResponse struct {
 	EventType    string     `json:"event_type"`
 	Status       string     `json:"status"`
 	ResponseCode *int64     `json:"response_code,omitempty"`
+	ResponseBody string     `json:"response_body,omitempty"`
 	Attempts     int64      `json:"attempts"`
 	MaxAttempts  int64      `json:"max_attempts"`
 	NextRetryAt  *time.Time `json:"next_retry_at,omitempty"`
@@ -87,21 +112,54 @@ type WebhookEventListResponse struct {
 	Limit  int                    `json:"limit"`
 }
 
+// WebhookStatsResponse aggregates a webhook's delivery attempts for the events
+// created in the last WindowSeconds. Failures count failed attempts, including
+// ones that were retried later; FailedEvents are events that gave up.
+type WebhookStatsResponse struct {
+	WebhookURLID  string    `json:"webhook_url_id"`
+	WindowSeconds int64     `json:"window_seconds"`
+	Since         time.Time `json:"since"`
+	Events        int64     `json:"events"`
+	Attempts      int64     `json:"attempts"`
+	Successes     int64     `json:"successes"`
+	Failures      int64     `json:"failures"`
+	FailedEvents  int64     `json:"failed_events"`
+	SuccessRate   float64   `json:"success_rate"`
+	AvgLatencyMs  float64   `json:"avg_latency_ms"`
+}
+
 // Webhook Payload (sent to external URLs)
 
+// LatestPayloadVersion is sent as X-Webhook-Payload-Version to webhooks that
+// don't pin a version. Bump it whenever the WebhookPayload shape changes.
+const LatestPayloadVersion = 1
+
 type WebhookPayload struct {
-	Event       string          `json:"event"`
-	Timestamp   time.Time       `json:"timestamp"`
-	BucketID    string          `json:"bucket_id"`
-	BucketName  string          `json:"bucket_name"`
-	ResourceID  string          `json:"resource_id"`
-	ResourceURL string          `json:"resource_url"`
-	Resource    ResourcePayload `json:"resource"`
+	Event                string          `json:"event"`
+	Timestamp            time.Time       `json:"timestamp"`
+	BucketID             string          `json:"bucket_id"`
+	BucketName           string          `json:"bucket_name"`
+	ResourceID           string          `json:"resource_id"`
+	ResourceURL          string          `json:"resource_url"`
+	ResourceURLExpiresAt *time.Time      `json:"resource_url_expires_at,omitempty"`
+	Resource             ResourcePayload `json:"resource"`
+	RequestID            string          `json:"request_id,omitempty"`
 }
 
 type ResourcePayload struct {
-	Hash        string `json:"hash"`
-	Size        int64  `json:"size"`
-	ContentType string `json:"content_type"`
-	Extension   string `json:"extension"`
+	Hash        string            `json:"hash"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"content_type"`
+	Extension   string            `json:"extension"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// LockoutPayload is sent to LOGIN_LOCKOUT_WEBHOOK_URL when an access key is
+// locked after repeated failed logins
+type LockoutPayload struct {
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	AccessKey string    `json:"access_key"`
+	IP        string    `json:"ip"`
+	Attempts  int       `json:"attempts"`
 }
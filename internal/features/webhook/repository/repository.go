@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
+	"github.com/aouiniamine/aoui-drive/internal/database"
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 )
 
@@ -12,6 +14,7 @@ var (
 	ErrWebhookURLNotFound    = errors.New("webhook URL not found")
 	ErrWebhookURLExists      = errors.New("webhook URL already exists for this event type")
 	ErrWebhookHeaderNotFound = errors.New("webhook header not found")
+	ErrWebhookHeaderExists   = errors.New("webhook header already exists")
 	ErrWebhookEventNotFound  = errors.New("webhook event not found")
 )
 
@@ -37,9 +40,18 @@ type WebhookRepository interface {
 	GetEventByID(ctx context.Context, id string) (*sqlc.WebhookEvent, error)
 	ListEventsByBucketID(ctx context.Context, bucketID string, limit, offset int64) ([]sqlc.WebhookEvent, error)
 	ListPendingEvents(ctx context.Context, limit int64) ([]sqlc.WebhookEvent, error)
+	// ClaimEvent marks a pending event as processing; false means another worker has it
+	ClaimEvent(ctx context.Context, id string) (bool, error)
+	// ClaimPendingEvents claims up to limit due events, including processing
+	// events whose claim is older than staleBefore
+	ClaimPendingEvents(ctx context.Context, limit int64, staleBefore time.Time) ([]sqlc.WebhookEvent, error)
 	CreateEvent(ctx context.Context, params sqlc.CreateWebhookEventParams) (*sqlc.WebhookEvent, error)
 	UpdateEventStatus(ctx context.Context, params sqlc.UpdateWebhookEventStatusParams) error
 	CountEventsByBucketID(ctx context.Context, bucketID string) (int64, error)
+	// CountPendingEvents counts pending and retrying events across all buckets
+	CountPendingEvents(ctx context.Context) (int64, error)
+	// DeliveryStats aggregates the webhook's events created since the given time
+	DeliveryStats(ctx context.Context, webhookURLID string, since time.Time) (*sqlc.GetWebhookDeliveryStatsRow, error)
 }
 
 type webhookRepository struct {
@@ -85,6 +97,10 @@ func (r *webhookRepository) CreateURL(ctx context.Context, params sqlc.CreateWeb
 
 	url, err := r.queries.CreateWebhookURL(ctx, params)
 	if err != nil {
+		// Created concurrently since the check above
+		if database.IsUniqueViolation(err) {
+			return nil, ErrWebhookURLExists
+		}
 		return nil, err
 	}
 	return &url, nil
@@ -144,6 +160,9 @@ func (r *webhookRepository) ListHeadersByURLID(ctx context.Context, webhookURLID
 func (r *webhookRepository) CreateHeader(ctx context.Context, params sqlc.CreateWebhookHeaderParams) (*sqlc.WebhookHeader, error) {
 	header, err := r.queries.CreateWebhookHeader(ctx, params)
 	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return nil, ErrWebhookHeaderExists
+		}
 		return nil, err
 	}
 	return &header, nil
@@ -201,6 +220,25 @@ func (r *webhookRepository) ListPendingEvents(ctx context.Context, limit int64)
 	return r.queries.ListPendingWebhookEvents(ctx, limit)
 }
 
+func (r *webhookRepository) ClaimEvent(ctx context.Context, id string) (bool, error) {
+	rows, err := r.queries.ClaimWebhookEvent(ctx, sqlc.ClaimWebhookEventParams{
+		ClaimedAt: time.Now().UTC(),
+		ID:        id,
+	})
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (r *webhookRepository) ClaimPendingEvents(ctx context.Context, limit int64, staleBefore time.Time) ([]sqlc.WebhookEvent, error) {
+	return r.queries.ClaimPendingWebhookEvents(ctx, sqlc.ClaimPendingWebhookEventsParams{
+		ClaimedAt:   time.Now().UTC(),
+		StaleBefore: staleBefore.UTC(),
+		BatchSize:   limit,
+	})
+}
+
 func (r *webhookRepository) CreateEvent(ctx context.Context, params sqlc.CreateWebhookEventParams) (*sqlc.WebhookEvent, error) {
 	event, err := r.queries.CreateWebhookEvent(ctx, params)
 	if err != nil {
@@ -216,3 +254,18 @@ func (r *webhookRepository) UpdateEventStatus(ctx context.Context, params sqlc.U
 func (r *webhookRepository) CountEventsByBucketID(ctx context.Context, bucketID string) (int64, error) {
 	return r.queries.CountWebhookEventsByBucketID(ctx, bucketID)
 }
+
+func (r *webhookRepository) CountPendingEvents(ctx context.Context) (int64, error) {
+	return r.queries.CountPendingWebhookEvents(ctx)
+}
+
+func (r *webhookRepository) DeliveryStats(ctx context.Context, webhookURLID string, since time.Time) (*sqlc.GetWebhookDeliveryStatsRow, error) {
+	stats, err := r.queries.GetWebhookDeliveryStats(ctx, sqlc.GetWebhookDeliveryStatsParams{
+		WebhookUrlID: webhookURLID,
+		Since:        since,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
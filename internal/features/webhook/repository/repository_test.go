@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+func TestCreateURLLosesRace(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	ctx := context.Background()
+	params := sqlc.CreateWebhookURLParams{
+		ID:        "webhook-1",
+		BucketID:  bucket.ID,
+		Url:       "https://example.com/hook",
+		EventType: "resource.new",
+		IsActive:  1,
+	}
+
+	if _, err := New(db.Queries).CreateURL(ctx, params); err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+
+	// The second request checked before the first inserted, so only the
+	// insert's unique constraint can tell it the webhook exists
+	repo := New(dbtest.StaleCheck(db, "WebhookURLExists"))
+	params.ID = "webhook-2"
+	if _, err := repo.CreateURL(ctx, params); !errors.Is(err, ErrWebhookURLExists) {
+		t.Fatalf("CreateURL() error = %v, want ErrWebhookURLExists", err)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import "strings"
+
+// normalizeContentTypeFilter validates a comma-separated list of content-type
+// patterns and returns it lower-cased with the spaces removed. Each pattern is
+// a full type ("image/png") or a prefix ending in "*" ("image/*",
+// "application/vnd.*", "*/*"). An empty filter matches everything.
+func normalizeContentTypeFilter(filter string) (string, bool) {
+	if len(filter) > 256 {
+		return "", false
+	}
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return "", true
+	}
+
+	patterns := strings.Split(strings.ToLower(filter), ",")
+	for i, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if !isValidContentTypePattern(pattern) {
+			return "", false
+		}
+		patterns[i] = pattern
+	}
+	return strings.Join(patterns, ","), true
+}
+
+func isValidContentTypePattern(pattern string) bool {
+	mainType, subType, ok := strings.Cut(pattern, "/")
+	if !ok || mainType == "" || subType == "" {
+		return false
+	}
+	// "*" only as the whole main type ("*/*") or at the end of the subtype
+	if mainType == "*" {
+		return subType == "*"
+	}
+	subType = strings.TrimSuffix(subType, "*")
+	return isMediaTypeToken(mainType) && (subType == "" || isMediaTypeToken(subType))
+}
+
+// isMediaTypeToken accepts the characters RFC 6838 allows in type names
+func isMediaTypeToken(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$&-^_.+", r):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// matchesContentType reports whether contentType matches any pattern of a
+// normalized filter. Parameters such as "; charset=utf-8" are ignored.
+func matchesContentType(filter, contentType string) bool {
+	if filter == "" {
+		return true
+	}
+
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	for _, pattern := range strings.Split(filter, ",") {
+		if pattern == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(contentType, prefix) {
+				return true
+			}
+		} else if contentType == pattern {
+			return true
+		}
+	}
+	return false
+}
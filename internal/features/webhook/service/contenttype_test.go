@@ -0,0 +1,65 @@
+package service
+
+import "testing"
+
+func TestNormalizeContentTypeFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+		wantOK bool
+	}{
+		{"", "", true},
+		{"  ", "", true},
+		{"image/png", "image/png", true},
+		{"Image/*, application/PDF", "image/*,application/pdf", true},
+		{"application/vnd.*", "application/vnd.*", true},
+		{"*/*", "*/*", true},
+		{"image", "", false},
+		{"image/", "", false},
+		{"/png", "", false},
+		{"*/png", "", false},
+		{"image/*png", "", false},
+		{"im*ge/png", "", false},
+		{"image/png,", "", false},
+		{"image/p ng", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := normalizeContentTypeFilter(tt.filter)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("normalizeContentTypeFilter(%q) = %q, %v, want %q, %v", tt.filter, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestMatchesContentType(t *testing.T) {
+	tests := []struct {
+		filter      string
+		contentType string
+		want        bool
+	}{
+		{"", "anything/at-all", true},
+		{"image/png", "image/png", true},
+		{"image/png", "IMAGE/PNG", true},
+		{"image/png", "image/png; charset=binary", true},
+		{"image/png", "image/pngx", false},
+		{"image/png", "image/jpeg", false},
+		{"image/*", "image/jpeg", true},
+		{"image/*", "image/svg+xml", true},
+		{"image/*", "video/mp4", false},
+		{"image/*", "imagex/png", false},
+		{"application/vnd.*", "application/vnd.ms-excel", true},
+		{"application/vnd.*", "application/json", false},
+		{"video/*,image/png", "image/png", true},
+		{"video/*,image/png", "video/webm", true},
+		{"video/*,image/png", "image/gif", false},
+		{"*/*", "text/plain", true},
+		{"*/*", "application/octet-stream; q=1", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchesContentType(tt.filter, tt.contentType); got != tt.want {
+			t.Errorf("matchesContentType(%q, %q) = %v, want %v", tt.filter, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -2,14 +2,17 @@ package service
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
 )
 
 const (
@@ -18,39 +21,75 @@ const (
 
 // WebhookSender handles sending webhooks directly
 type WebhookSender struct {
-	repo       repository.WebhookRepository
-	httpClient *http.Client
+	repo            repository.WebhookRepository
+	httpClient      *http.Client
+	captureBytes    int
+	requestIDHeader string
 }
 
-func NewWebhookSender(repo repository.WebhookRepository) *WebhookSender {
+// DeliveryResult is what the receiver answered, with the body truncated to the capture size
+type DeliveryResult struct {
+	StatusCode int
+	Body       string
+}
+
+// NewWebhookSender creates a sender that keeps at most captureBytes of each
+// response body for delivery history (0 disables capture). The ID of the
+// request that triggered a delivery is sent in requestIDHeader.
+func NewWebhookSender(repo repository.WebhookRepository, captureBytes int, requestIDHeader string) *WebhookSender {
 	return &WebhookSender{
 		repo: repo,
 		httpClient: &http.Client{
 			Timeout: requestTimeout,
 		},
+		captureBytes:    captureBytes,
+		requestIDHeader: requestIDHeader,
 	}
 }
 
 // SendWebhook sends a webhook to the specified URL with headers
+// partitionKey is sent as X-Webhook-Partition-Key when non-empty
 // extraHeaders are optional headers passed at request time (e.g., from resource upload)
-func (s *WebhookSender) SendWebhook(ctx context.Context, webhook *sqlc.WebhookUrl, payload string, extraHeaders map[string]string) error {
-	// Get headers for this webhook
-	headers, err := s.repo.ListHeadersByURLID(ctx, webhook.ID)
-	if err != nil {
-		log.Printf("Error fetching webhook headers: %v", err)
-		// Continue without custom headers
+func (s *WebhookSender) SendWebhook(ctx context.Context, webhook *sqlc.WebhookUrl, payload, partitionKey string, extraHeaders map[string]string) (*DeliveryResult, error) {
+	// Get headers for this webhook; unsaved webhooks (no ID) have none
+	var headers []sqlc.WebhookHeader
+	var err error
+	if webhook.ID != "" {
+		headers, err = s.repo.ListHeadersByURLID(ctx, webhook.ID)
+		if err != nil {
+			log.Printf("Error fetching webhook headers: %v", err)
+			// Continue without custom headers
+		}
+	}
+
+	body := []byte(payload)
+	if webhook.CompressPayload == 1 {
+		body, err = gzipPayload(body)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create request
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewBufferString(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Set default headers
 	req.Header.Set("Content-Type", "application/json")
+	if webhook.CompressPayload == 1 {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("User-Agent", "AOUI-Drive-Webhook/1.0")
 	req.Header.Set("X-Webhook-Event", webhook.EventType)
+	req.Header.Set("X-Webhook-Payload-Version", strconv.FormatInt(payloadVersionFor(webhook), 10))
+	if partitionKey != "" {
+		req.Header.Set("X-Webhook-Partition-Key", partitionKey)
+	}
+	if id := requestid.From(ctx); id != "" && s.requestIDHeader != "" {
+		req.Header.Set(s.requestIDHeader, id)
+	}
 
 	// Add custom headers from webhook configuration
 	for _, h := range headers {
@@ -66,11 +105,17 @@ func (s *WebhookSender) SendWebhook(ctx context.Context, webhook *sqlc.WebhookUr
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		log.Printf("Webhook delivery failed for %s: %v", webhook.Url, err)
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Read and discard response body
+	result := &DeliveryResult{StatusCode: resp.StatusCode}
+
+	// Capture a bounded snippet of the response for debugging, discard the rest
+	if s.captureBytes > 0 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, int64(s.captureBytes)))
+		result.Body = string(snippet)
+	}
 	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -79,5 +124,18 @@ func (s *WebhookSender) SendWebhook(ctx context.Context, webhook *sqlc.WebhookUr
 		log.Printf("Webhook delivery failed for %s (status: %d)", webhook.Url, resp.StatusCode)
 	}
 
-	return nil
+	return result, nil
+}
+
+// gzipPayload compresses a webhook body for receivers that opted into compression
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
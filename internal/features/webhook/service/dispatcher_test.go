@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+func TestSendWebhookCompressed(t *testing.T) {
+	payload := `{"event":"resource.new","data":"` + strings.Repeat("a", 64<<10) + `"}`
+
+	tests := []struct {
+		name     string
+		compress int64
+	}{
+		{"plain", 0},
+		{"gzip", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encoding string
+			var wireSize int
+			var body []byte
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoding = r.Header.Get("Content-Encoding")
+				raw, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("read body: %v", err)
+					return
+				}
+				wireSize = len(raw)
+
+				body = raw
+				if encoding == "gzip" {
+					zr, err := gzip.NewReader(bytes.NewReader(raw))
+					if err != nil {
+						t.Errorf("gzip reader: %v", err)
+						return
+					}
+					if body, err = io.ReadAll(zr); err != nil {
+						t.Errorf("decompress body: %v", err)
+					}
+				}
+			}))
+			defer receiver.Close()
+
+			webhook := &sqlc.WebhookUrl{Url: receiver.URL, EventType: "resource.new", CompressPayload: tt.compress}
+			if _, err := NewWebhookSender(nil, 0, "").SendWebhook(context.Background(), webhook, payload, "", nil); err != nil {
+				t.Fatalf("SendWebhook() error = %v", err)
+			}
+
+			if string(body) != payload {
+				t.Errorf("receiver got %d bytes that differ from the %d byte payload", len(body), len(payload))
+			}
+			if tt.compress == 1 {
+				if encoding != "gzip" {
+					t.Errorf("Content-Encoding = %q, want gzip", encoding)
+				}
+				if wireSize >= len(payload) {
+					t.Errorf("sent %d bytes for a %d byte payload, want it compressed", wireSize, len(payload))
+				}
+			} else if encoding != "" {
+				t.Errorf("Content-Encoding = %q, want none", encoding)
+			}
+		})
+	}
+}
+
+// TestSendWebhookCompressedResponseBounded answers with a gzip bomb: a small
+// compressed body that inflates to far more than the capture size. Only the
+// capture size is kept.
+func TestSendWebhookCompressedResponseBounded(t *testing.T) {
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zeros := make([]byte, 1<<20)
+	for range 64 {
+		zw.Write(zeros)
+	}
+	zw.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bomb.Bytes())
+	}))
+	defer receiver.Close()
+
+	const capture = 1024
+	webhook := &sqlc.WebhookUrl{Url: receiver.URL, EventType: "resource.new"}
+	result, err := NewWebhookSender(nil, capture, "").SendWebhook(context.Background(), webhook, `{}`, "", nil)
+	if err != nil {
+		t.Fatalf("SendWebhook() error = %v", err)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", result.StatusCode, http.StatusOK)
+	}
+	if len(result.Body) != capture || strings.Trim(result.Body, "\x00") != "" {
+		t.Errorf("captured %d bytes, want %d decompressed zero bytes", len(result.Body), capture)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+)
+
+// DownloadSigner replaces resource_url with a presigned share link for
+// webhooks with include_download_token, so receivers can fetch resources of
+// private buckets without credentials. Links are signed when each attempt is
+// sent, so a retried delivery never carries a link that expired while it
+// waited.
+type DownloadSigner struct {
+	signer    *presign.Signer
+	publicURL string
+	ttl       time.Duration
+}
+
+// NewDownloadSigner creates a signer whose links expire after ttl, clamped to
+// the presign limits
+func NewDownloadSigner(signer *presign.Signer, publicURL string, ttl time.Duration) *DownloadSigner {
+	return &DownloadSigner{signer: signer, publicURL: publicURL, ttl: ttl}
+}
+
+// sign returns a copy of the payload with a presigned resource_url, or nil
+// when the event needs none: public buckets already have a public link and
+// deleted resources cannot be downloaded.
+func (d *DownloadSigner) sign(bucket *sqlc.Bucket, p *dto.WebhookPayload) *dto.WebhookPayload {
+	if d == nil || bucket.IsPublic == 1 || p.Event != dto.EventResourceNew {
+		return nil
+	}
+
+	expires, signature := d.signer.Sign(bucket.ID, p.Resource.Hash, d.ttl)
+	expiresAt := time.Unix(expires, 0).UTC()
+
+	signed := *p
+	signed.ResourceURL = presign.ShareURL(d.publicURL, bucket.ID, p.Resource.Hash, p.Resource.Extension, expires, signature)
+	signed.ResourceURLExpiresAt = &expiresAt
+	return &signed
+}
+
+// resign signs resource_url again in a recorded payload before it is retried,
+// keeping the webhook's payload version. Payloads that carry no link, or
+// cannot be read back, are sent as recorded.
+func (d *DownloadSigner) resign(webhook *sqlc.WebhookUrl, bucket *sqlc.Bucket, payload string) string {
+	if d == nil || webhook.IncludeDownloadToken != 1 {
+		return payload
+	}
+
+	var data dto.WebhookPayload
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		return payload
+	}
+	signed := d.sign(bucket, &data)
+	if signed == nil {
+		return payload
+	}
+	encoded, err := encodePayload(signed, payloadVersionFor(webhook))
+	if err != nil {
+		log.Printf("Error encoding payload for webhook %s: %v", webhook.ID, err)
+		return payload
+	}
+	return string(encoded)
+}
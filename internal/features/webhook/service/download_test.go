@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	resourcecontroller "github.com/aouiniamine/aoui-drive/internal/features/resource/controller"
+	resourcerepo "github.com/aouiniamine/aoui-drive/internal/features/resource/repository"
+	resourceservice "github.com/aouiniamine/aoui-drive/internal/features/resource/service"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/internal/storage"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
+	"github.com/labstack/echo/v4"
+)
+
+// TestDownloadLinkExpiry signs resource_url for one second: the link works,
+// then /share refuses it once it expires, and a retry of the delivery sends a
+// fresh link that works again
+func TestDownloadLinkExpiry(t *testing.T) {
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	layout, err := storage.NewLayout(t.TempDir(), storage.LayoutFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(layout.BucketDir(client.ID, bucket.ID), 0755); err != nil {
+		t.Fatal(err)
+	}
+	signer := presign.New("secret", time.Hour, time.Hour)
+	resources := resourceservice.New(resourcerepo.New(db.DB, db.Queries), bucketrepo.New(db.Queries), nil, nil, resourceservice.Options{
+		Layout:  layout,
+		TempDir: t.TempDir(),
+		Signer:  signer,
+	})
+	resource, err := resources.UploadStream(context.Background(), client.ID, bucket.ID, "text/plain", ".txt", "", "", strings.NewReader("private content"), nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("UploadStream() error = %v", err)
+	}
+	e := echo.New()
+	resourcecontroller.New(resources, pagination.Limits{DefaultPerPage: 20, MaxPerPage: 100}, false).RegisterShareRoutes(e.Group("/share"))
+	share := func(link string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, link, nil))
+		return rec.Code
+	}
+
+	downloads := NewDownloadSigner(signer, "", time.Second)
+	payload := &dto.WebhookPayload{
+		Event:    dto.EventResourceNew,
+		BucketID: bucket.ID,
+		Resource: dto.ResourcePayload{Hash: resource.Hash, Extension: resource.Extension},
+	}
+	before := time.Now().Truncate(time.Second)
+	signed := downloads.sign(&bucket, payload)
+	if signed == nil || signed.ResourceURLExpiresAt == nil {
+		t.Fatal("sign() set no resource_url_expires_at")
+	}
+	expiresAt := *signed.ResourceURLExpiresAt
+	if expiresAt.Before(before.Add(time.Second)) || expiresAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("resource_url_expires_at = %v, want one second from %v", expiresAt, before)
+	}
+	if got := linkExpiry(t, signed.ResourceURL); got != expiresAt.Unix() {
+		t.Errorf("resource_url expires=%d, want resource_url_expires_at %d", got, expiresAt.Unix())
+	}
+	if code := share(signed.ResourceURL); code != http.StatusOK {
+		t.Fatalf("fresh link status = %d, want %d", code, http.StatusOK)
+	}
+
+	time.Sleep(time.Until(expiresAt.Add(time.Second)))
+	if code := share(signed.ResourceURL); code != http.StatusForbidden {
+		t.Errorf("expired link status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// A retry of the recorded delivery carries a new link
+	received := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+	repo := repository.New(db.Queries)
+	ctx := context.Background()
+	webhook, err := repo.CreateURL(ctx, sqlc.CreateWebhookURLParams{
+		ID: "webhook-1", BucketID: bucket.ID, Url: receiver.URL, EventType: dto.EventResourceNew, IsActive: 1,
+		IncludeDownloadToken: 1,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+	recorded, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := repo.CreateEvent(ctx, sqlc.CreateWebhookEventParams{
+		ID: "event-1", WebhookUrlID: webhook.ID, BucketID: bucket.ID, ResourceID: resource.ID,
+		EventType: dto.EventResourceNew, Payload: string(recorded), MaxAttempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("CreateEvent() error = %v", err)
+	}
+	worker := NewRetryWorker(repo, bucketrepo.New(db.Queries), NewWebhookSender(repo, 0, ""), nil, RetryPolicy{MaxAttempts: 3, Backoff: time.Second}, downloads, RetryWorkerConfig{})
+	worker.deliver(ctx, event)
+
+	var retried dto.WebhookPayload
+	if err := json.Unmarshal(<-received, &retried); err != nil {
+		t.Fatalf("decode retried payload: %v", err)
+	}
+	if retried.ResourceURLExpiresAt == nil || !retried.ResourceURLExpiresAt.After(expiresAt) {
+		t.Errorf("retried resource_url_expires_at = %v, want after %v", retried.ResourceURLExpiresAt, expiresAt)
+	}
+	if code := share(retried.ResourceURL); code != http.StatusOK {
+		t.Errorf("retried link status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+// linkExpiry returns the expires parameter of a share link
+func linkExpiry(t *testing.T, link string) int64 {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("expires of %s: %v", link, err)
+	}
+	return expires
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	deliveryChannelPrefix = "aoui-drive:webhook-deliveries:"
+
+	// subscriberBuffer is how many results a slow stream may fall behind
+	// before further results are dropped for it
+	subscriberBuffer = 32
+)
+
+// DeliveryFeed fans delivery results out to live subscribers, e.g. the SSE
+// event stream. Publishing never blocks on subscribers: results a subscriber
+// is too slow to take are dropped for it.
+type DeliveryFeed interface {
+	Publish(ctx context.Context, event dto.WebhookEventResponse)
+	// Subscribe returns results for one webhook until cancel is called
+	Subscribe(ctx context.Context, webhookID string) (events <-chan dto.WebhookEventResponse, cancel func(), err error)
+}
+
+var (
+	_ DeliveryFeed = (*MemoryDeliveryFeed)(nil)
+	_ DeliveryFeed = (*RedisDeliveryFeed)(nil)
+)
+
+// MemoryDeliveryFeed is an in-process DeliveryFeed. Subscribers only see
+// deliveries made by this instance.
+type MemoryDeliveryFeed struct {
+	mu   sync.Mutex
+	subs map[string]map[chan dto.WebhookEventResponse]struct{}
+}
+
+func NewMemoryDeliveryFeed() *MemoryDeliveryFeed {
+	return &MemoryDeliveryFeed{
+		subs: make(map[string]map[chan dto.WebhookEventResponse]struct{}),
+	}
+}
+
+func (f *MemoryDeliveryFeed) Publish(ctx context.Context, event dto.WebhookEventResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs[event.WebhookURLID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (f *MemoryDeliveryFeed) Subscribe(ctx context.Context, webhookID string) (<-chan dto.WebhookEventResponse, func(), error) {
+	ch := make(chan dto.WebhookEventResponse, subscriberBuffer)
+
+	f.mu.Lock()
+	if f.subs[webhookID] == nil {
+		f.subs[webhookID] = make(map[chan dto.WebhookEventResponse]struct{})
+	}
+	f.subs[webhookID][ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.subs[webhookID], ch)
+			if len(f.subs[webhookID]) == 0 {
+				delete(f.subs, webhookID)
+			}
+			close(ch)
+		})
+	}
+	return ch, cancel, nil
+}
+
+// RedisDeliveryFeed publishes results on a Redis pub/sub channel per webhook,
+// so a stream sees deliveries made by every instance, including retries run
+// by another instance's worker.
+type RedisDeliveryFeed struct {
+	client *redis.Client
+}
+
+func NewRedisDeliveryFeed(client *redis.Client) *RedisDeliveryFeed {
+	return &RedisDeliveryFeed{client: client}
+}
+
+func (f *RedisDeliveryFeed) Publish(ctx context.Context, event dto.WebhookEventResponse) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := f.client.Publish(ctx, deliveryChannelPrefix+event.WebhookURLID, data).Err(); err != nil {
+		log.Printf("Error publishing delivery of webhook event %s: %v", event.ID, err)
+	}
+}
+
+func (f *RedisDeliveryFeed) Subscribe(ctx context.Context, webhookID string) (<-chan dto.WebhookEventResponse, func(), error) {
+	pubsub := f.client.Subscribe(ctx, deliveryChannelPrefix+webhookID)
+	// Wait for the subscription to be confirmed so no result published after
+	// Subscribe returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, nil, err
+	}
+
+	ch := make(chan dto.WebhookEventResponse, subscriberBuffer)
+	go func() {
+		defer close(ch)
+		for msg := range pubsub.Channel() {
+			var event dto.WebhookEventResponse
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue
+			}
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			pubsub.Close()
+		})
+	}
+	return ch, cancel, nil
+}
+
+// eventResponse converts a stored delivery record to its API form
+func eventResponse(e *sqlc.WebhookEvent) dto.WebhookEventResponse {
+	event := dto.WebhookEventResponse{
+		ID:           e.ID,
+		WebhookURLID: e.WebhookUrlID,
+		BucketID:     e.BucketID,
+		ResourceID:   e.ResourceID,
+		EventType:    e.EventType,
+		Status:       e.Status,
+		ResponseBody: e.ResponseBody.String,
+		Attempts:     e.Attempts,
+		MaxAttempts:  e.MaxAttempts,
+		CreatedAt:    e.CreatedAt.Time,
+	}
+	if e.ResponseCode.Valid {
+		event.ResponseCode = &e.ResponseCode.Int64
+	}
+	if e.NextRetryAt.Valid {
+		event.NextRetryAt = &e.NextRetryAt.Time
+	}
+	if e.CompletedAt.Valid {
+		event.CompletedAt = &e.CompletedAt.Time
+	}
+	return event
+}
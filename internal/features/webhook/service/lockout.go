@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+// LockoutNotifier posts login lockouts to a single security webhook, outside
+// of any bucket. Deliveries are attempted once and not recorded.
+type LockoutNotifier struct {
+	sender  *WebhookSender
+	webhook *sqlc.WebhookUrl
+}
+
+func NewLockoutNotifier(sender *WebhookSender, url string) *LockoutNotifier {
+	return &LockoutNotifier{
+		sender: sender,
+		webhook: &sqlc.WebhookUrl{
+			Url:            url,
+			EventType:      dto.EventLoginLocked,
+			PayloadVersion: dto.LatestPayloadVersion,
+		},
+	}
+}
+
+func (n *LockoutNotifier) NotifyLockout(ctx context.Context, accessKey, ip string, attempts int) {
+	payload, err := json.Marshal(dto.LockoutPayload{
+		Event:     dto.EventLoginLocked,
+		Timestamp: time.Now().UTC(),
+		AccessKey: accessKey,
+		IP:        ip,
+		Attempts:  attempts,
+	})
+	if err != nil {
+		log.Printf("Error encoding lockout notification: %v", err)
+		return
+	}
+
+	// SendWebhook logs the outcome
+	n.sender.SendWebhook(ctx, n.webhook, string(payload), "", nil)
+}
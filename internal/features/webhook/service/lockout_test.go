@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+func TestNotifyLockout(t *testing.T) {
+	received := make(chan dto.LockoutPayload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload dto.LockoutPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	notifier := NewLockoutNotifier(NewWebhookSender(nil, 0, ""), receiver.URL)
+	notifier.NotifyLockout(context.Background(), "AKEXAMPLE", "192.0.2.1", 5)
+
+	got := <-received
+	if got.Event != dto.EventLoginLocked || got.AccessKey != "AKEXAMPLE" || got.IP != "192.0.2.1" || got.Attempts != 5 {
+		t.Errorf("payload = %+v, want a %s event for AKEXAMPLE from 192.0.2.1 after 5 attempts", got, dto.EventLoginLocked)
+	}
+	if got.Timestamp.IsZero() {
+		t.Error("payload has no timestamp")
+	}
+}
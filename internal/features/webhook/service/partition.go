@@ -0,0 +1,47 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// partitionPlaceholders are the values a partition key template may reference
+var partitionPlaceholders = map[string]bool{
+	"{bucket}":      true,
+	"{bucket_name}": true,
+	"{event}":       true,
+	"{hash}":        true,
+	"{resource}":    true,
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// isValidPartitionKeyTemplate accepts empty templates (no header) and templates
+// whose placeholders are all known, e.g. "{bucket}" or "{bucket}:{hash}"
+func isValidPartitionKeyTemplate(template string) bool {
+	if len(template) > 256 {
+		return false
+	}
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		if !partitionPlaceholders[p] {
+			return false
+		}
+	}
+	// Unbalanced braces are most likely a typo
+	stripped := placeholderPattern.ReplaceAllString(template, "")
+	return !strings.ContainsAny(stripped, "{}")
+}
+
+// renderPartitionKey fills a template with the event's values
+func renderPartitionKey(template string, e *Event) string {
+	if template == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		"{bucket}", e.Bucket.ID,
+		"{bucket_name}", e.Bucket.Name,
+		"{event}", e.Type,
+		"{hash}", e.Resource.Hash,
+		"{resource}", e.Resource.ID,
+	).Replace(template)
+}
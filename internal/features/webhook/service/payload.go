@@ -0,0 +1,43 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+// payloadEncoders serialize a WebhookPayload in each supported schema version.
+// When the payload shape changes, bump dto.LatestPayloadVersion and add an
+// encoder for it; older encoders stay so pinned webhooks keep their shape.
+var payloadEncoders = map[int64]func(p *dto.WebhookPayload) ([]byte, error){
+	1: func(p *dto.WebhookPayload) ([]byte, error) {
+		return json.Marshal(p)
+	},
+}
+
+func encodePayload(p *dto.WebhookPayload, version int64) ([]byte, error) {
+	encode, ok := payloadEncoders[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload version %d", version)
+	}
+	return encode(p)
+}
+
+// isSupportedPayloadVersion accepts 0 (follow the latest) and any version with an encoder
+func isSupportedPayloadVersion(version int64) bool {
+	if version == 0 {
+		return true
+	}
+	_, ok := payloadEncoders[version]
+	return ok
+}
+
+// payloadVersionFor returns the version a webhook receives
+func payloadVersionFor(webhook *sqlc.WebhookUrl) int64 {
+	if webhook.PayloadVersion > 0 {
+		return webhook.PayloadVersion
+	}
+	return dto.LatestPayloadVersion
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+)
+
+// payloadShapes is the body each payload version gives testPayload. A version
+// keeps its shape for as long as it is supported.
+var payloadShapes = map[int64]string{
+	1: `{"event":"resource.new","timestamp":"2025-12-23T10:30:00Z","bucket_id":"bucket-1","bucket_name":"photos",` +
+		`"resource_id":"resource-1","resource_url":"https://drive.example.com/resources/bucket-1/abc.png",` +
+		`"resource":{"hash":"abc","size":3,"content_type":"image/png","extension":".png","metadata":{"camera":"x100"}},` +
+		`"request_id":"request-1"}`,
+}
+
+var testPayload = &dto.WebhookPayload{
+	Event:       dto.EventResourceNew,
+	Timestamp:   time.Date(2025, 12, 23, 10, 30, 0, 0, time.UTC),
+	BucketID:    "bucket-1",
+	BucketName:  "photos",
+	ResourceID:  "resource-1",
+	ResourceURL: "https://drive.example.com/resources/bucket-1/abc.png",
+	Resource: dto.ResourcePayload{
+		Hash:        "abc",
+		Size:        3,
+		ContentType: "image/png",
+		Extension:   ".png",
+		Metadata:    map[string]string{"camera": "x100"},
+	},
+	RequestID: "request-1",
+}
+
+func TestPayloadVersions(t *testing.T) {
+	if len(payloadShapes) != len(payloadEncoders) {
+		t.Fatalf("%d payload shapes for %d versions, want one per version", len(payloadShapes), len(payloadEncoders))
+	}
+	if _, ok := payloadShapes[dto.LatestPayloadVersion]; !ok {
+		t.Fatalf("no payload shape for the latest version %d", dto.LatestPayloadVersion)
+	}
+
+	type delivery struct {
+		version string
+		body    string
+	}
+	received := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{r.Header.Get("X-Webhook-Payload-Version"), string(body)}
+	}))
+	defer receiver.Close()
+
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	repo := repository.New(db.Queries)
+	publisher := NewWebhookPublisher(repo, NewWebhookSender(repo, 0, ""), nil, RetryPolicy{MaxAttempts: 1}, nil, 0).(*webhookPublisher)
+	latest, err := encodePayload(testPayload, dto.LatestPayloadVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &Event{
+		Type:     dto.EventResourceNew,
+		Bucket:   &bucket,
+		Resource: &sqlc.Resource{ID: "resource-1", BucketID: bucket.ID},
+		Data:     testPayload,
+		Payload:  latest,
+	}
+
+	// Unpinned webhooks follow the latest version; pinned ones keep theirs
+	pins := []int64{0}
+	for version := range payloadEncoders {
+		pins = append(pins, version)
+	}
+	for _, pinned := range pins {
+		want := pinned
+		if want == 0 {
+			want = dto.LatestPayloadVersion
+		}
+		webhook, err := repo.CreateURL(context.Background(), sqlc.CreateWebhookURLParams{
+			ID: "webhook-" + strconv.FormatInt(pinned, 10), BucketID: bucket.ID, Url: receiver.URL + "/" + strconv.FormatInt(pinned, 10),
+			EventType: dto.EventResourceNew, IsActive: 1, PayloadVersion: pinned,
+		})
+		if err != nil {
+			t.Fatalf("CreateURL() error = %v", err)
+		}
+
+		publisher.deliver(context.Background(), webhook, event)
+		got := <-received
+		if got.version != strconv.FormatInt(want, 10) {
+			t.Errorf("pinned %d: X-Webhook-Payload-Version = %s, want %d", pinned, got.version, want)
+		}
+		if got.body != payloadShapes[want] {
+			t.Errorf("pinned %d: body = %s, want %s", pinned, got.body, payloadShapes[want])
+		}
+	}
+}
+
+func TestUnsupportedPayloadVersion(t *testing.T) {
+	for _, version := range []int64{-1, dto.LatestPayloadVersion + 1} {
+		if isSupportedPayloadVersion(version) {
+			t.Errorf("isSupportedPayloadVersion(%d) = true, want false", version)
+		}
+		if _, err := encodePayload(testPayload, version); err == nil {
+			t.Errorf("encodePayload(%d) error = nil, want an error", version)
+		}
+	}
+}
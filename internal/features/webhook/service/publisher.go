@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Event is a bucket event ready for delivery. Payload is Data serialized
+// in the latest payload version.
+type Event struct {
+	Type         string
+	Bucket       *sqlc.Bucket
+	Resource     *sqlc.Resource
+	Data         *dto.WebhookPayload
+	Payload      []byte
+	ExtraHeaders map[string]string
+}
+
+// EventPublisher delivers an event to one backend.
+// HTTP webhooks and queue publishers implement it so they can run side by side.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// webhookPublisher sends events to the bucket's active webhook URLs over HTTP
+type webhookPublisher struct {
+	repo   repository.WebhookRepository
+	sender *WebhookSender
+	feed   DeliveryFeed
+	policy RetryPolicy
+	// downloads presigns resource_url for webhooks that ask for it
+	downloads *DownloadSigner
+	// maxPending caps the pending and retrying events; 0 is unlimited
+	maxPending int64
+	// shed counts deliveries refused at the cap since startup
+	shed atomic.Int64
+}
+
+// NewWebhookPublisher creates the HTTP publisher. Each delivery is recorded as a
+// webhook event and attempted right away; failed attempts are left to the
+// RetryWorker according to policy. Results are published to feed. Once
+// maxPending events are pending or retrying, new deliveries are refused
+// (0 disables the cap).
+func NewWebhookPublisher(repo repository.WebhookRepository, sender *WebhookSender, feed DeliveryFeed, policy RetryPolicy, downloads *DownloadSigner, maxPending int64) EventPublisher {
+	return &webhookPublisher{
+		repo:       repo,
+		sender:     sender,
+		feed:       feed,
+		policy:     policy,
+		downloads:  downloads,
+		maxPending: maxPending,
+	}
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, event *Event) error {
+	webhooks, err := p.repo.ListActiveURLsByBucketAndEvent(ctx, event.Bucket.ID, event.Type)
+	if err != nil {
+		return err
+	}
+
+	matched := webhooks[:0]
+	for _, webhook := range webhooks {
+		if matchesContentType(webhook.ContentTypeFilter, event.Resource.ContentType) {
+			matched = append(matched, webhook)
+		}
+	}
+	if len(matched) == 0 || p.atCapacity(ctx, event, len(matched)) {
+		return nil
+	}
+
+	// Send webhook to each URL directly (fire and forget)
+	for _, webhook := range matched {
+		go func(w sqlc.WebhookUrl) {
+			p.deliver(ctx, &w, event)
+		}(webhook)
+	}
+
+	return nil
+}
+
+// atCapacity reports whether the backlog has reached maxPending, in which
+// case the event's deliveries are shed: neither recorded nor sent. A
+// persistently failing receiver would otherwise grow the events table
+// without bound. The check is not atomic with recording, so concurrent
+// events may overshoot the cap slightly.
+func (p *webhookPublisher) atCapacity(ctx context.Context, event *Event, deliveries int) bool {
+	if p.maxPending <= 0 {
+		return false
+	}
+	pending, err := p.repo.CountPendingEvents(ctx)
+	if err != nil {
+		log.Printf("Error counting pending webhook events: %v", err)
+		return false
+	}
+	if pending < p.maxPending {
+		return false
+	}
+	shed := p.shed.Add(int64(deliveries))
+	log.Printf("Webhook backlog at cap (%d pending, max %d): shed %d %s deliveries for bucket %s, %d shed since startup",
+		pending, p.maxPending, deliveries, event.Type, event.Bucket.ID, shed)
+	return true
+}
+
+// deliver sends one webhook and records the attempt and the receiver's answer
+func (p *webhookPublisher) deliver(ctx context.Context, webhook *sqlc.WebhookUrl, e *Event) {
+	// Webhooks pinned to an older version get the payload in that shape, and
+	// webhooks with include_download_token get a presigned resource_url
+	body := e.Payload
+	data := e.Data
+	if webhook.IncludeDownloadToken == 1 {
+		if signed := p.downloads.sign(e.Bucket, e.Data); signed != nil {
+			data = signed
+		}
+	}
+	if version := payloadVersionFor(webhook); version != dto.LatestPayloadVersion || data != e.Data {
+		encoded, err := encodePayload(data, version)
+		if err != nil {
+			log.Printf("Error encoding payload for webhook %s: %v", webhook.ID, err)
+			return
+		}
+		body = encoded
+	}
+	payload := string(body)
+	partitionKey := renderPartitionKey(webhook.PartitionKeyTemplate, e)
+	policy := p.policy.forWebhook(webhook)
+
+	record, err := p.repo.CreateEvent(ctx, sqlc.CreateWebhookEventParams{
+		ID:           uuid.New().String(),
+		WebhookUrlID: webhook.ID,
+		BucketID:     webhook.BucketID,
+		ResourceID:   e.Resource.ID,
+		EventType:    webhook.EventType,
+		Payload:      payload,
+		MaxAttempts:  policy.MaxAttempts,
+		PartitionKey: partitionKey,
+		RequestID:    requestid.From(ctx),
+	})
+	if err != nil {
+		log.Printf("Error recording webhook event: %v", err)
+	}
+
+	// Claim the event before sending so a retry worker polling at the same
+	// moment does not deliver it too
+	if record != nil {
+		claimed, err := p.repo.ClaimEvent(ctx, record.ID)
+		if err != nil {
+			log.Printf("Error claiming webhook event %s: %v", record.ID, err)
+			return
+		}
+		if !claimed {
+			return
+		}
+	}
+
+	sent := time.Now()
+	result, sendErr := p.sender.SendWebhook(ctx, webhook, payload, partitionKey, e.ExtraHeaders)
+	if record == nil {
+		return
+	}
+
+	completeEvent(ctx, p.repo, p.feed, policy, record, result, sendErr, time.Since(sent))
+}
+
+// redisStreamPublisher appends events to a per-bucket Redis Stream
+type redisStreamPublisher struct {
+	client *redis.Client
+	prefix string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(client *redis.Client, prefix string, maxLen int64) EventPublisher {
+	return &redisStreamPublisher{
+		client: client,
+		prefix: prefix,
+		maxLen: maxLen,
+	}
+}
+
+func (p *redisStreamPublisher) Publish(ctx context.Context, event *Event) error {
+	stream := p.prefix + event.Bucket.ID
+	err := p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event":           event.Type,
+			"bucket_id":       event.Bucket.ID,
+			"payload":         string(event.Payload),
+			"payload_version": dto.LatestPayloadVersion,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("stream %s: %w", stream, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+)
+
+// waitForAttempts waits until the asynchronous deliveries of Publish have
+// made one attempt at each of want events in the bucket
+func waitForAttempts(t *testing.T, repo repository.WebhookRepository, bucketID string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, err := repo.ListEventsByBucketID(context.Background(), bucketID, 100, 0)
+		if err != nil {
+			t.Fatalf("ListEventsByBucketID() error = %v", err)
+		}
+		attempted := 0
+		for _, e := range events {
+			if e.Attempts > 0 {
+				attempted++
+			}
+		}
+		if attempted == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events attempted, want %d", attempted, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPublishShedsAtMaxPending publishes to two webhooks of a failing
+// receiver, so every delivery stays in the backlog, with a cap of two events
+func TestPublishShedsAtMaxPending(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	repo, _, webhook, _ := retryFixture(t, receiver.URL+"/first")
+	ctx := context.Background()
+	if _, err := repo.CreateURL(ctx, sqlc.CreateWebhookURLParams{
+		ID: "webhook-2", BucketID: webhook.BucketID, Url: receiver.URL + "/second", EventType: dto.EventResourceNew, IsActive: 1,
+	}); err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}
+	publisher := NewWebhookPublisher(repo, NewWebhookSender(repo, 0, ""), nil, policy, nil, 2).(*webhookPublisher)
+	event := &Event{
+		Type:     dto.EventResourceNew,
+		Bucket:   &sqlc.Bucket{ID: webhook.BucketID},
+		Resource: &sqlc.Resource{ID: "resource-1", BucketID: webhook.BucketID, ContentType: "image/png"},
+		Payload:  []byte(`{}`),
+	}
+
+	// Below the cap both deliveries are recorded and left to retry
+	if err := publisher.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitForAttempts(t, repo, webhook.BucketID, 2)
+	if n := publisher.shed.Load(); n != 0 {
+		t.Errorf("%d deliveries shed below the cap, want 0", n)
+	}
+
+	// At the cap each event's deliveries are counted as shed and not recorded
+	for i := 1; i <= 2; i++ {
+		if err := publisher.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		if n := publisher.shed.Load(); n != int64(2*i) {
+			t.Errorf("after %d events at the cap, %d deliveries shed, want %d", i, n, 2*i)
+		}
+	}
+	total, err := repo.CountEventsByBucketID(ctx, webhook.BucketID)
+	if err != nil {
+		t.Fatalf("CountEventsByBucketID() error = %v", err)
+	}
+	if total != 2 {
+		t.Errorf("%d events recorded, want 2", total)
+	}
+
+	// Without a cap nothing is shed
+	unlimited := NewWebhookPublisher(repo, NewWebhookSender(repo, 0, ""), nil, policy, nil, 0).(*webhookPublisher)
+	if err := unlimited.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	waitForAttempts(t, repo, webhook.BucketID, 4)
+	if n := unlimited.shed.Load(); n != 0 {
+		t.Errorf("%d deliveries shed without a cap, want 0", n)
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
+)
+
+const (
+	// maxRetryBackoff caps the exponential delay between delivery attempts
+	maxRetryBackoff = time.Hour
+
+	// maxWebhookAttempts caps a webhook's own max_attempts
+	maxWebhookAttempts = 20
+
+	defaultRetryConcurrency  = 4
+	defaultRetryBatchSize    = 50
+	defaultRetryPollInterval = 5 * time.Second
+	defaultClaimTimeout      = 5 * time.Minute
+)
+
+// RetryPolicy decides how often a failed webhook delivery is attempted again.
+// Backoff is the delay before the first retry and doubles for every retry after it.
+type RetryPolicy struct {
+	MaxAttempts int64
+	Backoff     time.Duration
+}
+
+// delay returns how long to wait after the given (1-based) failed attempt
+func (p RetryPolicy) delay(attempt int64) time.Duration {
+	d := p.Backoff
+	for i := int64(1); i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
+
+// forWebhook returns the policy with the webhook's max_attempts and
+// retry_backoff_seconds applied. Zero keeps the global value.
+func (p RetryPolicy) forWebhook(webhook *sqlc.WebhookUrl) RetryPolicy {
+	if webhook.MaxAttempts > 0 {
+		p.MaxAttempts = webhook.MaxAttempts
+	}
+	if webhook.RetryBackoffSeconds > 0 {
+		p.Backoff = time.Duration(webhook.RetryBackoffSeconds) * time.Second
+	}
+	return p
+}
+
+// isValidRetryPolicy checks a webhook's retry overrides. Zero means the
+// global value; the backoff cannot exceed maxRetryBackoff.
+func isValidRetryPolicy(maxAttempts, backoffSeconds int64) bool {
+	return maxAttempts >= 0 && maxAttempts <= maxWebhookAttempts &&
+		backoffSeconds >= 0 && backoffSeconds <= int64(maxRetryBackoff/time.Second)
+}
+
+// completeEvent records the outcome of one delivery attempt, which took
+// latency, and publishes it to feed. Failed attempts are scheduled for retry
+// until the event's max_attempts is reached.
+func completeEvent(ctx context.Context, repo repository.WebhookRepository, feed DeliveryFeed, policy RetryPolicy, event *sqlc.WebhookEvent, result *DeliveryResult, sendErr error, latency time.Duration) {
+	now := time.Now().UTC()
+	attempt := event.Attempts + 1
+
+	params := sqlc.UpdateWebhookEventStatusParams{
+		Status:    dto.StatusFailed,
+		LatencyMs: latency.Milliseconds(),
+		ID:        event.ID,
+	}
+	if sendErr != nil {
+		params.ResponseBody = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	if result != nil {
+		params.ResponseCode = sql.NullInt64{Int64: int64(result.StatusCode), Valid: true}
+		params.ResponseBody = sql.NullString{String: result.Body, Valid: result.Body != ""}
+		if result.StatusCode >= 200 && result.StatusCode < 300 {
+			params.Status = dto.StatusSuccess
+		}
+	}
+
+	if params.Status == dto.StatusFailed && attempt < event.MaxAttempts {
+		params.Status = dto.StatusRetrying
+		params.NextRetryAt = sql.NullTime{Time: now.Add(policy.delay(attempt)), Valid: true}
+	} else {
+		params.CompletedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	if err := repo.UpdateEventStatus(ctx, params); err != nil {
+		log.Printf("Error updating webhook event %s: %v", event.ID, err)
+		return
+	}
+	publishUpdate(ctx, feed, event, params)
+}
+
+// publishUpdate sends the event as it now stands in the database to feed
+func publishUpdate(ctx context.Context, feed DeliveryFeed, event *sqlc.WebhookEvent, params sqlc.UpdateWebhookEventStatusParams) {
+	if feed == nil {
+		return
+	}
+	updated := *event
+	updated.Status = params.Status
+	updated.ResponseCode = params.ResponseCode
+	updated.ResponseBody = params.ResponseBody
+	updated.Attempts++
+	updated.LatencyMs += params.LatencyMs
+	updated.NextRetryAt = params.NextRetryAt
+	updated.CompletedAt = params.CompletedAt
+	feed.Publish(ctx, eventResponse(&updated))
+}
+
+// RetryWorkerConfig controls how the retry worker claims and delivers events
+type RetryWorkerConfig struct {
+	// Concurrency is how many deliveries run in parallel
+	Concurrency int
+	// BatchSize is how many due events are claimed per poll
+	BatchSize int
+	// PollInterval is how often the worker looks for due events
+	PollInterval time.Duration
+	// ClaimTimeout is how long a claimed event may stay in processing before
+	// another worker takes it over, e.g. after a crash mid-delivery
+	ClaimTimeout time.Duration
+}
+
+// RetryWorker delivers pending and retrying webhook events. Events are claimed
+// in the database before delivery, so several workers or instances can share
+// the events table without delivering an event twice.
+type RetryWorker struct {
+	repo       repository.WebhookRepository
+	bucketRepo bucketrepo.BucketRepository
+	sender     *WebhookSender
+	feed       DeliveryFeed
+	policy     RetryPolicy
+	// downloads presigns resource_url again for each retry
+	downloads *DownloadSigner
+	cfg       RetryWorkerConfig
+}
+
+func NewRetryWorker(repo repository.WebhookRepository, bucketRepo bucketrepo.BucketRepository, sender *WebhookSender, feed DeliveryFeed, policy RetryPolicy, downloads *DownloadSigner, cfg RetryWorkerConfig) *RetryWorker {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultRetryConcurrency
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultRetryBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultRetryPollInterval
+	}
+	if cfg.ClaimTimeout <= 0 {
+		cfg.ClaimTimeout = defaultClaimTimeout
+	}
+	return &RetryWorker{
+		repo:       repo,
+		bucketRepo: bucketRepo,
+		sender:     sender,
+		feed:       feed,
+		policy:     policy,
+		downloads:  downloads,
+		cfg:        cfg,
+	}
+}
+
+// Run polls for due events until ctx is cancelled. Full batches are drained
+// immediately instead of waiting for the next poll.
+func (w *RetryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			claimed, err := w.RunOnce(ctx)
+			if err != nil {
+				log.Printf("Webhook retry worker: %v", err)
+				break
+			}
+			if claimed < w.cfg.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims one batch of due events and delivers it, returning how many
+// events were claimed
+func (w *RetryWorker) RunOnce(ctx context.Context) (int, error) {
+	staleBefore := time.Now().Add(-w.cfg.ClaimTimeout)
+	events, err := w.repo.ClaimPendingEvents(ctx, int64(w.cfg.BatchSize), staleBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	slots := make(chan struct{}, w.cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := range events {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(event *sqlc.WebhookEvent) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			w.deliver(ctx, event)
+		}(&events[i])
+	}
+	wg.Wait()
+
+	return len(events), nil
+}
+
+func (w *RetryWorker) deliver(ctx context.Context, event *sqlc.WebhookEvent) {
+	webhook, err := w.repo.GetURLByID(ctx, event.WebhookUrlID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrWebhookURLNotFound) {
+			// Left claimed; it is picked up again once the claim times out
+			log.Printf("Error loading webhook %s for event %s: %v", event.WebhookUrlID, event.ID, err)
+		}
+		return
+	}
+
+	bucket, err := w.bucketRepo.GetByID(ctx, event.BucketID)
+	if err != nil {
+		log.Printf("Error loading bucket %s for event %s: %v", event.BucketID, event.ID, err)
+		return
+	}
+
+	// Disabled webhooks and suspended buckets drop their queued events
+	if webhook.IsActive != 1 || bucket.WebhooksSuspended == 1 {
+		w.abandon(ctx, event)
+		return
+	}
+
+	// The event keeps the max_attempts it was created with, while the backoff
+	// follows the webhook's current settings. Retries carry the ID of the
+	// request that triggered the event and a freshly signed resource_url.
+	sendCtx := requestid.With(ctx, event.RequestID)
+	payload := w.downloads.resign(webhook, bucket, event.Payload)
+	sent := time.Now()
+	result, sendErr := w.sender.SendWebhook(sendCtx, webhook, payload, event.PartitionKey, nil)
+	completeEvent(ctx, w.repo, w.feed, w.policy.forWebhook(webhook), event, result, sendErr, time.Since(sent))
+}
+
+// abandon marks an event failed without attempting delivery
+func (w *RetryWorker) abandon(ctx context.Context, event *sqlc.WebhookEvent) {
+	params := sqlc.UpdateWebhookEventStatusParams{
+		Status:       dto.StatusFailed,
+		ResponseBody: sql.NullString{String: "delivery cancelled: webhook disabled or bucket suspended", Valid: true},
+		CompletedAt:  sql.NullTime{Time: time.Now().UTC(), Valid: true},
+		ID:           event.ID,
+	}
+	if err := w.repo.UpdateEventStatus(ctx, params); err != nil {
+		log.Printf("Error updating webhook event %s: %v", event.ID, err)
+		return
+	}
+	publishUpdate(ctx, w.feed, event, params)
+}
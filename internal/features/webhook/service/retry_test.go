@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/database/dbtest"
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+)
+
+func TestForWebhook(t *testing.T) {
+	global := RetryPolicy{MaxAttempts: 5, Backoff: time.Minute}
+
+	tests := []struct {
+		name    string
+		webhook sqlc.WebhookUrl
+		want    RetryPolicy
+	}{
+		{"no overrides", sqlc.WebhookUrl{}, global},
+		{"max attempts", sqlc.WebhookUrl{MaxAttempts: 1}, RetryPolicy{MaxAttempts: 1, Backoff: time.Minute}},
+		{"backoff", sqlc.WebhookUrl{RetryBackoffSeconds: 30}, RetryPolicy{MaxAttempts: 5, Backoff: 30 * time.Second}},
+		{"both", sqlc.WebhookUrl{MaxAttempts: 10, RetryBackoffSeconds: 2}, RetryPolicy{MaxAttempts: 10, Backoff: 2 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := global.forWebhook(&tt.webhook); got != tt.want {
+				t.Errorf("forWebhook() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsValidRetryPolicy(t *testing.T) {
+	tests := []struct {
+		maxAttempts, backoffSeconds int64
+		want                        bool
+	}{
+		{0, 0, true},
+		{1, 1, true},
+		{maxWebhookAttempts, 3600, true},
+		{-1, 0, false},
+		{maxWebhookAttempts + 1, 0, false},
+		{0, -1, false},
+		{0, 3601, false},
+	}
+	for _, tt := range tests {
+		if got := isValidRetryPolicy(tt.maxAttempts, tt.backoffSeconds); got != tt.want {
+			t.Errorf("isValidRetryPolicy(%d, %d) = %v, want %v", tt.maxAttempts, tt.backoffSeconds, got, tt.want)
+		}
+	}
+}
+
+// TestWebhookRetryOverrides delivers one event to two failing receivers: one
+// webhook allows a single attempt, the other three attempts 30s apart
+func TestWebhookRetryOverrides(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	repo := repository.New(db.Queries)
+	ctx := context.Background()
+
+	once, err := repo.CreateURL(ctx, sqlc.CreateWebhookURLParams{
+		ID: "once", BucketID: bucket.ID, Url: receiver.URL + "/once", EventType: dto.EventResourceNew, IsActive: 1,
+		MaxAttempts: 1,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+	retried, err := repo.CreateURL(ctx, sqlc.CreateWebhookURLParams{
+		ID: "retried", BucketID: bucket.ID, Url: receiver.URL + "/retried", EventType: dto.EventResourceNew, IsActive: 1,
+		MaxAttempts: 3, RetryBackoffSeconds: 30,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 5, Backoff: time.Second}
+	sender := NewWebhookSender(repo, 0, "")
+	publisher := NewWebhookPublisher(repo, sender, nil, policy, nil, 0).(*webhookPublisher)
+	event := &Event{
+		Type:     dto.EventResourceNew,
+		Bucket:   &bucket,
+		Resource: &sqlc.Resource{ID: "resource-1", BucketID: bucket.ID},
+		Payload:  []byte(`{}`),
+	}
+	publisher.deliver(ctx, once, event)
+	publisher.deliver(ctx, retried, event)
+
+	// Deliver every retrying event right away instead of waiting for it to
+	// fall due, checking the backoff each failure scheduled
+	worker := NewRetryWorker(repo, bucketrepo.New(db.Queries), sender, nil, policy, nil, RetryWorkerConfig{})
+	for want := 30 * time.Second; ; want *= 2 {
+		events, err := repo.ListEventsByBucketID(ctx, bucket.ID, 10, 0)
+		if err != nil {
+			t.Fatalf("ListEventsByBucketID() error = %v", err)
+		}
+		pending := 0
+		for i := range events {
+			e := &events[i]
+			if e.Status != dto.StatusRetrying {
+				continue
+			}
+			if e.WebhookUrlID != retried.ID {
+				t.Fatalf("event of webhook %s is retrying", e.WebhookUrlID)
+			}
+			if delay := e.NextRetryAt.Time.Sub(e.LastAttemptAt.Time); delay < want-time.Second || delay > want+time.Second {
+				t.Errorf("attempt %d: next retry in %v, want %v", e.Attempts, delay, want)
+			}
+			worker.deliver(ctx, e)
+			pending++
+		}
+		if pending == 0 {
+			break
+		}
+	}
+
+	for id, wantHits := range map[string]int{"once": 1, "retried": 3} {
+		if hits["/"+id] != wantHits {
+			t.Errorf("webhook %s received %d attempts, want %d", id, hits["/"+id], wantHits)
+		}
+	}
+	events, err := repo.ListEventsByBucketID(ctx, bucket.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListEventsByBucketID() error = %v", err)
+	}
+	for _, e := range events {
+		if e.Status != dto.StatusFailed || !e.CompletedAt.Valid {
+			t.Errorf("event of webhook %s: status %s, completed %v, want failed and completed", e.WebhookUrlID, e.Status, e.CompletedAt.Valid)
+		}
+	}
+}
+
+// retryFixture is a bucket with one active webhook pointing at url
+func retryFixture(t *testing.T, url string) (repository.WebhookRepository, *RetryWorker, *sqlc.WebhookUrl, *database.Database) {
+	t.Helper()
+
+	db := dbtest.New(t)
+	client := dbtest.Client(t, db, "client-1")
+	bucket := dbtest.Bucket(t, db, client.ID, "bucket-1")
+	repo := repository.New(db.Queries)
+
+	webhook, err := repo.CreateURL(context.Background(), sqlc.CreateWebhookURLParams{
+		ID: "webhook-1", BucketID: bucket.ID, Url: url, EventType: dto.EventResourceNew, IsActive: 1,
+	})
+	if err != nil {
+		t.Fatalf("CreateURL() error = %v", err)
+	}
+
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Minute}
+	worker := NewRetryWorker(repo, bucketrepo.New(db.Queries), NewWebhookSender(repo, 0, ""), nil, policy, nil, RetryWorkerConfig{
+		BatchSize:    5,
+		ClaimTimeout: time.Minute,
+	})
+	return repo, worker, webhook, db
+}
+
+// createEvents queues n pending events for webhook, with payloads {"n":0} to {"n":n-1}
+func createEvents(t *testing.T, repo repository.WebhookRepository, webhook *sqlc.WebhookUrl, n int) []*sqlc.WebhookEvent {
+	t.Helper()
+
+	events := make([]*sqlc.WebhookEvent, n)
+	for i := range n {
+		event, err := repo.CreateEvent(context.Background(), sqlc.CreateWebhookEventParams{
+			ID:           fmt.Sprintf("event-%02d", i),
+			WebhookUrlID: webhook.ID,
+			BucketID:     webhook.BucketID,
+			ResourceID:   "resource-1",
+			EventType:    webhook.EventType,
+			Payload:      fmt.Sprintf(`{"n":%d}`, i),
+			MaxAttempts:  3,
+		})
+		if err != nil {
+			t.Fatalf("CreateEvent() error = %v", err)
+		}
+		events[i] = event
+	}
+	return events
+}
+
+func TestClaimPendingEvents(t *testing.T) {
+	repo, _, webhook, _ := retryFixture(t, "http://127.0.0.1:0")
+	ctx := context.Background()
+	events := createEvents(t, repo, webhook, 4)
+
+	// event-01 retries in an hour, event-02 is due and event-03 has used up its attempts
+	setStatus := func(id, status string, nextRetry time.Time, completed bool) {
+		t.Helper()
+		params := sqlc.UpdateWebhookEventStatusParams{
+			ID:          id,
+			Status:      status,
+			NextRetryAt: sql.NullTime{Time: nextRetry.UTC(), Valid: !nextRetry.IsZero()},
+			CompletedAt: sql.NullTime{Time: time.Now().UTC(), Valid: completed},
+		}
+		if err := repo.UpdateEventStatus(ctx, params); err != nil {
+			t.Fatalf("UpdateEventStatus() error = %v", err)
+		}
+	}
+	setStatus(events[1].ID, dto.StatusRetrying, time.Now().Add(time.Hour), false)
+	setStatus(events[2].ID, dto.StatusRetrying, time.Now().Add(-time.Second), false)
+	for range 3 {
+		setStatus(events[3].ID, dto.StatusRetrying, time.Now().Add(-time.Second), false)
+	}
+
+	claimed, err := repo.ClaimPendingEvents(ctx, 10, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ClaimPendingEvents() error = %v", err)
+	}
+	got := make(map[string]bool)
+	for _, e := range claimed {
+		got[e.ID] = true
+		if e.Status != dto.StatusProcessing || !e.ClaimedAt.Valid {
+			t.Errorf("claimed event %s: status %s, claimed %v, want processing and claimed", e.ID, e.Status, e.ClaimedAt.Valid)
+		}
+	}
+	want := map[string]bool{events[0].ID: true, events[2].ID: true}
+	if len(got) != len(want) || !got[events[0].ID] || !got[events[2].ID] {
+		t.Errorf("ClaimPendingEvents() claimed %v, want %v", got, want)
+	}
+
+	// Claimed events are not handed out again while the claim is fresh
+	again, err := repo.ClaimPendingEvents(ctx, 10, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("ClaimPendingEvents() error = %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second ClaimPendingEvents() claimed %d events, want 0", len(again))
+	}
+}
+
+// TestRetryWorkerReclaimsStaleEvents leaves an event in processing, as a
+// worker that crashed mid-delivery would, and checks it is only delivered
+// once the claim is older than ClaimTimeout
+func TestRetryWorkerReclaimsStaleEvents(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+
+	repo, worker, webhook, db := retryFixture(t, receiver.URL)
+	ctx := context.Background()
+	event := createEvents(t, repo, webhook, 1)[0]
+
+	claimed, err := repo.ClaimEvent(ctx, event.ID)
+	if err != nil || !claimed {
+		t.Fatalf("ClaimEvent() = %v, %v, want true", claimed, err)
+	}
+
+	if n, err := worker.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("RunOnce() with a fresh claim = %d, %v, want 0", n, err)
+	}
+
+	// Age the claim past the worker's one minute ClaimTimeout
+	claimedAt := time.Now().Add(-2 * time.Minute).UTC()
+	if _, err := db.DB.ExecContext(ctx, "UPDATE webhook_events SET claimed_at = ? WHERE id = ?", claimedAt, event.ID); err != nil {
+		t.Fatalf("age claim: %v", err)
+	}
+
+	if n, err := worker.RunOnce(ctx); err != nil || n != 1 {
+		t.Fatalf("RunOnce() with a stale claim = %d, %v, want 1", n, err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("receiver got %d deliveries, want 1", n)
+	}
+	got, err := repo.GetEventByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetEventByID() error = %v", err)
+	}
+	if got.Status != dto.StatusSuccess || got.Attempts != 1 {
+		t.Errorf("event status %s after %d attempts, want success after 1", got.Status, got.Attempts)
+	}
+}
+
+// TestRetryWorkersRace runs two workers over the same events table and checks
+// every event is delivered exactly once
+func TestRetryWorkersRace(t *testing.T) {
+	var mu sync.Mutex
+	delivered := make(map[string]int)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		delivered[string(body)]++
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	repo, worker, webhook, db := retryFixture(t, receiver.URL)
+	other := NewRetryWorker(repo, bucketrepo.New(db.Queries), NewWebhookSender(repo, 0, ""), nil, worker.policy, nil, worker.cfg)
+	events := createEvents(t, repo, webhook, 20)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for _, w := range []*RetryWorker{worker, other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n, err := w.RunOnce(ctx)
+				if err != nil {
+					t.Errorf("RunOnce() error = %v", err)
+					return
+				}
+				if n == 0 {
+					return
+				}
+				claimed.Add(int32(n))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := claimed.Load(); n != int32(len(events)) {
+		t.Errorf("workers claimed %d events, want %d", n, len(events))
+	}
+	for _, e := range events {
+		if n := delivered[e.Payload]; n != 1 {
+			t.Errorf("event %s delivered %d times, want 1", e.ID, n)
+		}
+	}
+}
@@ -2,14 +2,16 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"log"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
 	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
 	"github.com/google/uuid"
 )
 
@@ -26,24 +28,39 @@ type WebhookService interface {
 	UpdateHeader(ctx context.Context, clientID, bucketID, webhookID, headerID string, req dto.UpdateHeaderRequest) (*dto.HeaderResponse, error)
 	DeleteHeader(ctx context.Context, clientID, bucketID, webhookID, headerID string) error
 
+	// Delivery history
+	ListEvents(ctx context.Context, clientID, bucketID string, page, limit int) (*dto.WebhookEventListResponse, error)
+	StreamEvents(ctx context.Context, clientID, bucketID, webhookID string) (<-chan dto.WebhookEventResponse, func(), error)
+	Stats(ctx context.Context, clientID, bucketID, webhookID string, window time.Duration) (*dto.WebhookStatsResponse, error)
+
 	// Event dispatching (called from resource service)
-	TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, extraHeaders map[string]string) error
+	TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, metadata, extraHeaders map[string]string) error
 }
 
 type webhookService struct {
 	repo       repository.WebhookRepository
 	bucketRepo bucketrepo.BucketRepository
-	sender     *WebhookSender
+	publishers []EventPublisher
+	feed       DeliveryFeed
+	// streams bounds concurrent StreamEvents subscriptions
+	streams chan struct{}
+	stats   *statsCache
 }
 
 // Ensure webhookService implements WebhookService
 var _ WebhookService = (*webhookService)(nil)
 
-func New(repo repository.WebhookRepository, bucketRepo bucketrepo.BucketRepository) WebhookService {
+// New creates the webhook service. Triggered events are fanned out to every
+// publisher; delivery results are streamed from feed to at most maxStreams
+// subscribers at once.
+func New(repo repository.WebhookRepository, bucketRepo bucketrepo.BucketRepository, publishers []EventPublisher, feed DeliveryFeed, maxStreams int) WebhookService {
 	return &webhookService{
 		repo:       repo,
 		bucketRepo: bucketRepo,
-		sender:     NewWebhookSender(repo),
+		publishers: publishers,
+		feed:       feed,
+		streams:    make(chan struct{}, max(maxStreams, 1)),
+		stats:      newStatsCache(),
 	}
 }
 
@@ -96,18 +113,50 @@ func (s *webhookService) CreateURL(ctx context.Context, clientID, bucketID strin
 		return nil, ErrInvalidEventType
 	}
 
+	if !isValidPartitionKeyTemplate(req.PartitionKeyTemplate) {
+		return nil, ErrInvalidPartitionKey
+	}
+
+	if !isSupportedPayloadVersion(req.PayloadVersion) {
+		return nil, ErrUnsupportedPayloadVersion
+	}
+
+	contentTypeFilter, ok := normalizeContentTypeFilter(req.ContentTypeFilter)
+	if !ok {
+		return nil, ErrInvalidContentTypeFilter
+	}
+
+	if !isValidRetryPolicy(req.MaxAttempts, req.RetryBackoffSeconds) {
+		return nil, ErrInvalidRetryPolicy
+	}
+
 	webhookID := uuid.New().String()
 	var isActive int64
 	if req.IsActive {
 		isActive = 1
 	}
+	var compressPayload int64
+	if req.CompressPayload {
+		compressPayload = 1
+	}
+	var includeDownloadToken int64
+	if req.IncludeDownloadToken {
+		includeDownloadToken = 1
+	}
 
 	webhook, err := s.repo.CreateURL(ctx, sqlc.CreateWebhookURLParams{
-		ID:        webhookID,
-		BucketID:  bucketID,
-		Url:       req.URL,
-		EventType: req.EventType,
-		IsActive:  isActive,
+		ID:                   webhookID,
+		BucketID:             bucketID,
+		Url:                  req.URL,
+		EventType:            req.EventType,
+		IsActive:             isActive,
+		CompressPayload:      compressPayload,
+		PartitionKeyTemplate: req.PartitionKeyTemplate,
+		PayloadVersion:       req.PayloadVersion,
+		ContentTypeFilter:    contentTypeFilter,
+		IncludeDownloadToken: includeDownloadToken,
+		MaxAttempts:          req.MaxAttempts,
+		RetryBackoffSeconds:  req.RetryBackoffSeconds,
 	})
 	if err != nil {
 		return nil, err
@@ -135,14 +184,21 @@ func (s *webhookService) CreateURL(ctx context.Context, clientID, bucketID strin
 	}
 
 	return &dto.WebhookURLResponse{
-		ID:        webhook.ID,
-		BucketID:  webhook.BucketID,
-		URL:       webhook.Url,
-		EventType: webhook.EventType,
-		IsActive:  webhook.IsActive == 1,
-		Headers:   headers,
-		CreatedAt: webhook.CreatedAt.Time,
-		UpdatedAt: webhook.UpdatedAt.Time,
+		ID:                   webhook.ID,
+		BucketID:             webhook.BucketID,
+		URL:                  webhook.Url,
+		EventType:            webhook.EventType,
+		IsActive:             webhook.IsActive == 1,
+		CompressPayload:      webhook.CompressPayload == 1,
+		PartitionKeyTemplate: webhook.PartitionKeyTemplate,
+		PayloadVersion:       webhook.PayloadVersion,
+		ContentTypeFilter:    webhook.ContentTypeFilter,
+		IncludeDownloadToken: webhook.IncludeDownloadToken == 1,
+		MaxAttempts:          webhook.MaxAttempts,
+		RetryBackoffSeconds:  webhook.RetryBackoffSeconds,
+		Headers:              headers,
+		CreatedAt:            webhook.CreatedAt.Time,
+		UpdatedAt:            webhook.UpdatedAt.Time,
 	}, nil
 }
 
@@ -172,14 +228,21 @@ func (s *webhookService) GetURL(ctx context.Context, clientID, bucketID, webhook
 	}
 
 	return &dto.WebhookURLResponse{
-		ID:        webhook.ID,
-		BucketID:  webhook.BucketID,
-		URL:       webhook.Url,
-		EventType: webhook.EventType,
-		IsActive:  webhook.IsActive == 1,
-		Headers:   headerResponses,
-		CreatedAt: webhook.CreatedAt.Time,
-		UpdatedAt: webhook.UpdatedAt.Time,
+		ID:                   webhook.ID,
+		BucketID:             webhook.BucketID,
+		URL:                  webhook.Url,
+		EventType:            webhook.EventType,
+		IsActive:             webhook.IsActive == 1,
+		CompressPayload:      webhook.CompressPayload == 1,
+		PartitionKeyTemplate: webhook.PartitionKeyTemplate,
+		PayloadVersion:       webhook.PayloadVersion,
+		ContentTypeFilter:    webhook.ContentTypeFilter,
+		IncludeDownloadToken: webhook.IncludeDownloadToken == 1,
+		MaxAttempts:          webhook.MaxAttempts,
+		RetryBackoffSeconds:  webhook.RetryBackoffSeconds,
+		Headers:              headerResponses,
+		CreatedAt:            webhook.CreatedAt.Time,
+		UpdatedAt:            webhook.UpdatedAt.Time,
 	}, nil
 }
 
@@ -210,14 +273,21 @@ func (s *webhookService) ListURLs(ctx context.Context, clientID, bucketID string
 		}
 
 		response.Webhooks[i] = dto.WebhookURLResponse{
-			ID:        w.ID,
-			BucketID:  w.BucketID,
-			URL:       w.Url,
-			EventType: w.EventType,
-			IsActive:  w.IsActive == 1,
-			Headers:   headerResponses,
-			CreatedAt: w.CreatedAt.Time,
-			UpdatedAt: w.UpdatedAt.Time,
+			ID:                   w.ID,
+			BucketID:             w.BucketID,
+			URL:                  w.Url,
+			EventType:            w.EventType,
+			IsActive:             w.IsActive == 1,
+			CompressPayload:      w.CompressPayload == 1,
+			PartitionKeyTemplate: w.PartitionKeyTemplate,
+			PayloadVersion:       w.PayloadVersion,
+			ContentTypeFilter:    w.ContentTypeFilter,
+			IncludeDownloadToken: w.IncludeDownloadToken == 1,
+			MaxAttempts:          w.MaxAttempts,
+			RetryBackoffSeconds:  w.RetryBackoffSeconds,
+			Headers:              headerResponses,
+			CreatedAt:            w.CreatedAt.Time,
+			UpdatedAt:            w.UpdatedAt.Time,
 		}
 	}
 
@@ -241,16 +311,48 @@ func (s *webhookService) UpdateURL(ctx context.Context, clientID, bucketID, webh
 		return nil, ErrInvalidEventType
 	}
 
+	if !isValidPartitionKeyTemplate(req.PartitionKeyTemplate) {
+		return nil, ErrInvalidPartitionKey
+	}
+
+	if !isSupportedPayloadVersion(req.PayloadVersion) {
+		return nil, ErrUnsupportedPayloadVersion
+	}
+
+	contentTypeFilter, ok := normalizeContentTypeFilter(req.ContentTypeFilter)
+	if !ok {
+		return nil, ErrInvalidContentTypeFilter
+	}
+
+	if !isValidRetryPolicy(req.MaxAttempts, req.RetryBackoffSeconds) {
+		return nil, ErrInvalidRetryPolicy
+	}
+
 	var isActive int64
 	if req.IsActive {
 		isActive = 1
 	}
+	var compressPayload int64
+	if req.CompressPayload {
+		compressPayload = 1
+	}
+	var includeDownloadToken int64
+	if req.IncludeDownloadToken {
+		includeDownloadToken = 1
+	}
 
 	webhook, err := s.repo.UpdateURL(ctx, sqlc.UpdateWebhookURLParams{
-		ID:        webhookID,
-		Url:       req.URL,
-		EventType: req.EventType,
-		IsActive:  isActive,
+		ID:                   webhookID,
+		Url:                  req.URL,
+		EventType:            req.EventType,
+		IsActive:             isActive,
+		CompressPayload:      compressPayload,
+		PartitionKeyTemplate: req.PartitionKeyTemplate,
+		PayloadVersion:       req.PayloadVersion,
+		ContentTypeFilter:    contentTypeFilter,
+		IncludeDownloadToken: includeDownloadToken,
+		MaxAttempts:          req.MaxAttempts,
+		RetryBackoffSeconds:  req.RetryBackoffSeconds,
 	})
 	if err != nil {
 		return nil, err
@@ -268,14 +370,21 @@ func (s *webhookService) UpdateURL(ctx context.Context, clientID, bucketID, webh
 	}
 
 	return &dto.WebhookURLResponse{
-		ID:        webhook.ID,
-		BucketID:  webhook.BucketID,
-		URL:       webhook.Url,
-		EventType: webhook.EventType,
-		IsActive:  webhook.IsActive == 1,
-		Headers:   headerResponses,
-		CreatedAt: webhook.CreatedAt.Time,
-		UpdatedAt: webhook.UpdatedAt.Time,
+		ID:                   webhook.ID,
+		BucketID:             webhook.BucketID,
+		URL:                  webhook.Url,
+		EventType:            webhook.EventType,
+		IsActive:             webhook.IsActive == 1,
+		CompressPayload:      webhook.CompressPayload == 1,
+		PartitionKeyTemplate: webhook.PartitionKeyTemplate,
+		PayloadVersion:       webhook.PayloadVersion,
+		ContentTypeFilter:    webhook.ContentTypeFilter,
+		IncludeDownloadToken: webhook.IncludeDownloadToken == 1,
+		MaxAttempts:          webhook.MaxAttempts,
+		RetryBackoffSeconds:  webhook.RetryBackoffSeconds,
+		Headers:              headerResponses,
+		CreatedAt:            webhook.CreatedAt.Time,
+		UpdatedAt:            webhook.UpdatedAt.Time,
 	}, nil
 }
 
@@ -376,16 +485,76 @@ func (s *webhookService) DeleteHeader(ctx context.Context, clientID, bucketID, w
 	return s.repo.DeleteHeader(ctx, headerID)
 }
 
-// TriggerEvent sends webhooks directly to all active webhook URLs matching the event type
-// extraHeaders are optional headers passed at request time that will be included in the webhook request
-func (s *webhookService) TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, extraHeaders map[string]string) error {
-	webhooks, err := s.repo.ListActiveURLsByBucketAndEvent(ctx, bucket.ID, eventType)
+// ListEvents returns the bucket's webhook delivery history, newest first
+func (s *webhookService) ListEvents(ctx context.Context, clientID, bucketID string, page, limit int) (*dto.WebhookEventListResponse, error) {
+	if _, err := s.verifyBucketOwnership(ctx, clientID, bucketID); err != nil {
+		return nil, err
+	}
+
+	events, err := s.repo.ListEventsByBucketID(ctx, bucketID, int64(limit), int64((page-1)*limit))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if len(webhooks) == 0 {
-		return nil // No webhooks configured
+	total, err := s.repo.CountEventsByBucketID(ctx, bucketID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.WebhookEventListResponse{
+		Events: make([]dto.WebhookEventResponse, len(events)),
+		Total:  total,
+		Page:   page,
+		Limit:  limit,
+	}
+	for i := range events {
+		resp.Events[i] = eventResponse(&events[i])
+	}
+
+	return resp, nil
+}
+
+// StreamEvents subscribes to the delivery results of one webhook as they
+// happen. The caller must call cancel when done, which also frees the stream slot.
+func (s *webhookService) StreamEvents(ctx context.Context, clientID, bucketID, webhookID string) (<-chan dto.WebhookEventResponse, func(), error) {
+	if _, err := s.verifyBucketOwnership(ctx, clientID, bucketID); err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.verifyWebhookOwnership(ctx, bucketID, webhookID); err != nil {
+		return nil, nil, err
+	}
+
+	select {
+	case s.streams <- struct{}{}:
+	default:
+		return nil, nil, ErrTooManyStreams
+	}
+
+	events, unsubscribe, err := s.feed.Subscribe(ctx, webhookID)
+	if err != nil {
+		<-s.streams
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			unsubscribe()
+			<-s.streams
+		})
+	}
+	return events, cancel, nil
+}
+
+// TriggerEvent publishes the event payload to every configured publisher
+// (HTTP webhooks, Redis Streams, ...). Publisher failures are logged and do not
+// prevent delivery to the remaining publishers.
+// metadata is the resource's metadata, sent in the payload when not empty.
+// extraHeaders are optional headers passed at request time that will be included in the webhook request
+func (s *webhookService) TriggerEvent(ctx context.Context, eventType string, bucket *sqlc.Bucket, resource *sqlc.Resource, resourceURL string, metadata, extraHeaders map[string]string) error {
+	// Bucket-level kill switch
+	if bucket.WebhooksSuspended == 1 {
+		return nil
 	}
 
 	// Build payload
@@ -401,19 +570,29 @@ func (s *webhookService) TriggerEvent(ctx context.Context, eventType string, buc
 			Size:        resource.Size,
 			ContentType: resource.ContentType,
 			Extension:   resource.Extension,
+			Metadata:    metadata,
 		},
+		RequestID: requestid.From(ctx),
 	}
 
-	payloadJSON, err := json.Marshal(payload)
+	payloadJSON, err := encodePayload(&payload, dto.LatestPayloadVersion)
 	if err != nil {
 		return err
 	}
 
-	// Send webhook to each URL directly (fire and forget)
-	for _, webhook := range webhooks {
-		go func(w sqlc.WebhookUrl) {
-			s.sender.SendWebhook(ctx, &w, string(payloadJSON), extraHeaders)
-		}(webhook)
+	event := &Event{
+		Type:         eventType,
+		Bucket:       bucket,
+		Resource:     resource,
+		Data:         &payload,
+		Payload:      payloadJSON,
+		ExtraHeaders: extraHeaders,
+	}
+
+	for _, publisher := range s.publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			log.Printf("Error publishing %s event for bucket %s: %v", eventType, bucket.ID, err)
+		}
 	}
 
 	return nil
@@ -421,8 +600,14 @@ func (s *webhookService) TriggerEvent(ctx context.Context, eventType string, buc
 
 // Service errors
 var (
-	ErrInvalidURL       = repositoryError("invalid webhook URL")
-	ErrInvalidEventType = repositoryError("invalid event type")
+	ErrInvalidURL                = repositoryError("invalid webhook URL")
+	ErrInvalidEventType          = repositoryError("invalid event type")
+	ErrInvalidPartitionKey       = repositoryError("invalid partition key template")
+	ErrUnsupportedPayloadVersion = repositoryError("unsupported payload version")
+	ErrTooManyStreams            = repositoryError("too many open event streams")
+	ErrInvalidContentTypeFilter  = repositoryError("invalid content type filter")
+	ErrInvalidStatsWindow        = repositoryError("invalid stats window")
+	ErrInvalidRetryPolicy        = repositoryError("invalid retry policy")
 )
 
 type repositoryError string
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+const (
+	// MaxStatsWindow bounds how far back delivery stats are aggregated
+	MaxStatsWindow = 30 * 24 * time.Hour
+
+	// statsCacheTTL is how long computed stats are served before the events
+	// are aggregated again
+	statsCacheTTL = 30 * time.Second
+)
+
+// Stats aggregates the webhook's delivery attempts for events created within
+// window. Results are cached briefly, since dashboards poll them.
+func (s *webhookService) Stats(ctx context.Context, clientID, bucketID, webhookID string, window time.Duration) (*dto.WebhookStatsResponse, error) {
+	if window <= 0 || window > MaxStatsWindow {
+		return nil, ErrInvalidStatsWindow
+	}
+	if _, err := s.verifyBucketOwnership(ctx, clientID, bucketID); err != nil {
+		return nil, err
+	}
+	webhook, err := s.verifyWebhookOwnership(ctx, bucketID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := statsKey{webhookID: webhook.ID, window: window}
+	if stats, ok := s.stats.get(key); ok {
+		return stats, nil
+	}
+
+	since := time.Now().UTC().Add(-window).Truncate(time.Second)
+	row, err := s.repo.DeliveryStats(ctx, webhook.ID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &dto.WebhookStatsResponse{
+		WebhookURLID:  webhook.ID,
+		WindowSeconds: int64(window / time.Second),
+		Since:         since,
+		Events:        row.Events,
+		Attempts:      row.Attempts,
+		Successes:     row.Successes,
+		Failures:      row.Attempts - row.Successes,
+		FailedEvents:  row.FailedEvents,
+	}
+	if row.Attempts > 0 {
+		stats.SuccessRate = float64(row.Successes) / float64(row.Attempts)
+		stats.AvgLatencyMs = float64(row.LatencyMs) / float64(row.Attempts)
+	}
+
+	s.stats.put(key, stats)
+	return stats, nil
+}
+
+type statsKey struct {
+	webhookID string
+	window    time.Duration
+}
+
+type statsEntry struct {
+	stats   *dto.WebhookStatsResponse
+	expires time.Time
+}
+
+// statsCache keeps computed stats for statsCacheTTL
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[statsKey]statsEntry
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: make(map[statsKey]statsEntry)}
+}
+
+func (c *statsCache) get(key statsKey) (*dto.WebhookStatsResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.stats, true
+}
+
+// put stores stats and drops expired entries, so the cache only holds
+// webhooks that were queried recently
+func (c *statsCache) put(key statsKey, stats *dto.WebhookStatsResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = statsEntry{stats: stats, expires: now.Add(statsCacheTTL)}
+}
@@ -1,11 +1,15 @@
 package webhook
 
 import (
+	"github.com/aouiniamine/aoui-drive/internal/cache"
+	"github.com/aouiniamine/aoui-drive/internal/config"
 	"github.com/aouiniamine/aoui-drive/internal/database"
 	bucketrepo "github.com/aouiniamine/aoui-drive/internal/features/bucket/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/controller"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/repository"
 	"github.com/aouiniamine/aoui-drive/internal/features/webhook/service"
+	"github.com/aouiniamine/aoui-drive/internal/presign"
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/labstack/echo/v4"
 )
 
@@ -13,20 +17,62 @@ type Feature struct {
 	Controller *controller.WebhookController
 	Service    service.WebhookService
 	Repository repository.WebhookRepository
+	// RetryWorker is nil when the webhook publisher is disabled
+	RetryWorker *service.RetryWorker
 }
 
-func New(db *database.Database, bucketRepo bucketrepo.BucketRepository) *Feature {
+// New wires the webhook feature. rdb may be nil when the redis publisher is
+// disabled. Deliveries carry the triggering request's ID in requestIDHeader,
+// and signer presigns resource_url links under publicURL for webhooks with
+// include_download_token.
+func New(db *database.Database, bucketRepo bucketrepo.BucketRepository, eventsCfg config.EventsConfig, rdb *cache.Redis, requestIDHeader string, signer *presign.Signer, publicURL string, pageLimits pagination.Limits) *Feature {
 	repo := repository.New(db.Queries)
-	svc := service.New(repo, bucketRepo)
-	ctrl := controller.New(svc)
+
+	// Delivery results reach live streams across instances when Redis is available
+	var feed service.DeliveryFeed = service.NewMemoryDeliveryFeed()
+	if rdb != nil {
+		feed = service.NewRedisDeliveryFeed(rdb.Client)
+	}
+
+	var publishers []service.EventPublisher
+	var retryWorker *service.RetryWorker
+	if eventsCfg.HasPublisher("webhook") {
+		sender := service.NewWebhookSender(repo, eventsCfg.WebhookResponseCapture, requestIDHeader)
+		policy := service.RetryPolicy{
+			MaxAttempts: int64(max(eventsCfg.WebhookMaxAttempts, 1)),
+			Backoff:     eventsCfg.WebhookRetryBackoff,
+		}
+		downloads := service.NewDownloadSigner(signer, publicURL, eventsCfg.WebhookDownloadTokenTTL)
+		publishers = append(publishers, service.NewWebhookPublisher(repo, sender, feed, policy, downloads, int64(eventsCfg.WebhookMaxPending)))
+		retryWorker = service.NewRetryWorker(repo, bucketRepo, sender, feed, policy, downloads, service.RetryWorkerConfig{
+			Concurrency:  eventsCfg.WebhookRetryConcurrency,
+			BatchSize:    eventsCfg.WebhookRetryBatchSize,
+			PollInterval: eventsCfg.WebhookRetryPollInterval,
+			ClaimTimeout: eventsCfg.WebhookClaimTimeout,
+		})
+	}
+	if eventsCfg.HasPublisher("redis") && rdb != nil {
+		publishers = append(publishers, service.NewRedisStreamPublisher(rdb.Client, eventsCfg.RedisStreamPrefix, eventsCfg.RedisStreamMaxLen))
+	}
+
+	svc := service.New(repo, bucketRepo, publishers, feed, eventsCfg.WebhookMaxStreams)
+	ctrl := controller.New(svc, pageLimits)
 
 	return &Feature{
-		Controller: ctrl,
-		Service:    svc,
-		Repository: repo,
+		Controller:  ctrl,
+		Service:     svc,
+		Repository:  repo,
+		RetryWorker: retryWorker,
 	}
 }
 
 func (f *Feature) RegisterRoutes(g *echo.Group) {
 	f.Controller.RegisterRoutes(g)
 }
+
+// NewLockoutNotifier sends login lockouts to url through the webhook sender.
+// The ID of the failed login request is sent in requestIDHeader.
+func NewLockoutNotifier(db *database.Database, url, requestIDHeader string) *service.LockoutNotifier {
+	sender := service.NewWebhookSender(repository.New(db.Queries), 0, requestIDHeader)
+	return service.NewLockoutNotifier(sender, url)
+}
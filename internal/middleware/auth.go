@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -12,31 +14,59 @@ import (
 
 const (
 	ClientIDKey       = "client_id"
+	SessionIDKey      = "session_id"
 	SessionCookieName = "session"
 )
 
-// Auth middleware checks for Bearer token first, then falls back to session cookie.
-// For UI routes (starting with /ui), it redirects to login on failure.
+// TokenSource selects where Auth reads the session token from
+type TokenSource string
+
+const (
+	// TokenFromHeader accepts only "Authorization: Bearer <token>"
+	TokenFromHeader TokenSource = "header"
+	// TokenFromCookie accepts only the session cookie
+	TokenFromCookie TokenSource = "cookie"
+	// TokenFromAny tries the Bearer header first, then the session cookie
+	TokenFromAny TokenSource = "any"
+)
+
+var ErrUnknownTokenSource = errors.New("unknown token source")
+
+// ParseTokenSource validates a configured token source
+func ParseTokenSource(value string) (TokenSource, error) {
+	switch source := TokenSource(strings.ToLower(value)); source {
+	case TokenFromHeader, TokenFromCookie, TokenFromAny:
+		return source, nil
+	}
+	return "", fmt.Errorf("%w: %q (expected header, cookie or any)", ErrUnknownTokenSource, value)
+}
+
+// Auth middleware reads the token from the places allowed by source.
+// Restricting API routes to the header keeps them from being driven by a
+// browser cookie (CSRF), and restricting UI routes to the cookie does the reverse.
+// For UI routes (starting with <BASE_PATH>/ui), it redirects to login on failure.
 // For API routes, it returns JSON error responses.
-func Auth(authService service.AuthService) echo.MiddlewareFunc {
+func Auth(authService service.AuthService, source TokenSource) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			var token string
-
-			// First, try Bearer token from Authorization header
-			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader != "" {
-				parts := strings.SplitN(authHeader, " ", 2)
-				if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-					token = parts[1]
+			fromCookie := false
+
+			if source != TokenFromCookie {
+				authHeader := c.Request().Header.Get("Authorization")
+				if authHeader != "" {
+					parts := strings.SplitN(authHeader, " ", 2)
+					if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+						token = parts[1]
+					}
 				}
 			}
 
-			// If no Bearer token, try session cookie
-			if token == "" {
+			if token == "" && source != TokenFromHeader {
 				cookie, cookieErr := c.Cookie(SessionCookieName)
 				if cookieErr == nil && cookie.Value != "" {
 					token = cookie.Value
+					fromCookie = true
 				}
 			}
 
@@ -46,14 +76,16 @@ func Auth(authService service.AuthService) echo.MiddlewareFunc {
 			}
 
 			// Validate token
-			claims, err := authService.ValidateToken(token)
+			claims, err := authService.ValidateToken(c.Request().Context(), token)
 			if err != nil {
-				// Clear invalid cookie if present
-				clearSessionCookie(c)
+				if fromCookie {
+					clearSessionCookie(c)
+				}
 				return authError(c, "invalid or expired token")
 			}
 
 			c.Set(ClientIDKey, claims.ClientID)
+			c.Set(SessionIDKey, claims.ID)
 			return next(c)
 		}
 	}
@@ -62,8 +94,9 @@ func Auth(authService service.AuthService) echo.MiddlewareFunc {
 // authError returns appropriate error response based on request path
 func authError(c echo.Context, message string) error {
 	path := c.Request().URL.Path
-	if strings.HasPrefix(path, "/ui") {
-		return c.Redirect(http.StatusFound, "/ui/login?error="+message)
+	basePath := BasePath(c)
+	if strings.HasPrefix(path, basePath+"/ui") {
+		return c.Redirect(http.StatusFound, basePath+"/ui/login?error="+message)
 	}
 	return response.Unauthorized(c, message)
 }
@@ -73,7 +106,7 @@ func clearSessionCookie(c echo.Context) {
 	c.SetCookie(&http.Cookie{
 		Name:     SessionCookieName,
 		Value:    "",
-		Path:     "/",
+		Path:     CookiePath(c),
 		HttpOnly: true,
 		MaxAge:   -1,
 	})
@@ -105,3 +138,9 @@ func GetClientID(c echo.Context) string {
 	clientID, _ := c.Get(ClientIDKey).(string)
 	return clientID
 }
+
+// GetSessionID returns the jti of the token that authenticated the request
+func GetSessionID(c echo.Context) string {
+	sessionID, _ := c.Get(SessionIDKey).(string)
+	return sessionID
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/features/auth/service"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeAuth accepts the token "valid" for client-1
+type fakeAuth struct {
+	service.AuthService
+}
+
+func (fakeAuth) ValidateToken(ctx context.Context, token string) (*service.Claims, error) {
+	if token != "valid" {
+		return nil, service.ErrInvalidToken
+	}
+	return &service.Claims{ClientID: "client-1"}, nil
+}
+
+func TestAuthTokenSources(t *testing.T) {
+	type credentials struct {
+		header, cookie string
+	}
+	var (
+		none       = credentials{}
+		header     = credentials{header: "Bearer valid"}
+		cookie     = credentials{cookie: "valid"}
+		badHeader  = credentials{header: "Bearer expired", cookie: "valid"}
+		badCookie  = credentials{cookie: "expired"}
+		wrongKind  = credentials{header: "Basic valid"}
+		bothTokens = credentials{header: "Bearer valid", cookie: "valid"}
+	)
+
+	tests := []struct {
+		name   string
+		source TokenSource
+		creds  credentials
+		want   bool
+	}{
+		{"header/none", TokenFromHeader, none, false},
+		{"header/bearer", TokenFromHeader, header, true},
+		{"header/cookie", TokenFromHeader, cookie, false},
+		{"header/not bearer", TokenFromHeader, wrongKind, false},
+		{"header/both", TokenFromHeader, bothTokens, true},
+
+		{"cookie/none", TokenFromCookie, none, false},
+		{"cookie/bearer", TokenFromCookie, header, false},
+		{"cookie/cookie", TokenFromCookie, cookie, true},
+		{"cookie/invalid cookie", TokenFromCookie, badCookie, false},
+		{"cookie/both", TokenFromCookie, bothTokens, true},
+
+		{"any/none", TokenFromAny, none, false},
+		{"any/bearer", TokenFromAny, header, true},
+		{"any/cookie", TokenFromAny, cookie, true},
+		{"any/invalid cookie", TokenFromAny, badCookie, false},
+		// The header is tried first and an invalid one is not retried with the cookie
+		{"any/invalid bearer with cookie", TokenFromAny, badHeader, false},
+	}
+
+	routes := []struct {
+		name, path string
+		denied     int
+	}{
+		{"api", "/drive/buckets", http.StatusUnauthorized},
+		{"ui", "/drive/ui/buckets", http.StatusFound},
+	}
+
+	for _, route := range routes {
+		for _, tt := range tests {
+			t.Run(route.name+"/"+tt.name, func(t *testing.T) {
+				e := echo.New()
+				var clientID string
+				handler := Auth(fakeAuth{}, tt.source)(func(c echo.Context) error {
+					clientID = GetClientID(c)
+					return c.NoContent(http.StatusOK)
+				})
+
+				req := httptest.NewRequest(http.MethodGet, route.path, nil)
+				if tt.creds.header != "" {
+					req.Header.Set("Authorization", tt.creds.header)
+				}
+				if tt.creds.cookie != "" {
+					req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.creds.cookie})
+				}
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.Set(BasePathKey, "/drive")
+
+				if err := handler(c); err != nil {
+					t.Fatalf("handler error = %v", err)
+				}
+
+				want := http.StatusOK
+				if !tt.want {
+					want = route.denied
+				}
+				if rec.Code != want {
+					t.Fatalf("status = %d, want %d", rec.Code, want)
+				}
+				if tt.want && clientID != "client-1" {
+					t.Errorf("client ID = %q, want client-1", clientID)
+				}
+				if rec.Code == http.StatusFound {
+					if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "/drive/ui/login?") {
+						t.Errorf("redirected to %q, want /drive/ui/login", loc)
+					}
+				}
+
+				// A rejected cookie is cleared so the browser stops sending it
+				cleared := false
+				for _, c := range rec.Result().Cookies() {
+					if c.Name == SessionCookieName && c.MaxAge < 0 {
+						cleared = true
+					}
+				}
+				if wantCleared := tt.creds == badCookie && tt.source != TokenFromHeader; cleared != wantCleared {
+					t.Errorf("session cookie cleared = %v, want %v", cleared, wantCleared)
+				}
+			})
+		}
+	}
+}
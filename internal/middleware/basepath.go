@@ -0,0 +1,32 @@
+package middleware
+
+import "github.com/labstack/echo/v4"
+
+// BasePathKey holds the BASE_PATH the app is served under
+const BasePathKey = "base_path"
+
+// WithBasePath makes basePath available to handlers and middleware that
+// build redirects and cookie paths, through BasePath
+func WithBasePath(basePath string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(BasePathKey, basePath)
+			return next(c)
+		}
+	}
+}
+
+// BasePath returns the base path set by WithBasePath, "" at the server root
+func BasePath(c echo.Context) string {
+	basePath, _ := c.Get(BasePathKey).(string)
+	return basePath
+}
+
+// CookiePath returns the path session cookies are scoped to, so apps mounted
+// under different base paths on one host keep separate sessions
+func CookiePath(c echo.Context) string {
+	if basePath := BasePath(c); basePath != "" {
+		return basePath
+	}
+	return "/"
+}
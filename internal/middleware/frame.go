@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrInvalidFrameAncestor = errors.New("invalid frame ancestor")
+
+// ParseFrameAncestors validates the origins allowed to embed the UI in a
+// frame. Each must be an http(s) origin without a path, such as
+// https://portal.example.com or https://*.example.com, or 'self'. Trailing
+// slashes are dropped.
+func ParseFrameAncestors(values []string) ([]string, error) {
+	ancestors := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.EqualFold(value, "'self'") {
+			ancestors = append(ancestors, "'self'")
+			continue
+		}
+
+		origin := strings.TrimSuffix(value, "/")
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil ||
+			strings.ContainsAny(origin, " ;,'") {
+			return nil, fmt.Errorf("%w: %q (expected an origin such as https://portal.example.com)", ErrInvalidFrameAncestor, value)
+		}
+		host := u.Hostname()
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return nil, fmt.Errorf("%w: %q (a wildcard is only allowed as the first label)", ErrInvalidFrameAncestor, value)
+		}
+		ancestors = append(ancestors, origin)
+	}
+	return ancestors, nil
+}
+
+// FrameAncestors controls who may embed a page in a frame. Without ancestors
+// framing is denied outright; otherwise only the listed origins may frame it,
+// through Content-Security-Policy frame-ancestors. X-Frame-Options cannot
+// name origins, so it is only sent for the default deny.
+func FrameAncestors(ancestors []string) echo.MiddlewareFunc {
+	policy := "frame-ancestors 'none'"
+	if len(ancestors) > 0 {
+		policy = "frame-ancestors " + strings.Join(ancestors, " ")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set("Content-Security-Policy", policy)
+			if len(ancestors) == 0 {
+				header.Set("X-Frame-Options", "DENY")
+			}
+			return next(c)
+		}
+	}
+}
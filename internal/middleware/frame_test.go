@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseFrameAncestors(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, []string{}, false},
+		{"origins", []string{"https://portal.example.com", "http://localhost:3000/"}, []string{"https://portal.example.com", "http://localhost:3000"}, false},
+		{"wildcard subdomain", []string{"https://*.example.com"}, []string{"https://*.example.com"}, false},
+		{"self", []string{"'SELF'"}, []string{"'self'"}, false},
+		{"no scheme", []string{"portal.example.com"}, nil, true},
+		{"other scheme", []string{"ftp://portal.example.com"}, nil, true},
+		{"path", []string{"https://portal.example.com/app"}, nil, true},
+		{"query", []string{"https://portal.example.com?a=b"}, nil, true},
+		{"credentials", []string{"https://user@portal.example.com"}, nil, true},
+		{"injected directive", []string{"https://portal.example.com;script-src"}, nil, true},
+		{"inner wildcard", []string{"https://portal.*.com"}, nil, true},
+		{"bare wildcard", []string{"*"}, nil, true},
+		{"one bad among good", []string{"https://portal.example.com", "'none'"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFrameAncestors(tt.values)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFrameAncestor) {
+					t.Errorf("ParseFrameAncestors(%q) error = %v, want ErrInvalidFrameAncestor", tt.values, err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("ParseFrameAncestors(%q) = %q, %v, want %q", tt.values, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameAncestors(t *testing.T) {
+	tests := []struct {
+		name             string
+		ancestors        []string
+		wantCSP          string
+		wantFrameOptions string
+	}{
+		{"default deny", nil, "frame-ancestors 'none'", "DENY"},
+		{"allowed origins", []string{"'self'", "https://portal.example.com"}, "frame-ancestors 'self' https://portal.example.com", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, FrameAncestors(tt.ancestors))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := rec.Header().Get("Content-Security-Policy"); got != tt.wantCSP {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, tt.wantCSP)
+			}
+			if got := rec.Header().Get("X-Frame-Options"); got != tt.wantFrameOptions {
+				t.Errorf("X-Frame-Options = %q, want %q", got, tt.wantFrameOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Streaming lifts the server's read and write timeouts for routes whose
+// bodies are as long as the file being uploaded or downloaded, or that stay
+// open as event streams, so a large transfer over a slow link or a long-lived
+// stream is not cut off. Such requests are still bounded
+// by the header timeout, and their connections by the idle timeout once the
+// response is sent.
+func Streaming() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// Connections that cannot change deadlines keep the server's
+			// timeouts
+			rc := http.NewResponseController(c.Response())
+			rc.SetReadDeadline(time.Time{})
+			rc.SetWriteDeadline(time.Time{})
+			return next(c)
+		}
+	}
+}
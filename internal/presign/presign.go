@@ -0,0 +1,93 @@
+package presign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("link has expired")
+)
+
+// Signer issues and verifies time-limited HMAC-SHA256 signatures for
+// resource links, so private objects can be shared without credentials.
+type Signer struct {
+	secret     []byte
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+
+	// previous is a former secret, still accepted for links that expire by
+	// previousUntil
+	previous      []byte
+	previousUntil int64
+}
+
+func New(secret string, defaultTTL, maxTTL time.Duration) *Signer {
+	if maxTTL < defaultTTL {
+		maxTTL = defaultTTL
+	}
+	return &Signer{
+		secret:     []byte(secret),
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// AcceptPrevious also accepts links signed with a former secret, for one max
+// TTL from now: any link it signed before the switch has expired by then, so
+// links it would sign later are refused.
+func (s *Signer) AcceptPrevious(secret string) {
+	s.previous = []byte(secret)
+	s.previousUntil = time.Now().Add(s.maxTTL).Unix()
+}
+
+// ClampTTL returns the default TTL for zero/negative values and caps the rest at the max TTL
+func (s *Signer) ClampTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return s.defaultTTL
+	}
+	if ttl > s.maxTTL {
+		return s.maxTTL
+	}
+	return ttl
+}
+
+// Sign returns the expiry (unix seconds) and signature for a resource link
+func (s *Signer) Sign(bucketID, hash string, ttl time.Duration) (int64, string) {
+	expires := time.Now().Add(s.ClampTTL(ttl)).Unix()
+	return expires, sign(s.secret, bucketID, hash, expires)
+}
+
+// Verify checks the signature and that the link has not expired
+func (s *Signer) Verify(bucketID, hash string, expires int64, signature string) error {
+	if !valid(s.secret, bucketID, hash, expires, signature) &&
+		(s.previous == nil || expires > s.previousUntil || !valid(s.previous, bucketID, hash, expires, signature)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// ShareURL builds the credential-free download link for a signature under
+// baseURL (PUBLIC_URL; empty yields a relative link)
+func ShareURL(baseURL, bucketID, hash, extension string, expires int64, signature string) string {
+	return fmt.Sprintf("%s/share/%s/%s%s?expires=%d&signature=%s", baseURL, bucketID, hash, extension, expires, signature)
+}
+
+// valid reports whether signature is the signature of a link under secret
+func valid(secret []byte, bucketID, hash string, expires int64, signature string) bool {
+	return hmac.Equal([]byte(sign(secret, bucketID, hash, expires)), []byte(signature))
+}
+
+func sign(secret []byte, bucketID, hash string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s/%s/%d", bucketID, hash, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
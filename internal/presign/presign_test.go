@@ -0,0 +1,55 @@
+package presign
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	s := New("current", time.Hour, 24*time.Hour)
+	expires, signature := s.Sign("b1", "abc", time.Hour)
+	past := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		hash      string
+		expires   int64
+		signature string
+		want      error
+	}{
+		{"valid", "abc", expires, signature, nil},
+		{"other hash", "abd", expires, signature, ErrInvalidSignature},
+		{"extended expiry", "abc", expires + 1, signature, ErrInvalidSignature},
+		{"expired", "abc", past, sign([]byte("current"), "b1", "abc", past), ErrExpired},
+	}
+	for _, tt := range tests {
+		if err := s.Verify("b1", tt.hash, tt.expires, tt.signature); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAcceptPrevious(t *testing.T) {
+	s := New("derived", time.Hour, 24*time.Hour)
+	inWindow := time.Now().Add(12 * time.Hour).Unix()
+	afterWindow := time.Now().Add(48 * time.Hour).Unix()
+	old := sign([]byte("jwt-secret"), "b1", "abc", inWindow)
+
+	if err := s.Verify("b1", "abc", inWindow, old); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of a link under another key = %v, want ErrInvalidSignature", err)
+	}
+
+	s.AcceptPrevious("jwt-secret")
+	if err := s.Verify("b1", "abc", inWindow, old); err != nil {
+		t.Errorf("Verify() of a link signed before the switch = %v, want nil", err)
+	}
+	// Only a link signed after the switch can expire after the window
+	if err := s.Verify("b1", "abc", afterWindow, sign([]byte("jwt-secret"), "b1", "abc", afterWindow)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() of a previous-key link expiring after the window = %v, want ErrInvalidSignature", err)
+	}
+	expires, signature := s.Sign("b1", "abc", 0)
+	if err := s.Verify("b1", "abc", expires, signature); err != nil {
+		t.Errorf("Verify() of a new link = %v, want nil", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package quota enforces server-wide caps on how many clients and buckets
+// may exist, for hosted free tiers
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// LimitError is returned when creating one more item would exceed a cap
+type LimitError struct {
+	Kind  string
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d reached", e.Kind, e.Limit)
+}
+
+// Cap limits the number of items of one kind. The count is loaded with a
+// COUNT(*) query on first use and then kept in memory as items are created.
+// Deletions are not tracked: when the cached count reaches the limit it is
+// loaded again before anything is refused, so removed items free their slot.
+// A nil *Cap, or one with a limit <= 0, allows everything.
+type Cap struct {
+	kind  string
+	limit int64
+	count func(ctx context.Context) (int64, error)
+
+	mu     sync.Mutex
+	loaded bool
+	n      int64
+}
+
+// New creates a cap of limit items of kind, counted by count
+func New(kind string, limit int64, count func(ctx context.Context) (int64, error)) *Cap {
+	return &Cap{kind: kind, limit: limit, count: count}
+}
+
+// Create runs create if one more item fits under the cap, and returns a
+// *LimitError otherwise. Creations are serialised so concurrent requests
+// cannot overshoot the limit.
+func (c *Cap) Create(ctx context.Context, create func() error) error {
+	if c == nil || c.limit <= 0 {
+		return create()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded || c.n >= c.limit {
+		n, err := c.count(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count %ss: %w", c.kind, err)
+		}
+		c.n, c.loaded = n, true
+	}
+	if c.n >= c.limit {
+		return &LimitError{Kind: c.kind, Limit: c.limit}
+	}
+
+	if err := create(); err != nil {
+		return err
+	}
+	c.n++
+	return nil
+}
@@ -0,0 +1,21 @@
+// Package requestid carries the ID of the API request that caused some work
+// (e.g. a webhook delivery) through contexts, so it can be traced end-to-end.
+package requestid
+
+import "context"
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying id. An empty id leaves ctx unchanged.
+func With(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// From returns the request ID carried by ctx, or "" if there is none
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,134 @@
+// Package scanner checks uploads for malware before they are stored
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InfectedError reports content the scanner flagged as malware
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "malware detected: " + e.Signature
+}
+
+// Scanner checks content for malware. It returns an *InfectedError for
+// infected content and any other error when the content could not be scanned.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// streamChunk is the size of each INSTREAM chunk sent to clamd
+const streamChunk = 64 << 10
+
+// ClamAV scans content with clamd's INSTREAM command
+type ClamAV struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAV creates a scanner for the clamd at address, either
+// tcp://host:port or unix:///path/to/clamd.sock. timeout bounds each scan,
+// including sending the content; zero means no limit.
+func NewClamAV(address string, timeout time.Duration) (*ClamAV, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanner address: %w", err)
+	}
+
+	c := &ClamAV{network: u.Scheme, timeout: timeout}
+	switch u.Scheme {
+	case "tcp":
+		c.address = u.Host
+	case "unix":
+		c.address = u.Path
+	default:
+		return nil, fmt.Errorf("invalid scanner address %q: scheme must be tcp or unix", address)
+	}
+	if c.address == "" {
+		return nil, fmt.Errorf("invalid scanner address %q", address)
+	}
+	return c, nil
+}
+
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := stream(conn, r); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// stream sends r as a zINSTREAM command: length-prefixed chunks ended by a
+// zero-length chunk
+func stream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+streamChunk)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseReply interprets clamd's answer: "stream: OK", "stream: <signature>
+// FOUND", or an error such as "INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) error {
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return &InfectedError{Signature: signature}
+	default:
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+}
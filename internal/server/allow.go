@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// standardMethods is the set of methods reported in Allow headers
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// allowIndex maps registered route patterns to the methods they accept.
+// It is built on first use because features register routes after server.New.
+type allowIndex struct {
+	once   sync.Once
+	echo   *echo.Echo
+	routes map[string]map[string]bool
+}
+
+func (a *allowIndex) build() {
+	a.routes = make(map[string]map[string]bool)
+	for _, r := range a.echo.Routes() {
+		if !standardMethods[r.Method] {
+			continue
+		}
+		if a.routes[r.Path] == nil {
+			a.routes[r.Path] = make(map[string]bool)
+		}
+		a.routes[r.Path][r.Method] = true
+	}
+}
+
+// methodsFor returns the sorted methods accepted by every route matching path.
+// OPTIONS is always included since CORS preflight is answered globally.
+func (a *allowIndex) methodsFor(path string) []string {
+	a.once.Do(a.build)
+
+	set := make(map[string]bool)
+	for pattern, methods := range a.routes {
+		if !matchRoute(pattern, path) {
+			continue
+		}
+		for m := range methods {
+			set[m] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	set[http.MethodOptions] = true
+
+	methods := make([]string, 0, len(set))
+	for m := range set {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute reports whether an Echo route pattern (with :param and trailing *) matches path
+func matchRoute(pattern, path string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	xs := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, seg := range ps {
+		if strings.HasPrefix(seg, "*") {
+			return true
+		}
+		if i >= len(xs) {
+			return false
+		}
+		if strings.HasPrefix(seg, ":") {
+			if xs[i] == "" {
+				return false
+			}
+			continue
+		}
+		if seg != xs[i] {
+			return false
+		}
+	}
+	return len(ps) == len(xs)
+}
+
+// errorHandler answers requests for known paths with an unsupported method
+// with 405 and an accurate Allow header, then defers to Echo's default handler.
+// Router-level 404s are upgraded too, since group catch-all routes can mask a 405.
+func (s *Server) errorHandler(err error, c echo.Context) {
+	var he *echo.HTTPError
+	if errors.As(err, &he) && (he.Code == http.StatusMethodNotAllowed || he.Code == http.StatusNotFound) {
+		method := c.Request().Method
+		if methods := s.allow.methodsFor(c.Request().URL.Path); len(methods) > 0 && !contains(methods, method) {
+			c.Response().Header().Set(echo.HeaderAllow, strings.Join(methods, ", "))
+			err = echo.ErrMethodNotAllowed
+		}
+	}
+
+	s.echo.DefaultHTTPErrorHandler(err, c)
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
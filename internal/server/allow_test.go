@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	s := New(&config.Config{}, nil)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	pass := func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+
+	s.Router().GET("/health", ok)
+	resources := s.Router().Group("/resources", pass)
+	resources.GET("/:bucket/:hash", ok)
+	resources.PUT("/:bucket/:hash", ok)
+	resources.DELETE("/:bucket/:hash", ok)
+	resources.POST("/:bucket/:hash/restore", ok)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		wantCode  int
+		wantAllow string
+	}{
+		{"allowed method", http.MethodGet, "/health", http.StatusOK, ""},
+		{"unsupported method", http.MethodDelete, "/health", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{"parameterised route", http.MethodPost, "/resources/b/h", http.StatusMethodNotAllowed, "DELETE, GET, OPTIONS, PUT"},
+		{"nested route", http.MethodGet, "/resources/b/h/restore", http.StatusMethodNotAllowed, "OPTIONS, POST"},
+		{"unknown path", http.MethodGet, "/missing", http.StatusNotFound, ""},
+		{"unknown path in a group", http.MethodGet, "/resources/b/h/other", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.Echo().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get(echo.HeaderAllow); got != tt.wantAllow {
+				t.Errorf("%s %s Allow = %q, want %q", tt.method, tt.path, got, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestCORSExposeHeaders(t *testing.T) {
+	defaults := []string{"X-Resource-Hash", "X-Deduplicated", "ETag", "Content-Range", "Accept-Ranges", "X-Request-Id"}
+
+	tests := []struct {
+		name            string
+		expose          []string
+		requestIDHeader string
+		origin          string
+		readable        []string
+		hidden          []string
+	}{
+		{
+			name:            "default list",
+			expose:          defaults,
+			requestIDHeader: "X-Request-ID",
+			origin:          "https://app.example.com",
+			readable:        defaults,
+			hidden:          []string{"X-Internal"},
+		},
+		{
+			name:            "custom list with a renamed request ID header",
+			expose:          []string{"ETag"},
+			requestIDHeader: "X-Correlation-ID",
+			origin:          "https://app.example.com",
+			readable:        []string{"ETag", "X-Correlation-ID"},
+			hidden:          []string{"X-Resource-Hash", "X-Deduplicated"},
+		},
+		{
+			name:            "same-origin request",
+			expose:          defaults,
+			requestIDHeader: "X-Request-ID",
+			hidden:          defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&config.Config{Server: config.ServerConfig{
+				CORSExposeHeaders: tt.expose,
+				RequestIDHeader:   tt.requestIDHeader,
+			}}, nil)
+			s.Router().GET("/resources/:bucket/:hash", func(c echo.Context) error {
+				c.Response().Header().Set("X-Resource-Hash", c.Param("hash"))
+				c.Response().Header().Set("X-Internal", "secret")
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/resources/b/h", nil)
+			if tt.origin != "" {
+				req.Header.Set(echo.HeaderOrigin, tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			s.Echo().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			wantOrigin := ""
+			if tt.origin != "" {
+				wantOrigin = "*"
+			}
+			if got := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); got != wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, wantOrigin)
+			}
+
+			// Browsers let scripts read only the headers listed here
+			var exposed []string
+			for _, h := range strings.Split(rec.Header().Get(echo.HeaderAccessControlExposeHeaders), ",") {
+				if h = strings.TrimSpace(h); h != "" {
+					exposed = append(exposed, strings.ToLower(h))
+				}
+			}
+			for _, h := range tt.readable {
+				if !slices.Contains(exposed, strings.ToLower(h)) {
+					t.Errorf("%s is not exposed in %q", h, exposed)
+				}
+			}
+			for _, h := range tt.hidden {
+				if slices.Contains(exposed, strings.ToLower(h)) {
+					t.Errorf("%s is exposed in %q, want it hidden", h, exposed)
+				}
+			}
+		})
+	}
+}
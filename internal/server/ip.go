@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var ErrInvalidTrustedProxy = errors.New("invalid trusted proxy")
+
+// ParseTrustedProxies validates the reverse proxies whose X-Forwarded-For is
+// believed. Each is an IP or a CIDR range such as 10.0.0.0/8.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q (expected an IP or CIDR range)", ErrInvalidTrustedProxy, value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q (expected an IP or CIDR range)", ErrInvalidTrustedProxy, value)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// ipExtractor decides where ctx.RealIP() comes from, which keys the login
+// lockout, the registration limit and audit logs. Without trusted proxies it
+// is the connection's address, since any client can send X-Forwarded-For.
+// With them, X-Forwarded-For is followed back only through those proxies.
+func ipExtractor(proxies []*net.IPNet) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// TrustProxies makes the server take client IPs from X-Forwarded-For when
+// the request comes through one of proxies
+func (s *Server) TrustProxies(proxies []*net.IPNet) {
+	s.echo.IPExtractor = ipExtractor(proxies)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::1/128"}
+	for i, proxy := range proxies {
+		if proxy.String() != want[i] {
+			t.Errorf("proxy %d = %s, want %s", i, proxy, want[i])
+		}
+	}
+
+	for _, value := range []string{"proxy.local", "10.0.0.0/33", ""} {
+		if _, err := ParseTrustedProxies([]string{value}); !errors.Is(err, ErrInvalidTrustedProxy) {
+			t.Errorf("ParseTrustedProxies(%q) error = %v, want ErrInvalidTrustedProxy", value, err)
+		}
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		remoteAddr string
+		want       string
+	}{
+		{"no proxies ignore X-Forwarded-For", false, "198.51.100.1:40000", "198.51.100.1"},
+		{"no proxies ignore it from private addresses", false, "10.0.0.5:40000", "10.0.0.5"},
+		{"trusted proxy", true, "10.0.0.5:40000", "203.0.113.9"},
+		{"untrusted peer", true, "198.51.100.1:40000", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extract := ipExtractor(nil)
+			if tt.trusted {
+				extract = ipExtractor(proxies)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			req.Header.Set("X-Real-IP", "203.0.113.9")
+			if got := extract(req); got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,39 +4,82 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/aouiniamine/aoui-drive/internal/config"
 	"github.com/aouiniamine/aoui-drive/internal/database"
+	"github.com/aouiniamine/aoui-drive/internal/requestid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type Server struct {
 	echo   *echo.Echo
+	router *echo.Group
 	config *config.Config
 	db     *database.Database
+	allow  *allowIndex
 }
 
 func New(cfg *config.Config, db *database.Database) *Server {
 	e := echo.New()
 	e.HideBanner = true
+	// Client IPs come from the connection until TrustProxies is called
+	e.IPExtractor = ipExtractor(nil)
+
+	// Streaming routes lift the read and write timeouts for themselves with
+	// middleware.Streaming
+	e.Server.ReadHeaderTimeout = cfg.Server.ReadHeaderTimeout
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
+	e.Server.IdleTimeout = cfg.Server.IdleTimeout
+	e.Server.MaxHeaderBytes = cfg.Server.MaxHeaderBytes
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.RequestID())
-	e.Use(middleware.CORS())
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		TargetHeader: cfg.Server.RequestIDHeader,
+		// Make the ID available to services, e.g. for webhook deliveries
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(requestid.With(c.Request().Context(), id)))
+		},
+	}))
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		ExposeHeaders: exposeHeaders(cfg.Server),
+	}))
 
-	return &Server{
+	s := &Server{
 		echo:   e,
+		router: e.Group(cfg.Server.BasePath),
 		config: cfg,
 		db:     db,
+		allow:  &allowIndex{echo: e},
 	}
+	e.HTTPErrorHandler = s.errorHandler
+
+	return s
+}
+
+// exposeHeaders adds the request ID header to CORS_EXPOSE_HEADERS when it was
+// renamed, so browser clients can still read it
+func exposeHeaders(cfg config.ServerConfig) []string {
+	for _, h := range cfg.CORSExposeHeaders {
+		if strings.EqualFold(h, cfg.RequestIDHeader) {
+			return cfg.CORSExposeHeaders
+		}
+	}
+	return append(cfg.CORSExposeHeaders, cfg.RequestIDHeader)
 }
 
 func (s *Server) Echo() *echo.Echo {
 	return s.echo
 }
 
+// Router is the group every route is registered on, rooted at BASE_PATH
+func (s *Server) Router() *echo.Group {
+	return s.router
+}
+
 func (s *Server) DB() *database.Database {
 	return s.db
 }
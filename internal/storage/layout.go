@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aouiniamine/aoui-drive/internal/database/sqlc"
+)
+
+const (
+	// LayoutFlat stores buckets at <root>/<bucketID>
+	LayoutFlat = "flat"
+	// LayoutClient stores buckets at <root>/<clientID>/<bucketID>
+	LayoutClient = "client"
+
+	publicDir = "public"
+
+	// The caches and trash below are dot folders, which reindexing skips and
+	// /public does not serve
+
+	// blobDir holds one copy of each unencrypted content, hard-linked into
+	// every bucket that stores it
+	blobDir = ".blobs"
+	// transcodeDir holds re-encoded images, keyed by bucket, hash and format
+	transcodeDir = ".transcoded"
+	// chunkDir holds computed chunk manifests, keyed by bucket, hash and
+	// chunk size
+	chunkDir = ".chunks"
+	// trashDir, inside a bucket, holds the files of its soft-deleted resources
+	trashDir = ".trash"
+	// thumbnailDir, inside a bucket, holds its generated thumbnails, keyed by
+	// hash and dimensions
+	thumbnailDir = ".thumbs"
+)
+
+var ErrUnknownLayout = errors.New("unknown storage layout")
+
+// Layout decides where bucket directories live under the storage root
+type Layout struct {
+	root      string
+	perClient bool
+}
+
+func NewLayout(root, mode string) (*Layout, error) {
+	switch mode {
+	case LayoutFlat, "":
+		return &Layout{root: root}, nil
+	case LayoutClient:
+		return &Layout{root: root, perClient: true}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q (expected %q or %q)", ErrUnknownLayout, mode, LayoutFlat, LayoutClient)
+	}
+}
+
+// Root is the storage root, shared by every layout for caches and public links
+func (l *Layout) Root() string {
+	return l.root
+}
+
+// BucketDir returns the directory holding a bucket's files
+func (l *Layout) BucketDir(clientID, bucketID string) string {
+	if l.perClient {
+		return filepath.Join(l.root, clientID, bucketID)
+	}
+	return filepath.Join(l.root, bucketID)
+}
+
+// BlobDir returns the directory of shared blobs
+func (l *Layout) BlobDir() string {
+	return filepath.Join(l.root, blobDir)
+}
+
+// TranscodeDir returns the directory of a bucket's re-encoded images
+func (l *Layout) TranscodeDir(bucketID string) string {
+	return filepath.Join(l.root, transcodeDir, bucketID)
+}
+
+// ChunkDir returns the directory of a bucket's chunk manifests
+func (l *Layout) ChunkDir(bucketID string) string {
+	return filepath.Join(l.root, chunkDir, bucketID)
+}
+
+// TrashDir returns the directory of a bucket's soft-deleted files
+func (l *Layout) TrashDir(clientID, bucketID string) string {
+	return filepath.Join(l.BucketDir(clientID, bucketID), trashDir)
+}
+
+// ThumbnailDir returns the directory of a bucket's thumbnails
+func (l *Layout) ThumbnailDir(clientID, bucketID string) string {
+	return filepath.Join(l.BucketDir(clientID, bucketID), thumbnailDir)
+}
+
+// PublicLink returns the symlink path served under /public for a bucket
+func (l *Layout) PublicLink(bucketID string) string {
+	return filepath.Join(l.root, publicDir, bucketID)
+}
+
+// LinkPublic points public/<bucketID> at the bucket directory
+func (l *Layout) LinkPublic(clientID, bucketID string) error {
+	if err := os.MkdirAll(filepath.Join(l.root, publicDir), 0755); err != nil {
+		return err
+	}
+
+	target, err := l.publicTarget(clientID, bucketID)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, l.PublicLink(bucketID))
+}
+
+// publicTarget is the link target: a relative path from the public folder to
+// the bucket folder
+func (l *Layout) publicTarget(clientID, bucketID string) (string, error) {
+	return filepath.Rel(filepath.Join(l.root, publicDir), l.BucketDir(clientID, bucketID))
+}
+
+// MoveBucket moves a bucket directory from one client's folder to another's.
+// It does nothing under the flat layout, where the path has no client in it.
+// The public link, if any, is left for the caller to repoint.
+func (l *Layout) MoveBucket(fromClientID, toClientID, bucketID string) error {
+	src := l.BucketDir(fromClientID, bucketID)
+	dst := l.BucketDir(toClientID, bucketID)
+	if src == dst {
+		return nil
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+func (l *Layout) UnlinkPublic(bucketID string) {
+	os.Remove(l.PublicLink(bucketID))
+}
+
+// RepairPublic recreates public/<bucketID> if it is missing or points
+// anywhere but the bucket directory, and reports whether it did. A correct
+// link is left untouched, so repairing is safe to repeat.
+func (l *Layout) RepairPublic(clientID, bucketID string) (bool, error) {
+	if _, err := os.Stat(l.BucketDir(clientID, bucketID)); err != nil {
+		return false, fmt.Errorf("bucket directory: %w", err)
+	}
+	target, err := l.publicTarget(clientID, bucketID)
+	if err != nil {
+		return false, err
+	}
+
+	link := l.PublicLink(bucketID)
+	info, err := os.Lstat(link)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return false, err
+	case info.Mode()&os.ModeSymlink == 0:
+		// Never delete real files or directories in the public folder
+		return false, fmt.Errorf("%s exists and is not a symlink", link)
+	default:
+		if current, err := os.Readlink(link); err == nil && current == target {
+			return false, nil
+		}
+		if err := os.Remove(link); err != nil {
+			return false, err
+		}
+	}
+
+	if err := l.LinkPublic(clientID, bucketID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PublicLinks lists the bucket IDs that have a symlink in the public folder
+func (l *Layout) PublicLinks() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(l.root, publicDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink != 0 {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
+
+// Migrate moves bucket directories written under the other layout into this one
+// and repoints public symlinks. It is safe to run on every startup: buckets that
+// are already in place, or have no directory at all, are left alone.
+func (l *Layout) Migrate(buckets []sqlc.Bucket) error {
+	other := &Layout{root: l.root, perClient: !l.perClient}
+
+	moved := 0
+	for _, b := range buckets {
+		dst := l.BucketDir(b.ClientID, b.ID)
+		src := other.BucketDir(b.ClientID, b.ID)
+
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			if _, err := os.Stat(src); err == nil {
+				if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+					return fmt.Errorf("failed to create directory for bucket %s: %w", b.ID, err)
+				}
+				if err := os.Rename(src, dst); err != nil {
+					return fmt.Errorf("failed to move bucket %s: %w", b.ID, err)
+				}
+				moved++
+			}
+		}
+
+		if b.IsPublic == 1 {
+			l.UnlinkPublic(b.ID)
+			if err := l.LinkPublic(b.ClientID, b.ID); err != nil {
+				return fmt.Errorf("failed to link public bucket %s: %w", b.ID, err)
+			}
+		}
+	}
+
+	// Client directories left empty after moving back to the flat layout
+	if !l.perClient {
+		for _, b := range buckets {
+			os.Remove(filepath.Join(l.root, b.ClientID))
+		}
+	}
+
+	if moved > 0 {
+		log.Printf("Moved %d bucket(s) into the %s storage layout", moved, l.mode())
+	}
+	return nil
+}
+
+func (l *Layout) mode() string {
+	if l.perClient {
+		return LayoutClient
+	}
+	return LayoutFlat
+}
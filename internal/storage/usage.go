@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+)
+
+var (
+	ErrStorageFull = errors.New("storage capacity reached (MAX_TOTAL_STORAGE)")
+	ErrReadOnly    = errors.New("server is read-only after reaching MAX_TOTAL_STORAGE; restart it once space is freed")
+)
+
+// Usage tracks the bytes stored across all buckets against MAX_TOTAL_STORAGE.
+// The total is loaded from the database at startup and then kept current by
+// uploads and deletions, so checking it never scans the disk. It counts
+// physical bytes: each shared blob once, however many buckets link it, plus
+// every encrypted resource, which is never shared. A nil *Usage accepts
+// everything.
+type Usage struct {
+	limit        int64
+	tripReadOnly bool
+
+	used     atomic.Int64
+	readOnly atomic.Bool
+}
+
+// NewUsage creates a tracker. limit <= 0 disables the cap. With tripReadOnly,
+// the first upload rejected for lack of space switches the server to
+// read-only until restart.
+func NewUsage(limit int64, tripReadOnly bool) *Usage {
+	return &Usage{limit: limit, tripReadOnly: tripReadOnly}
+}
+
+// Set replaces the tracked total, e.g. with the sum loaded at startup
+func (u *Usage) Set(n int64) {
+	if u == nil {
+		return
+	}
+	u.used.Store(n)
+}
+
+// Add accounts for bytes written or (when negative) removed outside of
+// Reserve, such as deletions or files adopted by reindexing
+func (u *Usage) Add(n int64) {
+	if u == nil {
+		return
+	}
+	u.used.Add(n)
+}
+
+// Check reports whether uploads are accepted at all, without reserving space.
+// It lets uploads be rejected before their body is read.
+func (u *Usage) Check() error {
+	if u == nil {
+		return nil
+	}
+	if u.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if u.limit > 0 && u.used.Load() >= u.limit {
+		return ErrStorageFull
+	}
+	return nil
+}
+
+// Reserve accounts for n new bytes, failing if they would take the total over
+// the cap. Callers give the bytes back with Add(-n) if the write fails.
+func (u *Usage) Reserve(n int64) error {
+	if u == nil {
+		return nil
+	}
+	if u.readOnly.Load() {
+		return ErrReadOnly
+	}
+	if u.limit <= 0 {
+		u.used.Add(n)
+		return nil
+	}
+
+	for {
+		used := u.used.Load()
+		if used+n > u.limit {
+			if u.tripReadOnly && u.readOnly.CompareAndSwap(false, true) {
+				log.Printf("Storage cap of %d bytes reached (%d used, %d requested); switching to read-only", u.limit, used, n)
+			}
+			return ErrStorageFull
+		}
+		if u.used.CompareAndSwap(used, used+n) {
+			return nil
+		}
+	}
+}
+
+// Used is the tracked number of stored bytes
+func (u *Usage) Used() int64 {
+	if u == nil {
+		return 0
+	}
+	return u.used.Load()
+}
+
+// Limit is the configured cap; 0 means unlimited
+func (u *Usage) Limit() int64 {
+	if u == nil || u.limit < 0 {
+		return 0
+	}
+	return u.limit
+}
+
+// ReadOnly reports whether the read-only tripwire has fired
+func (u *Usage) ReadOnly() bool {
+	return u != nil && u.readOnly.Load()
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestUsageLimit(t *testing.T) {
+	const limit = 100
+
+	tests := []struct {
+		name        string
+		used        int64
+		reserve     int64
+		wantCheck   error
+		wantReserve error
+	}{
+		{"below the limit", limit - 1, 1, nil, nil},
+		{"at the limit", limit, 0, ErrStorageFull, nil},
+		{"over the limit", limit + 1, 0, ErrStorageFull, ErrStorageFull},
+		{"reserve reaching the limit", limit - 10, 10, nil, nil},
+		{"reserve one byte over", limit - 10, 11, nil, ErrStorageFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUsage(limit, false)
+			u.Set(tt.used)
+
+			if err := u.Check(); !errors.Is(err, tt.wantCheck) {
+				t.Errorf("Check() = %v, want %v", err, tt.wantCheck)
+			}
+
+			err := u.Reserve(tt.reserve)
+			if !errors.Is(err, tt.wantReserve) {
+				t.Fatalf("Reserve(%d) = %v, want %v", tt.reserve, err, tt.wantReserve)
+			}
+			want := tt.used
+			if err == nil {
+				want += tt.reserve
+			}
+			if got := u.Used(); got != want {
+				t.Errorf("Used() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUsageConcurrentReserve(t *testing.T) {
+	const limit, workers, size = 1000, 50, 30
+
+	u := NewUsage(limit, false)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if u.Reserve(size) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := limit / size; accepted != want {
+		t.Errorf("accepted %d reservations, want %d", accepted, want)
+	}
+	if got := u.Used(); got != int64(accepted*size) || got > limit {
+		t.Errorf("Used() = %d, want %d within %d", got, accepted*size, limit)
+	}
+}
+
+func TestUsageReadOnly(t *testing.T) {
+	u := NewUsage(100, true)
+	u.Set(90)
+
+	if err := u.Reserve(20); !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("Reserve(20) = %v, want %v", err, ErrStorageFull)
+	}
+	if !u.ReadOnly() {
+		t.Fatal("ReadOnly() = false after a refused upload, want true")
+	}
+
+	// Freeing space does not lift read-only mode
+	u.Add(-90)
+	if err := u.Check(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Check() = %v, want %v", err, ErrReadOnly)
+	}
+	if err := u.Reserve(1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Reserve(1) = %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestUsageReadOnlyDisabled(t *testing.T) {
+	u := NewUsage(100, false)
+	u.Set(90)
+
+	if err := u.Reserve(20); !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("Reserve(20) = %v, want %v", err, ErrStorageFull)
+	}
+	if u.ReadOnly() {
+		t.Error("ReadOnly() = true without STORAGE_READ_ONLY_WHEN_FULL, want false")
+	}
+	if err := u.Reserve(10); err != nil {
+		t.Errorf("Reserve(10) = %v, want nil", err)
+	}
+}
+
+func TestUsageRollback(t *testing.T) {
+	u := NewUsage(100, false)
+
+	if err := u.Reserve(100); err != nil {
+		t.Fatalf("Reserve(100) = %v", err)
+	}
+	if err := u.Check(); !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("Check() = %v, want %v", err, ErrStorageFull)
+	}
+
+	// A failed write gives its reservation back
+	u.Add(-100)
+	if got := u.Used(); got != 0 {
+		t.Errorf("Used() = %d after rollback, want 0", got)
+	}
+	if err := u.Reserve(100); err != nil {
+		t.Errorf("Reserve(100) after rollback = %v, want nil", err)
+	}
+}
+
+func TestUsageUnlimited(t *testing.T) {
+	for _, u := range []*Usage{nil, NewUsage(0, true)} {
+		if err := u.Reserve(1 << 40); err != nil {
+			t.Errorf("Reserve() = %v, want nil", err)
+		}
+		if err := u.Check(); err != nil {
+			t.Errorf("Check() = %v, want nil", err)
+		}
+		if got := u.Limit(); got != 0 {
+			t.Errorf("Limit() = %d, want 0", got)
+		}
+	}
+}
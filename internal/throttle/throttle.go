@@ -0,0 +1,174 @@
+// Package throttle caps download bandwidth, server-wide and per bucket
+package throttle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits holds the token buckets that downloads draw from. A bucket's limit is
+// shared by all of its concurrent downloads, and the global limit by every
+// throttled download on the server. A nil *Limits throttles nothing.
+type Limits struct {
+	global *rate.Limiter
+
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+}
+
+// New creates the limits. globalBytesPerSec caps the combined download rate
+// of the server; 0 means unlimited.
+func New(globalBytesPerSec int64) *Limits {
+	return &Limits{
+		global:  newLimiter(globalBytesPerSec),
+		buckets: make(map[string]*rate.Limiter),
+	}
+}
+
+// newLimiter allows bursts of one second worth of bytes
+func newLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), int(bytesPerSec))
+}
+
+// bucket returns the shared limiter of a bucket, following changes to its
+// configured rate. Buckets without a limit have no limiter.
+func (l *Limits) bucket(bucketID string, bytesPerSec int64) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bytesPerSec <= 0 {
+		delete(l.buckets, bucketID)
+		return nil
+	}
+
+	limiter, ok := l.buckets[bucketID]
+	if !ok {
+		limiter = newLimiter(bytesPerSec)
+		l.buckets[bucketID] = limiter
+	} else if limiter.Limit() != rate.Limit(bytesPerSec) {
+		limiter.SetLimit(rate.Limit(bytesPerSec))
+		limiter.SetBurst(int(bytesPerSec))
+	}
+	return limiter
+}
+
+// limiters lists the limiters a download from the bucket must wait for
+func (l *Limits) limiters(bucketID string, bucketRate int64) []*rate.Limiter {
+	if l == nil {
+		return nil
+	}
+
+	var limiters []*rate.Limiter
+	if b := l.bucket(bucketID, bucketRate); b != nil {
+		limiters = append(limiters, b)
+	}
+	if l.global != nil {
+		limiters = append(limiters, l.global)
+	}
+	return limiters
+}
+
+// Reader throttles reads from r by the bucket's rate and the global rate. It
+// stays an io.ReadSeeker when r is one, so range requests keep working, and
+// returns r itself when no limit applies.
+func (l *Limits) Reader(ctx context.Context, r io.ReadCloser, bucketID string, bucketRate int64) io.ReadCloser {
+	limiters := l.limiters(bucketID, bucketRate)
+	if len(limiters) == 0 {
+		return r
+	}
+
+	tr := &reader{ReadCloser: r, limiter: limiter{ctx: ctx, limiters: limiters}}
+	if seeker, ok := r.(io.Seeker); ok {
+		return &readSeeker{reader: tr, Seeker: seeker}
+	}
+	return tr
+}
+
+// ResponseWriter throttles writes to w by the bucket's rate and the global
+// rate, for responses the server does not read itself such as static files.
+func (l *Limits) ResponseWriter(ctx context.Context, w http.ResponseWriter, bucketID string, bucketRate int64) http.ResponseWriter {
+	limiters := l.limiters(bucketID, bucketRate)
+	if len(limiters) == 0 {
+		return w
+	}
+	return &responseWriter{ResponseWriter: w, limiter: limiter{ctx: ctx, limiters: limiters}}
+}
+
+type limiter struct {
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+// chunk caps n so that a single wait never exceeds any limiter's burst
+func (l limiter) chunk(n int) int {
+	for _, lim := range l.limiters {
+		if b := lim.Burst(); b < n {
+			n = b
+		}
+	}
+	return n
+}
+
+func (l limiter) wait(n int) error {
+	for _, lim := range l.limiters {
+		if err := lim.WaitN(l.ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type reader struct {
+	io.ReadCloser
+	limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	p = p[:r.chunk(len(p))]
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := r.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type readSeeker struct {
+	*reader
+	io.Seeker
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	limiter
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := w.chunk(len(p))
+		if err := w.wait(n); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
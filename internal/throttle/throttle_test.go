@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testRate is the throttled speed in the timed tests. The first second's
+// worth is a burst, so transfers of testSize take 1.5s.
+const (
+	testRate = 64 << 10
+	testSize = testRate * 5 / 2
+)
+
+// assertDuration checks that elapsed is within 20% of want
+func assertDuration(t *testing.T, elapsed, want time.Duration) {
+	t.Helper()
+	if elapsed < want*8/10 || elapsed > want*12/10 {
+		t.Errorf("transfer of %d bytes took %v, want %v ± 20%% at %d bytes/s", testSize, elapsed, want, testRate)
+	}
+}
+
+func TestReaderRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		global     int64
+		bucketRate int64
+	}{
+		{"bucket limit", 0, testRate},
+		{"global limit", testRate, 0},
+		{"lower of both", testRate * 4, testRate},
+	}
+
+	want := time.Duration(testSize-testRate) * time.Second / testRate
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := New(tt.global).Reader(context.Background(), io.NopCloser(bytes.NewReader(make([]byte, testSize))), "bucket-1", tt.bucketRate)
+			start := time.Now()
+			n, err := io.Copy(io.Discard, r)
+			elapsed := time.Since(start)
+			if err != nil || n != testSize {
+				t.Fatalf("io.Copy() = %d, %v, want %d bytes", n, err, testSize)
+			}
+			assertDuration(t, elapsed, want)
+		})
+	}
+}
+
+func TestResponseWriterRate(t *testing.T) {
+	t.Parallel()
+
+	w := New(0).ResponseWriter(context.Background(), httptest.NewRecorder(), "bucket-1", testRate)
+	start := time.Now()
+	n, err := w.Write(make([]byte, testSize))
+	elapsed := time.Since(start)
+	if err != nil || n != testSize {
+		t.Fatalf("Write() = %d, %v, want %d bytes", n, err, testSize)
+	}
+	assertDuration(t, elapsed, time.Duration(testSize-testRate)*time.Second/testRate)
+}
+
+func TestReaderSeeks(t *testing.T) {
+	content := []byte("0123456789")
+	r := New(0).Reader(context.Background(), readSeekCloser{bytes.NewReader(content)}, "bucket-1", testRate)
+
+	// Range requests seek before reading
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("throttled reader of a seeker is not an io.ReadSeeker")
+	}
+	if _, err := seeker.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	got, err := io.ReadAll(seeker)
+	if err != nil || string(got) != "456789" {
+		t.Errorf("read after Seek(4) = %q, %v, want %q", got, err, "456789")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	src := io.NopCloser(bytes.NewReader(nil))
+	for _, l := range []*Limits{nil, New(0)} {
+		if r := l.Reader(context.Background(), src, "bucket-1", 0); r != src {
+			t.Errorf("Reader() without limits = %T, want the source reader", r)
+		}
+	}
+}
+
+func TestReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := New(0).Reader(ctx, io.NopCloser(bytes.NewReader(make([]byte, testSize))), "bucket-1", testRate)
+	cancel()
+
+	// The burst may go through, but waiting for more fails at once
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, r); err == nil {
+		t.Error("io.Copy() error = nil after cancel, want the context error")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("cancelled read took %v", elapsed)
+	}
+}
+
+type readSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekCloser) Close() error { return nil }
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	authdto "github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+)
+
+// ListSessions returns the client's unexpired tokens
+func (c *Client) ListSessions(ctx context.Context) ([]Session, error) {
+	var out authdto.SessionListResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/auth/sessions"}, &out); err != nil {
+		return nil, err
+	}
+	return out.Sessions, nil
+}
+
+// RevokeSession invalidates one of the client's tokens by its jti
+func (c *Client) RevokeSession(ctx context.Context, jti string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/auth/sessions" + pathEscape(jti)}, nil)
+}
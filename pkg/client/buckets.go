@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	bucketdto "github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
+)
+
+func (c *Client) CreateBucket(ctx context.Context, req CreateBucketRequest) (*Bucket, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out Bucket
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/buckets", header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnsureBucket creates the bucket, or returns the caller's existing bucket of
+// the same name unchanged, which makes provisioning scripts safe to re-run
+func (c *Client) EnsureBucket(ctx context.Context, req CreateBucketRequest) (*Bucket, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"idempotent": {"true"}}
+	var out Bucket
+	if err := c.call(ctx, request{method: http.MethodPost, path: "/buckets", query: query, header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListBuckets(ctx context.Context) ([]Bucket, error) {
+	var out bucketdto.BucketListResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/buckets"}, &out); err != nil {
+		return nil, err
+	}
+	return out.Buckets, nil
+}
+
+// BucketOverview returns one page of buckets with usage and webhook stats.
+// perPage is clamped by the server; zero uses the server default.
+func (c *Client) BucketOverview(ctx context.Context, page, perPage int) (*BucketOverviewList, error) {
+	var out BucketOverviewList
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/buckets/overview", query: pageQuery(page, perPage)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) GetBucket(ctx context.Context, bucketID string) (*Bucket, error) {
+	var out Bucket
+	if err := c.call(ctx, request{method: http.MethodGet, path: "/buckets" + pathEscape(bucketID)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateBucket changes the settings set in req; nil fields are left as is
+func (c *Client) UpdateBucket(ctx context.Context, bucketID string, req UpdateBucketRequest) (*Bucket, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out Bucket
+	if err := c.call(ctx, request{method: http.MethodPatch, path: "/buckets" + pathEscape(bucketID), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteBucket(ctx context.Context, bucketID string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: "/buckets" + pathEscape(bucketID)}, nil)
+}
+
+// pageQuery builds ?page=&per_page=, omitting zero values
+func pageQuery(page, perPage int) url.Values {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if perPage > 0 {
+		query.Set("per_page", strconv.Itoa(perPage))
+	}
+	return query
+}
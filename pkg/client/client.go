@@ -0,0 +1,322 @@
+// Package client is a typed Go client for the aoui-drive HTTP API. It logs in
+// with a client's access and secret key, refreshes the token before it
+// expires, and decodes responses into the same DTOs the server uses.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	authdto "github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+	"github.com/aouiniamine/aoui-drive/pkg/response"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// refreshBefore renews the token this long before it expires so requests
+	// in flight don't race the expiry
+	refreshBefore = 30 * time.Second
+)
+
+// Client talks to one aoui-drive server as one API client. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL    string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+	timeout    time.Duration
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for every request
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTimeout bounds JSON API calls (login, buckets, webhooks, resource
+// metadata). Uploads and downloads are only bounded by their context, since
+// their duration depends on the transfer size. Zero disables the timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// New creates a client for the server at baseURL (e.g. http://localhost:8080,
+// including the BASE_PATH of servers mounted on a subpath).
+// No request is made until the first call; the client logs in lazily.
+func New(baseURL, accessKey, secretKey string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		accessKey:  accessKey,
+		secretKey:  secretKey,
+		httpClient: http.DefaultClient,
+		timeout:    defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is a non-2xx response from the server. Code is one of the
+// response.Code* values.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("aoui-drive: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a NOT_FOUND API error
+func IsNotFound(err error) bool {
+	return hasCode(err, response.CodeNotFound)
+}
+
+// IsUnauthorized reports whether err is an UNAUTHORIZED API error, e.g.
+// after a failed login
+func IsUnauthorized(err error) bool {
+	return hasCode(err, response.CodeUnauthorized)
+}
+
+// IsForbidden reports whether err is a FORBIDDEN API error
+func IsForbidden(err error) bool {
+	return hasCode(err, response.CodeForbidden)
+}
+
+func hasCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// Login exchanges the access and secret key for a token. Calling it is
+// optional: the client logs in on first use and again whenever the token
+// expires or is rejected.
+func (c *Client) Login(ctx context.Context) (*authdto.TokenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.login(ctx)
+}
+
+// login must be called with c.mu held
+func (c *Client) login(ctx context.Context) (*authdto.TokenResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	body, err := json.Marshal(authdto.LoginRequest{AccessKey: c.accessKey, SecretKey: c.secretKey})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/auth/login", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var token authdto.TokenResponse
+	if err := decode(resp, &token); err != nil {
+		return nil, err
+	}
+
+	c.token = token.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return &token, nil
+}
+
+// accessToken returns a token that is valid for at least refreshBefore,
+// logging in again if needed. stale is a token the server just rejected.
+func (c *Client) accessToken(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.token != stale && time.Until(c.expiresAt) > refreshBefore {
+		return c.token, nil
+	}
+	if _, err := c.login(ctx); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// request describes one API call. body is called once per attempt so the
+// request can be replayed after a token refresh; nil means no body.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   func() (io.Reader, error)
+}
+
+// jsonBody encodes v once and replays it on every attempt
+func jsonBody(v any) (func() (io.Reader, error), http.Header, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	return func() (io.Reader, error) { return bytes.NewReader(data), nil }, header, nil
+}
+
+// send performs an authenticated request. A 401 triggers one re-login and
+// retry, unless replayable is false because the body can only be read once.
+func (c *Client) send(ctx context.Context, r request, replayable bool) (*http.Response, error) {
+	target := c.baseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+
+	var stale string
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx, stale)
+		if err != nil {
+			return nil, err
+		}
+
+		var body io.Reader
+		if r.body != nil {
+			if body, err = r.body(); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, r.method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range r.header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := c.httpClient.Do(req)
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && replayable && attempt == 0 {
+			resp.Body.Close()
+			stale = token
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// call performs a JSON API call bounded by the client timeout and decodes the
+// response data into out (which may be nil)
+func (c *Client) call(ctx context.Context, r request, out any) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.send(ctx, r, true)
+	if err != nil {
+		return err
+	}
+	return decode(resp, out)
+}
+
+// decode unwraps the response envelope into out and closes the body
+func decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return readError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	envelope := response.Response{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("aoui-drive: failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// readError turns an error response into an *APIError. Bodies that are not an
+// error envelope fall back to statusError.
+func readError(resp *http.Response) error {
+	apiErr := statusError(resp.StatusCode)
+
+	var envelope response.Response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err == nil && envelope.Error != nil {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Message = envelope.Error.Message
+	}
+	return apiErr
+}
+
+// statusError builds an *APIError from the status alone, using the code the
+// server's response helpers send for it
+func statusError(status int) *APIError {
+	apiErr := &APIError{StatusCode: status, Message: http.StatusText(status)}
+	switch status {
+	case http.StatusBadRequest:
+		apiErr.Code = response.CodeBadRequest
+	case http.StatusUnauthorized:
+		apiErr.Code = response.CodeUnauthorized
+	case http.StatusForbidden:
+		apiErr.Code = response.CodeForbidden
+	case http.StatusNotFound:
+		apiErr.Code = response.CodeNotFound
+	case http.StatusRequestEntityTooLarge:
+		apiErr.Code = response.CodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		apiErr.Code = response.CodeUnprocessableEntity
+	case http.StatusTooManyRequests:
+		apiErr.Code = response.CodeTooManyRequests
+	case http.StatusInternalServerError:
+		apiErr.Code = response.CodeInternal
+	case http.StatusInsufficientStorage:
+		apiErr.Code = response.CodeInsufficientStorage
+	case http.StatusServiceUnavailable:
+		apiErr.Code = response.CodeServiceUnavailable
+	}
+	return apiErr
+}
+
+// pathEscape joins escaped path segments
+func pathEscape(segments ...string) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(url.PathEscape(s))
+	}
+	return b.String()
+}
@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aouiniamine/aoui-drive/pkg/response"
+)
+
+// fakeServer issues numbered tokens from /auth/login and hands every other
+// request to handler once its token checks out
+type fakeServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// logins counts successful logins
+	logins int
+	// expiresIn is the lifetime of issued tokens, in seconds
+	expiresIn int64
+	// revoked tokens are answered with 401
+	revoked map[string]bool
+}
+
+func newFakeServer(t *testing.T, handler http.HandlerFunc) *fakeServer {
+	t.Helper()
+
+	s := &fakeServer{expiresIn: 3600, revoked: map[string]bool{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/auth/login" {
+			s.login(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		valid := ok && token != "" && !s.revoked[token]
+		s.mu.Unlock()
+		if !valid {
+			writeError(w, http.StatusUnauthorized, response.CodeUnauthorized, "invalid token")
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccessKey string `json:"access_key"`
+		SecretKey string `json:"secret_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SecretKey != "secret" {
+		writeError(w, http.StatusUnauthorized, response.CodeUnauthorized, "invalid credentials")
+		return
+	}
+
+	s.mu.Lock()
+	s.logins++
+	token := fmt.Sprintf("token-%d", s.logins)
+	expiresIn := s.expiresIn
+	s.mu.Unlock()
+	writeData(w, http.StatusOK, Token{AccessToken: token, ExpiresIn: expiresIn})
+}
+
+func (s *fakeServer) loginCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *fakeServer) revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[token] = true
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response.Response{Success: true, Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response.Response{Error: &response.ErrorInfo{Code: code, Message: message}})
+}
+
+func bucketHandler(w http.ResponseWriter, r *http.Request) {
+	writeData(w, http.StatusOK, Bucket{ID: strings.TrimPrefix(r.URL.Path, "/buckets/"), Name: "photos"})
+}
+
+func TestClientLogsInOnce(t *testing.T) {
+	srv := newFakeServer(t, bucketHandler)
+	c := New(srv.URL, "access", "secret")
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := c.GetBucket(ctx, "b1"); err != nil {
+			t.Fatalf("GetBucket() error = %v", err)
+		}
+	}
+	if n := srv.loginCount(); n != 1 {
+		t.Errorf("%d logins, want 1", n)
+	}
+}
+
+func TestClientRefreshesExpiringToken(t *testing.T) {
+	srv := newFakeServer(t, bucketHandler)
+	// Tokens that expire within refreshBefore are renewed before each call
+	srv.expiresIn = int64(refreshBefore.Seconds()) - 1
+	c := New(srv.URL, "access", "secret")
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := c.GetBucket(ctx, "b1"); err != nil {
+			t.Fatalf("GetBucket() error = %v", err)
+		}
+	}
+	if n := srv.loginCount(); n != 2 {
+		t.Errorf("%d logins, want 2", n)
+	}
+}
+
+func TestClientRetriesAfterRejectedToken(t *testing.T) {
+	srv := newFakeServer(t, bucketHandler)
+	c := New(srv.URL, "access", "secret")
+	ctx := context.Background()
+
+	if _, err := c.Login(ctx); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	srv.revoke("token-1")
+
+	bucket, err := c.GetBucket(ctx, "b1")
+	if err != nil {
+		t.Fatalf("GetBucket() error = %v", err)
+	}
+	if bucket.ID != "b1" {
+		t.Errorf("bucket ID = %q, want b1", bucket.ID)
+	}
+	if n := srv.loginCount(); n != 2 {
+		t.Errorf("%d logins, want 2", n)
+	}
+}
+
+func TestClientLoginFailure(t *testing.T) {
+	srv := newFakeServer(t, bucketHandler)
+	c := New(srv.URL, "access", "wrong")
+
+	_, err := c.GetBucket(context.Background(), "b1")
+	if !IsUnauthorized(err) {
+		t.Errorf("GetBucket() error = %v, want UNAUTHORIZED", err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	var got struct {
+		method, path, contentType, extension, fileName, meta, body string
+	}
+	srv := newFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got.method, got.path, got.body = r.Method, r.URL.Path, string(body)
+		got.contentType = r.Header.Get("Content-Type")
+		got.extension = r.Header.Get("X-File-Extension")
+		got.fileName = r.Header.Get("X-File-Name")
+		got.meta = r.Header.Get("X-Meta-Owner")
+		writeData(w, http.StatusCreated, Resource{Hash: "abc", Size: int64(len(body)), ContentType: got.contentType})
+	})
+	c := New(srv.URL, "access", "secret")
+
+	resource, err := c.Upload(context.Background(), "b1", strings.NewReader("hello"), &UploadOptions{
+		ContentType: "text/plain",
+		Extension:   ".txt",
+		FileName:    "my notes.txt",
+		Metadata:    map[string]string{"owner": "ops team"},
+	})
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if resource.Hash != "abc" || resource.Size != 5 {
+		t.Errorf("Upload() = %+v, want hash abc and size 5", resource)
+	}
+
+	if got.method != http.MethodPut || got.path != "/resources/b1" || got.body != "hello" {
+		t.Errorf("request = %s %s %q, want PUT /resources/b1 \"hello\"", got.method, got.path, got.body)
+	}
+	if got.contentType != "text/plain" || got.extension != ".txt" {
+		t.Errorf("Content-Type, X-File-Extension = %q, %q", got.contentType, got.extension)
+	}
+	if got.fileName != "my%20notes.txt" || got.meta != "ops%20team" {
+		t.Errorf("X-File-Name, X-Meta-Owner = %q, %q, want them percent-encoded", got.fileName, got.meta)
+	}
+}
+
+func TestUploadIsNotReplayed(t *testing.T) {
+	srv := newFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, http.StatusCreated, Resource{Hash: "abc"})
+	})
+	c := New(srv.URL, "access", "secret")
+	ctx := context.Background()
+
+	if _, err := c.Login(ctx); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	srv.revoke("token-1")
+
+	// The body has been read once, so the 401 is returned rather than retried
+	_, err := c.Upload(ctx, "b1", strings.NewReader("hello"), nil)
+	if !IsUnauthorized(err) {
+		t.Errorf("Upload() error = %v, want UNAUTHORIZED", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	var rangeHeader string
+	srv := newFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/resources/b1/abc" {
+			writeError(w, http.StatusNotFound, response.CodeNotFound, "resource not found")
+			return
+		}
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Resource-Hash", "abc")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, "ell")
+	})
+	c := New(srv.URL, "access", "secret")
+	ctx := context.Background()
+
+	download, err := c.Download(ctx, "b1", "abc", &DownloadOptions{Offset: 1, Length: 3})
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	body, err := io.ReadAll(download)
+	download.Close()
+	if err != nil || string(body) != "ell" {
+		t.Errorf("body = %q, %v, want \"ell\"", body, err)
+	}
+	if rangeHeader != "bytes=1-3" {
+		t.Errorf("Range = %q, want bytes=1-3", rangeHeader)
+	}
+	if download.Hash != "abc" || download.ContentType != "text/plain" || download.Size != 3 {
+		t.Errorf("download = %+v, want hash abc, text/plain and 3 bytes", download)
+	}
+
+	if _, err := c.Download(ctx, "b1", "missing", nil); !IsNotFound(err) {
+		t.Errorf("Download() of a missing resource error = %v, want NOT_FOUND", err)
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantCode   string
+		wantStatus int
+	}{
+		{"envelope", http.StatusConflict, `{"success":false,"error":{"code":"CONFLICT","message":"bucket already exists"}}`, response.CodeConflict, http.StatusConflict},
+		{"envelope code over the status default", http.StatusBadRequest, `{"success":false,"error":{"code":"HASH_MISMATCH","message":"content does not match"}}`, response.CodeHashMismatch, http.StatusBadRequest},
+		{"forbidden", http.StatusForbidden, `{"success":false,"error":{"code":"FORBIDDEN","message":"denied"}}`, response.CodeForbidden, http.StatusForbidden},
+		{"plain body", http.StatusServiceUnavailable, "upstream unavailable", response.CodeServiceUnavailable, http.StatusServiceUnavailable},
+		{"empty body", http.StatusInsufficientStorage, "", response.CodeInsufficientStorage, http.StatusInsufficientStorage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+			c := New(srv.URL, "access", "secret")
+
+			_, err := c.GetBucket(context.Background(), "b1")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("GetBucket() error = %v, want an *APIError", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.Code != tt.wantCode {
+				t.Errorf("APIError = %d %s, want %d %s", apiErr.StatusCode, apiErr.Code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	resourcedto "github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+)
+
+// UploadOptions are optional settings for an upload
+type UploadOptions struct {
+	// ContentType is sent for stream uploads; it defaults to
+	// application/octet-stream on the server
+	ContentType string
+	// Extension (e.g. ".jpg") is sent as X-File-Extension for stream uploads;
+	// when empty the server derives it from ContentType
+	Extension string
+	// ExpectedHash is the hex SHA-256 of the content, sent as X-Expected-Hash
+	// for stream uploads; the server refuses content that does not match it
+	ExpectedHash string
+	// FileName is sent percent-encoded as X-File-Name for stream uploads, so
+	// the resource can be fetched with DownloadByName
+	FileName string
+	// WebhookHeaders are forwarded to the bucket's webhooks as X-Webhook-Header-*
+	WebhookHeaders map[string]string
+	// Metadata is sent as X-Meta-* headers and replaces the resource's
+	// metadata, also when the content was already stored. UploadFiles
+	// ignores it.
+	Metadata map[string]string
+	// Share asks for a presigned share_url in the response, valid for ShareTTL
+	// (zero uses the server default)
+	Share    bool
+	ShareTTL time.Duration
+	// Async returns as soon as the content is stored; poll ProcessingStatus
+	// until the returned resource is ready or failed
+	Async bool
+	// AutoCreate lets stream uploads name the bucket instead of giving its
+	// ID, creating a private bucket of that name if the client has none.
+	// The returned resource has BucketID set.
+	AutoCreate bool
+}
+
+func (o *UploadOptions) query() url.Values {
+	query := url.Values{}
+	if o != nil && o.Share {
+		query.Set("share", "true")
+		if o.ShareTTL > 0 {
+			query.Set("share_ttl", o.ShareTTL.String())
+		}
+	}
+	if o != nil && o.Async {
+		query.Set("async", "true")
+	}
+	return query
+}
+
+func (o *UploadOptions) header() http.Header {
+	header := http.Header{}
+	if o == nil {
+		return header
+	}
+	for name, value := range o.WebhookHeaders {
+		header.Set("X-Webhook-Header-"+name, value)
+	}
+	for key, value := range o.Metadata {
+		header.Set("X-Meta-"+key, url.PathEscape(value))
+	}
+	return header
+}
+
+func resourcesPath(bucketID string, rest ...string) string {
+	return "/resources" + pathEscape(bucketID) + pathEscape(rest...)
+}
+
+// Upload streams r into the bucket. The body is sent once, so r is read only
+// once; the token is refreshed before sending rather than after a 401.
+func (c *Client) Upload(ctx context.Context, bucketID string, r io.Reader, opts *UploadOptions) (*Resource, error) {
+	header := opts.header()
+	if opts != nil && opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	if opts != nil && opts.Extension != "" {
+		header.Set("X-File-Extension", opts.Extension)
+	}
+	if opts != nil && opts.ExpectedHash != "" {
+		header.Set("X-Expected-Hash", opts.ExpectedHash)
+	}
+	if opts != nil && opts.FileName != "" {
+		header.Set("X-File-Name", url.PathEscape(opts.FileName))
+	}
+
+	query := opts.query()
+	if opts != nil && opts.AutoCreate {
+		query.Set("auto_create", "true")
+	}
+
+	// NopCloser keeps send from closing the caller's reader
+	body := func() (io.Reader, error) { return io.NopCloser(r), nil }
+	resp, err := c.send(ctx, request{method: http.MethodPut, path: resourcesPath(bucketID), query: query, header: header, body: body}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var out Resource
+	if err := decode(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadFile uploads the file at path as a multipart form. The extension is
+// taken from the file name, and the file is reopened if the request has to be
+// retried after a token refresh.
+func (c *Client) UploadFile(ctx context.Context, bucketID, path string, opts *UploadOptions) (*Resource, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	header := opts.header()
+	body := func() (io.Reader, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		header.Set("Content-Type", form.FormDataContentType())
+		go func() {
+			defer file.Close()
+			part, err := form.CreateFormFile("file", filepath.Base(path))
+			if err == nil {
+				_, err = io.Copy(part, file)
+			}
+			if err == nil {
+				err = form.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID), query: opts.query(), header: header, body: body}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out Resource
+	if err := decode(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadFiles uploads the files at paths in one multipart request and reports
+// per file whether it was stored, deduplicated or failed. Failed files do not
+// make the call fail; check the result. Share options are ignored.
+func (c *Client) UploadFiles(ctx context.Context, bucketID string, paths []string, opts *UploadOptions) (*BatchUploadResult, error) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	header := opts.header()
+	body := func() (io.Reader, error) {
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		header.Set("Content-Type", form.FormDataContentType())
+		go func() {
+			var err error
+			for _, path := range paths {
+				if err = writeFormFile(form, "files", path); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = form.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, "batch"), query: opts.query(), header: header, body: body}, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var out BatchUploadResult
+	if err := decode(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// writeFormFile copies the file at path into a new form part
+func writeFormFile(form *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	part, err := form.CreateFormFile(field, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, file)
+	return err
+}
+
+// DownloadOptions are optional settings for a download
+type DownloadOptions struct {
+	// Format re-encodes images on the fly (e.g. "jpeg", "png", or "webp" on
+	// servers built with libwebp)
+	Format string
+	// Accept negotiates the representation when Format is empty (e.g.
+	// "image/png"); the original is served if it cannot be produced
+	Accept string
+	// Offset and Length request a byte range; Length zero reads to the end
+	Offset int64
+	Length int64
+}
+
+// Download is an open resource body. The caller must close it.
+type Download struct {
+	io.ReadCloser
+	ContentType string
+	// Size is the number of bytes in the body, or -1 if unknown
+	Size int64
+	Hash string
+}
+
+// Download opens a resource for streaming
+func (c *Client) Download(ctx context.Context, bucketID, hash string, opts *DownloadOptions) (*Download, error) {
+	return c.download(ctx, resourcesPath(bucketID, hash), opts)
+}
+
+// DownloadByName opens the resource most recently uploaded to the bucket
+// under name
+func (c *Client) DownloadByName(ctx context.Context, bucketID, name string, opts *DownloadOptions) (*Download, error) {
+	return c.download(ctx, resourcesPath(bucketID, "name", name), opts)
+}
+
+func (c *Client) download(ctx context.Context, path string, opts *DownloadOptions) (*Download, error) {
+	query := url.Values{}
+	header := http.Header{}
+	if opts != nil {
+		if opts.Format != "" {
+			query.Set("format", opts.Format)
+		}
+		if opts.Accept != "" {
+			header.Set("Accept", opts.Accept)
+		}
+		if opts.Offset > 0 || opts.Length > 0 {
+			rng := fmt.Sprintf("bytes=%d-", opts.Offset)
+			if opts.Length > 0 {
+				rng += strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+			}
+			header.Set("Range", rng)
+		}
+	}
+
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: path, query: query, header: header}, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+
+	return &Download{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		Hash:        resp.Header.Get("X-Resource-Hash"),
+	}, nil
+}
+
+// Thumbnail opens an image resource shrunk to fit within width x height.
+// Non-image resources fail with 415.
+func (c *Client) Thumbnail(ctx context.Context, bucketID, hash string, width, height int) (*Download, error) {
+	query := url.Values{}
+	query.Set("w", strconv.Itoa(width))
+	query.Set("h", strconv.Itoa(height))
+
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID, hash, "thumbnail"), query: query}, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+
+	return &Download{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		Hash:        resp.Header.Get("X-Resource-Hash"),
+	}, nil
+}
+
+// DownloadFile writes a resource to path, replacing any existing file. A
+// partially written file is removed on error.
+func (c *Client) DownloadFile(ctx context.Context, bucketID, hash, path string) error {
+	download, err := c.Download(ctx, bucketID, hash, nil)
+	if err != nil {
+		return err
+	}
+	defer download.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, download); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// StatResource returns a resource's metadata without downloading it
+func (c *Client) StatResource(ctx context.Context, bucketID, hash string) (*Download, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.send(ctx, request{method: http.MethodHead, path: resourcesPath(bucketID, hash)}, true)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// HEAD responses have no body to read the error code from
+		return nil, statusError(resp.StatusCode)
+	}
+
+	return &Download{
+		ReadCloser:  http.NoBody,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+		Hash:        resp.Header.Get("X-Resource-Hash"),
+	}, nil
+}
+
+// ListResources returns every resource of the bucket, newest first, fetching
+// as many pages as it takes
+func (c *Client) ListResources(ctx context.Context, bucketID string) ([]Resource, error) {
+	var resources []Resource
+	for page := 1; ; page++ {
+		out, err := c.ListResourcePage(ctx, bucketID, page, 0)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, out.Resources...)
+		if len(out.Resources) == 0 || int64(len(resources)) >= out.Total {
+			return resources, nil
+		}
+	}
+}
+
+// ListResourcePage returns one page of the bucket's resources, newest first,
+// with the bucket's total. perPage is clamped by the server; zero uses the
+// server default.
+func (c *Client) ListResourcePage(ctx context.Context, bucketID string, page, perPage int) (*ResourceList, error) {
+	var out ResourceList
+	if err := c.call(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID), query: pageQuery(page, perPage)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListChanges returns one page of resources created and hashes deleted after
+// since, or after cursor when it is set. Pass the returned Cursor to the next
+// call to continue. perPage zero uses the server default.
+func (c *Client) ListChanges(ctx context.Context, bucketID string, since time.Time, cursor string, perPage int) (*ResourceList, error) {
+	query := pageQuery(0, perPage)
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	} else {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	var out ResourceList
+	if err := c.call(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetContentType corrects the stored content type of a resource without
+// re-uploading it
+func (c *Client) SetContentType(ctx context.Context, bucketID, hash, contentType string) (*Resource, error) {
+	body, header, err := jsonBody(resourcedto.UpdateResourceRequest{ContentType: contentType})
+	if err != nil {
+		return nil, err
+	}
+	var out Resource
+	if err := c.call(ctx, request{method: http.MethodPatch, path: resourcesPath(bucketID, hash), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Metadata returns the key-value metadata entries of a resource
+func (c *Client) Metadata(ctx context.Context, bucketID, hash string) (map[string]string, error) {
+	var out Metadata
+	if err := c.call(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID, hash, "metadata")}, &out); err != nil {
+		return nil, err
+	}
+	return out.Metadata, nil
+}
+
+// SetMetadata replaces every metadata entry of a resource; an empty map
+// removes them all
+func (c *Client) SetMetadata(ctx context.Context, bucketID, hash string, metadata map[string]string) (map[string]string, error) {
+	body, header, err := jsonBody(resourcedto.SetMetadataRequest{Metadata: metadata})
+	if err != nil {
+		return nil, err
+	}
+	var out Metadata
+	if err := c.call(ctx, request{method: http.MethodPut, path: resourcesPath(bucketID, hash, "metadata"), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return out.Metadata, nil
+}
+
+func (c *Client) DeleteResource(ctx context.Context, bucketID, hash string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: resourcesPath(bucketID, hash)}, nil)
+}
+
+// CopyResource adds a resource to another bucket of the client without
+// re-uploading it. If destBucketID already holds the hash, that resource is
+// returned with Deduplicated set.
+func (c *Client) CopyResource(ctx context.Context, bucketID, hash, destBucketID string) (*Resource, error) {
+	body, header, err := jsonBody(resourcedto.CopyResourceRequest{DestBucket: destBucketID})
+	if err != nil {
+		return nil, err
+	}
+	var out Resource
+	if err := c.call(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, hash, "copy"), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RestoreResource brings a deleted resource back out of the bucket's trash.
+// It fails with 404 once the resource has been purged, or when the server
+// keeps no trash.
+func (c *Client) RestoreResource(ctx context.Context, bucketID, hash string) (*Resource, error) {
+	var out Resource
+	if err := c.call(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, hash, "restore")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteResources deletes the given hashes, best effort. Hashes that could
+// not be deleted are reported in the result rather than as an error.
+func (c *Client) DeleteResources(ctx context.Context, bucketID string, hashes []string) (*BulkDeleteResult, error) {
+	body, header, err := jsonBody(resourcedto.BulkDeleteRequest{Hashes: hashes})
+	if err != nil {
+		return nil, err
+	}
+	var out BulkDeleteResult
+	if err := c.call(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, "bulk-delete"), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAllResources empties a bucket
+func (c *Client) DeleteAllResources(ctx context.Context, bucketID string) (*DeleteAllResult, error) {
+	var out DeleteAllResult
+	query := url.Values{"confirm": []string{"true"}}
+	if err := c.call(ctx, request{method: http.MethodDelete, path: resourcesPath(bucketID), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Presign creates a time-limited public link to a resource. Zero ttl uses the
+// server default.
+func (c *Client) Presign(ctx context.Context, bucketID, hash string, ttl time.Duration) (*Presigned, error) {
+	query := url.Values{}
+	if ttl > 0 {
+		query.Set("ttl", ttl.String())
+	}
+	var out Presigned
+	if err := c.call(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, hash, "presign"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VerifyResource re-hashes a stored resource and compares it to its hash
+func (c *Client) VerifyResource(ctx context.Context, bucketID, hash string) (*VerifyResult, error) {
+	var out VerifyResult
+	if err := c.call(ctx, request{method: http.MethodPost, path: resourcesPath(bucketID, hash, "verify")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Chunks returns the per-range hash manifest used for resumable downloads
+func (c *Client) Chunks(ctx context.Context, bucketID, hash string) (*ChunkManifest, error) {
+	var out ChunkManifest
+	if err := c.call(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID, hash, "chunks")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ProcessingStatus returns the post-processing state of a resource
+func (c *Client) ProcessingStatus(ctx context.Context, bucketID, hash string) (*ProcessingStatus, error) {
+	var out ProcessingStatus
+	if err := c.call(ctx, request{method: http.MethodGet, path: resourcesPath(bucketID, hash, "status")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
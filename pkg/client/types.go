@@ -0,0 +1,44 @@
+package client
+
+import (
+	authdto "github.com/aouiniamine/aoui-drive/internal/features/auth/dto"
+	bucketdto "github.com/aouiniamine/aoui-drive/internal/features/bucket/dto"
+	resourcedto "github.com/aouiniamine/aoui-drive/internal/features/resource/dto"
+	webhookdto "github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+// Aliases for the server DTOs so code outside this module, which cannot
+// import internal packages, can still name the request and response types.
+type (
+	Token   = authdto.TokenResponse
+	Session = authdto.SessionResponse
+
+	CreateBucketRequest  = bucketdto.CreateBucketRequest
+	UpdateBucketRequest  = bucketdto.UpdateBucketRequest
+	Bucket               = bucketdto.BucketResponse
+	BucketOverview       = bucketdto.BucketOverview
+	BucketOverviewList   = bucketdto.BucketOverviewListResponse
+	Resource             = resourcedto.ResourceResponse
+	ResourceList         = resourcedto.ResourceListResponse
+	DeletedResource      = resourcedto.DeletedResource
+	VerifyResult         = resourcedto.VerifyResponse
+	BucketVerifyResult   = resourcedto.BucketVerifyResponse
+	DeleteAllResult      = resourcedto.DeleteAllResponse
+	BulkDeleteResult     = resourcedto.BulkDeleteResponse
+	BulkDeleteEntry      = resourcedto.BulkDeleteEntry
+	ChunkManifest        = resourcedto.ChunkManifest
+	ProcessingStatus     = resourcedto.ProcessingStatusResponse
+	BatchUploadResult    = resourcedto.BatchUploadResponse
+	BatchUploadEntry     = resourcedto.BatchUploadEntry
+	Presigned            = resourcedto.PresignResponse
+	Metadata             = resourcedto.MetadataResponse
+	CreateWebhookRequest = webhookdto.CreateWebhookURLRequest
+	UpdateWebhookRequest = webhookdto.UpdateWebhookURLRequest
+	CreateHeaderRequest  = webhookdto.CreateHeaderRequest
+	UpdateHeaderRequest  = webhookdto.UpdateHeaderRequest
+	Webhook              = webhookdto.WebhookURLResponse
+	WebhookHeader        = webhookdto.HeaderResponse
+	WebhookEvent         = webhookdto.WebhookEventResponse
+	WebhookEventList     = webhookdto.WebhookEventListResponse
+	WebhookStats         = webhookdto.WebhookStatsResponse
+)
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	webhookdto "github.com/aouiniamine/aoui-drive/internal/features/webhook/dto"
+)
+
+func webhooksPath(bucketID string, rest ...string) string {
+	return "/buckets" + pathEscape(bucketID) + "/webhooks" + pathEscape(rest...)
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, bucketID string, req CreateWebhookRequest) (*Webhook, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out Webhook
+	if err := c.call(ctx, request{method: http.MethodPost, path: webhooksPath(bucketID), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) ListWebhooks(ctx context.Context, bucketID string) ([]Webhook, error) {
+	var out webhookdto.WebhookURLListResponse
+	if err := c.call(ctx, request{method: http.MethodGet, path: webhooksPath(bucketID)}, &out); err != nil {
+		return nil, err
+	}
+	return out.Webhooks, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, bucketID, webhookID string) (*Webhook, error) {
+	var out Webhook
+	if err := c.call(ctx, request{method: http.MethodGet, path: webhooksPath(bucketID, webhookID)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, bucketID, webhookID string, req UpdateWebhookRequest) (*Webhook, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out Webhook
+	if err := c.call(ctx, request{method: http.MethodPut, path: webhooksPath(bucketID, webhookID), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, bucketID, webhookID string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: webhooksPath(bucketID, webhookID)}, nil)
+}
+
+func (c *Client) CreateWebhookHeader(ctx context.Context, bucketID, webhookID string, req CreateHeaderRequest) (*WebhookHeader, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out WebhookHeader
+	if err := c.call(ctx, request{method: http.MethodPost, path: webhooksPath(bucketID, webhookID, "headers"), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateWebhookHeader(ctx context.Context, bucketID, webhookID, headerID string, req UpdateHeaderRequest) (*WebhookHeader, error) {
+	body, header, err := jsonBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var out WebhookHeader
+	if err := c.call(ctx, request{method: http.MethodPut, path: webhooksPath(bucketID, webhookID, "headers", headerID), header: header, body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteWebhookHeader(ctx context.Context, bucketID, webhookID, headerID string) error {
+	return c.call(ctx, request{method: http.MethodDelete, path: webhooksPath(bucketID, webhookID, "headers", headerID)}, nil)
+}
+
+// ListWebhookEvents returns one page of the bucket's delivery log, newest first.
+// perPage is clamped by the server; zero uses the server default.
+func (c *Client) ListWebhookEvents(ctx context.Context, bucketID string, page, perPage int) (*WebhookEventList, error) {
+	var out WebhookEventList
+	if err := c.call(ctx, request{method: http.MethodGet, path: webhooksPath(bucketID, "events"), query: pageQuery(page, perPage)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WebhookStats aggregates the webhook's deliveries for events created within
+// window. Zero uses the server default of 24 hours.
+func (c *Client) WebhookStats(ctx context.Context, bucketID, webhookID string, window time.Duration) (*WebhookStats, error) {
+	query := url.Values{}
+	if window > 0 {
+		query.Set("window", window.String())
+	}
+	var out WebhookStats
+	if err := c.call(ctx, request{method: http.MethodGet, path: webhooksPath(bucketID, webhookID, "stats"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,61 @@
+package pagination
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Limits bounds page sizes for every paginated list (API and UI)
+type Limits struct {
+	DefaultPerPage int
+	MaxPerPage     int
+}
+
+// Params is a resolved page request
+type Params struct {
+	Page       int
+	PerPage    int
+	MaxPerPage int
+}
+
+// NewLimits normalizes configured limits so the default never exceeds the cap
+func NewLimits(defaultPerPage, maxPerPage int) Limits {
+	if maxPerPage < 1 {
+		maxPerPage = 100
+	}
+	if defaultPerPage < 1 {
+		defaultPerPage = 20
+	}
+	if defaultPerPage > maxPerPage {
+		defaultPerPage = maxPerPage
+	}
+	return Limits{DefaultPerPage: defaultPerPage, MaxPerPage: maxPerPage}
+}
+
+// Parse reads ?page= and ?per_page=, clamping per_page to [1, MaxPerPage]
+func (l Limits) Parse(c echo.Context) Params {
+	p := Params{Page: 1, PerPage: l.DefaultPerPage, MaxPerPage: l.MaxPerPage}
+
+	if v, err := strconv.Atoi(c.QueryParam("page")); err == nil && v > 0 {
+		p.Page = v
+	}
+
+	if v, err := strconv.Atoi(c.QueryParam("per_page")); err == nil {
+		switch {
+		case v < 1:
+			p.PerPage = 1
+		case v > l.MaxPerPage:
+			p.PerPage = l.MaxPerPage
+		default:
+			p.PerPage = v
+		}
+	}
+
+	return p
+}
+
+// Offset is the number of items to skip for this page
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
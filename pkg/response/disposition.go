@@ -0,0 +1,95 @@
+package response
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fallbackFilename is used when nothing printable is left of a name
+const fallbackFilename = "download"
+
+// ContentDisposition builds a Content-Disposition value ("attachment" or
+// "inline") for filename. Control characters, including CR and LF, are
+// dropped so a caller-supplied name cannot inject headers, and path
+// separators are replaced. The quoted filename= parameter is an ASCII-only
+// fallback; names that need more are also sent RFC 5987 encoded in a UTF-8
+// filename* parameter, which clients prefer when they understand it.
+func ContentDisposition(dispositionType, filename string) string {
+	name := SanitizeFilename(filename)
+	ascii := asciiFilename(name)
+
+	value := dispositionType + `; filename="` + ascii + `"`
+	if ascii != name {
+		value += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return value
+}
+
+// Attachment makes the response download as filename
+func Attachment(c echo.Context, filename string) {
+	c.Response().Header().Set(echo.HeaderContentDisposition, ContentDisposition("attachment", filename))
+}
+
+// SanitizeFilename drops control characters and replaces path separators, so
+// the name is safe as a download or archive entry name
+func SanitizeFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		switch {
+		case unicode.IsControl(r) || r == unicode.ReplacementChar:
+		case r == '/' || r == '\\':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.TrimSpace(b.String())
+	if name == "" || strings.Trim(name, ".") == "" {
+		return fallbackFilename
+	}
+	return name
+}
+
+// asciiFilename replaces everything that is not safe inside a quoted ASCII
+// filename parameter. % is replaced too, since some clients percent-decode it.
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			b.WriteRune('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// encodeRFC5987 percent-encodes the UTF-8 bytes of s that are not attr-chars
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c may appear unencoded in an RFC 5987 value
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
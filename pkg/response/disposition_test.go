@@ -0,0 +1,41 @@
+package response
+
+import (
+	"mime"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+		// decoded is what a client understanding filename* reads back
+		decoded string
+	}{
+		{"ascii", "report.pdf", `attachment; filename="report.pdf"`, "report.pdf"},
+		{"quotes", `say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`, `say "hi".txt`},
+		{"emoji", "📷 photo.jpg", `attachment; filename="_ photo.jpg"; filename*=UTF-8''%F0%9F%93%B7%20photo.jpg`, "📷 photo.jpg"},
+		{"accents", "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`, "résumé.pdf"},
+		{"percent", "100%.txt", `attachment; filename="100_.txt"; filename*=UTF-8''100%25.txt`, "100%.txt"},
+		{"header injection", "a.txt\r\nSet-Cookie: x=1", `attachment; filename="a.txtSet-Cookie: x=1"`, "a.txtSet-Cookie: x=1"},
+		{"path", "../etc/passwd", `attachment; filename=".._etc_passwd"`, ".._etc_passwd"},
+		{"nothing printable", "\x00\x7f", `attachment; filename="download"`, "download"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ContentDisposition("attachment", tt.filename)
+			if got != tt.want {
+				t.Errorf("ContentDisposition(%q) = %s, want %s", tt.filename, got, tt.want)
+			}
+
+			_, params, err := mime.ParseMediaType(got)
+			if err != nil {
+				t.Fatalf("ParseMediaType(%s) error = %v", got, err)
+			}
+			if params["filename"] != tt.decoded {
+				t.Errorf("decoded filename = %q, want %q", params["filename"], tt.decoded)
+			}
+		})
+	}
+}
@@ -3,9 +3,35 @@ package response
 import (
 	"net/http"
 
+	"github.com/aouiniamine/aoui-drive/pkg/pagination"
 	"github.com/labstack/echo/v4"
 )
 
+// Error codes carried in ErrorInfo.Code
+const (
+	CodeBadRequest   = "BAD_REQUEST"
+	CodeNotFound     = "NOT_FOUND"
+	CodeInternal     = "INTERNAL_ERROR"
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeForbidden    = "FORBIDDEN"
+	CodeConflict     = "CONFLICT"
+
+	// CodeHashMismatch is a 400 for uploads whose content does not match
+	// the X-Expected-Hash sent with them
+	CodeHashMismatch = "HASH_MISMATCH"
+
+	// CodeContentTypeMismatch is a 415 for uploads whose content does not
+	// match their extension, with STRICT_CONTENT_TYPE on
+	CodeContentTypeMismatch = "CONTENT_TYPE_MISMATCH"
+
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeUnprocessableEntity  = "UNPROCESSABLE_ENTITY"
+	CodeTooManyRequests      = "TOO_MANY_REQUESTS"
+	CodeInsufficientStorage  = "INSUFFICIENT_STORAGE"
+	CodeServiceUnavailable   = "SERVICE_UNAVAILABLE"
+)
+
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
@@ -21,6 +47,7 @@ type ErrorInfo struct {
 type Meta struct {
 	Page       int   `json:"page,omitempty"`
 	PerPage    int   `json:"per_page,omitempty"`
+	MaxPerPage int   `json:"max_per_page,omitempty"`
 	Total      int64 `json:"total,omitempty"`
 	TotalPages int   `json:"total_pages,omitempty"`
 }
@@ -39,6 +66,13 @@ func Created(c echo.Context, data interface{}) error {
 	})
 }
 
+func Accepted(c echo.Context, data interface{}) error {
+	return c.JSON(http.StatusAccepted, Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
 func NoContent(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
@@ -54,28 +88,56 @@ func Error(c echo.Context, status int, code, message string) error {
 }
 
 func BadRequest(c echo.Context, message string) error {
-	return Error(c, http.StatusBadRequest, "BAD_REQUEST", message)
+	return Error(c, http.StatusBadRequest, CodeBadRequest, message)
 }
 
 func NotFound(c echo.Context, message string) error {
-	return Error(c, http.StatusNotFound, "NOT_FOUND", message)
+	return Error(c, http.StatusNotFound, CodeNotFound, message)
 }
 
 func InternalError(c echo.Context, message string) error {
-	return Error(c, http.StatusInternalServerError, "INTERNAL_ERROR", message)
+	return Error(c, http.StatusInternalServerError, CodeInternal, message)
 }
 
 func Unauthorized(c echo.Context, message string) error {
-	return Error(c, http.StatusUnauthorized, "UNAUTHORIZED", message)
+	return Error(c, http.StatusUnauthorized, CodeUnauthorized, message)
 }
 
 func Forbidden(c echo.Context, message string) error {
-	return Error(c, http.StatusForbidden, "FORBIDDEN", message)
+	return Error(c, http.StatusForbidden, CodeForbidden, message)
+}
+
+func Conflict(c echo.Context, message string) error {
+	return Error(c, http.StatusConflict, CodeConflict, message)
 }
 
-func Paginated(c echo.Context, data interface{}, page, perPage int, total int64) error {
-	totalPages := int(total) / perPage
-	if int(total)%perPage > 0 {
+func PayloadTooLarge(c echo.Context, message string) error {
+	return Error(c, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, message)
+}
+
+func UnsupportedMediaType(c echo.Context, message string) error {
+	return Error(c, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, message)
+}
+
+func UnprocessableEntity(c echo.Context, message string) error {
+	return Error(c, http.StatusUnprocessableEntity, CodeUnprocessableEntity, message)
+}
+
+func TooManyRequests(c echo.Context, message string) error {
+	return Error(c, http.StatusTooManyRequests, CodeTooManyRequests, message)
+}
+
+func InsufficientStorage(c echo.Context, message string) error {
+	return Error(c, http.StatusInsufficientStorage, CodeInsufficientStorage, message)
+}
+
+func ServiceUnavailable(c echo.Context, message string) error {
+	return Error(c, http.StatusServiceUnavailable, CodeServiceUnavailable, message)
+}
+
+func Paginated(c echo.Context, data interface{}, p pagination.Params, total int64) error {
+	totalPages := int(total) / p.PerPage
+	if int(total)%p.PerPage > 0 {
 		totalPages++
 	}
 
@@ -83,10 +145,18 @@ func Paginated(c echo.Context, data interface{}, page, perPage int, total int64)
 		Success: true,
 		Data:    data,
 		Meta: &Meta{
-			Page:       page,
-			PerPage:    perPage,
+			Page:       p.Page,
+			PerPage:    p.PerPage,
+			MaxPerPage: p.MaxPerPage,
 			Total:      total,
 			TotalPages: totalPages,
 		},
 	})
 }
+
+// NoStore forbids browsers and intermediaries from caching the response,
+// overriding any Cache-Control set earlier
+func NoStore(c echo.Context) {
+	c.Response().Header().Set("Cache-Control", "no-store, private")
+	c.Response().Header().Set("Pragma", "no-cache")
+}